@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+type hrlRecord struct {
+	name   string
+	fields []hrlField
+}
+
+type hrlField struct {
+	name       string
+	value      string // default value
+	typ        string // type specification
+	hasDefault bool
+}
+
+// generateHRL makes Go structs for the records defined in the given .hrl file.
+// Each struct has embedded etf.Record so it is encoded/decoded as the Erlang record.
+func generateHRL(source string, data []byte, pkg string) ([]byte, error) {
+	records, err := parseHRL(stripComments(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no records found in %s", source)
+	}
+
+	known := make(map[string]string)
+	for _, r := range records {
+		known[r.name] = goName(r.name)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by etfgen from %s. DO NOT EDIT.\n\n", filepath.Base(source))
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	fmt.Fprintf(&out, "import %q\n\n", etfPackage)
+
+	for _, r := range records {
+		fmt.Fprintf(&out, "// %s is the Erlang record #%s{}\n", known[r.name], r.name)
+		fmt.Fprintf(&out, "type %s struct {\n", known[r.name])
+		fmt.Fprintf(&out, "etf.Record `etf:%q`\n", r.name)
+		for _, f := range r.fields {
+			typ := hrlGoType(f, known)
+			fmt.Fprintf(&out, "%s %s `etf:%q`", goName(f.name), typ, f.name)
+			if f.typ != "" {
+				fmt.Fprintf(&out, " // %s", strings.Join(strings.Fields(f.typ), " "))
+			}
+			fmt.Fprintf(&out, "\n")
+		}
+		fmt.Fprintf(&out, "}\n\n")
+	}
+
+	code, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("can't format generated code: %s", err)
+	}
+	return code, nil
+}
+
+// hrlGoType maps the Erlang type of the record field to the Go type. The field
+// which might have value 'undefined' (no default value or 'undefined' is in the type)
+// is mapped to etf.Term.
+func hrlGoType(f hrlField, known map[string]string) string {
+	if f.hasDefault == false || strings.TrimSpace(f.value) == "undefined" {
+		return "etf.Term"
+	}
+
+	alternatives := splitTopLevel(f.typ, "|")
+	if len(alternatives) != 1 {
+		return "etf.Term"
+	}
+	t := strings.Join(strings.Fields(alternatives[0]), "")
+
+	switch t {
+	case "integer()", "non_neg_integer()", "pos_integer()", "neg_integer()":
+		return "int64"
+	case "float()":
+		return "float64"
+	case "boolean()":
+		return "bool"
+	case "atom()", "module()", "node()":
+		return "etf.Atom"
+	case "binary()":
+		return "[]byte"
+	case "string()":
+		return "string"
+	case "pid()":
+		return "etf.Pid"
+	case "reference()":
+		return "etf.Ref"
+	case "port()":
+		return "etf.Port"
+	case "list()", "[]":
+		return "etf.List"
+	case "tuple()":
+		return "etf.Tuple"
+	case "map()":
+		return "etf.Map"
+	}
+
+	switch {
+	case strings.HasPrefix(t, "#{"):
+		return "etf.Map"
+	case strings.HasPrefix(t, "#"):
+		// another record
+		name := strings.TrimSuffix(strings.TrimPrefix(t, "#"), "{}")
+		if goType, ok := known[unquote(name)]; ok {
+			return goType
+		}
+	case strings.HasPrefix(t, "["):
+		return "etf.List"
+	case strings.HasPrefix(t, "{"):
+		return "etf.Tuple"
+	}
+	return "etf.Term"
+}
+
+// stripComments removes Erlang comments (from % to the end of line) keeping
+// the strings, quoted atoms and char literals intact
+func stripComments(s string) string {
+	var out strings.Builder
+	quote := rune(0)
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		if quote != 0 {
+			out.WriteRune(c)
+			if c == '\\' && i+1 < len(rs) {
+				i++
+				out.WriteRune(rs[i])
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '$':
+			// char literal ($%, $", $\n)
+			out.WriteRune(c)
+			if i+1 < len(rs) {
+				i++
+				out.WriteRune(rs[i])
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+					out.WriteRune(rs[i])
+				}
+			}
+			continue
+		case '%':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+			if i < len(rs) {
+				out.WriteRune('\n')
+			}
+			continue
+		}
+		out.WriteRune(c)
+	}
+	return out.String()
+}
+
+func parseHRL(s string) ([]hrlRecord, error) {
+	records := []hrlRecord{}
+	for {
+		i := strings.Index(s, "-record")
+		if i == -1 {
+			return records, nil
+		}
+		s = strings.TrimSpace(s[i+len("-record"):])
+		if strings.HasPrefix(s, "(") == false {
+			continue
+		}
+
+		// find the closing parenthesis of the -record(...)
+		end := matching(s, 0)
+		if end == -1 {
+			return nil, fmt.Errorf("malformed record definition")
+		}
+		body := s[1:end]
+		s = s[end+1:]
+
+		parts := splitTopLevel(body, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("malformed record definition: %s", body)
+		}
+		name := unquote(strings.TrimSpace(parts[0]))
+		def := strings.TrimSpace(strings.Join(parts[1:], ","))
+		if strings.HasPrefix(def, "{") == false || strings.HasSuffix(def, "}") == false {
+			return nil, fmt.Errorf("malformed definition of record %s", name)
+		}
+
+		record := hrlRecord{name: name}
+		for _, f := range splitTopLevel(def[1:len(def)-1], ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			record.fields = append(record.fields, parseHRLField(f))
+		}
+		records = append(records, record)
+	}
+}
+
+func parseHRLField(f string) hrlField {
+	field := hrlField{}
+	if parts := splitTopLevel(f, "::"); len(parts) > 1 {
+		f = parts[0]
+		field.typ = strings.TrimSpace(strings.Join(parts[1:], "::"))
+	}
+	if i := defaultAssignment(f); i != -1 {
+		field.value = strings.TrimSpace(f[i+1:])
+		field.hasDefault = true
+		f = f[:i]
+	}
+	field.name = unquote(strings.TrimSpace(f))
+	return field
+}
+
+// defaultAssignment returns the position of '=' separating the field name and its
+// default value. Skips the operators like ==, =:=, =<, =>, /=, >=
+func defaultAssignment(s string) int {
+	for _, i := range topLevelIndexes(s, "=") {
+		if i+1 < len(s) && strings.ContainsRune("=:<>", rune(s[i+1])) {
+			continue
+		}
+		if i > 0 && strings.ContainsRune("=:/<>", rune(s[i-1])) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// matching returns the index of the bracket closing the one at the position i
+func matching(s string, i int) int {
+	depth := 0
+	quote := byte(0)
+	for ; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '$':
+			i++
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// topLevelIndexes returns the positions of sep which are not nested into the brackets,
+// binaries, strings or quoted atoms
+func topLevelIndexes(s string, sep string) []int {
+	indexes := []int{}
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		case c == '$':
+			i++
+			continue
+		case c == '(' || c == '[' || c == '{':
+			depth++
+			continue
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			continue
+		case strings.HasPrefix(s[i:], "<<"):
+			depth++
+			i++
+			continue
+		case strings.HasPrefix(s[i:], ">>"):
+			depth--
+			i++
+			continue
+		}
+		if depth == 0 && strings.HasPrefix(s[i:], sep) {
+			indexes = append(indexes, i)
+			i += len(sep) - 1
+		}
+	}
+	return indexes
+}
+
+func splitTopLevel(s string, sep string) []string {
+	parts := []string{}
+	last := 0
+	for _, i := range topLevelIndexes(s, sep) {
+		parts = append(parts, s[last:i])
+		last = i + len(sep)
+	}
+	return append(parts, s[last:])
+}
+
+func unquote(s string) string {
+	if len(s) > 1 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// goName makes exported Go name from the Erlang atom (user_info => UserInfo)
+func goName(atom string) string {
+	var out strings.Builder
+	upper := true
+	for _, r := range atom {
+		if unicode.IsLetter(r) == false && unicode.IsDigit(r) == false {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		out.WriteRune(r)
+	}
+	name := out.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "R" + name
+	}
+	return name
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHRL = `
+%% users
+-record(user, {
+	name = <<"noname">> :: binary(), % name, "quoted, % symbols"
+	age = 0 :: non_neg_integer(),
+	email :: binary(),
+	group = undefined :: undefined | atom(),
+	tags = [] :: [atom()],
+	'created_at' = {0, 0, 0} :: erlang:timestamp(),
+	flag = $% :: char(),
+	owner = #owner{} :: #owner{}
+}).
+
+-record(owner, {id = 0 :: integer(), pid}).
+`
+
+func TestGenerateHRL(t *testing.T) {
+	code, err := generateHRL("users.hrl", []byte(testHRL), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"package users",
+		"type User struct {",
+		"etf.Record `etf:\"user\"`",
+		"Name      []byte   `etf:\"name\"`       // binary()",
+		"Age       int64    `etf:\"age\"`        // non_neg_integer()",
+		"Email     etf.Term `etf:\"email\"`      // binary()",
+		"Group     etf.Term `etf:\"group\"`      // undefined | atom()",
+		"Tags      etf.List `etf:\"tags\"`       // [atom()]",
+		"CreatedAt etf.Term `etf:\"created_at\"` // erlang:timestamp()",
+		"Flag      etf.Term `etf:\"flag\"`       // char()",
+		"Owner     Owner    `etf:\"owner\"`      // #owner{}",
+		"type Owner struct {",
+		"Id int64 `etf:\"id\"` // integer()",
+		"Pid etf.Term `etf:\"pid\"`",
+	}
+	// ignore alignment
+	normalized := strings.Join(strings.Fields(string(code)), " ")
+	for _, e := range expected {
+		if strings.Contains(normalized, strings.Join(strings.Fields(e), " ")) == false {
+			t.Fatalf("%q not found in\n%s", e, code)
+		}
+	}
+}
+
+func TestParseHRLField(t *testing.T) {
+	cases := []struct {
+		source string
+		field  hrlField
+	}{
+		{"a", hrlField{name: "a"}},
+		{"a = 1", hrlField{name: "a", value: "1", hasDefault: true}},
+		{"a :: integer()", hrlField{name: "a", typ: "integer()"}},
+		{"a = #{b => 1} :: map()", hrlField{name: "a", value: "#{b => 1}", typ: "map()", hasDefault: true}},
+		{"a = (1 =:= 2) :: boolean()", hrlField{name: "a", value: "(1 =:= 2)", typ: "boolean()", hasDefault: true}},
+		{"'A b' = \"x::y\"", hrlField{name: "A b", value: "\"x::y\"", hasDefault: true}},
+	}
+	for _, c := range cases {
+		if f := parseHRLField(c.source); f != c.field {
+			t.Fatalf("%q: expected %#v got %#v", c.source, c.field, f)
+		}
+	}
+}
@@ -0,0 +1,625 @@
+// Command etfgen generates reflection-free implementation of etf.TermMarshaler and
+// etf.TermUnmarshaler interfaces (methods EncodeETF/DecodeETF) for the annotated structs.
+//
+// Annotate a struct with one of the directives in its doc comment:
+//
+//	//etf:map
+//	type Person struct {
+//		Name string `etf:"name"`
+//		Age  int
+//	}
+//
+//	//etf:record order
+//	type Order struct {
+//		ID    int64
+//		Items []string
+//	}
+//
+// "etf:map" encodes struct as a map with atom keys (the same way etf.Encode does using reflection).
+// "etf:record name" encodes struct as an Erlang record (tagged tuple) {name, Field1, Field2, ...}.
+// If the record name is omitted the lowercased name of the struct is used.
+// Struct with the embedded etf.Record is treated as annotated with "etf:record".
+//
+// Add the line below to the source file and run "go generate":
+//
+//	//go:generate go run github.com/ergo-services/ergo/cmd/etfgen
+//
+// The result is written to the file with the "_etf" suffix (person.go => person_etf.go,
+// person_test.go => person_etf_test.go). Unexported fields are ignored.
+//
+// Record definitions can be imported from the Erlang header file. It generates
+// the structs with embedded etf.Record (records.hrl => records_hrl.go):
+//
+//	//go:generate go run github.com/ergo-services/ergo/cmd/etfgen -package mypkg include/records.hrl
+//	//go:generate go run github.com/ergo-services/ergo/cmd/etfgen records_hrl.go
+//
+// The second line is optional and generates EncodeETF/DecodeETF for them.
+// Fields which might have value 'undefined' (no default value) are mapped to etf.Term.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	etfPackage = "github.com/ergo-services/ergo/etf"
+	libPackage = "github.com/ergo-services/ergo/lib"
+
+	directiveMap    = "etf:map"
+	directiveRecord = "etf:record"
+)
+
+type representation int
+
+const (
+	representationMap    representation = 0
+	representationRecord representation = 1
+)
+
+type structInfo struct {
+	name   string
+	repr   representation
+	record string
+	fields []fieldInfo
+}
+
+type fieldInfo struct {
+	name string // Go name
+	key  string // etf tag or Go name
+	typ  ast.Expr
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	pkg     string
+	etf     string // local name of the etf package
+	structs map[string]*structInfo
+	imports map[string]bool
+}
+
+func main() {
+	output := flag.String("output", "", "output file name (default: <source>_etf.go or <source>_hrl.go)")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated code for .hrl source")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		// running by "go generate"
+		if f := os.Getenv("GOFILE"); f != "" {
+			files = []string{f}
+		}
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: etfgen [-output file] source.go")
+		os.Exit(2)
+	}
+
+	source := files[0]
+	out := *output
+	if out == "" {
+		out = outputName(source)
+	}
+
+	var code []byte
+	var err error
+	if strings.HasSuffix(source, ".hrl") {
+		var data []byte
+		if *pkg == "" {
+			fmt.Fprintln(os.Stderr, "etfgen: package name is required for .hrl source")
+			os.Exit(2)
+		}
+		data, err = ioutil.ReadFile(source)
+		if err == nil {
+			code, err = generateHRL(source, data, *pkg)
+		}
+	} else {
+		code, err = generate(source)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "etfgen:", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(out, code, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "etfgen:", err)
+		os.Exit(1)
+	}
+}
+
+func outputName(source string) string {
+	if strings.HasSuffix(source, ".hrl") {
+		// generated code belongs to the current package
+		return strings.TrimSuffix(filepath.Base(source), ".hrl") + "_hrl.go"
+	}
+	base := strings.TrimSuffix(source, ".go")
+	if strings.HasSuffix(base, "_test") {
+		return strings.TrimSuffix(base, "_test") + "_etf_test.go"
+	}
+	return base + "_etf.go"
+}
+
+func generate(source string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, source, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		pkg:     file.Name.Name,
+		etf:     "etf",
+		structs: make(map[string]*structInfo),
+		imports: make(map[string]bool),
+	}
+	if g.pkg == "etf" {
+		return nil, fmt.Errorf("package etf is not supported")
+	}
+
+	// the same local name of etf package must be used in the generated code
+	// since the field types refer to it
+	for _, imp := range file.Imports {
+		if strings.Trim(imp.Path.Value, `"`) == etfPackage && imp.Name != nil {
+			g.etf = imp.Name.Name
+		}
+	}
+
+	names := []string{}
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			info, err := parseDirective(ts.Name.Name, doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", fset.Position(ts.Pos()), err)
+			}
+			if record, ok := g.recordMarker(st); ok {
+				if record == "" {
+					record = strings.ToLower(ts.Name.Name)
+				}
+				if info != nil && (info.repr != representationRecord || info.record != record) {
+					return nil, fmt.Errorf("%s: directive conflicts with etf.Record field", fset.Position(ts.Pos()))
+				}
+				info = &structInfo{name: ts.Name.Name, repr: representationRecord, record: record}
+			}
+			if info == nil {
+				continue
+			}
+			info.fields = g.parseFields(st)
+			g.structs[info.name] = info
+			names = append(names, info.name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no annotated structs found in %s", source)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		g.generateStruct(g.structs[name])
+	}
+
+	return g.format()
+}
+
+func parseDirective(name string, doc *ast.CommentGroup) (*structInfo, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	for _, c := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		switch {
+		case text == directiveMap:
+			return &structInfo{name: name, repr: representationMap}, nil
+
+		case text == directiveRecord || strings.HasPrefix(text, directiveRecord+" "):
+			record := strings.TrimSpace(strings.TrimPrefix(text, directiveRecord))
+			if record == "" {
+				record = strings.ToLower(name)
+			}
+			return &structInfo{name: name, repr: representationRecord, record: record}, nil
+
+		case strings.HasPrefix(text, "etf:"):
+			return nil, fmt.Errorf("unknown directive %q", text)
+		}
+	}
+	return nil, nil
+}
+
+// recordMarker returns the record name if the first field of the struct is
+// the embedded etf.Record
+func (g *generator) recordMarker(st *ast.StructType) (string, bool) {
+	if len(st.Fields.List) == 0 {
+		return "", false
+	}
+	f := st.Fields.List[0]
+	if len(f.Names) > 0 || g.isRecordMarker(f.Type) == false {
+		return "", false
+	}
+	if f.Tag == nil {
+		return "", true
+	}
+	return reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("etf"), true
+}
+
+func (g *generator) isRecordMarker(t ast.Expr) bool {
+	sel, ok := t.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == g.etf && sel.Sel.Name == "Record"
+}
+
+func (g *generator) parseFields(st *ast.StructType) []fieldInfo {
+	fields := []fieldInfo{}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 && g.isRecordMarker(f.Type) {
+			continue
+		}
+		names := []string{}
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			// embedded field
+			names = append(names, typeName(f.Type))
+		}
+
+		tag := ""
+		if f.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("etf")
+		}
+
+		for _, n := range names {
+			if ast.IsExported(n) == false {
+				continue
+			}
+			key := n
+			if tag != "" {
+				key = tag
+			}
+			fields = append(fields, fieldInfo{name: n, key: key, typ: f.Type})
+		}
+	}
+	return fields
+}
+
+func typeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) format() ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by etfgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg)
+	fmt.Fprintf(&out, "import (\n")
+	if g.imports["fmt"] {
+		fmt.Fprintf(&out, "\t\"fmt\"\n")
+	}
+	if g.imports["strings"] {
+		fmt.Fprintf(&out, "\t\"strings\"\n")
+	}
+	fmt.Fprintf(&out, "\n")
+	if g.etf != "etf" {
+		fmt.Fprintf(&out, "\t%s %q\n", g.etf, etfPackage)
+	} else {
+		fmt.Fprintf(&out, "\t%q\n", etfPackage)
+	}
+	fmt.Fprintf(&out, "\t%q\n", libPackage)
+	fmt.Fprintf(&out, ")\n\n")
+	out.Write(g.buf.Bytes())
+
+	code, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("can't format generated code: %s", err)
+	}
+	return code, nil
+}
+
+func (g *generator) typeString(e ast.Expr) string {
+	var b bytes.Buffer
+	format.Node(&b, token.NewFileSet(), e)
+	return b.String()
+}
+
+func (g *generator) generateStruct(s *structInfo) {
+	e := g.etf
+
+	// encoding
+	g.printf("// EncodeETF implements %s.TermMarshaler interface\n", e)
+	g.printf("func (x %s) EncodeETF(b *lib.Buffer, options %s.EncodeOptions) error {\n", s.name, e)
+	switch s.repr {
+	case representationMap:
+		g.printf("%s.EncodeMapHeader(b, %d)\n", e, len(s.fields))
+		for _, f := range s.fields {
+			g.printf("if err := %s.Encode(%s.Atom(%q), b, options); err != nil {\nreturn err\n}\n", e, e, f.key)
+			g.encodeValue("x."+f.name, f.typ, 0)
+		}
+	case representationRecord:
+		g.printf("%s.EncodeTupleHeader(b, %d)\n", e, len(s.fields)+1)
+		g.printf("if err := %s.Encode(%s.Atom(%q), b, options); err != nil {\nreturn err\n}\n", e, e, s.record)
+		for _, f := range s.fields {
+			g.encodeValue("x."+f.name, f.typ, 0)
+		}
+	}
+	g.printf("return nil\n}\n\n")
+
+	// decoding
+	g.imports["fmt"] = true
+	g.printf("// DecodeETF implements %s.TermUnmarshaler interface\n", e)
+	g.printf("func (x *%s) DecodeETF(term %s.Term) error {\n", s.name, e)
+	switch s.repr {
+	case representationMap:
+		g.printf("m, ok := term.(%s.Map)\n", e)
+		g.printf("if !ok {\nreturn fmt.Errorf(\"can't convert %%#v to %s\", term)\n}\n", s.name)
+		if len(s.fields) == 0 {
+			g.printf("_ = m\nreturn nil\n}\n\n")
+			return
+		}
+		g.imports["strings"] = true
+		g.printf("for k, v := range m {\n")
+		g.printf("key, ok := %s.TermToString(k)\n", e)
+		g.printf("if !ok {\nreturn &%s.InvalidStructKeyError{Term: k}\n}\n", e)
+		g.printf("switch {\n")
+		for _, f := range s.fields {
+			if f.key == f.name {
+				g.printf("case strings.EqualFold(key, %q):\n", f.name)
+			} else {
+				g.printf("case key == %q || strings.EqualFold(key, %q):\n", f.key, f.name)
+			}
+			g.decodeValue("x."+f.name, "v", f.typ, 0)
+		}
+		g.printf("}\n}\n")
+
+	case representationRecord:
+		g.printf("t, ok := term.(%s.Tuple)\n", e)
+		g.printf("if !ok || len(t) != %d {\nreturn fmt.Errorf(\"can't convert %%#v to %s\", term)\n}\n",
+			len(s.fields)+1, s.name)
+		g.printf("if tag, ok := t[0].(%s.Atom); !ok || tag != %q {\n", e, s.record)
+		g.printf("return fmt.Errorf(\"can't convert %%#v to %s: wrong record name\", term)\n}\n", s.name)
+		for i, f := range s.fields {
+			g.decodeValue("x."+f.name, fmt.Sprintf("t[%d]", i+1), f.typ, 0)
+		}
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+// kinds of the field types
+const (
+	kindOther     = iota // fallback to the reflection
+	kindString           // string, etf.String, etf.Charlist
+	kindBool             // bool
+	kindInt              // int, int8...int64
+	kindUint             // uint, uint8...uint64
+	kindFloat            // float32, float64
+	kindAssert           // decoded by the type assertion ([]byte, etf.Atom, etf.Pid...)
+	kindTerm             // etf.Term, interface{}
+	kindStruct           // annotated struct
+	kindStructPtr        // pointer to the annotated struct
+	kindSlice            // slice of the supported types
+	kindMap              // map of the supported types
+)
+
+func (g *generator) kind(t ast.Expr) int {
+	switch tt := t.(type) {
+	case *ast.Ident:
+		switch tt.Name {
+		case "string":
+			return kindString
+		case "bool":
+			return kindBool
+		case "int", "int8", "int16", "int32", "int64", "rune":
+			return kindInt
+		case "uint", "uint8", "uint16", "uint32", "uint64", "byte":
+			return kindUint
+		case "float32", "float64":
+			return kindFloat
+		}
+		if _, ok := g.structs[tt.Name]; ok {
+			return kindStruct
+		}
+
+	case *ast.SelectorExpr:
+		if pkg, ok := tt.X.(*ast.Ident); ok && pkg.Name == g.etf {
+			switch tt.Sel.Name {
+			case "String", "Charlist":
+				return kindString
+			case "Term":
+				return kindTerm
+			case "Atom", "Pid", "Ref", "Alias", "Port", "Tuple", "List", "ListImproper",
+				"Map", "BitString", "Export", "Function":
+				return kindAssert
+			}
+		}
+
+	case *ast.InterfaceType:
+		if len(tt.Methods.List) == 0 {
+			return kindTerm
+		}
+
+	case *ast.StarExpr:
+		if id, ok := tt.X.(*ast.Ident); ok {
+			if _, ok := g.structs[id.Name]; ok {
+				return kindStructPtr
+			}
+		}
+
+	case *ast.ArrayType:
+		if tt.Len != nil {
+			return kindOther
+		}
+		if id, ok := tt.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+			return kindAssert
+		}
+		if g.kind(tt.Elt) != kindOther {
+			return kindSlice
+		}
+
+	case *ast.MapType:
+		if g.kind(tt.Key) != kindOther && g.kind(tt.Value) != kindOther {
+			return kindMap
+		}
+	}
+	return kindOther
+}
+
+func (g *generator) encodeValue(v string, t ast.Expr, depth int) {
+	e := g.etf
+	switch g.kind(t) {
+	case kindStruct:
+		g.printf("if err := %s.EncodeETF(b, options); err != nil {\nreturn err\n}\n", v)
+
+	case kindStructPtr:
+		g.printf("if %s == nil {\n%s.EncodeNil(b)\n} else if err := %s.EncodeETF(b, options); err != nil {\nreturn err\n}\n", v, e, v)
+
+	case kindSlice:
+		elt := t.(*ast.ArrayType).Elt
+		i := fmt.Sprintf("i%d", depth)
+		g.printf("if len(%s) == 0 {\n%s.EncodeNil(b)\n} else {\n", v, e)
+		g.printf("%s.EncodeListHeader(b, len(%s))\n", e, v)
+		g.printf("for %s := range %s {\n", i, v)
+		g.encodeValue(fmt.Sprintf("%s[%s]", v, i), elt, depth+1)
+		g.printf("}\n%s.EncodeNil(b)\n}\n", e)
+
+	case kindMap:
+		mt := t.(*ast.MapType)
+		k := fmt.Sprintf("k%d", depth)
+		val := fmt.Sprintf("v%d", depth)
+		g.printf("%s.EncodeMapHeader(b, len(%s))\n", e, v)
+		g.printf("for %s, %s := range %s {\n", k, val, v)
+		g.encodeValue(k, mt.Key, depth+1)
+		g.encodeValue(val, mt.Value, depth+1)
+		g.printf("}\n")
+
+	default:
+		g.printf("if err := %s.Encode(%s, b, options); err != nil {\nreturn err\n}\n", e, v)
+	}
+}
+
+// bitSize returns the size of the integer type for etf.TermToInt/etf.TermToUint
+// (0 means int/uint)
+func bitSize(typ string) int {
+	switch typ {
+	case "int8", "uint8", "byte":
+		return 8
+	case "int16", "uint16":
+		return 16
+	case "int32", "uint32", "rune":
+		return 32
+	case "int64", "uint64":
+		return 64
+	}
+	return 0
+}
+
+func (g *generator) decodeValue(dest, term string, t ast.Expr, depth int) {
+	e := g.etf
+	typ := g.typeString(t)
+	fail := fmt.Sprintf("return fmt.Errorf(\"can't convert %%#v to %s\", %s)", typ, term)
+
+	switch g.kind(t) {
+	case kindString:
+		g.printf("if s, ok := %s.TermToString(%s); ok {\n%s = %s(s)\n} else {\n%s\n}\n", e, term, dest, typ, fail)
+
+	case kindBool:
+		g.printf("if b, ok := %s.(bool); ok {\n%s = b\n} else {\n%s\n}\n", term, dest, fail)
+
+	case kindInt:
+		g.printf("if i, ok := %s.TermToInt(%s, %d); ok {\n%s = %s(i)\n} else {\n%s\n}\n", e, term, bitSize(typ), dest, typ, fail)
+
+	case kindUint:
+		g.printf("if i, ok := %s.TermToUint(%s, %d); ok {\n%s = %s(i)\n} else {\n%s\n}\n", e, term, bitSize(typ), dest, typ, fail)
+
+	case kindFloat:
+		g.printf("if f, ok := %s.(float64); ok {\n%s = %s(f)\n} else {\n%s\n}\n", term, dest, typ, fail)
+
+	case kindAssert:
+		g.printf("if a, ok := %s.(%s); ok {\n%s = a\n} else {\n%s\n}\n", term, typ, dest, fail)
+
+	case kindTerm:
+		g.printf("%s = %s\n", dest, term)
+
+	case kindStruct:
+		g.printf("if err := %s.DecodeETF(%s); err != nil {\nreturn err\n}\n", dest, term)
+
+	case kindStructPtr:
+		// nil pointer is encoded as an empty list
+		l := fmt.Sprintf("l%d", depth)
+		g.printf("if %s, ok := %s.(%s.List); %s == nil || ok && len(%s) == 0 {\n", l, term, e, term, l)
+		g.printf("%s = nil\n} else {\n", dest)
+		g.printf("%s = new(%s)\n", dest, typeName(t))
+		g.printf("if err := %s.DecodeETF(%s); err != nil {\nreturn err\n}\n}\n", dest, term)
+
+	case kindSlice:
+		elt := t.(*ast.ArrayType).Elt
+		l := fmt.Sprintf("l%d", depth)
+		i := fmt.Sprintf("i%d", depth)
+		g.printf("switch %s := %s.(type) {\n", l, term)
+		g.printf("case %s.List:\n", e)
+		g.printf("%s = make(%s, len(%s))\n", dest, typ, l)
+		g.printf("for %s := range %s {\n", i, l)
+		g.decodeValue(fmt.Sprintf("%s[%s]", dest, i), fmt.Sprintf("%s[%s]", l, i), elt, depth+1)
+		g.printf("}\n")
+		if k := g.kind(elt); k == kindInt || k == kindUint {
+			// Erlang encodes the list of small integers as a string
+			g.printf("case string:\n")
+			g.printf("%s = make(%s, len(%s))\n", dest, typ, l)
+			g.printf("for %s := range %s {\n%s[%s] = %s(%s[%s])\n}\n", i, l, dest, i, g.typeString(elt), l, i)
+		}
+		g.printf("default:\n%s\n}\n", fail)
+
+	case kindMap:
+		mt := t.(*ast.MapType)
+		m := fmt.Sprintf("m%d", depth)
+		k := fmt.Sprintf("k%d", depth)
+		val := fmt.Sprintf("v%d", depth)
+		key := fmt.Sprintf("key%d", depth)
+		value := fmt.Sprintf("value%d", depth)
+		g.printf("if %s, ok := %s.(%s.Map); ok {\n", m, term, e)
+		g.printf("%s = make(%s, len(%s))\n", dest, typ, m)
+		g.printf("for %s, %s := range %s {\n", k, val, m)
+		g.printf("var %s %s\n", key, g.typeString(mt.Key))
+		g.decodeValue(key, k, mt.Key, depth+1)
+		g.printf("var %s %s\n", value, g.typeString(mt.Value))
+		g.decodeValue(value, val, mt.Value, depth+1)
+		g.printf("%s[%s] = %s\n", dest, key, value)
+		g.printf("}\n} else {\n%s\n}\n", fail)
+
+	default:
+		g.printf("if err := %s.TermIntoStruct(%s, &%s); err != nil {\nreturn err\n}\n", e, term, dest)
+	}
+}
@@ -78,6 +78,18 @@ func (r *rex) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, messag
 	return reply, gen.ServerStatusOK
 }
 
+func (r *rex) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	lib.Log("REX: HandleCast: %#v", message)
+	// etf.Tuple{"cast", Module, Function, Args, GroupLeader}
+	if m, ok := message.(etf.Tuple); ok && len(m) > 3 && m.Element(1) == etf.Atom("cast") {
+		module, _ := m.Element(2).(etf.Atom)
+		function, _ := m.Element(3).(etf.Atom)
+		args, _ := m.Element(4).(etf.List)
+		r.handleRPC(process, module, function, args)
+	}
+	return gen.ServerStatusOK
+}
+
 func (r *rex) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
 	// add this handler to suppres any messages from erlang
 	return gen.ServerStatusOK
@@ -106,6 +118,16 @@ func (r *rex) HandleDirect(process *gen.ServerProcess, message interface{}) (int
 		}
 		return nil, fmt.Errorf("unknown RPC name")
 
+	case gen.MessageLookupRPC:
+		mf := modFun{
+			module:   m.Module,
+			function: m.Function,
+		}
+		if r.methods[mf] == nil {
+			return nil, fmt.Errorf("unknown RPC name")
+		}
+		return nil, nil
+
 	default:
 		return nil, gen.ErrUnsupportedRequest
 	}
@@ -130,6 +152,13 @@ func (r *rex) handleRPC(process *gen.ServerProcess, module, function etf.Atom, a
 			}
 		}
 	}()
+	// applying the fun (erpc:call(Node, Fun) and rpc:call(Node, erlang, apply, [Fun, Args]))
+	if module == "erlang" && function == "apply" && len(args) == 2 {
+		if reply, ok := r.handleApply(process, args[0], args[1]); ok {
+			return reply
+		}
+	}
+
 	mf := modFun{
 		module:   string(module),
 		function: string(function),
@@ -169,6 +198,35 @@ func (r *rex) handleRPC(process *gen.ServerProcess, module, function etf.Atom, a
 	}
 }
 
+// handleApply applies the external fun pointing to the provided rpc method. Closures
+// (etf.Function) can't be evaluated on this node.
+func (r *rex) handleApply(process *gen.ServerProcess, fun etf.Term, args etf.Term) (interface{}, bool) {
+	funArgs, ok := args.(etf.List)
+	if !ok {
+		return nil, false
+	}
+	exit := func(reason etf.Term) interface{} {
+		return etf.Tuple{
+			etf.Atom("badrpc"),
+			etf.Tuple{
+				etf.Atom("EXIT"),
+				etf.Tuple{reason, etf.List{}},
+			},
+		}
+	}
+
+	switch f := fun.(type) {
+	case etf.Export:
+		if f.Arity != len(funArgs) {
+			return exit(etf.Tuple{etf.Atom("badarity"), etf.Tuple{f, funArgs}}), true
+		}
+		return r.handleRPC(process, f.Module, f.Function, funArgs), true
+	case etf.Function:
+		return exit(etf.Tuple{etf.Atom("badfun"), f}), true
+	}
+	return nil, false
+}
+
 type erpcMFA struct {
 	id etf.Ref
 	m  etf.Atom
@@ -0,0 +1,27 @@
+package etf
+
+import (
+	"sync"
+)
+
+var (
+	knownAtoms sync.Map // Atom => struct{}
+)
+
+func init() {
+	RegisterAtom("true", "false", "undefined", "ok", "error")
+}
+
+// RegisterAtom makes the given atoms known for decoding in the safe mode
+// (DecodeOptions.Safe). Record names are registered by RegisterRecord.
+func RegisterAtom(atoms ...Atom) {
+	for _, atom := range atoms {
+		knownAtoms.Store(atom, struct{}{})
+	}
+}
+
+// IsKnownAtom returns true if the given atom was registered by RegisterAtom
+func IsKnownAtom(atom Atom) bool {
+	_, ok := knownAtoms.Load(atom)
+	return ok
+}
@@ -0,0 +1,759 @@
+package etf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+// BridgeRule defines the representation of the term type in JSON/MessagePack
+type BridgeRule int
+
+const (
+	// BridgeRuleDefault friendly representation (see BridgeOptions for the details)
+	BridgeRuleDefault BridgeRule = 0
+	// BridgeRuleString represents the value as a string
+	BridgeRuleString BridgeRule = 1
+	// BridgeRuleTagged represents the value as a tagged object {"$type": value}.
+	// It makes the conversion lossless.
+	BridgeRuleTagged BridgeRule = 2
+)
+
+// BridgeString defines what the plain strings (and the keys of objects) become
+// on converting JSON/MessagePack into the term
+type BridgeString int
+
+const (
+	BridgeStringString BridgeString = 0
+	BridgeStringBinary BridgeString = 1
+	BridgeStringAtom   BridgeString = 2
+)
+
+// BridgeOptions defines the rules for converting terms into JSON/MessagePack and back.
+// Zero value is the friendly mode: atoms are strings, tuples are arrays, binaries
+// are strings (base64 if it is not a valid UTF-8; MessagePack keeps them binary),
+// pids/refs are objects {"node": ..., "id": ..., "creation": ...}, the atom 'undefined'
+// is null. Go structs are converted the same way they are encoded by Encode, so
+// the field names are taken from the "etf" tags.
+//
+// Tagged objects ({"$atom": "ok"}, {"$tuple": [...]}, {"$binary": "base64"},
+// {"$bitstring": {...}}, {"$improper": [...]}, {"$map": [[key, value], ...]},
+// {"$atomkeys": {...}}, {"$pid": {...}}, {"$ref": {...}}, {"$port": {...}},
+// {"$export": {...}}, {"$bigint": "digits"}) are always recognized on converting back.
+type BridgeOptions struct {
+	// Tagged enables lossless mode. All the types having no native representation
+	// are tagged. The rules below are ignored.
+	Tagged bool
+
+	// Atom rule. Default, String: "name". Tagged: {"$atom": "name"}.
+	// true/false are always booleans.
+	Atom BridgeRule
+	// Charlist rule (lists of integers). Default: array of integers.
+	// String: string if all the integers are printable code points.
+	Charlist BridgeRule
+	// Binary rule. Default: UTF-8 string or base64 string (binary for MessagePack).
+	// String: string (base64 string if it is not a valid UTF-8).
+	// Tagged: {"$binary": "base64"} (binary for MessagePack).
+	Binary BridgeRule
+	// Tuple rule. Default, String: array. Tagged: {"$tuple": [...]}.
+	Tuple BridgeRule
+	// Pid rule (applies to ports as well). Default: object. String: "<...>" (see Format).
+	// Tagged: {"$pid": {...}}.
+	Pid BridgeRule
+	// Ref rule. Default: object. String: "#Ref<...>" (see Format). Tagged: {"$ref": {...}}.
+	Ref BridgeRule
+
+	// Strings defines what the plain strings become on converting back to the term.
+	// Ignored in the tagged mode (always string).
+	Strings BridgeString
+	// Keys defines what the keys of objects become on converting back to the term.
+	// Ignored in the tagged mode (always string).
+	Keys BridgeString
+	// NullAtom the atom represented as null. Default is 'undefined'.
+	// In the tagged mode null is nil.
+	NullAtom Atom
+}
+
+var (
+	ErrBridgeUnsupported = fmt.Errorf("Unsupported type for conversion")
+	ErrBridgeMalformed   = fmt.Errorf("Malformed tagged object")
+)
+
+// bridgeMap is the intermediate representation of JSON object/MessagePack map
+// keeping the order of the keys
+type bridgeMap []bridgePair
+
+type bridgePair struct {
+	key   interface{}
+	value interface{}
+}
+
+type bridge struct {
+	options BridgeOptions
+	// JSON has no binaries and non-string keys
+	json bool
+}
+
+func newBridge(options BridgeOptions, json bool) *bridge {
+	if options.NullAtom == "" {
+		options.NullAtom = "undefined"
+	}
+	return &bridge{options: options, json: json}
+}
+
+func (b *bridge) rule(r BridgeRule) BridgeRule {
+	if b.options.Tagged {
+		return BridgeRuleTagged
+	}
+	return r
+}
+
+func tagged(tag string, value interface{}) bridgeMap {
+	return bridgeMap{{key: tag, value: value}}
+}
+
+// toBridge converts the term into the intermediate representation: nil, bool, int64,
+// uint64, *big.Int, float64, string, []byte, []interface{}, bridgeMap
+func (b *bridge) toBridge(term Term) (interface{}, error) {
+	switch t := term.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return t, nil
+	case Atom:
+		if b.options.Tagged == false && t == b.options.NullAtom {
+			return nil, nil
+		}
+		if b.rule(b.options.Atom) == BridgeRuleTagged {
+			return tagged("$atom", string(t)), nil
+		}
+		return string(t), nil
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint:
+		return uint64(t), nil
+	case uint8:
+		return uint64(t), nil
+	case uint16:
+		return uint64(t), nil
+	case uint32:
+		return uint64(t), nil
+	case uint64:
+		return t, nil
+	case *big.Int:
+		if t.IsInt64() {
+			return t.Int64(), nil
+		}
+		if t.IsUint64() {
+			return t.Uint64(), nil
+		}
+		if b.json {
+			// JSON numbers have no limits
+			return t, nil
+		}
+		if b.options.Tagged {
+			return tagged("$bigint", t.String()), nil
+		}
+		return t.String(), nil
+	case float32:
+		return float64(t), nil
+	case float64:
+		if math.IsInf(t, 0) || math.IsNaN(t) {
+			return nil, fmt.Errorf("%w: %v", ErrBridgeUnsupported, t)
+		}
+		return t, nil
+	case string:
+		return t, nil
+	case Charlist:
+		return string(t), nil
+	case String:
+		return b.binary([]byte(t)), nil
+	case []byte:
+		return b.binary(t), nil
+	case BitString:
+		if len(t.Bytes) == 0 || t.Bits == 0 || t.Bits >= 8 {
+			return b.binary(t.Bytes), nil
+		}
+		value := bridgeMap{
+			{key: "bytes", value: b.rawBinary(t.Bytes)},
+			{key: "bits", value: int64(t.Bits)},
+		}
+		if b.options.Tagged {
+			return tagged("$bitstring", value), nil
+		}
+		return value, nil
+	case List:
+		if b.rule(b.options.Charlist) == BridgeRuleString {
+			if s, ok := charlistToString(t); ok {
+				return s, nil
+			}
+		}
+		return b.list(t)
+	case ListImproper:
+		l, err := b.list(t)
+		if err != nil {
+			return nil, err
+		}
+		if b.options.Tagged {
+			return tagged("$improper", l), nil
+		}
+		return l, nil
+	case Tuple:
+		l, err := b.list(t)
+		if err != nil {
+			return nil, err
+		}
+		if b.rule(b.options.Tuple) == BridgeRuleTagged {
+			return tagged("$tuple", l), nil
+		}
+		return l, nil
+	case Map:
+		return b.mapTerm(t)
+	case Pid:
+		switch b.rule(b.options.Pid) {
+		case BridgeRuleString:
+			return Format(t), nil
+		case BridgeRuleTagged:
+			return tagged("$pid", pidToBridge(t)), nil
+		}
+		return pidToBridge(t), nil
+	case Port:
+		switch b.rule(b.options.Pid) {
+		case BridgeRuleString:
+			return Format(t), nil
+		case BridgeRuleTagged:
+			return tagged("$port", portToBridge(t)), nil
+		}
+		return portToBridge(t), nil
+	case Ref:
+		return b.ref(t), nil
+	case Alias:
+		return b.ref(Ref(t)), nil
+	case Export:
+		if b.options.Tagged {
+			return tagged("$export", bridgeMap{
+				{key: "module", value: string(t.Module)},
+				{key: "function", value: string(t.Function)},
+				{key: "arity", value: int64(t.Arity)},
+			}), nil
+		}
+		return Format(t), nil
+	case Function:
+		if b.options.Tagged {
+			return nil, fmt.Errorf("%w: %T", ErrBridgeUnsupported, t)
+		}
+		return Format(t), nil
+	}
+
+	// Go types (structs, slices, maps...). Convert them the way they are encoded.
+	buf := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(buf)
+	if err := Encode(term, buf, EncodeOptions{}); err != nil {
+		return nil, fmt.Errorf("%w: %T", ErrBridgeUnsupported, term)
+	}
+	decoded, _, err := Decode(buf.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %T", ErrBridgeUnsupported, term)
+	}
+	return b.toBridge(decoded)
+}
+
+func (b *bridge) list(l []Term) ([]interface{}, error) {
+	list := make([]interface{}, len(l))
+	for i := range l {
+		v, err := b.toBridge(l[i])
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+func (b *bridge) mapTerm(m Map) (interface{}, error) {
+	stringKeys := true
+	atomKeys := true
+	for k := range m {
+		switch k.(type) {
+		case string:
+			atomKeys = false
+		case Atom:
+			stringKeys = false
+		default:
+			stringKeys = false
+			atomKeys = false
+		}
+	}
+
+	object := make(bridgeMap, 0, len(m))
+	for k, v := range m {
+		value, err := b.toBridge(v)
+		if err != nil {
+			return nil, err
+		}
+		var key interface{}
+		switch {
+		case b.options.Tagged && (stringKeys || atomKeys):
+			key = fmt.Sprint(k)
+		case b.options.Tagged && b.json:
+			// pairs [key, value]. will be wrapped into $map below
+			key, err = b.toBridge(k)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, bridgePair{value: []interface{}{key, value}})
+			continue
+		case b.json:
+			key = bridgeKey(k)
+		default:
+			key, err = b.toBridge(k)
+			if err != nil {
+				return nil, err
+			}
+		}
+		object = append(object, bridgePair{key: key, value: value})
+	}
+	sortBridgeMap(object)
+
+	if b.options.Tagged == false || stringKeys {
+		return object, nil
+	}
+	if atomKeys {
+		return tagged("$atomkeys", object), nil
+	}
+	if b.json {
+		pairs := make([]interface{}, len(object))
+		for i := range object {
+			pairs[i] = object[i].value
+		}
+		return tagged("$map", pairs), nil
+	}
+	return object, nil
+}
+
+// bridgeKey makes a string key of the JSON object from the term
+func bridgeKey(k Term) string {
+	switch key := k.(type) {
+	case Atom:
+		return string(key)
+	case string:
+		return key
+	case []byte:
+		return string(key)
+	case String:
+		return string(key)
+	case Charlist:
+		return string(key)
+	}
+	return Format(k)
+}
+
+func (b *bridge) binary(data []byte) interface{} {
+	switch b.rule(b.options.Binary) {
+	case BridgeRuleTagged:
+		if b.json {
+			return tagged("$binary", base64.StdEncoding.EncodeToString(data))
+		}
+		return data
+	case BridgeRuleString:
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	if b.json == false {
+		return data
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// rawBinary binary data inside of the other objects
+func (b *bridge) rawBinary(data []byte) interface{} {
+	if b.json {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return data
+}
+
+func (b *bridge) ref(r Ref) interface{} {
+	switch b.rule(b.options.Ref) {
+	case BridgeRuleString:
+		return Format(r)
+	case BridgeRuleTagged:
+		return tagged("$ref", refToBridge(r))
+	}
+	return refToBridge(r)
+}
+
+func pidToBridge(p Pid) bridgeMap {
+	return bridgeMap{
+		{key: "node", value: string(p.Node)},
+		{key: "id", value: p.ID},
+		{key: "creation", value: int64(p.Creation)},
+	}
+}
+
+func portToBridge(p Port) bridgeMap {
+	return bridgeMap{
+		{key: "node", value: string(p.Node)},
+		{key: "id", value: int64(p.ID)},
+		{key: "creation", value: int64(p.Creation)},
+	}
+}
+
+func refToBridge(r Ref) bridgeMap {
+	id := make([]interface{}, len(r.ID))
+	for i := range r.ID {
+		id[i] = int64(r.ID[i])
+	}
+	return bridgeMap{
+		{key: "node", value: string(r.Node)},
+		{key: "creation", value: int64(r.Creation)},
+		{key: "id", value: id},
+	}
+}
+
+func charlistToString(l List) (string, bool) {
+	runes := make([]rune, len(l))
+	for i := range l {
+		c, ok := TermToInt64(l[i])
+		if !ok || c > unicode.MaxRune || unicode.IsPrint(rune(c)) == false && unicode.IsSpace(rune(c)) == false {
+			return "", false
+		}
+		runes[i] = rune(c)
+	}
+	return string(runes), true
+}
+
+// sortBridgeMap sorts pairs by the text representation of the keys
+// to make the result stable
+func sortBridgeMap(m bridgeMap) {
+	keys := make([]string, len(m))
+	for i := range m {
+		if m[i].key == nil {
+			// pair [key, value] of the tagged $map
+			keys[i] = fmt.Sprintf("%v", m[i].value)
+			continue
+		}
+		keys[i] = fmt.Sprintf("%v", m[i].key)
+	}
+	sort.Sort(bridgeMapSorter{m: m, keys: keys})
+}
+
+type bridgeMapSorter struct {
+	m    bridgeMap
+	keys []string
+}
+
+func (s bridgeMapSorter) Len() int           { return len(s.m) }
+func (s bridgeMapSorter) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s bridgeMapSorter) Swap(i, j int) {
+	s.m[i], s.m[j] = s.m[j], s.m[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// fromBridge converts the intermediate representation back to the term
+func (b *bridge) fromBridge(v interface{}) (Term, error) {
+	switch value := v.(type) {
+	case nil:
+		if b.options.Tagged {
+			return nil, nil
+		}
+		return b.options.NullAtom, nil
+	case bool:
+		return value, nil
+	case int64:
+		return int(value), nil
+	case uint64:
+		if value > math.MaxInt64 {
+			return new(big.Int).SetUint64(value), nil
+		}
+		return int(value), nil
+	case *big.Int:
+		if value.IsInt64() {
+			return int(value.Int64()), nil
+		}
+		return value, nil
+	case float64:
+		return value, nil
+	case string:
+		return b.fromString(value, b.options.Strings), nil
+	case []byte:
+		return value, nil
+	case []interface{}:
+		l, err := b.fromList(value)
+		if err != nil {
+			return nil, err
+		}
+		return List(l), nil
+	case bridgeMap:
+		if len(value) == 1 {
+			if tag, ok := value[0].key.(string); ok && len(tag) > 0 && tag[0] == '$' {
+				term, err := b.fromTagged(tag, value[0].value)
+				if err != ErrBridgeUnsupported {
+					return term, err
+				}
+				// not a tag. handle it as a regular map
+			}
+		}
+		m := make(Map, len(value))
+		for _, pair := range value {
+			var key Term
+			if s, ok := pair.key.(string); ok {
+				key = b.fromString(s, b.options.Keys)
+			} else {
+				k, err := b.fromBridge(pair.key)
+				if err != nil {
+					return nil, err
+				}
+				key = k
+			}
+			switch key.(type) {
+			case List, ListImproper, Tuple, Map, []byte, BitString:
+				return nil, fmt.Errorf("%w: map key %s", ErrBridgeUnsupported, Format(key))
+			}
+			val, err := b.fromBridge(pair.value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrBridgeUnsupported, v)
+}
+
+func (b *bridge) fromString(s string, rule BridgeString) Term {
+	if b.options.Tagged {
+		return s
+	}
+	switch rule {
+	case BridgeStringBinary:
+		return []byte(s)
+	case BridgeStringAtom:
+		return Atom(s)
+	}
+	return s
+}
+
+func (b *bridge) fromList(l []interface{}) ([]Term, error) {
+	list := make([]Term, len(l))
+	for i := range l {
+		term, err := b.fromBridge(l[i])
+		if err != nil {
+			return nil, err
+		}
+		list[i] = term
+	}
+	return list, nil
+}
+
+// fromTagged converts the tagged object. Returns ErrBridgeUnsupported if the tag is unknown.
+func (b *bridge) fromTagged(tag string, value interface{}) (Term, error) {
+	switch tag {
+	case "$atom":
+		if s, ok := value.(string); ok {
+			return Atom(s), nil
+		}
+	case "$tuple":
+		if l, ok := value.([]interface{}); ok {
+			t, err := b.fromList(l)
+			return Tuple(t), err
+		}
+	case "$improper":
+		if l, ok := value.([]interface{}); ok && len(l) > 1 {
+			t, err := b.fromList(l)
+			return ListImproper(t), err
+		}
+	case "$binary":
+		return bridgeBinary(value)
+	case "$bitstring":
+		fields, ok := bridgeFields(value)
+		if !ok {
+			break
+		}
+		data, err := bridgeBinary(fields["bytes"])
+		if err != nil {
+			return nil, err
+		}
+		bits, ok := bridgeInt(fields["bits"])
+		if !ok || bits < 1 || bits > 8 || len(data) == 0 {
+			break
+		}
+		return BitString{Bytes: data, Bits: uint8(bits)}, nil
+	case "$map":
+		l, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		m := make(Map, len(l))
+		for _, p := range l {
+			pair, ok := p.([]interface{})
+			if !ok || len(pair) != 2 {
+				return nil, ErrBridgeMalformed
+			}
+			key, err := b.fromBridge(pair[0])
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case List, ListImproper, Tuple, Map, []byte, BitString:
+				return nil, fmt.Errorf("%w: map key %s", ErrBridgeUnsupported, Format(key))
+			}
+			val, err := b.fromBridge(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	case "$atomkeys":
+		object, ok := value.(bridgeMap)
+		if !ok {
+			break
+		}
+		m := make(Map, len(object))
+		for _, pair := range object {
+			key, ok := pair.key.(string)
+			if !ok {
+				return nil, ErrBridgeMalformed
+			}
+			val, err := b.fromBridge(pair.value)
+			if err != nil {
+				return nil, err
+			}
+			m[Atom(key)] = val
+		}
+		return m, nil
+	case "$pid":
+		fields, ok := bridgeFields(value)
+		if !ok {
+			break
+		}
+		node, ok1 := fields["node"].(string)
+		id, ok2 := bridgeInt(fields["id"])
+		creation, ok3 := bridgeInt(fields["creation"])
+		if !ok1 || !ok2 || !ok3 {
+			break
+		}
+		return Pid{Node: Atom(node), ID: uint64(id), Creation: uint32(creation)}, nil
+	case "$port":
+		fields, ok := bridgeFields(value)
+		if !ok {
+			break
+		}
+		node, ok1 := fields["node"].(string)
+		id, ok2 := bridgeInt(fields["id"])
+		creation, ok3 := bridgeInt(fields["creation"])
+		if !ok1 || !ok2 || !ok3 {
+			break
+		}
+		return Port{Node: Atom(node), ID: uint32(id), Creation: uint32(creation)}, nil
+	case "$ref":
+		fields, ok := bridgeFields(value)
+		if !ok {
+			break
+		}
+		node, ok1 := fields["node"].(string)
+		creation, ok2 := bridgeInt(fields["creation"])
+		id, ok3 := fields["id"].([]interface{})
+		if !ok1 || !ok2 || !ok3 || len(id) > 5 {
+			break
+		}
+		ref := Ref{Node: Atom(node), Creation: uint32(creation)}
+		for i := range id {
+			v, ok := bridgeInt(id[i])
+			if !ok {
+				return nil, ErrBridgeMalformed
+			}
+			ref.ID[i] = uint32(v)
+		}
+		return ref, nil
+	case "$export":
+		fields, ok := bridgeFields(value)
+		if !ok {
+			break
+		}
+		module, ok1 := fields["module"].(string)
+		function, ok2 := fields["function"].(string)
+		arity, ok3 := bridgeInt(fields["arity"])
+		if !ok1 || !ok2 || !ok3 {
+			break
+		}
+		return Export{Module: Atom(module), Function: Atom(function), Arity: int(arity)}, nil
+	case "$bigint":
+		s, ok := value.(string)
+		if !ok {
+			break
+		}
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			break
+		}
+		return b.fromBridge(i)
+	default:
+		return nil, ErrBridgeUnsupported
+	}
+	return nil, fmt.Errorf("%w: %s", ErrBridgeMalformed, tag)
+}
+
+func bridgeFields(v interface{}) (map[string]interface{}, bool) {
+	object, ok := v.(bridgeMap)
+	if !ok {
+		return nil, false
+	}
+	fields := make(map[string]interface{}, len(object))
+	for _, pair := range object {
+		key, ok := pair.key.(string)
+		if !ok {
+			return nil, false
+		}
+		fields[key] = pair.value
+	}
+	return fields, true
+}
+
+func bridgeInt(v interface{}) (int64, bool) {
+	switch i := v.(type) {
+	case int64:
+		return i, true
+	case uint64:
+		return int64(i), true
+	case *big.Int:
+		if i.IsUint64() {
+			return int64(i.Uint64()), true
+		}
+	}
+	return 0, false
+}
+
+func bridgeBinary(v interface{}) ([]byte, error) {
+	switch data := v.(type) {
+	case []byte:
+		return data, nil
+	case string:
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBridgeMalformed, err)
+		}
+		return b, nil
+	}
+	return nil, ErrBridgeMalformed
+}
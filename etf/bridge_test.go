@@ -0,0 +1,152 @@
+package etf
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestTermToJSONFriendly(t *testing.T) {
+	type user struct {
+		Name  string `etf:"name"`
+		Age   int    `etf:"age"`
+		Email Atom   `etf:"email"`
+	}
+	cases := []struct {
+		term     Term
+		options  BridgeOptions
+		expected string
+	}{
+		{Atom("ok"), BridgeOptions{}, `"ok"`},
+		{Atom("undefined"), BridgeOptions{}, `null`},
+		{Atom("nil"), BridgeOptions{NullAtom: "nil"}, `null`},
+		{true, BridgeOptions{}, `true`},
+		{123, BridgeOptions{}, `123`},
+		{1.0, BridgeOptions{}, `1.0`},
+		{"a<b>", BridgeOptions{}, `"a<b>"`},
+		{[]byte("text"), BridgeOptions{}, `"text"`},
+		{[]byte{0xff, 0}, BridgeOptions{}, `"/wA="`},
+		{Tuple{Atom("ok"), List{1, 2}}, BridgeOptions{}, `["ok",[1,2]]`},
+		{Tuple{Atom("ok"), 1}, BridgeOptions{Tuple: BridgeRuleTagged}, `{"$tuple":["ok",1]}`},
+		{List{104, 105}, BridgeOptions{}, `[104,105]`},
+		{List{104, 105}, BridgeOptions{Charlist: BridgeRuleString}, `"hi"`},
+		{Map{Atom("b"): 2, "a": 1, 3: 3}, BridgeOptions{}, `{"3":3,"a":1,"b":2}`},
+		{Pid{Node: "a@b", ID: 1, Creation: 2}, BridgeOptions{}, `{"node":"a@b","id":1,"creation":2}`},
+		{Pid{}, BridgeOptions{Pid: BridgeRuleString}, `"<0.0.0>"`},
+		{Ref{ID: [5]uint32{1, 2, 3}}, BridgeOptions{Ref: BridgeRuleString}, `"#Ref<0.1.2.3>"`},
+		{user{Name: "Jack", Age: 30, Email: "undefined"}, BridgeOptions{}, `{"age":30,"email":null,"name":"Jack"}`},
+	}
+
+	for _, c := range cases {
+		data, err := TermToJSON(c.term, c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != c.expected {
+			t.Fatalf("expected %s got %s", c.expected, data)
+		}
+	}
+}
+
+func TestJSONToTermFriendly(t *testing.T) {
+	data := []byte(`{"name": "Jack", "age": 30, "score": 1.5, "tags": ["a", null], "big": 123456789012345678901234567890, "t": {"$tuple": [1, 2]}}`)
+	term, err := JSONToTerm(data, BridgeOptions{Strings: BridgeStringBinary, Keys: BridgeStringAtom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	expected := Map{
+		Atom("name"):  []byte("Jack"),
+		Atom("age"):   30,
+		Atom("score"): 1.5,
+		Atom("tags"):  List{[]byte("a"), Atom("undefined")},
+		Atom("big"):   bigInt,
+		Atom("t"):     Tuple{1, 2},
+	}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+
+	// struct tags are reused on the way back
+	type user struct {
+		Name []byte `etf:"name"`
+		Age  int    `etf:"age"`
+	}
+	u := user{}
+	term, _ = JSONToTerm([]byte(`{"name": "Jack", "age": 30}`), BridgeOptions{Strings: BridgeStringBinary, Keys: BridgeStringAtom})
+	if err := TermIntoStruct(term, &u); err != nil {
+		t.Fatal(err)
+	}
+	if string(u.Name) != "Jack" || u.Age != 30 {
+		t.Fatal("wrong value", u)
+	}
+
+	if _, err := JSONToTerm([]byte(`{"a": 1} 1`), BridgeOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func testBridgeTerm() Term {
+	bigInt, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	return Tuple{
+		Atom("ok"),
+		"string",
+		[]byte{1, 2, 0xff},
+		BitString{Bytes: []byte{0xa0}, Bits: 3},
+		List{1, -2, 3.5, List{}, nil},
+		ListImproper{Atom("a"), Atom("b")},
+		Map{"key": Atom("undefined")},
+		Map{Atom("key"): 1},
+		Map{Atom("a"): 1, 1: Atom("int")},
+		Pid{Node: "a@b", ID: 1, Creation: 2},
+		Ref{Node: "a@b", Creation: 3, ID: [5]uint32{1, 2, 3}},
+		Port{Node: "a@b", ID: 4, Creation: 5},
+		Export{Module: "m", Function: "f", Arity: 1},
+		bigInt,
+		true,
+	}
+}
+
+func TestJSONTagged(t *testing.T) {
+	term := testBridgeTerm()
+	data, err := TermToJSON(term, BridgeOptions{Tagged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := JSONToTerm(data, BridgeOptions{Tagged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(term, result) {
+		t.Fatalf("expected %#v\ngot %#v\n%s", term, result, data)
+	}
+}
+
+func TestMsgPack(t *testing.T) {
+	data, err := TermToMsgPack(Map{Atom("a"): List{1, -1, 300, "x", []byte{1}}}, BridgeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x81, 0xa1, 'a', 0x95, 0x01, 0xff, 0xd1, 0x01, 0x2c, 0xa1, 'x', 0xc4, 0x01, 0x01}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expected %x got %x", expected, data)
+	}
+
+	term := testBridgeTerm()
+	data, err = TermToMsgPack(term, BridgeOptions{Tagged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := MsgPackToTerm(data, BridgeOptions{Tagged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(term, result) {
+		t.Fatalf("expected %#v\ngot %#v", term, result)
+	}
+
+	if _, err := MsgPackToTerm([]byte{0x92, 0x01}, BridgeOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -22,9 +22,6 @@ type stackElement struct {
 var (
 	termNil = make(List, 0)
 
-	biggestInt = big.NewInt(0xfffffffffffffff)
-	lowestInt  = big.NewInt(-0xfffffffffffffff)
-
 	errMalformedAtomUTF8      = fmt.Errorf("Malformed ETF. ettAtomUTF8")
 	errMalformedSmallAtomUTF8 = fmt.Errorf("Malformed ETF. ettSmallAtomUTF8")
 	errMalformedString        = fmt.Errorf("Malformed ETF. ettString")
@@ -53,11 +50,118 @@ var (
 
 	errMalformed = fmt.Errorf("Malformed ETF")
 	errInternal  = fmt.Errorf("Internal error")
+
+	ErrMaxDepth       = fmt.Errorf("Decoding limit exceeded. Max depth")
+	ErrMaxAllocations = fmt.Errorf("Decoding limit exceeded. Max allocations")
+	ErrMaxBinarySize  = fmt.Errorf("Decoding limit exceeded. Max binary size")
+	ErrMaxAtoms       = fmt.Errorf("Decoding limit exceeded. Max atoms")
+	ErrUnknownAtom    = fmt.Errorf("Unknown atom (safe mode)")
 )
 
 type DecodeOptions struct {
 	FlagV4NC        bool
 	FlagBigCreation bool
+
+	// Limits for decoding untrusted data. Zero value means no limit.
+
+	// MaxDepth limits the nesting of lists, tuples, maps and complex types like pid/ref/fun
+	MaxDepth int
+	// MaxAllocations limits the total number of elements of lists, tuples, maps
+	// and free variables of funs allocated during decoding
+	MaxAllocations int
+	// MaxBinarySize limits the size of a single binary
+	MaxBinarySize int
+	// MaxAtoms limits the number of different atoms in the term
+	MaxAtoms int
+
+	// Safe refuses to create atoms not registered by RegisterAtom (or being a
+	// part of the atom cache) like the 'safe' option of erlang:binary_to_term/2.
+	Safe bool
+
+	// BigInt defines the representation of SMALL_BIG_EXT/LARGE_BIG_EXT integers
+	BigInt BigIntMode
+}
+
+// BigIntMode defines how the big integers (SMALL_BIG_EXT, LARGE_BIG_EXT) are decoded.
+// Integers encoded as SMALL_INTEGER_EXT/INTEGER_EXT are always decoded as int/int64.
+type BigIntMode int
+
+const (
+	// BigIntDefault decodes the big integer as int64 if it fits, otherwise as *big.Int
+	BigIntDefault BigIntMode = 0
+	// BigIntUint64 decodes the big integer as int64 if it fits, as uint64 if it is
+	// a positive value fitting 64 bits, otherwise as *big.Int
+	BigIntUint64 BigIntMode = 1
+	// BigIntAlways decodes the big integer as *big.Int regardless of its value
+	BigIntAlways BigIntMode = 2
+)
+
+// DecodeError is returned by Decode. Offset is the position of the term (in the
+// given packet) where decoding has failed.
+type DecodeError struct {
+	Offset int
+	// Path is the path of the failed value (like .users[3].name). Set by DecodeInto only.
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s at %s (offset %d)", e.Err, e.Path, e.Offset)
+	}
+	return fmt.Sprintf("%s (offset %d)", e.Err, e.Offset)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeLimits keeps the state of the limits given in DecodeOptions
+type decodeLimits struct {
+	options     DecodeOptions
+	depth       int
+	allocations int
+	atoms       map[Atom]struct{}
+}
+
+func (l *decodeLimits) push() error {
+	l.depth++
+	if l.options.MaxDepth > 0 && l.depth > l.options.MaxDepth {
+		return ErrMaxDepth
+	}
+	return nil
+}
+
+func (l *decodeLimits) allocate(n int) error {
+	l.allocations += n
+	if l.options.MaxAllocations > 0 && l.allocations > l.options.MaxAllocations {
+		return ErrMaxAllocations
+	}
+	return nil
+}
+
+func (l *decodeLimits) binary(n int) error {
+	if l.options.MaxBinarySize > 0 && n > l.options.MaxBinarySize {
+		return ErrMaxBinarySize
+	}
+	return nil
+}
+
+func (l *decodeLimits) atom(atom Atom) error {
+	if l.options.Safe && IsKnownAtom(atom) == false {
+		return ErrUnknownAtom
+	}
+	if l.options.MaxAtoms == 0 {
+		return nil
+	}
+	if l.atoms == nil {
+		l.atoms = make(map[Atom]struct{})
+	}
+	l.atoms[atom] = struct{}{}
+	if len(l.atoms) > l.options.MaxAtoms {
+		return ErrMaxAtoms
+	}
+	return nil
 }
 
 // stackless implementation is speeding up it up to x25 times
@@ -70,10 +174,22 @@ type DecodeOptions struct {
 // see comments within this function
 
 func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, retByte []byte, retErr error) {
+	limits := decodeLimits{options: options}
+	return decode(packet, cache, &limits)
+}
+
+// decode decodes the term keeping the state of the limits in the given decodeLimits
+// (DecodeInto decodes the terms within the packet using the same limits)
+func decode(packet []byte, cache []Atom, limits *decodeLimits) (retTerm Term, retByte []byte, retErr error) {
 	var term Term
 	var stack *stackElement
 	var child *stackElement
 	var t byte
+	var offset int
+
+	size := len(packet)
+	options := limits.options
+
 	defer func() {
 		// We should catch any panic happened during decoding the raw data.
 		// Some of the Erlang' types can not be supported in Golang.
@@ -89,6 +205,9 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			retByte = nil
 			retErr = fmt.Errorf("%v", r)
 		}
+		if retErr != nil {
+			retErr = &DecodeError{Offset: offset, Err: retErr}
+		}
 	}()
 
 	for {
@@ -97,6 +216,7 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			return nil, nil, errMalformed
 		}
 
+		offset = size - len(packet)
 		t = packet[0]
 		packet = packet[1:]
 
@@ -121,6 +241,9 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			if len([]rune(atom)) > 255 {
 				return nil, nil, errMalformedAtomUTF8
 			}
+			if err := limits.atom(atom); err != nil {
+				return nil, nil, err
+			}
 			term = atom
 			packet = packet[n+2:]
 
@@ -140,7 +263,11 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			case "false":
 				term = false
 			default:
-				term = Atom(packet[1 : n+1])
+				atom := Atom(packet[1 : n+1])
+				if err := limits.atom(atom); err != nil {
+					return nil, nil, err
+				}
+				term = atom
 			}
 			packet = packet[n+1:]
 
@@ -198,15 +325,18 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			packet = packet[4:]
 
 		case ettSmallBig:
-			if len(packet) == 0 {
+			if len(packet) < 2 {
 				return nil, nil, errMalformedSmallBig
 			}
 
-			n := packet[0]
+			n := int(packet[0])
 			negative := packet[1] == 1 // sign
+			if len(packet) < n+2 {
+				return nil, nil, errMalformedSmallBig
+			}
 
 			///// this block improve the performance at least 4 times
-			if n < 8 { // treat as an int64
+			if n < 8 && options.BigInt != BigIntAlways { // treat as an int64
 				le8 := make([]byte, 8)
 				copy(le8, packet[2:n+2])
 				smallBig := binary.LittleEndian.Uint64(le8)
@@ -220,59 +350,22 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			}
 			/////
 
-			if len(packet) < int(n+2) {
-				return nil, nil, errMalformedSmallBig
-			}
-			bytes := packet[2 : n+2]
-
-			// encoded as a little endian. convert it to the big endian order
-			l := len(bytes)
-			for i := 0; i < l/2; i++ {
-				bytes[i], bytes[l-1-i] = bytes[l-1-i], bytes[i]
-			}
-
-			bigInt := &big.Int{}
-			bigInt.SetBytes(bytes)
-			if negative {
-				bigInt = bigInt.Neg(bigInt)
-			}
-
-			// try int and int64
-			if bigInt.Cmp(biggestInt) < 0 && bigInt.Cmp(lowestInt) > 0 {
-				term = bigInt.Int64()
-				packet = packet[n+2:]
-				break
-			}
-
-			term = bigInt
+			term = decodeBig(packet[2:n+2], negative, options.BigInt)
 			packet = packet[n+2:]
 
 		case ettLargeBig:
-			if len(packet) < 256 { // must be longer than ettSmallBig
+			if len(packet) < 5 {
 				return nil, nil, errMalformedLargeBig
 			}
 
 			n := binary.BigEndian.Uint32(packet[:4])
 			negative := packet[4] == 1 // sign
 
-			if len(packet) < int(n+5) {
+			if uint64(len(packet)) < uint64(n)+5 {
 				return nil, nil, errMalformedLargeBig
 			}
-			bytes := packet[5 : n+5]
 
-			// encoded as a little endian. convert it to the big endian order
-			l := len(bytes)
-			for i := 0; i < l/2; i++ {
-				bytes[i], bytes[l-1-i] = bytes[l-1-i], bytes[i]
-			}
-
-			bigInt := &big.Int{}
-			bigInt.SetBytes(bytes)
-			if negative {
-				bigInt = bigInt.Neg(bigInt)
-			}
-
-			term = bigInt
+			term = decodeBig(packet[5:n+5], negative, options.BigInt)
 			packet = packet[n+5:]
 
 		case ettList:
@@ -285,9 +378,17 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 				// must be encoded as ettNil
 				return nil, nil, errMalformedList
 			}
+			packet = packet[4:]
+
+			// every element (and the tail) takes at least 1 byte
+			if uint64(n)+1 > uint64(len(packet)) {
+				return nil, nil, errMalformedList
+			}
+			if err := limits.allocate(int(n) + 1); err != nil {
+				return nil, nil, err
+			}
 
 			term = make(List, n+1)
-			packet = packet[4:]
 			child = &stackElement{
 				parent:   stack,
 				termType: ettList,
@@ -302,6 +403,12 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 			n := packet[0]
 			packet = packet[1:]
+			if int(n) > len(packet) {
+				return nil, nil, errMalformedSmallTuple
+			}
+			if err := limits.allocate(int(n)); err != nil {
+				return nil, nil, err
+			}
 			term = make(Tuple, n)
 
 			if n == 0 {
@@ -322,6 +429,12 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 			n := binary.BigEndian.Uint32(packet[:4])
 			packet = packet[4:]
+			if uint64(n) > uint64(len(packet)) {
+				return nil, nil, errMalformedLargeTuple
+			}
+			if err := limits.allocate(int(n)); err != nil {
+				return nil, nil, err
+			}
 			term = make(Tuple, n)
 
 			if n == 0 {
@@ -342,6 +455,12 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 			n := binary.BigEndian.Uint32(packet[:4])
 			packet = packet[4:]
+			if uint64(n)*2 > uint64(len(packet)) {
+				return nil, nil, errMalformedMap
+			}
+			if err := limits.allocate(int(n) * 2); err != nil {
+				return nil, nil, err
+			}
 			term = make(Map)
 
 			if n == 0 {
@@ -361,9 +480,12 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			}
 
 			n := binary.BigEndian.Uint32(packet)
-			if len(packet) < int(n+4) {
+			if uint64(len(packet)) < uint64(n)+4 {
 				return nil, nil, errMalformedBinary
 			}
+			if err := limits.binary(int(n)); err != nil {
+				return nil, nil, err
+			}
 
 			b := make([]byte, n)
 			copy(b, packet[4:n+4])
@@ -413,6 +535,12 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 			copy(unique[:], packet[5:21])
 			l := binary.BigEndian.Uint32(packet[25:29])
+			if uint64(l)+4 > uint64(len(packet)-29) {
+				return nil, nil, errMalformedFun
+			}
+			if err := limits.allocate(int(l)); err != nil {
+				return nil, nil, err
+			}
 
 			fun := Function{
 				Arity:    packet[4],
@@ -437,18 +565,23 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 			}
 
 		case ettBitBinary:
-			if len(packet) < 6 {
+			if len(packet) < 5 {
 				return nil, nil, errMalformedBitBinary
 			}
 
 			n := binary.BigEndian.Uint32(packet)
-			bits := uint(packet[4])
+			bits := packet[4]
+			if uint64(len(packet)) < uint64(n)+5 || bits > 8 || (n > 0 && bits == 0) {
+				return nil, nil, errMalformedBitBinary
+			}
+			if err := limits.binary(int(n)); err != nil {
+				return nil, nil, err
+			}
 
 			b := make([]byte, n)
 			copy(b, packet[5:n+5])
-			b[n-1] = b[n-1] >> (8 - bits)
 
-			term = b
+			term = BitString{Bytes: b, Bits: bits}
 			packet = packet[n+5:]
 
 		case ettFloat:
@@ -475,6 +608,9 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 		// decoding child item of List/Map/Tuple/Pid/Ref/Port/... going deeper
 		if child != nil {
+			if err := limits.push(); err != nil {
+				return nil, nil, err
+			}
 			stack = child
 			continue
 		}
@@ -706,19 +842,19 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 				case 1:
 					// OldIndex
-					oldindex, ok := term.(int)
+					oldindex, ok := funInteger(term)
 					if !ok {
 						return nil, nil, errMalformedFun
 					}
-					fun.OldIndex = uint32(oldindex)
+					fun.OldIndex = oldindex
 
 				case 2:
 					// OldUnique
-					olduniq, ok := term.(int64)
+					olduniq, ok := funInteger(term)
 					if !ok {
 						return nil, nil, errMalformedFun
 					}
-					fun.OldUnique = uint32(olduniq)
+					fun.OldUnique = olduniq
 
 				case 3:
 					// Pid
@@ -767,6 +903,9 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 				}
 
+				stack.term = exp
+				stack.i++
+
 			default:
 				return nil, nil, errInternal
 			}
@@ -781,6 +920,7 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 		// this term was the last element of List/Map/Tuple/...
 		// pop from the stack, but if its the root just finish
+		limits.depth--
 		if stack.parent == nil {
 			break
 		}
@@ -792,3 +932,43 @@ func Decode(packet []byte, cache []Atom, options DecodeOptions) (retTerm Term, r
 
 	return term, packet, nil
 }
+
+// funInteger returns OldIndex/OldUniq of the fun which might be encoded
+// as ettSmallInteger or ettInteger
+func funInteger(term Term) (uint32, bool) {
+	switch v := term.(type) {
+	case int:
+		return uint32(v), true
+	case int64:
+		return uint32(v), true
+	}
+	return 0, false
+}
+
+// decodeBig decodes the little endian magnitude of the big integer
+func decodeBig(le []byte, negative bool, mode BigIntMode) Term {
+	// convert it to the big endian order. do not modify the packet.
+	l := len(le)
+	bytes := make([]byte, l)
+	for i := range le {
+		bytes[l-1-i] = le[i]
+	}
+
+	bigInt := new(big.Int).SetBytes(bytes)
+	if negative {
+		bigInt.Neg(bigInt)
+	}
+
+	switch mode {
+	case BigIntAlways:
+		return bigInt
+	case BigIntUint64:
+		if bigInt.IsInt64() == false && bigInt.IsUint64() {
+			return bigInt.Uint64()
+		}
+	}
+	if bigInt.IsInt64() {
+		return bigInt.Int64()
+	}
+	return bigInt
+}
@@ -0,0 +1,751 @@
+package etf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	termUnmarshalerType = reflect.TypeOf((*TermUnmarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+	// etf types are decoded using Decode and TermIntoStruct
+	termTypes = map[reflect.Type]bool{
+		reflect.TypeOf(Tuple{}):        true,
+		reflect.TypeOf(List{}):         true,
+		reflect.TypeOf(ListImproper{}): true,
+		reflect.TypeOf(Map{}):          true,
+		reflect.TypeOf(Pid{}):          true,
+		reflect.TypeOf(Ref{}):          true,
+		reflect.TypeOf(Alias{}):        true,
+		reflect.TypeOf(Port{}):         true,
+		reflect.TypeOf(BitString{}):    true,
+		reflect.TypeOf(Export{}):       true,
+		reflect.TypeOf(Function{}):     true,
+		bigIntType:                     true,
+	}
+
+	intoFields sync.Map // reflect.Type => []reflect.StructField
+)
+
+// DecodeInto decodes the packet directly into the value pointed by dest skipping
+// the intermediate etf.Term representation. The rules are the same as TermIntoStruct
+// has: maps are decoded into structs using "etf" tags (or the field names), tuples
+// into structs field by field, records (see Record) are validated. On type mismatch
+// returns *DecodeError with the path of the failed value (like .users[3].name).
+func DecodeInto(packet []byte, dest interface{}, options DecodeOptions) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("dest must be a non-nil pointer")
+	}
+	d := &intoDecoder{
+		packet: packet,
+		size:   len(packet),
+		limits: decodeLimits{options: options},
+	}
+	if err := d.decode(v.Elem()); err != nil {
+		return err
+	}
+	if len(d.packet) > 0 {
+		return d.fail(d.offset(), errPacketTrailer)
+	}
+	return nil
+}
+
+type intoDecoder struct {
+	packet []byte
+	size   int
+	limits decodeLimits
+	path   []intoSegment
+}
+
+// intoSegment is a part of the path to the decoding value. It is formatted
+// on error only.
+type intoSegment struct {
+	field string
+	index int
+	key   reflect.Value
+}
+
+func (s intoSegment) String() string {
+	switch {
+	case s.field != "":
+		return "." + s.field
+	case s.key.IsValid():
+		return fmt.Sprintf("[%v]", s.key.Interface())
+	}
+	return fmt.Sprintf("[%d]", s.index)
+}
+
+func (d *intoDecoder) offset() int {
+	return d.size - len(d.packet)
+}
+
+func (d *intoDecoder) fail(offset int, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	path := make([]string, len(d.path))
+	for i := range d.path {
+		path[i] = d.path[i].String()
+	}
+	return &DecodeError{
+		Offset: offset,
+		Path:   strings.Join(path, ""),
+		Err:    err,
+	}
+}
+
+func (d *intoDecoder) mismatch(offset int, t byte, dest reflect.Type) error {
+	return d.fail(offset, fmt.Errorf("can't decode %s into %s", termTypeName(t), dest))
+}
+
+func (d *intoDecoder) push(segment intoSegment) error {
+	d.path = append(d.path, segment)
+	return d.limits.push()
+}
+
+func (d *intoDecoder) pop() {
+	d.path = d.path[:len(d.path)-1]
+	d.limits.depth--
+}
+
+func (d *intoDecoder) read(n int) ([]byte, error) {
+	if len(d.packet) < n {
+		return nil, errMalformed
+	}
+	b := d.packet[:n]
+	d.packet = d.packet[n:]
+	return b, nil
+}
+
+// term decodes the next term using Decode. The limits are shared with
+// the whole packet decoding.
+func (d *intoDecoder) term() (Term, error) {
+	offset := d.offset()
+	term, rest, err := decode(d.packet, []Atom{}, &d.limits)
+	if err != nil {
+		if e, ok := err.(*DecodeError); ok {
+			return nil, d.fail(offset+e.Offset, e.Err)
+		}
+		return nil, d.fail(offset, err)
+	}
+	d.packet = rest
+	return term, nil
+}
+
+// fallback decodes the term and puts it into dest using TermIntoStruct
+func (d *intoDecoder) fallback(dest reflect.Value) error {
+	offset := d.offset()
+	term, err := d.term()
+	if err != nil {
+		return err
+	}
+	if err := termIntoStructSafe(term, dest); err != nil {
+		return d.fail(offset, err)
+	}
+	return nil
+}
+
+func termIntoStructSafe(term Term, dest reflect.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return termIntoStruct(term, dest)
+}
+
+func (d *intoDecoder) decode(dest reflect.Value) error {
+	offset := d.offset()
+	if len(d.packet) == 0 {
+		return d.fail(offset, errMalformed)
+	}
+	t := d.packet[0]
+
+	typ := dest.Type()
+	if dest.Kind() == reflect.Interface || termTypes[typ] {
+		return d.fallback(dest)
+	}
+	if pt := reflect.PtrTo(typ); pt.Implements(termUnmarshalerType) || pt.Implements(unmarshalerType) {
+		return d.fallback(dest)
+	}
+
+	switch dest.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(typ.Elem())
+		if err := d.decode(v.Elem()); err != nil {
+			return err
+		}
+		dest.Set(v)
+		return nil
+
+	case reflect.Bool:
+		atom, ok, err := d.atom()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if !ok || (atom != "true" && atom != "false") {
+			return d.mismatch(offset, t, typ)
+		}
+		dest.SetBool(atom == "true")
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		mag, negative, ok, err := d.integer()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if !ok {
+			return d.mismatch(offset, t, typ)
+		}
+		var i int64
+		switch {
+		case negative && mag <= 1<<63:
+			i = int64(^mag + 1)
+		case negative == false && mag <= math.MaxInt64:
+			i = int64(mag)
+		default:
+			return d.fail(offset, fmt.Errorf("%w: value overflows %s", ErrIntegerOverflow, typ))
+		}
+		if dest.OverflowInt(i) {
+			return d.fail(offset, fmt.Errorf("%w: %d overflows %s", ErrIntegerOverflow, i, typ))
+		}
+		dest.SetInt(i)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		mag, negative, ok, err := d.integer()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if !ok {
+			return d.mismatch(offset, t, typ)
+		}
+		if negative && mag > 0 {
+			return d.fail(offset, fmt.Errorf("%w: negative value for %s", ErrIntegerOverflow, typ))
+		}
+		if dest.OverflowUint(mag) {
+			return d.fail(offset, fmt.Errorf("%w: %d overflows %s", ErrIntegerOverflow, mag, typ))
+		}
+		dest.SetUint(mag)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		switch t {
+		case ettNewFloat:
+			b, err := d.read(9)
+			if err != nil {
+				return d.fail(offset, errMalformedNewFloat)
+			}
+			dest.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(b[1:])))
+			return nil
+		case ettFloat:
+			return d.fallback(dest)
+		}
+		return d.mismatch(offset, t, typ)
+
+	case reflect.String:
+		switch t {
+		case ettString, ettBinary:
+			b, err := d.bytes()
+			if err != nil {
+				return d.fail(offset, err)
+			}
+			dest.SetString(string(b))
+			return nil
+		case ettNil:
+			d.packet = d.packet[1:]
+			dest.SetString("")
+			return nil
+		case ettList:
+			// charlist
+			return d.fallback(dest)
+		}
+		atom, ok, err := d.atom()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if !ok {
+			return d.mismatch(offset, t, typ)
+		}
+		dest.SetString(atom)
+		return nil
+
+	case reflect.Slice:
+		switch t {
+		case ettBinary, ettString:
+			if typ.Elem().Kind() != reflect.Uint8 {
+				break
+			}
+			b, err := d.bytes()
+			if err != nil {
+				return d.fail(offset, err)
+			}
+			v := reflect.MakeSlice(typ, len(b), len(b))
+			reflect.Copy(v, reflect.ValueOf(b))
+			dest.Set(v)
+			return nil
+		case ettNil:
+			d.packet = d.packet[1:]
+			dest.Set(reflect.MakeSlice(typ, 0, 0))
+			return nil
+		case ettList:
+			n, err := d.listHeader()
+			if err != nil {
+				return d.fail(offset, err)
+			}
+			v := reflect.MakeSlice(typ, n, n)
+			if err := d.elements(v, n); err != nil {
+				return err
+			}
+			if err := d.tail(); err != nil {
+				return err
+			}
+			dest.Set(v)
+			return nil
+		}
+		return d.mismatch(offset, t, typ)
+
+	case reflect.Array:
+		switch t {
+		case ettBinary:
+			if typ.Elem().Kind() != reflect.Uint8 {
+				break
+			}
+			b, err := d.bytes()
+			if err != nil {
+				return d.fail(offset, err)
+			}
+			if len(b) != typ.Len() {
+				return d.fail(offset, fmt.Errorf("binary of %d bytes for %s", len(b), typ))
+			}
+			reflect.Copy(dest, reflect.ValueOf(b))
+			return nil
+		case ettNil:
+			if typ.Len() != 0 {
+				break
+			}
+			d.packet = d.packet[1:]
+			return nil
+		case ettList:
+			n, err := d.listHeader()
+			if err != nil {
+				return d.fail(offset, err)
+			}
+			if n != typ.Len() {
+				return d.fail(offset, fmt.Errorf("list of %d elements for %s", n, typ))
+			}
+			if err := d.elements(dest, n); err != nil {
+				return err
+			}
+			return d.tail()
+		}
+		return d.mismatch(offset, t, typ)
+
+	case reflect.Map:
+		if t != ettMap {
+			return d.mismatch(offset, t, typ)
+		}
+		n, err := d.mapHeader()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.MakeMapWithSize(typ, n))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(typ.Key()).Elem()
+			if err := d.push(intoSegment{field: "{key}"}); err != nil {
+				return d.fail(d.offset(), err)
+			}
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			d.pop()
+
+			value := reflect.New(typ.Elem()).Elem()
+			if err := d.push(intoSegment{key: key}); err != nil {
+				return d.fail(d.offset(), err)
+			}
+			if err := d.decode(value); err != nil {
+				return err
+			}
+			d.pop()
+			dest.SetMapIndex(key, value)
+		}
+		return nil
+
+	case reflect.Struct:
+		switch t {
+		case ettMap:
+			if record, ok := recordOf(typ); ok {
+				return d.fail(offset, fmt.Errorf("can't decode map into the record %s", record.name))
+			}
+			return d.mapIntoStruct(dest)
+		case ettSmallTuple, ettLargeTuple:
+			return d.tupleIntoStruct(dest)
+		}
+		return d.mismatch(offset, t, typ)
+	}
+
+	return d.fallback(dest)
+}
+
+// elements decodes n elements of the list into the slice/array v
+func (d *intoDecoder) elements(v reflect.Value, n int) error {
+	for i := 0; i < n; i++ {
+		if err := d.push(intoSegment{index: i}); err != nil {
+			return d.fail(d.offset(), err)
+		}
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+		d.pop()
+	}
+	return nil
+}
+
+func (d *intoDecoder) tail() error {
+	offset := d.offset()
+	if len(d.packet) == 0 || d.packet[0] != ettNil {
+		return d.fail(offset, fmt.Errorf("improper list"))
+	}
+	d.packet = d.packet[1:]
+	return nil
+}
+
+func (d *intoDecoder) listHeader() (int, error) {
+	b, err := d.read(5)
+	if err != nil {
+		return 0, errMalformedList
+	}
+	n := binary.BigEndian.Uint32(b[1:])
+	if uint64(n)+1 > uint64(len(d.packet)) {
+		return 0, errMalformedList
+	}
+	if err := d.limits.allocate(int(n) + 1); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (d *intoDecoder) mapHeader() (int, error) {
+	b, err := d.read(5)
+	if err != nil {
+		return 0, errMalformedMap
+	}
+	n := binary.BigEndian.Uint32(b[1:])
+	if uint64(n)*2 > uint64(len(d.packet)) {
+		return 0, errMalformedMap
+	}
+	if err := d.limits.allocate(int(n) * 2); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (d *intoDecoder) tupleHeader() (int, error) {
+	var n int
+	switch d.packet[0] {
+	case ettSmallTuple:
+		b, err := d.read(2)
+		if err != nil {
+			return 0, errMalformedSmallTuple
+		}
+		n = int(b[1])
+	default:
+		b, err := d.read(5)
+		if err != nil {
+			return 0, errMalformedLargeTuple
+		}
+		n = int(binary.BigEndian.Uint32(b[1:]))
+	}
+	if n > len(d.packet) {
+		return 0, errMalformedLargeTuple
+	}
+	if err := d.limits.allocate(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (d *intoDecoder) mapIntoStruct(dest reflect.Value) error {
+	offset := d.offset()
+	n, err := d.mapHeader()
+	if err != nil {
+		return d.fail(offset, err)
+	}
+	fields := structFields(dest.Type())
+
+	for i := 0; i < n; i++ {
+		name, err := d.key()
+		if err != nil {
+			return err
+		}
+		index := findStructField(fields, name)
+		if index == -1 || dest.Field(index).CanSet() == false {
+			// unknown field
+			if _, err := d.term(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.field(dest, fields[index], index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *intoDecoder) tupleIntoStruct(dest reflect.Value) error {
+	offset := d.offset()
+	n, err := d.tupleHeader()
+	if err != nil {
+		return d.fail(offset, err)
+	}
+	typ := dest.Type()
+
+	if record, ok := recordOf(typ); ok {
+		atom, isAtom, err := d.atom()
+		if err != nil {
+			return d.fail(offset, err)
+		}
+		if !isAtom || Atom(atom) != record.name {
+			return d.fail(offset, ErrRecordName)
+		}
+		if n-1 != len(record.fields) {
+			return d.fail(offset, ErrRecordArity)
+		}
+		for _, i := range record.fields {
+			if err := d.field(dest, typ.Field(i), i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if n > typ.NumField() {
+		return d.fail(offset, fmt.Errorf("tuple of %d elements for %s", n, typ))
+	}
+
+	for i := 0; i < n; i++ {
+		if dest.Field(i).CanSet() == false {
+			if _, err := d.term(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.field(dest, typ.Field(i), i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key reads the key of the map decoding into a struct
+func (d *intoDecoder) key() (string, error) {
+	offset := d.offset()
+	if len(d.packet) == 0 {
+		return "", d.fail(offset, errMalformed)
+	}
+	switch d.packet[0] {
+	case ettString, ettBinary:
+		b, err := d.bytes()
+		if err != nil {
+			return "", d.fail(offset, err)
+		}
+		return string(b), nil
+	}
+	atom, ok, err := d.atom()
+	if err != nil {
+		return "", d.fail(offset, err)
+	}
+	if ok {
+		return atom, nil
+	}
+	key, err := d.term()
+	if err != nil {
+		return "", err
+	}
+	name, ok := TermToString(key)
+	if !ok {
+		return "", d.fail(offset, &InvalidStructKeyError{Term: key})
+	}
+	return name, nil
+}
+
+func structFields(typ reflect.Type) []reflect.StructField {
+	if fields, ok := intoFields.Load(typ); ok {
+		return fields.([]reflect.StructField)
+	}
+	fields := make([]reflect.StructField, typ.NumField())
+	for i := range fields {
+		fields[i] = typ.Field(i)
+	}
+	intoFields.Store(typ, fields)
+	return fields
+}
+
+func (d *intoDecoder) field(dest reflect.Value, field reflect.StructField, index int) error {
+	name := field.Name
+	if tag := field.Tag.Get("etf"); tag != "" {
+		name = tag
+	}
+	if err := d.push(intoSegment{field: name}); err != nil {
+		return d.fail(d.offset(), err)
+	}
+	if err := d.decode(dest.Field(index)); err != nil {
+		return err
+	}
+	d.pop()
+	return nil
+}
+
+// atom reads the atom. Returns false if the next term is not an atom.
+func (d *intoDecoder) atom() (string, bool, error) {
+	var n int
+	switch d.packet[0] {
+	case ettAtom, ettAtomUTF8:
+		if len(d.packet) < 3 {
+			return "", false, errMalformedAtomUTF8
+		}
+		n = int(binary.BigEndian.Uint16(d.packet[1:3]))
+		d.packet = d.packet[3:]
+	case ettSmallAtom, ettSmallAtomUTF8:
+		if len(d.packet) < 2 {
+			return "", false, errMalformedSmallAtomUTF8
+		}
+		n = int(d.packet[1])
+		d.packet = d.packet[2:]
+	default:
+		return "", false, nil
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return "", false, errMalformedAtomUTF8
+	}
+	atom := string(b)
+	if atom != "true" && atom != "false" {
+		if err := d.limits.atom(Atom(atom)); err != nil {
+			return "", false, err
+		}
+	}
+	return atom, true, nil
+}
+
+// integer reads the integer returning its magnitude and sign. Returns false
+// if the next term is not an integer.
+func (d *intoDecoder) integer() (uint64, bool, bool, error) {
+	switch d.packet[0] {
+	case ettSmallInteger:
+		b, err := d.read(2)
+		if err != nil {
+			return 0, false, false, errMalformedSmallInteger
+		}
+		return uint64(b[1]), false, true, nil
+	case ettInteger:
+		b, err := d.read(5)
+		if err != nil {
+			return 0, false, false, errMalformedInteger
+		}
+		i := int64(int32(binary.BigEndian.Uint32(b[1:])))
+		if i < 0 {
+			return uint64(-i), true, true, nil
+		}
+		return uint64(i), false, true, nil
+	case ettSmallBig, ettLargeBig:
+		var n int
+		var negative bool
+		if d.packet[0] == ettSmallBig {
+			b, err := d.read(3)
+			if err != nil {
+				return 0, false, false, errMalformedSmallBig
+			}
+			n, negative = int(b[1]), b[2] == 1
+		} else {
+			b, err := d.read(6)
+			if err != nil {
+				return 0, false, false, errMalformedLargeBig
+			}
+			n, negative = int(binary.BigEndian.Uint32(b[1:5])), b[5] == 1
+		}
+		b, err := d.read(n)
+		if err != nil {
+			return 0, false, false, errMalformedSmallBig
+		}
+		var mag uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			if i >= 8 && b[i] != 0 {
+				return 0, false, false, fmt.Errorf("%w: value overflows 64 bits", ErrIntegerOverflow)
+			}
+			mag = mag<<8 | uint64(b[i])
+		}
+		return mag, negative, true, nil
+	}
+	return 0, false, false, nil
+}
+
+// bytes reads the data of ettBinary or ettString
+func (d *intoDecoder) bytes() ([]byte, error) {
+	if d.packet[0] == ettString {
+		if len(d.packet) < 3 {
+			return nil, errMalformedString
+		}
+		n := int(binary.BigEndian.Uint16(d.packet[1:3]))
+		d.packet = d.packet[3:]
+		b, err := d.read(n)
+		if err != nil {
+			return nil, errMalformedString
+		}
+		return b, nil
+	}
+	if len(d.packet) < 5 {
+		return nil, errMalformedBinary
+	}
+	n := binary.BigEndian.Uint32(d.packet[1:5])
+	if uint64(n)+5 > uint64(len(d.packet)) {
+		return nil, errMalformedBinary
+	}
+	if err := d.limits.binary(int(n)); err != nil {
+		return nil, err
+	}
+	d.packet = d.packet[5:]
+	b, _ := d.read(int(n))
+	return b, nil
+}
+
+func termTypeName(t byte) string {
+	switch t {
+	case ettAtom, ettAtomUTF8, ettSmallAtom, ettSmallAtomUTF8, ettCacheRef:
+		return "atom"
+	case ettString:
+		return "string"
+	case ettNewFloat, ettFloat:
+		return "float"
+	case ettSmallInteger, ettInteger, ettSmallBig, ettLargeBig:
+		return "integer"
+	case ettList, ettNil:
+		return "list"
+	case ettSmallTuple, ettLargeTuple:
+		return "tuple"
+	case ettMap:
+		return "map"
+	case ettBinary:
+		return "binary"
+	case ettBitBinary:
+		return "bitstring"
+	case ettPid, ettNewPid:
+		return "pid"
+	case ettNewRef, ettNewerRef:
+		return "reference"
+	case ettPort, ettNewPort:
+		return "port"
+	case ettExport, ettNewFun:
+		return "fun"
+	}
+	return fmt.Sprintf("unknown type %d", t)
+}
@@ -0,0 +1,278 @@
+package etf
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+func encodeInto(t *testing.T, term Term) []byte {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	if err := Encode(term, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	packet := make([]byte, b.Len())
+	copy(packet, b.B)
+	return packet
+}
+
+func TestDecodeInto(t *testing.T) {
+	type user struct {
+		Name  string   `etf:"name"`
+		Age   uint8    `etf:"age"`
+		Admin bool     `etf:"admin"`
+		Tags  []string `etf:"tags"`
+		Score float64
+		Extra Term
+		Raw   []byte
+	}
+	type group struct {
+		ID     int64           `etf:"id"`
+		Users  []user          `etf:"users"`
+		Owner  *user           `etf:"owner"`
+		Limits map[string]int  `etf:"limits"`
+		Pair   [2]int          `etf:"pair"`
+		Flags  map[Atom]bool   `etf:"flags"`
+		Nested map[int][]int16 `etf:"nested"`
+	}
+
+	term := Map{
+		Atom("id"): int64(-1 << 40),
+		Atom("users"): List{
+			Map{Atom("name"): "Alice", Atom("age"): 30, Atom("admin"): true,
+				Atom("tags"):  List{Atom("a"), "b", []byte("c")},
+				Atom("Score"): 1.5, Atom("extra"): Tuple{Atom("x"), 1},
+				Atom("raw"): []byte{1, 2, 3}, Atom("unknown"): List{1, 2}},
+			Map{Atom("name"): []byte("Bob"), Atom("age"): 255, Atom("admin"): false},
+		},
+		Atom("owner"):  Map{Atom("name"): Atom("root")},
+		Atom("limits"): Map{"cpu": 4, "mem": 1 << 30},
+		Atom("pair"):   List{1, 2},
+		Atom("flags"):  Map{Atom("on"): true},
+		Atom("nested"): Map{1: List{-1, 2}},
+	}
+
+	var result group
+	if err := DecodeInto(encodeInto(t, term), &result, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := group{
+		ID: -1 << 40,
+		Users: []user{
+			{Name: "Alice", Age: 30, Admin: true, Tags: []string{"a", "b", "c"},
+				Score: 1.5, Extra: Tuple{Atom("x"), 1}, Raw: []byte{1, 2, 3}},
+			{Name: "Bob", Age: 255},
+		},
+		Owner:  &user{Name: "root"},
+		Limits: map[string]int{"cpu": 4, "mem": 1 << 30},
+		Pair:   [2]int{1, 2},
+		Flags:  map[Atom]bool{"on": true},
+		Nested: map[int][]int16{1: {-1, 2}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("got %#v\nexp %#v", result, expected)
+	}
+
+	// the same result as TermIntoStruct has
+	var result1 group
+	if err := TermIntoStruct(term, &result1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, result1) {
+		t.Fatalf("got %#v\nexp %#v", result, result1)
+	}
+
+	// tuple into struct
+	type point struct {
+		X, Y int
+	}
+	var p point
+	if err := DecodeInto(encodeInto(t, Tuple{1, -2}), &p, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if p != (point{1, -2}) {
+		t.Fatal("wrong result", p)
+	}
+
+	// interface
+	var any interface{}
+	if err := DecodeInto(encodeInto(t, List{Atom("a"), 1}), &any, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(any, List{Atom("a"), 1}) {
+		t.Fatal("wrong result", any)
+	}
+
+	// records
+	type recUser struct {
+		Record `etf:"user"`
+		Name   string
+		Age    int
+	}
+	var r recUser
+	if err := DecodeInto(encodeInto(t, Tuple{Atom("user"), "Alice", 30}), &r, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "Alice" || r.Age != 30 {
+		t.Fatal("wrong result", r)
+	}
+	err := DecodeInto(encodeInto(t, Tuple{Atom("group"), "Alice", 30}), &r, DecodeOptions{})
+	if errors.Is(err, ErrRecordName) == false {
+		t.Fatal("expected", ErrRecordName, "got", err)
+	}
+	err = DecodeInto(encodeInto(t, Tuple{Atom("user"), "Alice"}), &r, DecodeOptions{})
+	if errors.Is(err, ErrRecordArity) == false {
+		t.Fatal("expected", ErrRecordArity, "got", err)
+	}
+
+	// unexported fields of the record are skipped
+	type recPrivate struct {
+		Record `etf:"user"`
+		Name   string
+		note   string
+		Age    int
+	}
+	var rp recPrivate
+	if err := DecodeInto(encodeInto(t, Tuple{Atom("user"), "Alice", 30}), &rp, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if rp.Name != "Alice" || rp.Age != 30 || rp.note != "" {
+		t.Fatal("wrong result", rp)
+	}
+}
+
+func TestDecodeIntoErrors(t *testing.T) {
+	type user struct {
+		Name string `etf:"name"`
+		Age  int8   `etf:"age"`
+	}
+	type group struct {
+		Users []user `etf:"users"`
+	}
+
+	users := func(last Term) List {
+		l := List{}
+		for i := 0; i < 3; i++ {
+			l = append(l, Map{Atom("name"): "a"})
+		}
+		return append(l, last)
+	}
+
+	cases := []struct {
+		name string
+		term Term
+		path string
+	}{
+		{"mismatch", users(Map{Atom("name"): 1}), ".users[3].name"},
+		{"overflow", users(Map{Atom("age"): 128}), ".users[3].age"},
+		{"list", Map{Atom("users"): Atom("none")}, ".users"},
+		{"element", List{1}, ".users[0]"},
+	}
+
+	for _, c := range cases {
+		term := c.term
+		if c.name != "list" {
+			term = Map{Atom("users"): c.term}
+		}
+		var result group
+		err := DecodeInto(encodeInto(t, term), &result, DecodeOptions{})
+		var e *DecodeError
+		if errors.As(err, &e) == false {
+			t.Fatalf("%s: expected DecodeError, got %v", c.name, err)
+		}
+		if e.Path != c.path {
+			t.Fatalf("%s: expected path %q, got %q (%s)", c.name, c.path, e.Path, err)
+		}
+		if strings.Contains(err.Error(), c.path) == false {
+			t.Fatalf("%s: no path in %q", c.name, err)
+		}
+	}
+
+	// limits
+	var list []int
+	packet := encodeInto(t, List{1, 2, 3})
+	err := DecodeInto(packet, &list, DecodeOptions{MaxAllocations: 2})
+	if errors.Is(err, ErrMaxAllocations) == false {
+		t.Fatal("expected", ErrMaxAllocations, "got", err)
+	}
+	var nested [][]int
+	err = DecodeInto(encodeInto(t, List{List{1}}), &nested, DecodeOptions{MaxDepth: 1})
+	if errors.Is(err, ErrMaxDepth) == false {
+		t.Fatal("expected", ErrMaxDepth, "got", err)
+	}
+	// the limits are shared with the terms decoded into interface{}/etf.Term
+	var terms []Term
+	nested3 := encodeInto(t, List{List{1, 2, 3}, List{4, 5, 6}, List{7, 8, 9}})
+	if err := DecodeInto(nested3, &terms, DecodeOptions{MaxAllocations: 16}); err != nil {
+		t.Fatal(err)
+	}
+	err = DecodeInto(nested3, &terms, DecodeOptions{MaxAllocations: 8})
+	if errors.Is(err, ErrMaxAllocations) == false {
+		t.Fatal("expected", ErrMaxAllocations, "got", err)
+	}
+	err = DecodeInto(encodeInto(t, List{Atom("a"), Atom("b"), Atom("c")}), &terms, DecodeOptions{MaxAtoms: 2})
+	if errors.Is(err, ErrMaxAtoms) == false {
+		t.Fatal("expected", ErrMaxAtoms, "got", err)
+	}
+	nested1 := encodeInto(t, List{List{1}, List{2}, List{3}, List{4}})
+	if err := DecodeInto(nested1, &terms, DecodeOptions{MaxDepth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	err = DecodeInto(encodeInto(t, Atom("unknown_atom_into")), &s, DecodeOptions{Safe: true})
+	if errors.Is(err, ErrUnknownAtom) == false {
+		t.Fatal("expected", ErrUnknownAtom, "got", err)
+	}
+
+	// trailing data and malformed packets
+	if err := DecodeInto(append(packet, 1), &list, DecodeOptions{}); errors.Is(err, errPacketTrailer) == false {
+		t.Fatal("expected", errPacketTrailer, "got", err)
+	}
+	for i := 0; i < len(packet); i++ {
+		if err := DecodeInto(packet[:i], &list, DecodeOptions{}); err == nil {
+			t.Fatal("expected error on truncated packet", i)
+		}
+	}
+	if err := DecodeInto(packet, list, DecodeOptions{}); err == nil {
+		t.Fatal("expected error on non-pointer dest")
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	type user struct {
+		Name string `etf:"name"`
+		Age  int    `etf:"age"`
+	}
+	users := List{}
+	for i := 0; i < 100; i++ {
+		users = append(users, Map{Atom("name"): "Alice", Atom("age"): i})
+	}
+	buf := lib.TakeBuffer()
+	Encode(users, buf, EncodeOptions{})
+	packet := buf.B
+
+	b.Run("DecodeInto", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var result []user
+			if err := DecodeInto(packet, &result, DecodeOptions{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Decode+TermIntoStruct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var result []user
+			term, _, err := Decode(packet, []Atom{}, DecodeOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := TermIntoStruct(term, &result); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
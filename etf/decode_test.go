@@ -1,9 +1,13 @@
 package etf
 
 import (
+	"errors"
+	"math"
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ergo-services/ergo/lib"
 )
 
 func TestDecodeAtom(t *testing.T) {
@@ -22,13 +26,13 @@ func TestDecodeAtom(t *testing.T) {
 
 	packet = []byte{ettSmallAtomUTF8, 4, 97, 98, 99}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedSmallAtomUTF8 {
+	if errors.Is(err, errMalformedSmallAtomUTF8) == false {
 		t.Fatal(err)
 	}
 
 	packet = []byte{119}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedSmallAtomUTF8 {
+	if errors.Is(err, errMalformedSmallAtomUTF8) == false {
 		t.Fatal(err)
 	}
 
@@ -44,7 +48,7 @@ func TestDecodeString(t *testing.T) {
 
 	packet = []byte{ettString, 3, 97, 98, 99}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedString {
+	if errors.Is(err, errMalformedString) == false {
 		t.Fatal(err)
 	}
 }
@@ -59,7 +63,7 @@ func TestDecodeNewFloat(t *testing.T) {
 
 	packet = []byte{ettNewFloat, 64, 0, 204, 204, 204, 204, 204}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedNewFloat {
+	if errors.Is(err, errMalformedNewFloat) == false {
 		t.Fatal(err)
 	}
 }
@@ -75,7 +79,7 @@ func TestDecodeInteger(t *testing.T) {
 
 	packet = []byte{ettSmallInteger}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedSmallInteger {
+	if errors.Is(err, errMalformedSmallInteger) == false {
 		t.Fatal(err)
 	}
 
@@ -88,7 +92,7 @@ func TestDecodeInteger(t *testing.T) {
 
 	packet = []byte{ettInteger, 182, 105, 253}
 	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
-	if err != errMalformedInteger {
+	if errors.Is(err, errMalformedInteger) == false {
 		t.Fatal(err)
 	}
 
@@ -96,10 +100,15 @@ func TestDecodeInteger(t *testing.T) {
 	bigInt := new(big.Int)
 	bigInt.SetString("-1234567890987654321", 10)
 	packet = []byte{ettSmallBig, 8, 1, 177, 28, 108, 177, 244, 16, 34, 17}
-	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
+	term, _, err = Decode(packet, []Atom{}, DecodeOptions{BigInt: BigIntAlways})
 	if err != nil || bigInt.Cmp(term.(*big.Int)) != 0 {
 		t.Fatal(err, term, bigInt)
 	}
+	// fits int64
+	term, _, err = Decode(packet, []Atom{}, DecodeOptions{})
+	if err != nil || term != bigInt.Int64() {
+		t.Fatal(err, term, bigInt)
+	}
 
 	largeBigString := "-12345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890987654321012345678909876543210123456789098765432101234567890"
 
@@ -146,6 +155,57 @@ func TestDecodeInteger(t *testing.T) {
 	}
 }
 
+func TestDecodeBigIntMode(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	maxUint64 := new(big.Int).SetUint64(math.MaxUint64)
+	int128, _ := new(big.Int).SetString("170141183460469231731687303715884105727", 10)
+
+	cases := []struct {
+		value Term
+		mode  BigIntMode
+		exp   Term
+	}{
+		{int64(math.MaxInt64), BigIntDefault, int64(math.MaxInt64)},
+		{int64(math.MinInt64), BigIntDefault, int64(math.MinInt64)},
+		{int64(1 << 40), BigIntAlways, big.NewInt(1 << 40)},
+		{uint64(math.MaxUint64), BigIntDefault, maxUint64},
+		{uint64(math.MaxUint64), BigIntUint64, uint64(math.MaxUint64)},
+		{uint64(math.MaxUint64), BigIntAlways, maxUint64},
+		{uint(math.MaxUint64), BigIntUint64, uint64(math.MaxUint64)},
+		{int128, BigIntUint64, int128},
+		{new(big.Int).Neg(int128), BigIntDefault, new(big.Int).Neg(int128)},
+		// small integers are not affected
+		{1, BigIntAlways, 1},
+	}
+
+	for _, c := range cases {
+		b.Reset()
+		if err := Encode(c.value, b, EncodeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		packet := append([]byte{}, b.B...)
+		term, _, err := Decode(b.B, []Atom{}, DecodeOptions{BigInt: c.mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(term, c.exp) {
+			t.Fatalf("%v (mode %d): got %#v, exp %#v", c.value, c.mode, term, c.exp)
+		}
+		// the packet must not be modified
+		if !reflect.DeepEqual(packet, b.B) {
+			t.Fatal("packet has been modified")
+		}
+	}
+
+	// truncated SMALL_BIG_EXT
+	packet := []byte{ettSmallBig, 4, 0, 1, 2}
+	if _, _, err := Decode(packet, []Atom{}, DecodeOptions{}); errors.Is(err, errMalformedSmallBig) == false {
+		t.Fatal("expected", errMalformedSmallBig, "got", err)
+	}
+}
+
 func TestDecodeList(t *testing.T) {
 	expected := List{3.14, Atom("abc"), int64(987654321)}
 	packet := []byte{ettList, 0, 0, 0, 3, 70, 64, 9, 30, 184, 81, 235, 133, 31, 100, 0, 3, 97,
@@ -229,7 +289,8 @@ func TestDecodeBinary(t *testing.T) {
 }
 
 func TestDecodeBitBinary(t *testing.T) {
-	expected := []byte{1, 2, 3, 4, 5}
+	// <<1,2,3,4,5:3>>
+	expected := BitString{Bytes: []byte{1, 2, 3, 4, 160}, Bits: 3}
 	packet := []byte{77, 0, 0, 0, 5, 3, 1, 2, 3, 4, 160}
 
 	term, _, err := Decode(packet, []Atom{}, DecodeOptions{})
@@ -237,11 +298,24 @@ func TestDecodeBitBinary(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := term.([]byte)
+	result := term.(BitString)
 	if !reflect.DeepEqual(expected, result) {
 		t.Fatal("result != expected")
 	}
+	if result.Len() != 35 {
+		t.Fatal("wrong length", result.Len())
+	}
 
+	malformed := [][]byte{
+		{77, 0, 0, 0, 5, 3, 1, 2, 3, 4},
+		{77, 0, 0, 0, 1, 9, 1},
+		{77, 0, 0, 0, 1, 0, 1},
+	}
+	for _, packet := range malformed {
+		if _, _, err := Decode(packet, []Atom{}, DecodeOptions{}); errors.Is(err, errMalformedBitBinary) == false {
+			t.Fatal("expected", errMalformedBitBinary, "got", err)
+		}
+	}
 }
 
 func TestDecodePid(t *testing.T) {
@@ -473,6 +547,91 @@ func TestDecodeFunction(t *testing.T) {
 
 }
 
+func TestDecodeLimits(t *testing.T) {
+	// [[[[]]]]
+	nested := []byte{ettList, 0, 0, 0, 1, ettList, 0, 0, 0, 1, ettList, 0, 0, 0, 1, ettNil, ettNil, ettNil, ettNil}
+	if _, _, err := Decode(nested, []Atom{}, DecodeOptions{MaxDepth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := Decode(nested, []Atom{}, DecodeOptions{MaxDepth: 2})
+	if errors.Is(err, ErrMaxDepth) == false {
+		t.Fatal("expected ErrMaxDepth, got", err)
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) == false || decodeErr.Offset != 10 {
+		t.Fatal("wrong offset", err)
+	}
+
+	// {1,2,3}
+	tuple := []byte{ettSmallTuple, 3, ettSmallInteger, 1, ettSmallInteger, 2, ettSmallInteger, 3}
+	if _, _, err := Decode(tuple, []Atom{}, DecodeOptions{MaxAllocations: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(tuple, []Atom{}, DecodeOptions{MaxAllocations: 2}); errors.Is(err, ErrMaxAllocations) == false {
+		t.Fatal("expected ErrMaxAllocations, got", err)
+	}
+
+	// huge declared length must be rejected before the allocation
+	huge := []byte{ettLargeTuple, 0xff, 0xff, 0xff, 0xff, ettNil}
+	if _, _, err := Decode(huge, []Atom{}, DecodeOptions{}); errors.Is(err, errMalformedLargeTuple) == false {
+		t.Fatal("expected errMalformedLargeTuple, got", err)
+	}
+	huge = []byte{ettList, 0xff, 0xff, 0xff, 0xff, ettNil}
+	if _, _, err := Decode(huge, []Atom{}, DecodeOptions{}); errors.Is(err, errMalformedList) == false {
+		t.Fatal("expected errMalformedList, got", err)
+	}
+
+	binary := []byte{ettBinary, 0, 0, 0, 3, 1, 2, 3}
+	if _, _, err := Decode(binary, []Atom{}, DecodeOptions{MaxBinarySize: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(binary, []Atom{}, DecodeOptions{MaxBinarySize: 2}); errors.Is(err, ErrMaxBinarySize) == false {
+		t.Fatal("expected ErrMaxBinarySize, got", err)
+	}
+
+	// [a,b,a]
+	atoms := []byte{ettList, 0, 0, 0, 3, ettSmallAtomUTF8, 1, 'a', ettSmallAtomUTF8, 1, 'b', ettSmallAtomUTF8, 1, 'a', ettNil}
+	if _, _, err := Decode(atoms, []Atom{}, DecodeOptions{MaxAtoms: 2}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Decode(atoms, []Atom{}, DecodeOptions{MaxAtoms: 1})
+	if errors.Is(err, ErrMaxAtoms) == false {
+		t.Fatal("expected ErrMaxAtoms, got", err)
+	}
+	if errors.As(err, &decodeErr) == false || decodeErr.Offset != 8 {
+		t.Fatal("wrong offset", err)
+	}
+}
+
+func TestDecodeSafe(t *testing.T) {
+	// {ok, testDecodeSafe}
+	packet := []byte{ettSmallTuple, 2, ettSmallAtomUTF8, 2, 'o', 'k', ettAtomUTF8, 0, 14,
+		't', 'e', 's', 't', 'D', 'e', 'c', 'o', 'd', 'e', 'S', 'a', 'f', 'e'}
+	if _, _, err := Decode(packet, []Atom{}, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := Decode(packet, []Atom{}, DecodeOptions{Safe: true})
+	if errors.Is(err, ErrUnknownAtom) == false {
+		t.Fatal("expected ErrUnknownAtom, got", err)
+	}
+
+	RegisterAtom("testDecodeSafe")
+	term, _, err := Decode(packet, []Atom{}, DecodeOptions{Safe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Tuple{Atom("ok"), Atom("testDecodeSafe")}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+
+	// atoms of the cache are known
+	packet = []byte{ettCacheRef, 0}
+	if _, _, err := Decode(packet, []Atom{"cached"}, DecodeOptions{Safe: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 //
 // benchmarks
 //
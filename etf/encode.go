@@ -17,6 +17,7 @@ var (
 	goSlice  = byte(240) // internal type
 	goMap    = byte(241) // internal type
 	goStruct = byte(242) // internal type
+	goRecord = byte(243) // internal type
 
 	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
 )
@@ -70,6 +71,11 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 		if stack != nil {
 
 			if stack.i == stack.children {
+				if stack.termType == ettNewFun {
+					// Size is the total number of bytes including the Size field
+					start := stack.tmp.(int)
+					binary.BigEndian.PutUint32(b.B[start:start+4], uint32(b.Len()-start))
+				}
 				if stack.parent == nil {
 					return nil
 				}
@@ -219,6 +225,35 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 				}
 				term = key
 
+			case ettExport:
+				e := stack.term.(Export)
+				switch stack.i {
+				case 0:
+					term = e.Module
+				case 1:
+					term = e.Function
+				case 2:
+					if e.Arity < 0 || e.Arity > 255 {
+						return fmt.Errorf("wrong arity %d of the fun", e.Arity)
+					}
+					term = uint8(e.Arity)
+				}
+
+			case ettNewFun:
+				f := stack.term.(Function)
+				switch stack.i {
+				case 0:
+					term = f.Module
+				case 1:
+					term = int64(f.OldIndex)
+				case 2:
+					term = int64(f.OldUnique)
+				case 3:
+					term = f.Pid
+				default:
+					term = f.FreeVars[stack.i-4]
+				}
+
 			case goMap:
 				key := stack.tmp.([]reflect.Value)[stack.i/2]
 				if stack.i&0x01 == 0x01 { // a value
@@ -251,6 +286,14 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 				// a value
 				term = stack.term.(func(int) reflect.Value)(stack.i / 2).Interface()
 
+			case goRecord:
+				record := stack.tmp.(recordInfo)
+				if stack.i == 0 {
+					term = record.name
+					break
+				}
+				term = stack.term.(func(int) reflect.Value)(record.fields[stack.i-1]).Interface()
+
 			default:
 
 				return errInternal
@@ -351,7 +394,7 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			}
 
 			if t > math.MaxInt32 {
-				term = int64(t)
+				term = uint64(t)
 				goto recasting
 			}
 
@@ -619,6 +662,32 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			binary.BigEndian.PutUint16(buf[1:3], 3)
 			//}
 
+		case Export:
+			b.AppendByte(ettExport)
+			child = &stackElement{
+				parent:   stack,
+				termType: ettExport,
+				term:     t,
+				children: 3,
+			}
+
+		case Function:
+			start := b.Len()
+			// Size (4), Arity (1), Uniq (16), Index (4), NumFree (4)
+			buf := b.Extend(1 + 4 + 1 + 16 + 4 + 4)
+			buf[0] = ettNewFun
+			buf[5] = t.Arity
+			copy(buf[6:22], t.Unique[:])
+			binary.BigEndian.PutUint32(buf[22:26], t.Index)
+			binary.BigEndian.PutUint32(buf[26:30], uint32(len(t.FreeVars)))
+			child = &stackElement{
+				parent:   stack,
+				termType: ettNewFun,
+				term:     t,
+				children: 4 + len(t.FreeVars),
+				tmp:      start + 1,
+			}
+
 		case Map:
 			lenMap := len(t)
 			buf := b.Extend(5)
@@ -677,6 +746,29 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 			binary.BigEndian.PutUint32(buf[1:5], uint32(lenBinary))
 			copy(buf[5:], t)
 
+		case BitString:
+			lenBinary := len(t.Bytes)
+			if lenBinary == 0 || t.Bits == 0 || t.Bits >= 8 {
+				// whole bytes
+				buf := b.Extend(1 + 4 + lenBinary)
+				buf[0] = ettBinary
+				binary.BigEndian.PutUint32(buf[1:5], uint32(lenBinary))
+				copy(buf[5:], t.Bytes)
+				break
+			}
+			buf := b.Extend(1 + 4 + 1 + lenBinary)
+			buf[0] = ettBitBinary
+			binary.BigEndian.PutUint32(buf[1:5], uint32(lenBinary))
+			buf[5] = t.Bits
+			copy(buf[6:], t.Bytes)
+			// unused bits of the last byte must be zero
+			buf[len(buf)-1] &= byte(0xff << (8 - t.Bits))
+
+		case TermMarshaler:
+			if err := t.EncodeETF(b, options); err != nil {
+				return err
+			}
+
 		case Marshaler:
 			m, err := t.MarshalETF()
 			if err != nil {
@@ -694,6 +786,20 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 
 			switch v.Kind() {
 			case reflect.Struct:
+				if record, ok := recordOf(v.Type()); ok {
+					lenRecord := len(record.fields) + 1
+					EncodeTupleHeader(b, lenRecord)
+
+					child = &stackElement{
+						parent:   stack,
+						termType: goRecord,
+						term:     v.Field,
+						children: lenRecord,
+						tmp:      record,
+					}
+					break
+				}
+
 				lenStruct := v.NumField()
 				buf := b.Extend(5)
 				buf[0] = ettMap
@@ -760,3 +866,40 @@ func Encode(term Term, b *lib.Buffer, options EncodeOptions) (retErr error) {
 
 	}
 }
+
+// EncodeTupleHeader writes the header of the tuple with the given arity. Must be
+// followed by encoding of the tuple elements. Intended to be used by TermMarshaler
+// implementation.
+func EncodeTupleHeader(b *lib.Buffer, arity int) {
+	if arity < 256 {
+		b.Append([]byte{ettSmallTuple, byte(arity)})
+		return
+	}
+	buf := b.Extend(5)
+	buf[0] = ettLargeTuple
+	binary.BigEndian.PutUint32(buf[1:], uint32(arity))
+}
+
+// EncodeMapHeader writes the header of the map with the given number of pairs. Must be
+// followed by encoding of the keys and values. Intended to be used by TermMarshaler
+// implementation.
+func EncodeMapHeader(b *lib.Buffer, arity int) {
+	buf := b.Extend(5)
+	buf[0] = ettMap
+	binary.BigEndian.PutUint32(buf[1:], uint32(arity))
+}
+
+// EncodeListHeader writes the header of the list with the given length. Must be
+// followed by encoding of the list elements and EncodeNil as a tail. Use EncodeNil only
+// for the empty list. Intended to be used by TermMarshaler implementation.
+func EncodeListHeader(b *lib.Buffer, length int) {
+	buf := b.Extend(5)
+	buf[0] = ettList
+	binary.BigEndian.PutUint32(buf[1:], uint32(length))
+}
+
+// EncodeNil writes the empty list (or the tail of the proper list).
+// Intended to be used by TermMarshaler implementation.
+func EncodeNil(b *lib.Buffer) {
+	b.AppendByte(ettNil)
+}
@@ -2,6 +2,7 @@ package etf
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -322,6 +323,42 @@ func TestEncodeBinary(t *testing.T) {
 	}
 }
 
+func TestEncodeBitString(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	// <<1,2,3,4,5:3>>. unused bits of the last byte must be cleared
+	err := Encode(BitString{Bytes: []byte{1, 2, 3, 4, 175}, Bits: 3}, b, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{ettBitBinary, 0, 0, 0, 5, 3, 1, 2, 3, 4, 160}
+	if !reflect.DeepEqual(b.B, expected) {
+		t.Fatal("incorrect value")
+	}
+
+	// round trip
+	term, _, err := Decode(b.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(term, BitString{Bytes: []byte{1, 2, 3, 4, 160}, Bits: 3}) {
+		t.Fatal("incorrect value", term)
+	}
+
+	// whole bytes are encoded as a binary
+	b.Reset()
+	err = Encode(BitString{Bytes: []byte{1, 2, 3}, Bits: 8}, b, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []byte{ettBinary, 0, 0, 0, 3, 1, 2, 3}
+	if !reflect.DeepEqual(b.B, expected) {
+		t.Fatal("incorrect value")
+	}
+}
+
 func TestEncodeList(t *testing.T) {
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
@@ -933,6 +970,64 @@ func TestEncodeMarshal(t *testing.T) {
 	}
 }
 
+func TestEncodeFun(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	export := Export{Module: "lists", Function: "map", Arity: 2}
+	expected := []byte{ettExport,
+		ettSmallAtomUTF8, 5, 'l', 'i', 's', 't', 's',
+		ettSmallAtomUTF8, 3, 'm', 'a', 'p',
+		ettSmallInteger, 2}
+	if err := Encode(export, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.B, expected) {
+		t.Fatal("incorrect value", b.B)
+	}
+
+	fun := Function{
+		Arity:     1,
+		Unique:    [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		Index:     3,
+		Module:    "test",
+		OldIndex:  3,
+		OldUnique: 123456789,
+		Pid:       Pid{Node: "erl-demo@127.0.0.1", ID: 312, Creation: 2},
+		FreeVars:  []Term{Atom("a"), 1},
+	}
+	for _, term := range []Term{export, fun, Tuple{fun, List{fun, export}}} {
+		b.Reset()
+		if err := Encode(term, b, EncodeOptions{FlagBigCreation: true}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, rest, err := Decode(b.B, []Atom{}, DecodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rest) > 0 {
+			t.Fatal("trailing data", rest)
+		}
+		if !reflect.DeepEqual(decoded, term) {
+			t.Fatalf("got %#v\nexp %#v", decoded, term)
+		}
+	}
+
+	// Size of NEW_FUN_EXT includes itself
+	b.Reset()
+	if err := Encode(fun, b, EncodeOptions{FlagBigCreation: true}); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.BigEndian.Uint32(b.B[1:5]); int(size) != b.Len()-1 {
+		t.Fatal("wrong size", size, b.Len()-1)
+	}
+
+	export.Arity = 256
+	if err := Encode(export, b, EncodeOptions{}); err == nil {
+		t.Fatal("expected error on wrong arity")
+	}
+}
+
 func BenchmarkEncodeBool(b *testing.B) {
 
 	buf := lib.TakeBuffer()
@@ -3,8 +3,13 @@ package etf
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
+
+	"github.com/ergo-services/ergo/lib"
 )
 
 type Term interface{}
@@ -72,6 +77,41 @@ type Unmarshaler interface {
 	UnmarshalETF([]byte) error
 }
 
+// TermMarshaler interface implemented by types that can encode themselves as an ETF term
+// writing directly into the buffer. Unlike Marshaler, the result is not wrapped into
+// a binary. Use cmd/etfgen to generate implementation for your structs.
+type TermMarshaler interface {
+	EncodeETF(b *lib.Buffer, options EncodeOptions) error
+}
+
+// TermUnmarshaler interface implemented by types that can set themselves from the decoded
+// term. It is used by TermIntoStruct. Interface implementation must be over pointer to the object.
+// Use cmd/etfgen to generate implementation for your structs.
+type TermUnmarshaler interface {
+	DecodeETF(term Term) error
+}
+
+// BitString this type is intended to be used to interact with Erlang. It represents
+// a bitstring whose length in bits is not divisible by 8 (Erlang type: <<1:3>>).
+// Bytes keeps the data as it is in the Erlang External Term Format: the significant
+// bits of the last byte are the most significant ones. Bits is the number of
+// significant bits in the last byte (1..8). Zero value of Bits means all 8 bits are used.
+type BitString struct {
+	Bytes []byte
+	Bits  uint8
+}
+
+// Len returns the length of the bitstring in bits
+func (bs BitString) Len() int {
+	if len(bs.Bytes) == 0 {
+		return 0
+	}
+	if bs.Bits == 0 || bs.Bits > 8 {
+		return len(bs.Bytes) * 8
+	}
+	return (len(bs.Bytes)-1)*8 + int(bs.Bits)
+}
+
 type Function struct {
 	Arity  byte
 	Unique [16]byte
@@ -86,6 +126,10 @@ type Function struct {
 
 var (
 	hasher32 = fnv.New32a()
+
+	bigIntType = reflect.TypeOf(big.Int{})
+
+	ErrIntegerOverflow = fmt.Errorf("Integer overflow")
 )
 
 type Export struct {
@@ -215,6 +259,120 @@ func TermToString(t Term) (s string, ok bool) {
 	return
 }
 
+// TermToInt64 transforms given integer term to int64
+func TermToInt64(t Term) (int64, bool) {
+	switch v := t.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case *big.Int:
+		if v.IsInt64() {
+			return v.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+// TermToUint64 transforms given integer term to uint64
+func TermToUint64(t Term) (uint64, bool) {
+	switch v := t.(type) {
+	case uint:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case *big.Int:
+		if v.IsUint64() {
+			return v.Uint64(), true
+		}
+		return 0, false
+	}
+	i, ok := TermToInt64(t)
+	if i < 0 {
+		return 0, false
+	}
+	return uint64(i), ok
+}
+
+// TermToInt transforms given integer term to int64 checking whether the value
+// fits the integer type of the given bit size (0 means int) like strconv.ParseInt does
+func TermToInt(t Term, bitSize int) (int64, bool) {
+	i, ok := TermToInt64(t)
+	if !ok {
+		return 0, false
+	}
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	if bitSize < 64 && (i < -1<<(bitSize-1) || i > 1<<(bitSize-1)-1) {
+		return 0, false
+	}
+	return i, true
+}
+
+// TermToUint transforms given integer term to uint64 checking whether the value
+// fits the unsigned integer type of the given bit size (0 means uint) like strconv.ParseUint does
+func TermToUint(t Term, bitSize int) (uint64, bool) {
+	u, ok := TermToUint64(t)
+	if !ok {
+		return 0, false
+	}
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	if bitSize < 64 && u > 1<<bitSize-1 {
+		return 0, false
+	}
+	return u, true
+}
+
+// TermToBigInt transforms given integer term to *big.Int
+func TermToBigInt(t Term) (*big.Int, bool) {
+	switch v := t.(type) {
+	case *big.Int:
+		return new(big.Int).Set(v), true
+	case big.Int:
+		return new(big.Int).Set(&v), true
+	case uint, uint64:
+		u, _ := TermToUint64(v)
+		return new(big.Int).SetUint64(u), true
+	}
+	if i, ok := TermToInt64(t); ok {
+		return big.NewInt(i), true
+	}
+	return nil, false
+}
+
+func isInteger(t Term) bool {
+	switch t.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, *big.Int:
+		return true
+	}
+	return false
+}
+
 // ProplistIntoStruct transorms given term into the provided struct 'dest'.
 // Proplist is the list of Tuple values with two items { Name , Value },
 // where Name can be string or Atom and Value must be the same type as
@@ -256,6 +414,10 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		if v.Kind() != reflect.Ptr && v.CanAddr() {
 			v = v.Addr()
 
+			if u, ok := v.Interface().(TermUnmarshaler); ok {
+				return u.DecodeETF(term)
+			}
+
 			if u, ok := v.Interface().(Unmarshaler); ok {
 				b, is_binary := term.([]byte)
 				if !is_binary {
@@ -289,10 +451,21 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		return setListField(term.(List), dest)
 
 	case reflect.Struct:
+		if dest.Type() == bigIntType {
+			v, ok := TermToBigInt(term)
+			if !ok {
+				return fmt.Errorf("can't convert %#v to big.Int", term)
+			}
+			dest.Set(reflect.ValueOf(v).Elem())
+			return nil
+		}
 		switch s := term.(type) {
 		case Map:
 			return setMapStructField(s, dest)
 		case Tuple:
+			if record, ok := recordOf(dest.Type()); ok {
+				return setRecordField(s, dest, record)
+			}
 			return setStructField(s, dest)
 		case Ref:
 			dest.Set(reflect.ValueOf(s))
@@ -300,6 +473,14 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		case Pid:
 			dest.Set(reflect.ValueOf(s))
 			return nil
+		case BitString:
+			dest.Set(reflect.ValueOf(s))
+			return nil
+		case []byte:
+			if dest.Type() == reflect.TypeOf(BitString{}) {
+				dest.Set(reflect.ValueOf(BitString{Bytes: s, Bits: 8}))
+				return nil
+			}
 		}
 		return fmt.Errorf("can't convert %#v to struct", term)
 
@@ -328,61 +509,30 @@ func termIntoStruct(term Term, dest reflect.Value) error {
 		return nil
 
 	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-		i := int64(0)
-		switch v := term.(type) {
-		case int64:
-			i = v
-		case int32:
-			i = int64(v)
-		case int16:
-			i = int64(v)
-		case int8:
-			i = int64(v)
-		case int:
-			i = int64(v)
-		case uint64:
-			i = int64(v)
-		case uint32:
-			i = int64(v)
-		case uint16:
-			i = int64(v)
-		case uint8:
-			i = int64(v)
-		case uint:
-			i = int64(v)
-		default:
+		i, ok := TermToInt64(term)
+		if !ok {
+			if isInteger(term) {
+				return fmt.Errorf("%w: %v overflows %s", ErrIntegerOverflow, term, dest.Type())
+			}
 			return fmt.Errorf("can't convert %#v to int64", term)
 		}
+		if dest.OverflowInt(i) {
+			return fmt.Errorf("%w: %v overflows %s", ErrIntegerOverflow, term, dest.Type())
+		}
 		dest.SetInt(i)
 		return nil
 
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
-		u := uint64(0)
-		switch v := term.(type) {
-		case uint64:
-			u = v
-		case uint32:
-			u = uint64(v)
-		case uint16:
-			u = uint64(v)
-		case uint8:
-			u = uint64(v)
-		case uint:
-			u = uint64(v)
-		case int64:
-			u = uint64(v)
-		case int32:
-			u = uint64(v)
-		case int16:
-			u = uint64(v)
-		case int8:
-			u = uint64(v)
-		case int:
-			u = uint64(v)
-
-		default:
+		u, ok := TermToUint64(term)
+		if !ok {
+			if isInteger(term) {
+				return fmt.Errorf("%w: %v overflows %s", ErrIntegerOverflow, term, dest.Type())
+			}
 			return fmt.Errorf("can't convert %#v to uint64", term)
 		}
+		if dest.OverflowUint(u) {
+			return fmt.Errorf("%w: %v overflows %s", ErrIntegerOverflow, term, dest.Type())
+		}
 		dest.SetUint(u)
 		return nil
 
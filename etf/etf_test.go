@@ -2,7 +2,10 @@ package etf
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
@@ -157,6 +160,139 @@ func TestTermIntoStruct_Struct(t *testing.T) {
 	}
 }
 
+func TestTermIntoStruct_BitString(t *testing.T) {
+	type bitStringStruct struct {
+		A BitString
+		B BitString
+	}
+	dest := bitStringStruct{}
+	expected := bitStringStruct{
+		A: BitString{Bytes: []byte{1, 160}, Bits: 3},
+		B: BitString{Bytes: []byte{1, 2}, Bits: 8},
+	}
+	term := Tuple{BitString{Bytes: []byte{1, 160}, Bits: 3}, []byte{1, 2}}
+	if err := TermIntoStruct(term, &dest); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dest, expected) {
+		t.Fatal("result != expected", dest)
+	}
+}
+
+func TestTermIntoStruct_Integer(t *testing.T) {
+	type ids struct {
+		Small  int8
+		Int    int64
+		Uint   uint64
+		Big    *big.Int
+		BigVal big.Int
+	}
+
+	maxUint64 := new(big.Int).SetUint64(math.MaxUint64)
+	int128, _ := new(big.Int).SetString("170141183460469231731687303715884105727", 10)
+
+	var dest ids
+	term := Tuple{-128, int64(math.MinInt64), maxUint64, int128, 5}
+	if err := TermIntoStruct(term, &dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest.Small != -128 || dest.Int != math.MinInt64 || dest.Uint != math.MaxUint64 ||
+		dest.Big.Cmp(int128) != 0 || dest.BigVal.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("wrong result %#v", dest)
+	}
+
+	// uint64 (decoded with BigIntUint64)
+	if err := TermIntoStruct(Tuple{0, 0, uint64(math.MaxUint64)}, &dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest.Uint != math.MaxUint64 {
+		t.Fatal("wrong result", dest.Uint)
+	}
+
+	overflows := []Tuple{
+		{128},
+		{-129},
+		{0, maxUint64},
+		{0, uint64(math.MaxInt64 + 1)},
+		{0, 0, -1},
+		{0, 0, int128},
+	}
+	for _, o := range overflows {
+		if err := TermIntoStruct(o, &dest); errors.Is(err, ErrIntegerOverflow) == false {
+			t.Fatalf("%v: expected %v, got %v", o, ErrIntegerOverflow, err)
+		}
+	}
+
+	if err := TermIntoStruct(Tuple{0, 0, 0, Atom("a")}, &dest); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// the same for DecodeInto
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+	for _, o := range overflows {
+		b.Reset()
+		if err := Encode(o, b, EncodeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := DecodeInto(b.B, &dest, DecodeOptions{}); errors.Is(err, ErrIntegerOverflow) == false {
+			t.Fatalf("%v: expected %v, got %v", o, ErrIntegerOverflow, err)
+		}
+	}
+	b.Reset()
+	if err := Encode(term, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var dest1 ids
+	if err := DecodeInto(b.B, &dest1, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if dest1.Small != -128 || dest1.Int != math.MinInt64 || dest1.Uint != math.MaxUint64 ||
+		dest1.Big.Cmp(int128) != 0 || dest1.BigVal.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("wrong result %#v", dest1)
+	}
+}
+
+func TestTermToInt(t *testing.T) {
+	cases := []struct {
+		term    Term
+		bitSize int
+		ok      bool
+	}{
+		{127, 8, true},
+		{128, 8, false},
+		{-128, 8, true},
+		{-129, 8, false},
+		{int64(math.MaxInt64), 64, true},
+		{uint64(math.MaxUint64), 64, false},
+		{big.NewInt(1), 0, true},
+		{Atom("a"), 0, false},
+	}
+	for _, c := range cases {
+		if _, ok := TermToInt(c.term, c.bitSize); ok != c.ok {
+			t.Fatalf("TermToInt(%v, %d): expected %v", c.term, c.bitSize, c.ok)
+		}
+	}
+
+	cases = []struct {
+		term    Term
+		bitSize int
+		ok      bool
+	}{
+		{255, 8, true},
+		{256, 8, false},
+		{-1, 8, false},
+		{uint64(math.MaxUint64), 64, true},
+		{new(big.Int).SetUint64(math.MaxUint64), 0, true},
+		{new(big.Int).Lsh(big.NewInt(1), 64), 64, false},
+	}
+	for _, c := range cases {
+		if _, ok := TermToUint(c.term, c.bitSize); ok != c.ok {
+			t.Fatalf("TermToUint(%v, %d): expected %v", c.term, c.bitSize, c.ok)
+		}
+	}
+}
+
 func TestTermIntoStruct_Map(t *testing.T) {
 	type St struct {
 		A uint16
@@ -587,3 +723,135 @@ func TestTermIntoStructUnmarshal(t *testing.T) {
 		t.Errorf("got %v, want %v", dst1, src1)
 	}
 }
+
+// myTerm implements both the Marshaler/Unmarshaler and TermMarshaler/TermUnmarshaler
+type myTerm struct {
+	V int
+}
+
+func (m myTerm) MarshalETF() ([]byte, error) {
+	return []byte("binary"), nil
+}
+
+func (m *myTerm) UnmarshalETF(b []byte) error {
+	return fmt.Errorf("must not be used")
+}
+
+func (m myTerm) EncodeETF(b *lib.Buffer, options EncodeOptions) error {
+	return Encode(Tuple{Atom("my"), m.V}, b, options)
+}
+
+func (m *myTerm) DecodeETF(term Term) error {
+	t, ok := term.(Tuple)
+	if !ok || len(t) != 2 || t.Element(1) != Atom("my") {
+		return fmt.Errorf("malformed term %#v", term)
+	}
+	m.V = t.Element(2).(int)
+	return nil
+}
+
+func TestTermIntoStructTermUnmarshal(t *testing.T) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	// TermMarshaler has priority over Marshaler
+	src := myTerm{V: 123}
+	if err := Encode(src, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	term, _, err := Decode(b.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Tuple{Atom("my"), 123}); !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, term)
+	}
+
+	// TermUnmarshaler has priority over Unmarshaler
+	var dest myTerm
+	if err := TermIntoStruct(term, &dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest != src {
+		t.Fatalf("expected %#v, got %#v", src, dest)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	type recordUser struct {
+		Record `etf:"user"`
+		Name   string
+		Age    int
+	}
+	type recordPlain struct {
+		ID   int
+		Name Atom
+	}
+
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	// declared by the marker
+	user := recordUser{Name: "Alice", Age: 30}
+	if err := Encode(user, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	term, _, err := Decode(b.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Tuple{Atom("user"), "Alice", 30}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+	if name, ok := RecordName(user); !ok || name != "user" {
+		t.Fatal("wrong record name", name)
+	}
+
+	result := recordUser{}
+	if err := TermIntoStruct(term, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, result) {
+		t.Fatal("result != expected", result)
+	}
+
+	// validation
+	if err := TermIntoStruct(Tuple{Atom("group"), "Alice", 30}, &result); err != ErrRecordName {
+		t.Fatal("expected", ErrRecordName, "got", err)
+	}
+	if err := TermIntoStruct(Tuple{Atom("user"), "Alice"}, &result); err != ErrRecordArity {
+		t.Fatal("expected", ErrRecordArity, "got", err)
+	}
+
+	// declared by the registry
+	if err := RegisterRecord("plain", recordPlain{}); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterRecord(recordPlain{})
+
+	b.Reset()
+	plain := recordPlain{ID: 1, Name: "a"}
+	if err := Encode(List{plain}, b, EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	term, _, err = Decode(b.B, []Atom{}, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = Tuple{Atom("plain"), 1, Atom("a")}
+	if !reflect.DeepEqual(term, List{expected}) {
+		t.Fatalf("expected %#v got %#v", List{expected}, term)
+	}
+	resultPlain := []recordPlain{}
+	if err := TermIntoStruct(term, &resultPlain); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resultPlain, []recordPlain{plain}) {
+		t.Fatal("result != expected", resultPlain)
+	}
+
+	if err := RegisterRecord("wrong", 1); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,159 @@
+package etf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// TermToJSON converts the term into JSON using the given rules
+func TermToJSON(term Term, options BridgeOptions) ([]byte, error) {
+	b := newBridge(options, true)
+	value, err := b.toBridge(term)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// JSONToTerm converts JSON into the term using the given rules. Integers are
+// int (or *big.Int), floats are float64, arrays are List, objects are Map.
+func JSONToTerm(data []byte, options BridgeOptions) (Term, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := readJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: trailing data")
+	}
+	return newBridge(options, true).fromBridge(value)
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case *big.Int:
+		buf.WriteString(v.String())
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		buf.WriteString(s)
+		if strings.ContainsAny(s, ".e") == false {
+			// keep it float on the way back
+			buf.WriteString(".0")
+		}
+	case string:
+		writeJSONString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, v[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case bridgeMap:
+		buf.WriteByte('{')
+		for i, pair := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, ok := pair.key.(string)
+			if !ok {
+				return fmt.Errorf("%w: JSON object key %v", ErrBridgeUnsupported, pair.key)
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, pair.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("%w: %T", ErrBridgeUnsupported, value)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// remove the newline added by Encode
+	buf.Truncate(buf.Len() - 1)
+}
+
+func readJSON(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			list := []interface{}{}
+			for dec.More() {
+				v, err := readJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			// closing ]
+			_, err := dec.Token()
+			return list, err
+		case '{':
+			object := bridgeMap{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := readJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, bridgePair{key: key, value: v})
+			}
+			// closing }
+			_, err := dec.Token()
+			return object, err
+		}
+	case json.Number:
+		s := string(t)
+		if strings.ContainsAny(s, ".eE") {
+			return t.Float64()
+		}
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON number %s", s)
+		}
+		if i.IsInt64() {
+			return i.Int64(), nil
+		}
+		return i, nil
+	case string, bool, nil:
+		return t, nil
+	}
+	return nil, fmt.Errorf("invalid JSON token %v", token)
+}
@@ -0,0 +1,280 @@
+package etf
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+var (
+	errMalformedMsgPack = fmt.Errorf("Malformed MessagePack")
+)
+
+// TermToMsgPack converts the term into MessagePack using the given rules. Binaries
+// are MessagePack binaries, keys of maps might be of any type.
+func TermToMsgPack(term Term, options BridgeOptions) ([]byte, error) {
+	b := newBridge(options, false)
+	value, err := b.toBridge(term)
+	if err != nil {
+		return nil, err
+	}
+	return writeMsgPack(nil, value)
+}
+
+// MsgPackToTerm converts MessagePack into the term using the given rules. Integers
+// are int (or *big.Int), floats are float64, strings are string (see BridgeOptions.Strings),
+// binaries are []byte, arrays are List, maps are Map.
+func MsgPackToTerm(data []byte, options BridgeOptions) (Term, error) {
+	value, rest, err := readMsgPack(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing data", errMalformedMsgPack)
+	}
+	return newBridge(options, false).fromBridge(value)
+}
+
+func writeMsgPack(buf []byte, value interface{}) ([]byte, error) {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		buf = append(buf, 0xc0)
+	case bool:
+		if v {
+			buf = append(buf, 0xc3)
+		} else {
+			buf = append(buf, 0xc2)
+		}
+	case int64:
+		buf = writeMsgPackInt(buf, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			buf = writeMsgPackInt(buf, int64(v))
+			break
+		}
+		buf = append(buf, 0xcf)
+		buf = appendUint64(buf, v)
+	case float64:
+		buf = append(buf, 0xcb)
+		buf = appendUint64(buf, math.Float64bits(v))
+	case string:
+		l := len(v)
+		switch {
+		case l < 32:
+			buf = append(buf, 0xa0|byte(l))
+		case l < 256:
+			buf = append(buf, 0xd9, byte(l))
+		case l < 65536:
+			buf = append(buf, 0xda, byte(l>>8), byte(l))
+		default:
+			buf = append(buf, 0xdb)
+			buf = appendUint32(buf, uint32(l))
+		}
+		buf = append(buf, v...)
+	case []byte:
+		l := len(v)
+		switch {
+		case l < 256:
+			buf = append(buf, 0xc4, byte(l))
+		case l < 65536:
+			buf = append(buf, 0xc5, byte(l>>8), byte(l))
+		default:
+			buf = append(buf, 0xc6)
+			buf = appendUint32(buf, uint32(l))
+		}
+		buf = append(buf, v...)
+	case []interface{}:
+		buf = writeMsgPackHeader(buf, len(v), 0x90, 0xdc)
+		for i := range v {
+			if buf, err = writeMsgPack(buf, v[i]); err != nil {
+				return nil, err
+			}
+		}
+	case bridgeMap:
+		buf = writeMsgPackHeader(buf, len(v), 0x80, 0xde)
+		for _, pair := range v {
+			if buf, err = writeMsgPack(buf, pair.key); err != nil {
+				return nil, err
+			}
+			if buf, err = writeMsgPack(buf, pair.value); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrBridgeUnsupported, value)
+	}
+	return buf, nil
+}
+
+func writeMsgPackInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(buf, byte(v))
+	case v < 0 && v >= -32:
+		return append(buf, byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return append(buf, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		buf = append(buf, 0xd2)
+		return appendUint32(buf, uint32(v))
+	}
+	buf = append(buf, 0xd3)
+	return appendUint64(buf, uint64(v))
+}
+
+// writeMsgPackHeader writes header of array/map. fix is the type of fixarray/fixmap,
+// typ16 is the type of array16/map16 (array32/map32 follows it)
+func writeMsgPackHeader(buf []byte, l int, fix byte, typ16 byte) []byte {
+	switch {
+	case l < 16:
+		return append(buf, fix|byte(l))
+	case l < 65536:
+		return append(buf, typ16, byte(l>>8), byte(l))
+	}
+	buf = append(buf, typ16+1)
+	return appendUint32(buf, uint32(l))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+// readMsgPack reads the value into the intermediate representation (see toBridge)
+func readMsgPack(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errMalformedMsgPack
+	}
+	if depth > 10000 {
+		return nil, nil, fmt.Errorf("%w: too deep", errMalformedMsgPack)
+	}
+
+	t := data[0]
+	data = data[1:]
+	switch {
+	case t < 0x80: // positive fixint
+		return int64(t), data, nil
+	case t >= 0xe0: // negative fixint
+		return int64(int8(t)), data, nil
+	case t&0xf0 == 0x80: // fixmap
+		return readMsgPackMap(data, int(t&0x0f), depth)
+	case t&0xf0 == 0x90: // fixarray
+		return readMsgPackArray(data, int(t&0x0f), depth)
+	case t&0xe0 == 0xa0: // fixstr
+		return readMsgPackString(data, int(t&0x1f))
+	}
+
+	// size of the length/value field
+	var size int
+	switch t {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2:
+		return false, data, nil
+	case 0xc3:
+		return true, data, nil
+	case 0xc4, 0xcc, 0xd0, 0xd9:
+		size = 1
+	case 0xc5, 0xcd, 0xd1, 0xda, 0xdc, 0xde:
+		size = 2
+	case 0xc6, 0xca, 0xce, 0xd2, 0xdb, 0xdd, 0xdf:
+		size = 4
+	case 0xcb, 0xcf, 0xd3:
+		size = 8
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported type 0x%x", errMalformedMsgPack, t)
+	}
+	if len(data) < size {
+		return nil, nil, errMalformedMsgPack
+	}
+	var n uint64
+	for i := 0; i < size; i++ {
+		n = n<<8 | uint64(data[i])
+	}
+	data = data[size:]
+
+	switch t {
+	case 0xcc, 0xcd, 0xce:
+		return int64(n), data, nil
+	case 0xcf:
+		if n > math.MaxInt64 {
+			return new(big.Int).SetUint64(n), data, nil
+		}
+		return int64(n), data, nil
+	case 0xd0:
+		return int64(int8(n)), data, nil
+	case 0xd1:
+		return int64(int16(n)), data, nil
+	case 0xd2:
+		return int64(int32(n)), data, nil
+	case 0xd3:
+		return int64(n), data, nil
+	case 0xca:
+		return float64(math.Float32frombits(uint32(n))), data, nil
+	case 0xcb:
+		return math.Float64frombits(n), data, nil
+	case 0xd9, 0xda, 0xdb:
+		return readMsgPackString(data, int(n))
+	case 0xc4, 0xc5, 0xc6:
+		if uint64(len(data)) < n {
+			return nil, nil, errMalformedMsgPack
+		}
+		b := make([]byte, n)
+		copy(b, data)
+		return b, data[n:], nil
+	case 0xdc, 0xdd:
+		return readMsgPackArray(data, int(n), depth)
+	}
+	// 0xde, 0xdf
+	return readMsgPackMap(data, int(n), depth)
+}
+
+func readMsgPackString(data []byte, n int) (interface{}, []byte, error) {
+	if len(data) < n {
+		return nil, nil, errMalformedMsgPack
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func readMsgPackArray(data []byte, n int, depth int) (interface{}, []byte, error) {
+	// every element takes at least 1 byte
+	if n > len(data) {
+		return nil, nil, errMalformedMsgPack
+	}
+	list := make([]interface{}, n)
+	for i := range list {
+		v, rest, err := readMsgPack(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		list[i] = v
+		data = rest
+	}
+	return list, data, nil
+}
+
+func readMsgPackMap(data []byte, n int, depth int) (interface{}, []byte, error) {
+	if n*2 > len(data) {
+		return nil, nil, errMalformedMsgPack
+	}
+	m := make(bridgeMap, n)
+	for i := range m {
+		k, rest, err := readMsgPack(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, rest, err := readMsgPack(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[i] = bridgePair{key: k, value: v}
+		data = rest
+	}
+	return m, data, nil
+}
@@ -0,0 +1,138 @@
+package etf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Record is intended to be used to interact with Erlang. Struct with the embedded
+// Record (must be the first field) is encoded as an Erlang record - the tuple tagged
+// with the record name given in the "etf" tag (or the lowercased name of the struct
+// if the tag is omitted).
+//
+//	type User struct {
+//		etf.Record `etf:"user"`
+//		Name       string
+//		Age        int
+//	}
+//
+// encodes as {user, Name, Age}. Unexported fields are skipped. TermIntoStruct validates the record name and arity
+// on decoding the tuple into such a struct. Use RegisterRecord for the types you
+// can't modify.
+type Record struct{}
+
+var (
+	ErrRecordName  = fmt.Errorf("Record name mismatch")
+	ErrRecordArity = fmt.Errorf("Record arity mismatch")
+
+	recordType = reflect.TypeOf(Record{})
+	records    sync.Map // reflect.Type => recordInfo
+)
+
+type recordInfo struct {
+	name Atom
+	// indexes of the record fields (skips Record marker and the unexported
+	// fields as cmd/etfgen does)
+	fields []int
+}
+
+// RegisterRecord declares the struct type of the given value as an Erlang record
+// with the given name. Fields of the struct are the record fields in the same order.
+func RegisterRecord(name Atom, value interface{}) error {
+	t := reflect.Indirect(reflect.ValueOf(value)).Type()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("can't register %s as a record: not a struct", t)
+	}
+	if name == "" {
+		return fmt.Errorf("can't register %s as a record: empty name", t)
+	}
+	offset := 0
+	if hasRecordMarker(t) {
+		offset = 1
+	}
+	info := recordInfo{
+		name:   name,
+		fields: recordFields(t, offset),
+	}
+	records.Store(t, info)
+	RegisterAtom(name)
+	return nil
+}
+
+// UnregisterRecord removes the record declaration made by RegisterRecord
+func UnregisterRecord(value interface{}) {
+	t := reflect.Indirect(reflect.ValueOf(value)).Type()
+	records.Delete(t)
+}
+
+// RecordName returns the record name if the given value is a struct declared as
+// an Erlang record (using embedded Record or RegisterRecord)
+func RecordName(value interface{}) (Atom, bool) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+	info, ok := recordOf(v.Type())
+	return info.name, ok
+}
+
+func hasRecordMarker(t reflect.Type) bool {
+	if t.NumField() == 0 {
+		return false
+	}
+	f := t.Field(0)
+	return f.Anonymous && f.Type == recordType
+}
+
+func recordOf(t reflect.Type) (recordInfo, bool) {
+	if info, ok := records.Load(t); ok {
+		return info.(recordInfo), true
+	}
+	if hasRecordMarker(t) == false {
+		return recordInfo{}, false
+	}
+
+	name := t.Field(0).Tag.Get("etf")
+	if name == "" {
+		name = strings.ToLower(t.Name())
+	}
+	info := recordInfo{
+		name:   Atom(name),
+		fields: recordFields(t, 1),
+	}
+	records.Store(t, info)
+	RegisterAtom(info.name)
+	return info, true
+}
+
+func recordFields(t reflect.Type, offset int) []int {
+	fields := []int{}
+	for i := offset; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			// unexported field
+			continue
+		}
+		fields = append(fields, i)
+	}
+	return fields
+}
+
+func setRecordField(term Tuple, dest reflect.Value, info recordInfo) error {
+	if len(term) == 0 {
+		return ErrRecordArity
+	}
+	if name, ok := term[0].(Atom); !ok || name != info.name {
+		return ErrRecordName
+	}
+	if len(term)-1 != len(info.fields) {
+		return ErrRecordArity
+	}
+	for i, elem := range term[1:] {
+		if err := termIntoStruct(elem, dest.Field(info.fields[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package etf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+const (
+	// ettVersion is the version magic of the external term format (term_to_binary)
+	ettVersion = byte(131)
+
+	// DefaultDecoderMaxSize default limit of the encoded term size for the Decoder
+	DefaultDecoderMaxSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrTooLarge      = fmt.Errorf("Term is too large")
+	ErrWrongVersion  = fmt.Errorf("Wrong ETF version")
+	ErrWrongPacket   = fmt.Errorf("Wrong packet size. Must be 0, 1, 2 or 4")
+	ErrNotBinary     = fmt.Errorf("Term is not a binary")
+	errPacketTrailer = fmt.Errorf("Malformed ETF. Trailing data in the packet")
+)
+
+// Encoder writes terms in the external term format to the io.Writer. Every
+// term starts with the version magic (131) as the term_to_binary does. Use
+// SetPacket to prefix every term with its length like Erlang ports do
+// with the option {packet, N}.
+type Encoder struct {
+	w       io.Writer
+	packet  int
+	options EncodeOptions
+}
+
+// NewEncoder creates a new Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// SetPacket sets the size (0, 1, 2 or 4 bytes) of the length header written
+// before every term. 0 (default) means no framing.
+func (e *Encoder) SetPacket(n int) error {
+	if checkPacket(n) == false {
+		return ErrWrongPacket
+	}
+	e.packet = n
+	return nil
+}
+
+// SetOptions sets the encoding options. Atom cache options are ignored.
+func (e *Encoder) SetOptions(options EncodeOptions) {
+	options.LinkAtomCache = nil
+	options.WriterAtomCache = nil
+	options.EncodingAtomCache = nil
+	e.options = options
+}
+
+// Encode writes the given term
+func (e *Encoder) Encode(term Term) error {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	b.Allocate(e.packet)
+	b.AppendByte(ettVersion)
+	if err := Encode(term, b, e.options); err != nil {
+		return err
+	}
+	if err := putPacketLength(b.B[:e.packet], b.Len()-e.packet); err != nil {
+		return err
+	}
+	return b.WriteDataTo(e.w)
+}
+
+// EncodeBinary writes the binary of the given size reading its data from r. It allows
+// to send a large binary without keeping it in memory.
+func (e *Encoder) EncodeBinary(r io.Reader, size int) error {
+	header := make([]byte, e.packet+6)
+	if err := putPacketLength(header[:e.packet], size+6); err != nil {
+		return err
+	}
+	header[e.packet] = ettVersion
+	header[e.packet+1] = ettBinary
+	binary.BigEndian.PutUint32(header[e.packet+2:], uint32(size))
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	n, err := io.CopyN(e.w, r, int64(size))
+	if err == io.EOF && n < int64(size) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Decoder reads terms in the external term format from the io.Reader. Since
+// the input might be untrusted, the size of the decoding term is limited by
+// DefaultDecoderMaxSize. Use SetMaxSize to change it.
+type Decoder struct {
+	r       *bufio.Reader
+	packet  int
+	max     int
+	options DecodeOptions
+
+	// the rest of binary returned by DecodeBinary
+	binary *io.LimitedReader
+}
+
+// NewDecoder creates a new Decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:   bufio.NewReader(r),
+		max: DefaultDecoderMaxSize,
+	}
+}
+
+// SetPacket sets the size (0, 1, 2 or 4 bytes) of the length header expected before
+// every term. 0 (default) means no framing.
+func (d *Decoder) SetPacket(n int) error {
+	if checkPacket(n) == false {
+		return ErrWrongPacket
+	}
+	d.packet = n
+	return nil
+}
+
+// SetMaxSize sets the limit of the encoded term size. 0 disables the limit.
+func (d *Decoder) SetMaxSize(n int) {
+	d.max = n
+}
+
+// SetOptions sets the decoding options
+func (d *Decoder) SetOptions(options DecodeOptions) {
+	d.options = options
+}
+
+// Decode reads the next term. Returns io.EOF if there is no more data.
+func (d *Decoder) Decode() (Term, error) {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	if err := d.read(b); err != nil {
+		return nil, err
+	}
+	term, rest, err := Decode(b.B[1:], []Atom{}, d.options)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errPacketTrailer
+	}
+	return term, nil
+}
+
+// DecodeInto reads the next term right into the value pointed by dest (see DecodeInto).
+// Returns io.EOF if there is no more data.
+func (d *Decoder) DecodeInto(dest interface{}) error {
+	b := lib.TakeBuffer()
+	defer lib.ReleaseBuffer(b)
+
+	if err := d.read(b); err != nil {
+		return err
+	}
+	return DecodeInto(b.B[1:], dest, d.options)
+}
+
+// read reads the next encoded term (with the version byte) into the buffer
+func (d *Decoder) read(b *lib.Buffer) error {
+	if err := d.skipBinary(); err != nil {
+		return err
+	}
+
+	if d.packet > 0 {
+		size, err := d.readPacketLength()
+		if err != nil {
+			return err
+		}
+		if d.max > 0 && size > d.max {
+			return ErrTooLarge
+		}
+		b.Allocate(size)
+		if _, err := io.ReadFull(d.r, b.B); err != nil {
+			return unexpectedEOF(err)
+		}
+	} else {
+		s := termScanner{r: d.r, b: b, max: d.max}
+		if err := s.scan(); err != nil {
+			return err
+		}
+	}
+
+	if b.Len() == 0 || b.B[0] != ettVersion {
+		return ErrWrongVersion
+	}
+	return nil
+}
+
+// DecodeBinary reads the next term if it is a binary. Instead of reading it into
+// memory returns the reader of the binary data and its size. The size limit
+// isn't applied here. The data must be read before the next call of Decode or
+// DecodeBinary, otherwise the rest of it is discarded. Returns ErrNotBinary (the
+// term stays unread) if the next term is not a binary.
+func (d *Decoder) DecodeBinary() (io.Reader, int, error) {
+	if err := d.skipBinary(); err != nil {
+		return nil, 0, err
+	}
+
+	header, err := d.r.Peek(d.packet + 6)
+	if err != nil {
+		if len(header) == 0 {
+			return nil, 0, err
+		}
+		if len(header) > d.packet+1 && header[d.packet+1] != ettBinary {
+			return nil, 0, ErrNotBinary
+		}
+		return nil, 0, unexpectedEOF(err)
+	}
+	if header[d.packet] != ettVersion {
+		return nil, 0, ErrWrongVersion
+	}
+	if header[d.packet+1] != ettBinary {
+		return nil, 0, ErrNotBinary
+	}
+	size := int(binary.BigEndian.Uint32(header[d.packet+2:]))
+	if d.packet > 0 {
+		length, _ := packetLength(header[:d.packet])
+		if length != size+6 {
+			return nil, 0, errMalformedBinary
+		}
+	}
+	d.r.Discard(d.packet + 6)
+
+	d.binary = &io.LimitedReader{R: d.r, N: int64(size)}
+	return d.binary, size, nil
+}
+
+func (d *Decoder) skipBinary() error {
+	if d.binary == nil {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, d.binary)
+	if err == nil && d.binary.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	d.binary = nil
+	return err
+}
+
+func (d *Decoder) readPacketLength() (int, error) {
+	header := make([]byte, d.packet)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return 0, err
+	}
+	return packetLength(header)
+}
+
+func checkPacket(n int) bool {
+	switch n {
+	case 0, 1, 2, 4:
+		return true
+	}
+	return false
+}
+
+func packetLength(header []byte) (int, error) {
+	switch len(header) {
+	case 1:
+		return int(header[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(header)), nil
+	case 4:
+		return int(binary.BigEndian.Uint32(header)), nil
+	}
+	return 0, ErrWrongPacket
+}
+
+func putPacketLength(header []byte, length int) error {
+	switch len(header) {
+	case 0:
+		return nil
+	case 1:
+		if length > 0xff {
+			return ErrTooLarge
+		}
+		header[0] = byte(length)
+	case 2:
+		if length > 0xffff {
+			return ErrTooLarge
+		}
+		binary.BigEndian.PutUint16(header, uint16(length))
+	case 4:
+		if int64(length) > 0xffffffff {
+			return ErrTooLarge
+		}
+		binary.BigEndian.PutUint32(header, uint32(length))
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// termScanner reads the raw data of a single term from the stream with no framing.
+// It doesn't decode the term, but walks over its structure to find out the size.
+type termScanner struct {
+	r   *bufio.Reader
+	b   *lib.Buffer
+	max int
+}
+
+func (s *termScanner) read(n int) ([]byte, error) {
+	if s.max > 0 && s.b.Len()+n > s.max {
+		return nil, ErrTooLarge
+	}
+	buf := s.b.Extend(n)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (s *termScanner) scan() error {
+	// version
+	if _, err := s.read(1); err != nil {
+		// io.EOF here means there is no more terms
+		return err
+	}
+
+	// number of terms left to read
+	terms := 1
+	for terms > 0 {
+		terms--
+		tag, err := s.read(1)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if err := s.scanTag(tag[0], &terms); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+func (s *termScanner) scanTag(tag byte, terms *int) error {
+	switch tag {
+	case ettAtom, ettAtomUTF8, ettSmallAtom, ettSmallAtomUTF8:
+		return s.scanAtomData(tag)
+
+	case ettString:
+		return s.scanSized(2, 0)
+
+	case ettNewFloat:
+		_, err := s.read(8)
+		return err
+
+	case ettFloat:
+		_, err := s.read(31)
+		return err
+
+	case ettSmallInteger:
+		_, err := s.read(1)
+		return err
+
+	case ettInteger:
+		_, err := s.read(4)
+		return err
+
+	case ettSmallBig:
+		// n, sign, digits
+		return s.scanSized(1, 1)
+
+	case ettLargeBig:
+		return s.scanSized(4, 1)
+
+	case ettBinary:
+		return s.scanSized(4, 0)
+
+	case ettBitBinary:
+		// len, bits, data
+		return s.scanSized(4, 1)
+
+	case ettNil:
+		return nil
+
+	case ettList:
+		n, err := s.scanLength(4)
+		if err != nil {
+			return err
+		}
+		// elements and the tail
+		*terms += n + 1
+
+	case ettSmallTuple:
+		n, err := s.scanLength(1)
+		if err != nil {
+			return err
+		}
+		*terms += n
+
+	case ettLargeTuple:
+		n, err := s.scanLength(4)
+		if err != nil {
+			return err
+		}
+		*terms += n
+
+	case ettMap:
+		n, err := s.scanLength(4)
+		if err != nil {
+			return err
+		}
+		*terms += 2 * n
+
+	case ettPid:
+		// node, id, serial, creation(1)
+		return s.scanNodeData(9)
+
+	case ettNewPid:
+		return s.scanNodeData(12)
+
+	case ettPort:
+		// node, id, creation(1)
+		return s.scanNodeData(5)
+
+	case ettNewPort:
+		return s.scanNodeData(8)
+
+	case ettNewRef, ettNewerRef:
+		n, err := s.scanLength(2)
+		if err != nil {
+			return err
+		}
+		creation := 1
+		if tag == ettNewerRef {
+			creation = 4
+		}
+		return s.scanNodeData(creation + n*4)
+
+	case ettExport:
+		// module, function, arity
+		*terms += 3
+
+	case ettNewFun:
+		// size, arity, uniq, index, num_free
+		header, err := s.read(4 + 1 + 16 + 4 + 4)
+		if err != nil {
+			return err
+		}
+		free := int(binary.BigEndian.Uint32(header[25:]))
+		// module, old_index, old_uniq, pid and free vars
+		*terms += 4 + free
+
+	default:
+		return errMalformedUnknownType
+	}
+	return nil
+}
+
+// scanLength reads the length field of the given size
+func (s *termScanner) scanLength(size int) (int, error) {
+	buf, err := s.read(size)
+	if err != nil {
+		return 0, err
+	}
+	return packetLength(buf)
+}
+
+// scanSized reads the length field, extra bytes and the data of this length
+func (s *termScanner) scanSized(size int, extra int) error {
+	n, err := s.scanLength(size)
+	if err != nil {
+		return err
+	}
+	_, err = s.read(extra + n)
+	return err
+}
+
+func (s *termScanner) scanAtomData(tag byte) error {
+	switch tag {
+	case ettAtom, ettAtomUTF8:
+		return s.scanSized(2, 0)
+	case ettSmallAtom, ettSmallAtomUTF8:
+		return s.scanSized(1, 0)
+	}
+	return errMalformedUnknownType
+}
+
+// scanNodeData reads the node name (atom) followed by the data of the given size
+func (s *termScanner) scanNodeData(size int) error {
+	tag, err := s.read(1)
+	if err != nil {
+		return err
+	}
+	if err := s.scanAtomData(tag[0]); err != nil {
+		return err
+	}
+	_, err = s.read(size)
+	return err
+}
@@ -0,0 +1,194 @@
+package etf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	terms := []Term{
+		Atom("hello"),
+		"string",
+		123,
+		int64(-123456789),
+		3.14,
+		big.NewInt(0).Lsh(big.NewInt(1), 100),
+		[]byte{1, 2, 3},
+		List{1, Atom("a"), List{}, Tuple{}},
+		Tuple{Atom("ok"), Map{Atom("key"): "value"}},
+		Pid{Node: "node@host", ID: 123, Creation: 1},
+		Ref{Node: "node@host", Creation: 2, ID: [5]uint32{1, 2, 3}},
+		BitString{Bytes: []byte{1, 0xf0}, Bits: 4},
+		true,
+	}
+
+	for _, packet := range []int{0, 1, 2, 4} {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		if err := enc.SetPacket(packet); err != nil {
+			t.Fatal(err)
+		}
+		enc.SetOptions(EncodeOptions{FlagBigCreation: true})
+		for _, term := range terms {
+			if err := enc.Encode(term); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dec := NewDecoder(buf)
+		if err := dec.SetPacket(packet); err != nil {
+			t.Fatal(err)
+		}
+		dec.SetOptions(DecodeOptions{FlagBigCreation: true})
+		for i := range terms {
+			term, err := dec.Decode()
+			if err != nil {
+				t.Fatal(packet, i, err)
+			}
+			expected := terms[i]
+			if !reflect.DeepEqual(expected, term) {
+				t.Fatalf("packet %d: expected %#v got %#v", packet, expected, term)
+			}
+		}
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Fatal("expected io.EOF, got", err)
+		}
+	}
+}
+
+func TestDecoderScanner(t *testing.T) {
+	// the terms the Encoder doesn't produce, but Erlang does
+	data := []byte{
+		// fun erlang:self/0
+		131, 113, 119, 6, 'e', 'r', 'l', 'a', 'n', 'g', 119, 4, 's', 'e', 'l', 'f', 97, 0,
+		// old style port
+		131, 102, 119, 1, 'n', 0, 0, 0, 5, 3,
+	}
+	expected := []Term{
+		Export{Module: "erlang", Function: "self", Arity: 0},
+		Port{Node: "n", ID: 5, Creation: 3},
+	}
+	dec := NewDecoder(bytes.NewReader(data))
+	for _, e := range expected {
+		term, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, term) {
+			t.Fatalf("expected %#v got %#v", e, term)
+		}
+	}
+}
+
+func TestEncoderPacket(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.SetPacket(4)
+	if err := enc.Encode(Atom("a")); err != nil {
+		t.Fatal(err)
+	}
+	// term_to_binary(a) prefixed by the length
+	expected := []byte{0, 0, 0, 4, 131, 119, 1, 'a'}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expected %v got %v", expected, buf.Bytes())
+	}
+
+	enc.SetPacket(1)
+	if err := enc.Encode(make([]byte, 300)); err != ErrTooLarge {
+		t.Fatal("expected ErrTooLarge, got", err)
+	}
+	if err := enc.SetPacket(3); err != ErrWrongPacket {
+		t.Fatal("expected ErrWrongPacket, got", err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	for _, packet := range []int{0, 4} {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		enc.SetPacket(packet)
+		enc.Encode(make([]byte, 1000))
+
+		dec := NewDecoder(buf)
+		dec.SetPacket(packet)
+		dec.SetMaxSize(100)
+		if _, err := dec.Decode(); err != ErrTooLarge {
+			t.Fatal("expected ErrTooLarge, got", err)
+		}
+	}
+
+	// wrong version
+	dec := NewDecoder(bytes.NewReader([]byte{0, 0, 0, 3, 130, 97, 1}))
+	dec.SetPacket(4)
+	if _, err := dec.Decode(); err != ErrWrongVersion {
+		t.Fatal("expected ErrWrongVersion, got", err)
+	}
+
+	// truncated
+	dec = NewDecoder(bytes.NewReader([]byte{131, 104, 2, 97, 1}))
+	if _, err := dec.Decode(); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+
+	// trailing data in the packet
+	dec = NewDecoder(bytes.NewReader([]byte{0, 0, 0, 4, 131, 97, 1, 1}))
+	dec.SetPacket(4)
+	if _, err := dec.Decode(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEncodeDecodeBinaryStream(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	for _, packet := range []int{0, 4} {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		enc.SetPacket(packet)
+		enc.Encode(Atom("begin"))
+		if err := enc.EncodeBinary(bytes.NewReader(data), len(data)); err != nil {
+			t.Fatal(err)
+		}
+		enc.EncodeBinary(bytes.NewReader(data), len(data))
+		enc.Encode(Atom("end"))
+
+		dec := NewDecoder(buf)
+		dec.SetPacket(packet)
+		// the limit doesn't affect DecodeBinary
+		dec.SetMaxSize(1000)
+
+		if _, _, err := dec.DecodeBinary(); err != ErrNotBinary {
+			t.Fatal("expected ErrNotBinary, got", err)
+		}
+		if term, err := dec.Decode(); err != nil || term != Atom("begin") {
+			t.Fatal("wrong term", term, err)
+		}
+
+		r, size, err := dec.DecodeBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(data) {
+			t.Fatal("wrong size", size)
+		}
+		received, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, received) {
+			t.Fatal("data mismatch")
+		}
+
+		// do not read the second one. must be skipped
+		if _, _, err := dec.DecodeBinary(); err != nil {
+			t.Fatal(err)
+		}
+		if term, err := dec.Decode(); err != nil || term != Atom("end") {
+			t.Fatal("wrong term", term, err)
+		}
+	}
+}
@@ -0,0 +1,897 @@
+package etf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ergo-services/ergo/lib"
+)
+
+var (
+	// reserved words must be quoted being used as atoms
+	reservedWords = map[string]bool{
+		"after": true, "and": true, "andalso": true, "band": true, "begin": true,
+		"bnot": true, "bor": true, "bsl": true, "bsr": true, "bxor": true,
+		"case": true, "catch": true, "cond": true, "div": true, "else": true,
+		"end": true, "fun": true, "if": true, "let": true, "maybe": true,
+		"not": true, "of": true, "or": true, "orelse": true, "receive": true,
+		"rem": true, "try": true, "when": true, "xor": true,
+	}
+)
+
+// Format returns the text representation of the given term in the Erlang syntax
+// (the way io_lib:format("~p") does it). Pids, references, ports and funs are printed
+// as Erlang prints them, so they can't be parsed back. Go types which are not the etf
+// types (structs, slices, maps...) are printed as they are encoded by Encode.
+func Format(term Term) string {
+	var b strings.Builder
+	formatTerm(&b, term)
+	return b.String()
+}
+
+func formatTerm(b *strings.Builder, term Term) {
+	switch t := term.(type) {
+	case nil:
+		b.WriteString("[]")
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case Atom:
+		formatAtom(b, string(t))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		fmt.Fprintf(b, "%d", t)
+	case *big.Int:
+		b.WriteString(t.String())
+	case float32:
+		formatFloat(b, float64(t), 32)
+	case float64:
+		formatFloat(b, t, 64)
+	case string:
+		formatQuoted(b, t, '"')
+	case Charlist:
+		formatQuoted(b, string(t), '"')
+	case String:
+		formatBinary(b, []byte(t))
+	case []byte:
+		formatBinary(b, t)
+	case BitString:
+		formatBitString(b, t)
+	case List:
+		b.WriteByte('[')
+		formatElements(b, t)
+		b.WriteByte(']')
+	case ListImproper:
+		if len(t) < 2 {
+			formatTerm(b, List(t))
+			return
+		}
+		b.WriteByte('[')
+		formatElements(b, t[:len(t)-1])
+		b.WriteByte('|')
+		formatTerm(b, t[len(t)-1])
+		b.WriteByte(']')
+	case Tuple:
+		b.WriteByte('{')
+		formatElements(b, t)
+		b.WriteByte('}')
+	case Map:
+		formatMap(b, t)
+	case Pid:
+		b.WriteString(t.String())
+	case Ref:
+		fmt.Fprintf(b, "#Ref<%X.%d.%d.%d>", nodeHash(t.Node), t.ID[0], t.ID[1], t.ID[2])
+	case Alias:
+		fmt.Fprintf(b, "#Ref<%X.%d.%d.%d>", nodeHash(t.Node), t.ID[0], t.ID[1], t.ID[2])
+	case Port:
+		fmt.Fprintf(b, "#Port<%X.%d>", nodeHash(t.Node), t.ID)
+	case Export:
+		b.WriteString("fun ")
+		formatAtom(b, string(t.Module))
+		b.WriteByte(':')
+		formatAtom(b, string(t.Function))
+		fmt.Fprintf(b, "/%d", t.Arity)
+	case Function:
+		b.WriteString("#Fun<")
+		formatAtom(b, string(t.Module))
+		fmt.Fprintf(b, ".%d.%d>", t.OldIndex, t.OldUnique)
+	default:
+		// print it the way it is seen on the Erlang side
+		buf := lib.TakeBuffer()
+		defer lib.ReleaseBuffer(buf)
+		if err := Encode(term, buf, EncodeOptions{}); err != nil {
+			fmt.Fprintf(b, "%v", term)
+			return
+		}
+		decoded, _, err := Decode(buf.B, []Atom{}, DecodeOptions{})
+		if err != nil {
+			fmt.Fprintf(b, "%v", term)
+			return
+		}
+		formatTerm(b, decoded)
+	}
+}
+
+func formatElements(b *strings.Builder, elements []Term) {
+	for i := range elements {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		formatTerm(b, elements[i])
+	}
+}
+
+func formatMap(b *strings.Builder, m Map) {
+	// keys are sorted by their text representation to make the result stable
+	type pair struct {
+		key   string
+		value Term
+	}
+	pairs := make([]pair, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, pair{key: Format(k), value: v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key < pairs[j].key })
+
+	b.WriteString("#{")
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(p.key)
+		b.WriteString(" => ")
+		formatTerm(b, p.value)
+	}
+	b.WriteByte('}')
+}
+
+func formatAtom(b *strings.Builder, atom string) {
+	if isUnquotedAtom(atom) {
+		b.WriteString(atom)
+		return
+	}
+	formatQuoted(b, atom, '\'')
+}
+
+func isUnquotedAtom(atom string) bool {
+	if atom == "" || reservedWords[atom] {
+		return false
+	}
+	for i, c := range atom {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '@'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func formatQuoted(b *strings.Builder, s string, quote rune) {
+	b.WriteRune(quote)
+	for _, c := range s {
+		switch c {
+		case quote, '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\v':
+			b.WriteString("\\v")
+		case '\b':
+			b.WriteString("\\b")
+		case '\f':
+			b.WriteString("\\f")
+		case 27:
+			b.WriteString("\\e")
+		case 127:
+			b.WriteString("\\d")
+		default:
+			if unicode.IsPrint(c) == false {
+				fmt.Fprintf(b, "\\x{%X}", c)
+				continue
+			}
+			b.WriteRune(c)
+		}
+	}
+	b.WriteRune(quote)
+}
+
+func formatFloat(b *strings.Builder, f float64, bitSize int) {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	mantissa, exponent := s, ""
+	if i := strings.IndexByte(s, 'e'); i != -1 {
+		mantissa, exponent = s[:i], s[i+1:]
+	}
+	b.WriteString(mantissa)
+	if strings.ContainsAny(mantissa, ".NI") == false {
+		// Erlang float must have a fraction part
+		b.WriteString(".0")
+	}
+	if exponent == "" {
+		return
+	}
+	negative := exponent[0] == '-'
+	exponent = strings.TrimLeft(exponent, "+-0")
+	b.WriteByte('e')
+	if negative {
+		b.WriteByte('-')
+	}
+	b.WriteString(exponent)
+}
+
+func formatBinary(b *strings.Builder, data []byte) {
+	b.WriteString("<<")
+	printable := len(data) > 0
+	for _, c := range data {
+		if (c < 0x20 || c > 0x7e) && c != '\n' && c != '\r' && c != '\t' {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		formatQuoted(b, string(data), '"')
+	} else {
+		for i, c := range data {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Itoa(int(c)))
+		}
+	}
+	b.WriteString(">>")
+}
+
+func formatBitString(b *strings.Builder, bs BitString) {
+	l := len(bs.Bytes)
+	if l == 0 || bs.Bits == 0 || bs.Bits >= 8 {
+		formatBinary(b, bs.Bytes)
+		return
+	}
+	b.WriteString("<<")
+	for _, c := range bs.Bytes[:l-1] {
+		b.WriteString(strconv.Itoa(int(c)))
+		b.WriteByte(',')
+	}
+	fmt.Fprintf(b, "%d:%d>>", bs.Bytes[l-1]>>(8-bs.Bits), bs.Bits)
+}
+
+func nodeHash(node Atom) uint32 {
+	if node == "" {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(node))
+	return h.Sum32()
+}
+
+// Parse parses the text representation of the Erlang term. The term might be
+// terminated by the dot. Supported literals are: integers (including 16#FF and $c
+// notations), floats, atoms, strings, binaries (<<"abc">>, <<1,2:4>>), lists, improper
+// lists, tuples, maps and external funs (fun m:f/1). Returned types are the same
+// Decode returns: integers are int (or *big.Int), strings are string, binaries are
+// []byte (or BitString), [a|b] is ListImproper.
+func Parse(text string) (Term, error) {
+	p := &termParser{s: text, line: 1}
+	term, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == '.' {
+		p.next()
+		p.skipSpace()
+	}
+	if p.eof() == false {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return term, nil
+}
+
+// Consult parses the sequence of the terms terminated by dot, like file:consult/1
+// does. Comments (starting with %) are ignored.
+func Consult(text string) ([]Term, error) {
+	p := &termParser{s: text, line: 1}
+	terms := []Term{}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return terms, nil
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != '.' {
+			return nil, p.errorf("expected '.'")
+		}
+		p.next()
+		terms = append(terms, term)
+	}
+}
+
+type termParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *termParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Syntax error at line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *termParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *termParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.pos:])
+	return r
+}
+
+func (p *termParser) next() rune {
+	if p.eof() {
+		return 0
+	}
+	r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+	p.pos += n
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *termParser) skipSpace() {
+	for p.eof() == false {
+		c := p.peek()
+		if c == '%' {
+			for p.eof() == false && p.peek() != '\n' {
+				p.next()
+			}
+			continue
+		}
+		if unicode.IsSpace(c) == false {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *termParser) expect(s string) error {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], s) == false {
+		if p.eof() {
+			return p.errorf("expected %q, got end of input", s)
+		}
+		return p.errorf("expected %q, got %q", s, p.peek())
+	}
+	for range s {
+		p.next()
+	}
+	return nil
+}
+
+func (p *termParser) term() (Term, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case p.eof():
+		return nil, p.errorf("unexpected end of input")
+	case c == '{':
+		p.next()
+		elements, err := p.elements('}')
+		if err != nil {
+			return nil, err
+		}
+		return Tuple(elements), nil
+	case c == '[':
+		return p.list()
+	case c == '#':
+		p.next()
+		if p.peek() != '{' {
+			return nil, p.errorf("records are not supported")
+		}
+		return p.mapTerm()
+	case strings.HasPrefix(p.s[p.pos:], "<<"):
+		return p.binary()
+	case c == '"':
+		return p.stringLiteral()
+	case c == '\'':
+		atom, err := p.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		return Atom(atom), nil
+	case c == '$':
+		p.next()
+		return p.char()
+	case c == '-' || c == '+' || (c >= '0' && c <= '9'):
+		return p.number()
+	case c >= 'a' && c <= 'z':
+		name := p.name()
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "fun":
+			return p.export()
+		}
+		return Atom(name), nil
+	case c == '_' || unicode.IsUpper(c):
+		return nil, p.errorf("variables are not allowed (%s)", p.name())
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+// elements parses comma separated terms until the given closing bracket
+func (p *termParser) elements(closing rune) ([]Term, error) {
+	elements := []Term{}
+	p.skipSpace()
+	if p.peek() == closing {
+		p.next()
+		return elements, nil
+	}
+	for {
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, term)
+		p.skipSpace()
+		switch p.next() {
+		case ',':
+			continue
+		case closing:
+			return elements, nil
+		}
+		return nil, p.errorf("expected ',' or %q", closing)
+	}
+}
+
+func (p *termParser) list() (Term, error) {
+	p.next() // [
+	elements := List{}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.next()
+		return elements, nil
+	}
+	for {
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, term)
+		p.skipSpace()
+		switch p.next() {
+		case ',':
+			continue
+		case ']':
+			return elements, nil
+		case '|':
+			tail, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if l, ok := tail.(List); ok {
+				return append(elements, l...), nil
+			}
+			if l, ok := tail.(ListImproper); ok {
+				return append(ListImproper(elements), l...), nil
+			}
+			return append(ListImproper(elements), tail), nil
+		}
+		return nil, p.errorf("expected ',', '|' or ']'")
+	}
+}
+
+func (p *termParser) mapTerm() (Term, error) {
+	p.next() // {
+	m := Map{}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.next()
+		return m, nil
+	}
+	for {
+		key, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case List, ListImproper, Tuple, Map, []byte:
+			return nil, p.errorf("unsupported type of the map key %s", Format(key))
+		}
+		m[key] = value
+		p.skipSpace()
+		switch p.next() {
+		case ',':
+			continue
+		case '}':
+			return m, nil
+		}
+		return nil, p.errorf("expected ',' or '}'")
+	}
+}
+
+func (p *termParser) name() string {
+	start := p.pos
+	for p.eof() == false {
+		c := p.peek()
+		if unicode.IsLetter(c) == false && unicode.IsDigit(c) == false && c != '_' && c != '@' {
+			break
+		}
+		p.next()
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *termParser) atom() (Atom, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '\'':
+		atom, err := p.quoted('\'')
+		return Atom(atom), err
+	case c >= 'a' && c <= 'z':
+		return Atom(p.name()), nil
+	}
+	return "", p.errorf("expected atom")
+}
+
+// export parses "M:F/A" (after "fun")
+func (p *termParser) export() (Term, error) {
+	module, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	function, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("/"); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	arity, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	a, ok := arity.(int)
+	if !ok || a < 0 || a > 255 {
+		return nil, p.errorf("wrong arity")
+	}
+	return Export{Module: module, Function: function, Arity: a}, nil
+}
+
+// stringLiteral parses the string literal. Adjacent strings are concatenated ("a" "b").
+func (p *termParser) stringLiteral() (Term, error) {
+	var b strings.Builder
+	for {
+		s, err := p.quoted('"')
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(s)
+		p.skipSpace()
+		if p.peek() != '"' {
+			return b.String(), nil
+		}
+	}
+}
+
+func (p *termParser) quoted(quote rune) (string, error) {
+	var b strings.Builder
+	p.next() // opening quote
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated %c", quote)
+		}
+		c := p.next()
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			e, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(e)
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
+
+func (p *termParser) escape() (rune, error) {
+	c := p.next()
+	switch c {
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'v':
+		return '\v', nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'e':
+		return 27, nil
+	case 's':
+		return ' ', nil
+	case 'd':
+		return 127, nil
+	case '^':
+		return p.next() & 31, nil
+	case 'x':
+		digits := ""
+		if p.peek() == '{' {
+			p.next()
+			for p.eof() == false && p.peek() != '}' {
+				digits += string(p.next())
+			}
+			p.next()
+		} else {
+			for i := 0; i < 2 && isDigit(p.peek(), 16); i++ {
+				digits += string(p.next())
+			}
+		}
+		v, err := strconv.ParseInt(digits, 16, 32)
+		if err != nil {
+			return 0, p.errorf("wrong escape sequence \\x%s", digits)
+		}
+		return rune(v), nil
+	}
+	if c >= '0' && c <= '7' {
+		v := c - '0'
+		for i := 0; i < 2 && isDigit(p.peek(), 8); i++ {
+			v = v*8 + p.next() - '0'
+		}
+		return v, nil
+	}
+	if c == 0 {
+		return 0, p.errorf("unexpected end of input")
+	}
+	return c, nil
+}
+
+func (p *termParser) char() (Term, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of input")
+	}
+	c := p.next()
+	if c == '\\' {
+		e, err := p.escape()
+		if err != nil {
+			return nil, err
+		}
+		c = e
+	}
+	return int(c), nil
+}
+
+func (p *termParser) number() (Term, error) {
+	negative := false
+	switch p.peek() {
+	case '-':
+		negative = true
+		p.next()
+	case '+':
+		p.next()
+	}
+	p.skipSpace()
+
+	if p.peek() == '$' {
+		p.next()
+		c, err := p.char()
+		if err != nil {
+			return nil, err
+		}
+		if negative {
+			return -c.(int), nil
+		}
+		return c, nil
+	}
+
+	digits := p.digits(10)
+	if digits == "" {
+		return nil, p.errorf("expected number")
+	}
+
+	base := 10
+	switch {
+	case p.peek() == '#':
+		p.next()
+		b, err := strconv.Atoi(digits)
+		if err != nil || b < 2 || b > 36 {
+			return nil, p.errorf("wrong base %s", digits)
+		}
+		base = b
+		digits = p.digits(base)
+		if digits == "" {
+			return nil, p.errorf("expected number")
+		}
+
+	case p.peek() == '.' && p.pos+1 < len(p.s) && isDigit(rune(p.s[p.pos+1]), 10):
+		p.next()
+		f := digits + "." + p.digits(10)
+		if c := p.peek(); c == 'e' || c == 'E' {
+			p.next()
+			f += "e"
+			if c := p.peek(); c == '-' || c == '+' {
+				f += string(p.next())
+			}
+			f += p.digits(10)
+		}
+		value, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, p.errorf("wrong float %s", f)
+		}
+		if negative {
+			value = -value
+		}
+		return value, nil
+	}
+
+	i, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, p.errorf("wrong integer %s", digits)
+	}
+	if negative {
+		i.Neg(i)
+	}
+	if i.IsInt64() && int64(int(i.Int64())) == i.Int64() {
+		return int(i.Int64()), nil
+	}
+	return i, nil
+}
+
+// digits reads the digits of the given base skipping the separators (1_000)
+func (p *termParser) digits(base int) string {
+	var b strings.Builder
+	for p.eof() == false {
+		c := p.peek()
+		if c == '_' && b.Len() > 0 && p.pos+1 < len(p.s) && isDigit(rune(p.s[p.pos+1]), base) {
+			p.next()
+			continue
+		}
+		if isDigit(c, base) == false {
+			break
+		}
+		b.WriteRune(p.next())
+	}
+	return b.String()
+}
+
+func isDigit(c rune, base int) bool {
+	var v int
+	switch {
+	case c >= '0' && c <= '9':
+		v = int(c - '0')
+	case c >= 'a' && c <= 'z':
+		v = int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		v = int(c-'A') + 10
+	default:
+		return false
+	}
+	return v < base
+}
+
+// binary parses <<...>>. Segments are strings, integers and Integer:Size (in bits).
+func (p *termParser) binary() (Term, error) {
+	p.next()
+	p.next()
+	w := bitWriter{}
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], ">>") {
+		p.next()
+		p.next()
+		return []byte{}, nil
+	}
+	for {
+		p.skipSpace()
+		if p.peek() == '"' {
+			s, err := p.stringLiteral()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(p.s[p.pos:], "/utf8") {
+				p.pos += len("/utf8")
+				for _, c := range []byte(s.(string)) {
+					w.write(uint64(c), 8)
+				}
+			} else {
+				for _, c := range s.(string) {
+					if c > 255 {
+						return nil, p.errorf("character %q doesn't fit a byte (use /utf8)", c)
+					}
+					w.write(uint64(c), 8)
+				}
+			}
+		} else {
+			v, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			value, ok := TermToInt64(v)
+			if !ok {
+				return nil, p.errorf("wrong segment %s", Format(v))
+			}
+			size := 8
+			if p.peek() == ':' {
+				p.next()
+				s, err := strconv.Atoi(p.digits(10))
+				if err != nil || s < 1 || s > 64 {
+					return nil, p.errorf("wrong segment size")
+				}
+				size = s
+			}
+			w.write(uint64(value), size)
+		}
+
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.next()
+			continue
+		}
+		if err := p.expect(">>"); err != nil {
+			return nil, err
+		}
+		return w.term(), nil
+	}
+}
+
+type bitWriter struct {
+	bytes []byte
+	bits  int
+}
+
+func (w *bitWriter) write(value uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.bytes = append(w.bytes, 0)
+		}
+		if value>>uint(i)&1 == 1 {
+			w.bytes[len(w.bytes)-1] |= 1 << uint(7-w.bits%8)
+		}
+		w.bits++
+	}
+}
+
+func (w *bitWriter) term() Term {
+	if w.bits%8 == 0 {
+		return w.bytes
+	}
+	return BitString{Bytes: w.bytes, Bits: uint8(w.bits % 8)}
+}
@@ -0,0 +1,162 @@
+package etf
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	cases := []struct {
+		term     Term
+		expected string
+	}{
+		{Atom("ok"), "ok"},
+		{Atom("node@host"), "node@host"},
+		{Atom("Hello world"), "'Hello world'"},
+		{Atom("it's"), "'it\\'s'"},
+		{Atom("receive"), "'receive'"},
+		{Atom(""), "''"},
+		{true, "true"},
+		{123, "123"},
+		{int64(-5), "-5"},
+		{bigInt, "123456789012345678901234567890"},
+		{3.14, "3.14"},
+		{1.0, "1.0"},
+		{1e21, "1.0e21"},
+		{1.5e-7, "1.5e-7"},
+		{"text\n", "\"text\\n\""},
+		{[]byte("abc"), "<<\"abc\">>"},
+		{[]byte{1, 2, 255}, "<<1,2,255>>"},
+		{[]byte{}, "<<>>"},
+		{String("abc"), "<<\"abc\">>"},
+		{BitString{Bytes: []byte{1, 0xf0}, Bits: 4}, "<<1,15:4>>"},
+		{List{}, "[]"},
+		{List{1, Atom("a"), List{2}}, "[1,a,[2]]"},
+		{ListImproper{Atom("a"), Atom("b"), Atom("c")}, "[a,b|c]"},
+		{Tuple{Atom("ok"), List{1, 2, []byte("x")}, Map{Atom("a"): Atom("b")}}, "{ok,[1,2,<<\"x\">>],#{a => b}}"},
+		{Map{Atom("b"): 2, Atom("a"): 1}, "#{a => 1,b => 2}"},
+		{Export{Module: "erlang", Function: "self", Arity: 0}, "fun erlang:self/0"},
+		{Function{Module: "erl_eval", OldIndex: 6, OldUnique: 12345}, "#Fun<erl_eval.6.12345>"},
+		{Pid{}, "<0.0.0>"},
+		{Ref{ID: [5]uint32{1, 2, 3}}, "#Ref<0.1.2.3>"},
+		{Port{ID: 5}, "#Port<0.5>"},
+		{[]int{1, 2}, "[1,2]"},
+	}
+
+	for _, c := range cases {
+		if s := Format(c.term); s != c.expected {
+			t.Fatalf("expected %s got %s", c.expected, s)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	cases := []struct {
+		text     string
+		expected Term
+	}{
+		{"ok", Atom("ok")},
+		{"'Hello world'", Atom("Hello world")},
+		{"'it\\'s'", Atom("it's")},
+		{"true.", true},
+		{"123", 123},
+		{"-5", -5},
+		{"1_000_000", 1000000},
+		{"16#FF", 255},
+		{"2#1010", 10},
+		{"$a", 97},
+		{"$\\n", 10},
+		{"123456789012345678901234567890", bigInt},
+		{"3.14", 3.14},
+		{"-1.5e-7", -1.5e-7},
+		{"\"text\\n\\x{41}\\101\"", "text\nAA"},
+		{"\"abc\" \"def\"", "abcdef"},
+		{"<<\"abc\">>", []byte("abc")},
+		{"<<1, 2, 255>>", []byte{1, 2, 255}},
+		{"<<\"a\", 1, \"é\"/utf8>>", []byte{'a', 1, 0xc3, 0xa9}},
+		{"<<>>", []byte{}},
+		{"<<1,15:4>>", BitString{Bytes: []byte{1, 0xf0}, Bits: 4}},
+		{"[]", List{}},
+		{"[1, a, [2]]", List{1, Atom("a"), List{2}}},
+		{"[a, b | c]", ListImproper{Atom("a"), Atom("b"), Atom("c")}},
+		{"[a | [b]]", List{Atom("a"), Atom("b")}},
+		{"{}", Tuple{}},
+		{"{ok, [1,2,<<\"x\">>], #{a => b}}", Tuple{Atom("ok"), List{1, 2, []byte("x")}, Map{Atom("a"): Atom("b")}}},
+		{"#{}", Map{}},
+		{"fun erlang:self/0", Export{Module: "erlang", Function: "self", Arity: 0}},
+		{"{a, % comment\n b}", Tuple{Atom("a"), Atom("b")}},
+	}
+
+	for _, c := range cases {
+		term, err := Parse(c.text)
+		if err != nil {
+			t.Fatalf("%s: %s", c.text, err)
+		}
+		if !reflect.DeepEqual(term, c.expected) {
+			t.Fatalf("%s: expected %#v got %#v", c.text, c.expected, term)
+		}
+	}
+
+	wrong := []string{
+		"",
+		"{a, b",
+		"[a, b",
+		"X",
+		"{a} b",
+		"#rec{a = 1}",
+		"<<\"ё\">>",
+		"#{[a] => 1}",
+		"'unterminated",
+		"<<1:100>>",
+	}
+	for _, text := range wrong {
+		if _, err := Parse(text); err == nil {
+			t.Fatalf("%q: expected error", text)
+		}
+	}
+}
+
+func TestFormatParse(t *testing.T) {
+	term := Tuple{
+		Atom("ok"),
+		Atom("Quoted 'atom'"),
+		List{1, -2, 3.5, "string", []byte("binary"), []byte{0, 1}},
+		ListImproper{1, 2},
+		Map{Atom("key"): Tuple{}, 1: List{}},
+		BitString{Bytes: []byte{0xa0}, Bits: 3},
+		Export{Module: "m", Function: "f", Arity: 2},
+	}
+	parsed, err := Parse(Format(term))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(term, parsed) {
+		t.Fatalf("expected %#v got %#v", term, parsed)
+	}
+}
+
+func TestConsult(t *testing.T) {
+	text := `
+	%% config
+	{app, [{key, value}]}.
+	{port, 8080}. % comment
+	`
+	terms, err := Consult(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Term{
+		Tuple{Atom("app"), List{Tuple{Atom("key"), Atom("value")}}},
+		Tuple{Atom("port"), 8080},
+	}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Fatalf("expected %#v got %#v", expected, terms)
+	}
+
+	if _, err := Consult("{a, b}"); err == nil {
+		t.Fatal("expected error (no dot)")
+	}
+}
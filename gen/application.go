@@ -31,24 +31,92 @@ const (
 	ApplicationStartTransient = "transient"
 )
 
+// ApplicationStartReason is passed to the StartWithReason callback
+// (see ApplicationStartWithReason).
+type ApplicationStartReason = string
+
+const (
+	// EnvKeyStartReason the name of the environment variable the start reason is passed
+	// to the application process with. It is removed from the environment on start,
+	// so the children don't inherit it.
+	EnvKeyStartReason = "ergo:StartReason"
+
+	// EnvKeyStopDeadline the name of the environment variable with the time (time.Time)
+	// the application must be stopped by. It is set by the node stopping the application,
+	// so the application doesn't wait for its children longer than the node does.
+	EnvKeyStopDeadline = "ergo:StopDeadline"
+
+	// start reasons:
+
+	// ApplicationStartReasonNormal the application is started as usual
+	ApplicationStartReasonNormal = "normal"
+
+	// ApplicationStartReasonFailover the distributed application is started
+	// because the node it was running on went down
+	ApplicationStartReasonFailover = "failover"
+
+	// ApplicationStartReasonTakeover the distributed application is started on
+	// the node with higher priority and is going to be stopped on the node it
+	// was running on before
+	ApplicationStartReasonTakeover = "takeover"
+
+	defaultApplicationStopTimeout = 5 * time.Second
+)
+
 // ApplicationBehavior interface
 type ApplicationBehavior interface {
 	ProcessBehavior
 	Load(args ...etf.Term) (ApplicationSpec, error)
 	Start(process Process, args ...etf.Term)
+	// ConfigChange invoked on the running application once its environment has been
+	// changed. The process environment already has the new values.
+	ConfigChange(process Process, changed map[string]interface{}, added map[string]interface{}, removed []string)
+	// PrepStop invoked before the application is stopped. Its children are still running.
+	PrepStop(process Process, reason string)
+	// Stop invoked once the application has been stopped. All its children are terminated.
+	Stop(reason string)
+}
+
+// ApplicationStartWithReason is an optional interface of ApplicationBehavior. If it is
+// implemented, StartWithReason is invoked instead of Start with the reason the application
+// is started for (the distributed application can be started on failover or takeover).
+type ApplicationStartWithReason interface {
+	StartWithReason(process Process, reason ApplicationStartReason, args ...etf.Term)
 }
 
 type ApplicationSpec struct {
 	sync.Mutex
-	Name         string
-	Description  string
-	Version      string
-	Lifespan     time.Duration
+	Name        string
+	Description string
+	Version     string
+	Lifespan    time.Duration
+	// Applications must be started before this application. They are started
+	// with the same start type.
 	Applications []string
-	Environment  map[string]interface{}
-	Children     []ApplicationChildSpec
-	Process      Process
-	StartType    ApplicationStartType
+	// IncludedApplications are not started on their own. Their children are
+	// started under this application and share its environment. The included
+	// application can be included by one application only.
+	IncludedApplications []string
+	Environment          map[string]interface{}
+	Children             []ApplicationChildSpec
+	Process              Process
+	StartType            ApplicationStartType
+	// Nodes makes the application distributed. It runs on exactly one of the
+	// given nodes (ordered by priority): on the first available one. If this
+	// node goes down the application fails over to the next one, and it is taken
+	// over back once it is started on the node with higher priority.
+	Nodes []string
+	// Upgrade instructions are applied on upgrading the running application
+	// to this version (see Node.ApplicationUpgrade)
+	Upgrade []ApplicationUpgrade
+}
+
+// ApplicationUpgrade replaces the behavior of the running processes (matched by
+// type) with the new one. Their state is migrated using the CodeChange callback
+// of the new behavior.
+type ApplicationUpgrade struct {
+	From ProcessBehavior
+	To   ServerBehavior
 }
 
 type ApplicationChildSpec struct {
@@ -68,24 +136,56 @@ type ApplicationInfo struct {
 	PID         etf.Pid
 }
 
+// ApplicationTree describes the application along with the applications
+// it depends on and the included ones
+type ApplicationTree struct {
+	ApplicationInfo
+	Applications []ApplicationTree
+	Included     []ApplicationTree
+}
+
+type applicationState struct {
+	spec *ApplicationSpec
+	// children of the application and its included applications
+	children []ApplicationChildSpec
+}
+
 func (a *Application) ProcessInit(p Process, args ...etf.Term) (ProcessState, error) {
 	spec, ok := p.Env("spec").(*ApplicationSpec)
 	if !ok {
 		return ProcessState{}, fmt.Errorf("ProcessInit: not an ApplicationBehavior")
 	}
-	// remove variable from the env
+	reason, ok := p.Env(EnvKeyStartReason).(ApplicationStartReason)
+	if !ok {
+		reason = ApplicationStartReasonNormal
+	}
+	included, _ := p.Env("included").([]*ApplicationSpec)
+	// remove variables from the env
 	p.SetEnv("spec", nil)
+	p.SetEnv("included", nil)
+	p.SetEnv(EnvKeyStartReason, nil)
 
 	p.SetTrapExit(true)
 
+	// environment of the included applications doesn't override the own one
+	for i := len(included) - 1; i >= 0; i-- {
+		for k, v := range included[i].Environment {
+			p.SetEnv(k, v)
+		}
+	}
 	if spec.Environment != nil {
 		for k, v := range spec.Environment {
 			p.SetEnv(k, v)
 		}
 	}
 
-	if !a.startChildren(p, spec.Children[:]) {
-		a.stopChildren(p.Self(), spec.Children[:], "failed")
+	children := append([]ApplicationChildSpec(nil), spec.Children...)
+	for i := range included {
+		children = append(children, included[i].Children...)
+	}
+
+	if !a.startChildren(p, children) {
+		a.stopChildren(p.Self(), children, "failed", time.Now().Add(defaultApplicationStopTimeout))
 		return ProcessState{}, fmt.Errorf("failed")
 	}
 
@@ -93,17 +193,25 @@ func (a *Application) ProcessInit(p Process, args ...etf.Term) (ProcessState, er
 	if !ok {
 		return ProcessState{}, fmt.Errorf("ProcessInit: not an ApplicationBehavior")
 	}
-	behavior.Start(p, args...)
+	if withReason, ok := behavior.(ApplicationStartWithReason); ok {
+		withReason.StartWithReason(p, reason, args...)
+	} else {
+		behavior.Start(p, args...)
+	}
 	spec.Process = p
 
 	return ProcessState{
 		Process: p,
-		State:   spec,
+		State: &applicationState{
+			spec:     spec,
+			children: children,
+		},
 	}, nil
 }
 
 func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
-	spec := ps.State.(*ApplicationSpec)
+	state := ps.State.(*applicationState)
+	spec := state.spec
 	defer func() { spec.Process = nil }()
 
 	if spec.Lifespan == 0 {
@@ -111,6 +219,7 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 	}
 
 	chs := ps.ProcessChannels()
+	behavior := ps.Behavior().(ApplicationBehavior)
 
 	timer := time.NewTimer(spec.Lifespan)
 	// timer must be stopped explicitly to prevent of timer leaks
@@ -124,18 +233,22 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			terminated := ex.From
 			reason := ex.Reason
 			if ex.From == ps.Self() {
-				childrenStopped := a.stopChildren(terminated, spec.Children, reason)
+				deadline := stopDeadline(ps)
+				ps.SetEnv(EnvKeyStopDeadline, nil)
+				behavior.PrepStop(ps, reason)
+				childrenStopped := a.stopChildren(terminated, state.children, reason, deadline)
 				if !childrenStopped {
 					fmt.Printf("Warining: application can't be stopped. Some of the children are still running")
 					continue
 				}
+				behavior.Stop(reason)
 				return ex.Reason
 			}
 
 			unknownChild := true
 
-			for i := range spec.Children {
-				child := spec.Children[i].process
+			for i := range state.children {
+				child := state.children[i].process
 				if child == nil {
 					continue
 				}
@@ -151,9 +264,11 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 
 			switch spec.StartType {
 			case ApplicationStartPermanent:
-				a.stopChildren(terminated, spec.Children, string(reason))
+				behavior.PrepStop(ps, "shutdown")
+				a.stopChildren(terminated, state.children, string(reason), stopDeadline(ps))
 				fmt.Printf("Application child %s (at %s) stopped with reason %s (permanent: node is shutting down)\n",
 					terminated, ps.NodeName(), reason)
+				behavior.Stop("shutdown")
 				ps.NodeStop()
 				return "shutdown"
 
@@ -163,9 +278,11 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 						terminated, ps.NodeName(), reason)
 					continue
 				}
-				a.stopChildren(terminated, spec.Children, reason)
+				behavior.PrepStop(ps, reason)
+				a.stopChildren(terminated, state.children, reason, stopDeadline(ps))
 				fmt.Printf("Application child %s (at %s) stopped with reason %s. (transient: node is shutting down)\n",
 					terminated, ps.NodeName(), reason)
+				behavior.Stop(reason)
 				ps.NodeStop()
 				return string(reason)
 
@@ -178,11 +295,11 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			switch direct.Message.(type) {
 			case MessageDirectChildren:
 				pids := []etf.Pid{}
-				for i := range spec.Children {
-					if spec.Children[i].process == nil {
+				for i := range state.children {
+					if state.children[i].process == nil {
 						continue
 					}
-					pids = append(pids, spec.Children[i].process.Self())
+					pids = append(pids, state.children[i].process.Self())
 				}
 
 				direct.Message = pids
@@ -211,9 +328,19 @@ func (a *Application) ProcessLoop(ps ProcessState, started chan<- bool) string {
 	}
 }
 
-func (a *Application) stopChildren(from etf.Pid, children []ApplicationChildSpec, reason string) bool {
+// stopDeadline returns the time the application must be stopped by. It is set in
+// the process environment (EnvKeyStopDeadline) by the node stopping this application.
+func stopDeadline(p Process) time.Time {
+	if deadline, ok := p.Env(EnvKeyStopDeadline).(time.Time); ok {
+		return deadline
+	}
+	return time.Now().Add(defaultApplicationStopTimeout)
+}
+
+func (a *Application) stopChildren(from etf.Pid, children []ApplicationChildSpec, reason string, deadline time.Time) bool {
 	childrenStopped := true
-	for i := range children {
+	// in the reverse order
+	for i := len(children) - 1; i >= 0; i-- {
 		child := children[i].process
 		if child == nil {
 			continue
@@ -232,7 +359,9 @@ func (a *Application) stopChildren(from etf.Pid, children []ApplicationChildSpec
 			continue
 		}
 
-		if err := child.WaitWithTimeout(5 * time.Second); err != nil {
+		// supervisor terminates its children respecting their shutdown
+		// options, but it can't take longer than the caller is waiting for
+		if err := child.WaitWithTimeout(time.Until(deadline)); err != nil {
 			childrenStopped = false
 			continue
 		}
@@ -247,11 +376,26 @@ func (a *Application) startChildren(parent Process, children []ApplicationChildS
 	for i := range children {
 		// i know, it looks weird to use the funcion from supervisor file.
 		// will move it to somewhere else, but let it be there for a while.
-		p := startChild(parent, children[i].Name, children[i].Child, children[i].Args...)
-		if p == nil {
-			return false
+		p, err := spawnLocalChild(parent, children[i].Name, children[i].Child, children[i].Args...)
+		if err != nil {
+			panic(err)
 		}
 		children[i].process = p
 	}
 	return true
 }
+
+//
+// default callbacks for Application interface
+//
+func (a *Application) ConfigChange(process Process, changed map[string]interface{}, added map[string]interface{}, removed []string) {
+	return
+}
+
+func (a *Application) PrepStop(process Process, reason string) {
+	return
+}
+
+func (a *Application) Stop(reason string) {
+	return
+}
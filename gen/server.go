@@ -38,6 +38,16 @@ type ServerBehavior interface {
 	// Terminate invoked on a termination process. ServerProcess.State is not locked during
 	// this callback.
 	Terminate(process *ServerProcess, reason string)
+
+	// Version returns the version of the behavior. It is passed to the CodeChange callback
+	// of the new behavior once the running process is upgraded.
+	Version() string
+
+	// CodeChange invoked on the new behavior replacing the current one of the running
+	// process (see MessageDirectCodeChange). Returns the migrated state. The process keeps
+	// the current behavior and the state if it returns error. The process is suspended
+	// during this callback, so it must not make Call requests.
+	CodeChange(process *ServerProcess, oldVersion string, state interface{}) (interface{}, error)
 }
 
 type ServerStatus error
@@ -71,6 +81,10 @@ type ServerProcess struct {
 	currentFunction string
 	trapExit        bool
 
+	suspended      bool
+	suspendedQueue []ProcessMailboxMessage
+	debug          sysDebug
+
 	mailbox  <-chan ProcessMailboxMessage
 	original <-chan ProcessMailboxMessage
 	deferred chan ProcessMailboxMessage
@@ -78,6 +92,14 @@ type ServerProcess struct {
 	waitReply         *etf.Ref
 	callbackWaitReply chan *etf.Ref
 	stop              chan string
+
+	reporter callbackReporter
+}
+
+// callbackReporter is implemented by the node process. Reports the duration of
+// the callback to the system monitor (if enabled).
+type callbackReporter interface {
+	ReportCallbackDuration(callback string, message etf.Term, duration time.Duration)
 }
 
 type handleCallMessage struct {
@@ -161,6 +183,54 @@ func (sp *ServerProcess) CastRPC(node, module, function string, args ...etf.Term
 	return sp.Cast(to, message)
 }
 
+// CallFun applies the fun (etf.Export or etf.Function) to the given arguments using
+// erlang:apply/2 via rpc on the given node. If node is empty the closure (etf.Function)
+// is applied on the node it was created on, the external fun (etf.Export) - on the local
+// node (see Node.ProvideRPC).
+func (sp *ServerProcess) CallFun(node string, fun etf.Term, args ...etf.Term) (etf.Term, error) {
+	return sp.CallFunWithTimeout(DefaultCallTimeout, node, fun, args...)
+}
+
+// CallFunWithTimeout applies the fun to the given arguments with timeout (see CallFun)
+func (sp *ServerProcess) CallFunWithTimeout(timeout int, node string, fun etf.Term, args ...etf.Term) (etf.Term, error) {
+	node, err := sp.funNode(node, fun, len(args))
+	if err != nil {
+		return nil, err
+	}
+	return sp.CallRPCWithTimeout(timeout, node, "erlang", "apply", fun, etf.List(args))
+}
+
+// CastFun applies the fun to the given arguments asynchronously (see CallFun)
+func (sp *ServerProcess) CastFun(node string, fun etf.Term, args ...etf.Term) error {
+	node, err := sp.funNode(node, fun, len(args))
+	if err != nil {
+		return err
+	}
+	return sp.CastRPC(node, "erlang", "apply", fun, etf.List(args))
+}
+
+func (sp *ServerProcess) funNode(node string, fun etf.Term, arity int) (string, error) {
+	switch f := fun.(type) {
+	case etf.Export:
+		if f.Arity != arity {
+			return "", ErrFunArity
+		}
+		if node == "" {
+			node = sp.NodeName()
+		}
+	case etf.Function:
+		if int(f.Arity) != arity {
+			return "", ErrFunArity
+		}
+		if node == "" {
+			node = string(f.Pid.Node)
+		}
+	default:
+		return "", ErrFunUnsupported
+	}
+	return node, nil
+}
+
 // SendReply sends a reply message to the sender made ServerProcess.Call request.
 // Useful for the case with dispatcher and pool of workers: Dispatcher process
 // forwards Call requests (asynchronously) within a HandleCall callback to the worker(s)
@@ -168,6 +238,10 @@ func (sp *ServerProcess) CastRPC(node, module, function string, args ...etf.Term
 // instead of ServerStatusOK; Worker process sends result using ServerProcess.SendReply
 // method with 'from' value received from the Dispatcher.
 func (sp *ServerProcess) SendReply(from ServerFrom, reply etf.Term) error {
+	return sendReply(sp, from, reply)
+}
+
+func sendReply(p Process, from ServerFrom, reply etf.Term) error {
 	var fromTag etf.Term
 	var to etf.Term
 	if from.ReplyByAlias {
@@ -181,10 +255,37 @@ func (sp *ServerProcess) SendReply(from ServerFrom, reply etf.Term) error {
 
 	if reply != nil {
 		rep := etf.Tuple{fromTag, reply}
-		return sp.Send(to, rep)
+		return p.Send(to, rep)
 	}
 	rep := etf.Tuple{fromTag, etf.Atom("nil")}
-	return sp.Send(to, rep)
+	return p.Send(to, rep)
+}
+
+// parseServerFrom parses the 'from' value of the $gen_call message {Pid, Ref} or
+// {Pid, [alias|Ref]}
+func parseServerFrom(term etf.Term) (ServerFrom, bool) {
+	var from ServerFrom
+	fromTuple, ok := term.(etf.Tuple)
+	if !ok || len(fromTuple) != 2 {
+		return from, false
+	}
+	from.Pid, ok = fromTuple.Element(1).(etf.Pid)
+	if !ok {
+		return from, false
+	}
+	switch v := fromTuple.Element(2).(type) {
+	case etf.Ref:
+		from.Ref = v
+		return from, true
+	case etf.List:
+		if len(v) != 2 || v.Element(1) != etf.Atom("alias") {
+			return from, false
+		}
+		from.Ref, ok = v.Element(2).(etf.Ref)
+		from.ReplyByAlias = true
+		return from, ok
+	}
+	return from, false
 }
 
 func (gs *Server) ProcessInit(p Process, args ...etf.Term) (ProcessState, error) {
@@ -205,6 +306,7 @@ func (gs *Server) ProcessInit(p Process, args ...etf.Term) (ProcessState, error)
 		// a message to the nil channel)
 		callbackWaitReply: make(chan *etf.Ref),
 	}
+	gsp.reporter, _ = p.(callbackReporter)
 
 	err := behavior.Init(gsp, args...)
 	if err != nil {
@@ -243,44 +345,50 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 		var message etf.Term
 		var fromPid etf.Pid
 
-		select {
-		case ex := <-channels.GracefulExit:
-			if !gsp.TrapExit() {
-				gsp.behavior.Terminate(gsp, ex.Reason)
-				return ex.Reason
-			}
-			// Enabled trap exit message. Transform exit signal
-			// into MessageExit and send it to itself as a regular message
-			// keeping the processing order right.
-			// We should process this message after the others we got earlier
-			// from the died process.
-			message = MessageExit{
-				Pid:    ex.From,
-				Reason: ex.Reason,
+		if gsp.suspended == false && gsp.waitReply == nil && len(gsp.suspendedQueue) > 0 {
+			// the messages received while the process was suspended go first
+			message = gsp.suspendedQueue[0].Message
+			gsp.suspendedQueue = gsp.suspendedQueue[1:]
+		} else {
+			select {
+			case ex := <-channels.GracefulExit:
+				if !gsp.TrapExit() {
+					gsp.behavior.Terminate(gsp, ex.Reason)
+					return ex.Reason
+				}
+				// Enabled trap exit message. Transform exit signal
+				// into MessageExit and send it to itself as a regular message
+				// keeping the processing order right.
+				// We should process this message after the others we got earlier
+				// from the died process.
+				message = MessageExit{
+					Pid:    ex.From,
+					Reason: ex.Reason,
+				}
+				// We can't write this message to the mailbox directly so use
+				// the common way to send it to itself
+				ps.Send(ps.Self(), message)
+				continue
+
+			case reason := <-gsp.stop:
+				gsp.behavior.Terminate(gsp, reason)
+				return reason
+
+			case msg := <-gsp.mailbox:
+				gsp.mailbox = gsp.original
+				fromPid = msg.From
+				message = msg.Message
+
+			case <-gsp.Context().Done():
+				gsp.behavior.Terminate(gsp, "kill")
+				return "kill"
+
+			case direct := <-channels.Direct:
+				gsp.waitCallbackOrDeferr(direct)
+				continue
+			case gsp.waitReply = <-gsp.callbackWaitReply:
+				continue
 			}
-			// We can't write this message to the mailbox directly so use
-			// the common way to send it to itself
-			ps.Send(ps.Self(), message)
-			continue
-
-		case reason := <-gsp.stop:
-			gsp.behavior.Terminate(gsp, reason)
-			return reason
-
-		case msg := <-gsp.mailbox:
-			gsp.mailbox = gsp.original
-			fromPid = msg.From
-			message = msg.Message
-
-		case <-gsp.Context().Done():
-			gsp.behavior.Terminate(gsp, "kill")
-			return "kill"
-
-		case direct := <-channels.Direct:
-			gsp.waitCallbackOrDeferr(direct)
-			continue
-		case gsp.waitReply = <-gsp.callbackWaitReply:
-			continue
 		}
 
 		lib.Log("[%s] GEN_SERVER %s got message from %s", gsp.NodeName(), gsp.Self(), fromPid)
@@ -374,6 +482,14 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 					}
 					gsp.waitCallbackOrDeferr(castMessage)
 					continue
+
+				case etf.Atom("system"):
+					system, ok := parseSystemMessage(m)
+					if !ok {
+						break
+					}
+					gsp.waitCallbackOrDeferr(system)
+					continue
 				}
 			}
 
@@ -391,6 +507,8 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 			gsp.waitCallbackOrDeferr(message)
 		case ProcessDirectMessage:
 			gsp.waitCallbackOrDeferr(message)
+		case systemMessage:
+			gsp.waitCallbackOrDeferr(message)
 
 		default:
 			lib.Log("m: %#v", m)
@@ -405,6 +523,36 @@ func (gs *Server) ProcessLoop(ps ProcessState, started chan<- bool) string {
 // ServerProcess handlers
 
 func (gsp *ServerProcess) waitCallbackOrDeferr(message interface{}) {
+	if gsp.waitReply == nil {
+		handled := true
+		switch m := message.(type) {
+		case ProcessDirectMessage:
+			handled = gsp.handleSystemDirect(m)
+		case systemMessage:
+			handleSystemMessage(gsp, &gsp.debug, m)
+		default:
+			handled = false
+		}
+		if handled {
+			if gsp.suspended == false && len(gsp.deferred) > 0 {
+				gsp.mailbox = gsp.deferred
+			}
+			return
+		}
+
+		if gsp.suspended && message != nil {
+			// keep it until the process is resumed. the system messages are still
+			// handled, so the mailbox is read and the queue is limited by its size
+			if len(gsp.suspendedQueue) >= cap(gsp.original) {
+				fmt.Printf("WARNING! suspended queue of %s[%q] is full. dropped message %v\n",
+					gsp.Self(), gsp.Name(), message)
+				return
+			}
+			gsp.suspendedQueue = append(gsp.suspendedQueue, ProcessMailboxMessage{Message: message})
+			return
+		}
+	}
+
 	if gsp.waitReply != nil {
 		// already waiting for reply. deferr this message
 		deferred := ProcessMailboxMessage{
@@ -461,6 +609,52 @@ func (gsp *ServerProcess) waitCallbackOrDeferr(message interface{}) {
 	}
 }
 
+// handleSystemDirect handles the direct requests to suspend, resume and upgrade
+// the process. They are handled in the loop between the callbacks.
+func (gsp *ServerProcess) handleSystemDirect(direct ProcessDirectMessage) bool {
+	switch m := direct.Message.(type) {
+	case MessageDirectSuspend:
+		gsp.suspended = true
+		direct.Message = nil
+		direct.Err = nil
+
+	case MessageDirectResume:
+		gsp.suspended = false
+		direct.Message = nil
+		direct.Err = nil
+
+	case MessageDirectCodeChange:
+		direct.Message = nil
+		direct.Err = gsp.codeChange(m.To)
+
+	default:
+		return false
+	}
+
+	direct.Reply <- direct
+	return true
+}
+
+func (gsp *ServerProcess) codeChange(behavior ServerBehavior) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("CodeChange panic: %#v", r)
+		}
+	}()
+
+	cf := gsp.currentFunction
+	gsp.currentFunction = "Server:CodeChange"
+	defer func() { gsp.currentFunction = cf }()
+
+	state, err := behavior.CodeChange(gsp, gsp.behavior.Version(), gsp.State)
+	if err != nil {
+		return err
+	}
+	gsp.State = state
+	gsp.behavior = behavior
+	return nil
+}
+
 func (gsp *ServerProcess) panicHandler() {
 	if r := recover(); r != nil {
 		pc, fn, line, _ := runtime.Caller(2)
@@ -489,6 +683,13 @@ func (gsp *ServerProcess) handleDirect(direct ProcessDirectMessage) {
 	return
 }
 
+func (gsp *ServerProcess) reportCallback(callback string, message etf.Term, started time.Time) {
+	if gsp.reporter == nil {
+		return
+	}
+	gsp.reporter.ReportCallbackDuration(callback, message, time.Since(started))
+}
+
 func (gsp *ServerProcess) handleCall(m handleCallMessage) {
 	if lib.CatchPanic() {
 		defer gsp.panicHandler()
@@ -496,11 +697,15 @@ func (gsp *ServerProcess) handleCall(m handleCallMessage) {
 
 	cf := gsp.currentFunction
 	gsp.currentFunction = "Server:HandleCall"
+	gsp.debug.in(gsp, "got call %v from %s", m.message, m.from.Pid)
+	started := time.Now()
 	reply, status := gsp.behavior.HandleCall(gsp, m.from, m.message)
+	gsp.reportCallback("HandleCall", m.message, started)
 	gsp.currentFunction = cf
 	switch status {
 	case ServerStatusOK:
 		gsp.SendReply(m.from, reply)
+		gsp.debug.out(gsp, "sent %v to %s", reply, m.from.Pid)
 	case ServerStatusIgnore:
 		return
 	case ServerStatusStop:
@@ -518,7 +723,10 @@ func (gsp *ServerProcess) handleCast(m handleCastMessage) {
 
 	cf := gsp.currentFunction
 	gsp.currentFunction = "Server:HandleCast"
+	gsp.debug.in(gsp, "got cast %v", m.message)
+	started := time.Now()
 	status := gsp.behavior.HandleCast(gsp, m.message)
+	gsp.reportCallback("HandleCast", m.message, started)
 	gsp.currentFunction = cf
 
 	switch status {
@@ -538,7 +746,10 @@ func (gsp *ServerProcess) handleInfo(m handleInfoMessage) {
 
 	cf := gsp.currentFunction
 	gsp.currentFunction = "Server:HandleInfo"
+	gsp.debug.in(gsp, "got %v", m.message)
+	started := time.Now()
 	status := gsp.behavior.HandleInfo(gsp, m.message)
+	gsp.reportCallback("HandleInfo", m.message, started)
 	gsp.currentFunction = cf
 	switch status {
 	case ServerStatusOK, ServerStatusIgnore:
@@ -579,3 +790,11 @@ func (gs *Server) HandleInfo(process *ServerProcess, message etf.Term) ServerSta
 func (gs *Server) Terminate(process *ServerProcess, reason string) {
 	return
 }
+
+func (gs *Server) Version() string {
+	return ""
+}
+
+func (gs *Server) CodeChange(process *ServerProcess, oldVersion string, state interface{}) (interface{}, error) {
+	return state, nil
+}
@@ -2,6 +2,9 @@ package gen
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
@@ -18,11 +21,38 @@ type SupervisorStrategy struct {
 	Type      SupervisorStrategyType
 	Intensity uint16
 	Period    uint16
-	Restart   SupervisorStrategyRestart
+	// Restart defines the restart type for the children with no Restart value in their specs
+	Restart SupervisorStrategyRestart
+	// AutoShutdown defines whether the supervisor stops itself once the significant
+	// children terminate (see SupervisorChildSpec.Significant). Default is never.
+	AutoShutdown SupervisorAutoShutdown
+	// Backoff defines the delay between the restarts of the children with
+	// no Backoff value in their specs. Disabled by default.
+	Backoff SupervisorBackoff
+}
+
+// SupervisorBackoff defines the exponential backoff between the restarts of the child.
+// The delay before the restart is Min * Factor^(N-1), where N is the number of the
+// child failures in a row, but not greater than Max. The child failure counter is reset
+// once the child runs longer than Reset.
+type SupervisorBackoff struct {
+	// Min the delay before the first restart. Zero value disables backoff.
+	Min time.Duration
+	// Max the maximum delay. Default is 30 seconds (or Min if it is greater).
+	Max time.Duration
+	// Factor the multiplier of the delay for the next restart. Default is 2.
+	Factor float64
+	// Jitter randomly decreases the delay by up to this fraction of it (0..1).
+	Jitter float64
+	// Reset the time the child must run to be considered healthy. Default is Max.
+	Reset time.Duration
 }
 
 type SupervisorStrategyType = string
 type SupervisorStrategyRestart = string
+type SupervisorAutoShutdown = string
+type SupervisorChildType = string
+type SupervisorChildCircuit = string
 
 const (
 	// Restart strategies:
@@ -69,9 +99,69 @@ const (
 	// than normal, shutdown.
 	SupervisorStrategyRestartTransient = SupervisorStrategyRestart("transient")
 
+	// Auto shutdown:
+
+	// SupervisorAutoShutdownNever automatic shutdown is disabled. This is the default setting.
+	// Significant children are not allowed with this option.
+	SupervisorAutoShutdownNever = SupervisorAutoShutdown("never")
+
+	// SupervisorAutoShutdownAnySignificant the supervisor will shut down itself (with
+	// the reason "shutdown") when any significant child terminates, that is, when
+	// a transient significant child terminates normally or when a temporary significant
+	// child terminates normally or abnormally.
+	SupervisorAutoShutdownAnySignificant = SupervisorAutoShutdown("any_significant")
+
+	// SupervisorAutoShutdownAllSignificant the supervisor will shut down itself when
+	// all significant children have terminated.
+	SupervisorAutoShutdownAllSignificant = SupervisorAutoShutdown("all_significant")
+
+	// Child types:
+
+	// SupervisorChildTypeWorker child process is a worker
+	SupervisorChildTypeWorker = SupervisorChildType("worker")
+
+	// SupervisorChildTypeSupervisor child process is a supervisor
+	SupervisorChildTypeSupervisor = SupervisorChildType("supervisor")
+
+	// Shutdown options:
+
+	// SupervisorShutdownDefault means 5 seconds for a worker and infinity for a supervisor
+	SupervisorShutdownDefault = time.Duration(0)
+
+	// SupervisorShutdownBrutalKill child process is unconditionally killed
+	SupervisorShutdownBrutalKill = time.Duration(-1)
+
+	// SupervisorShutdownInfinity supervisor waits for the child process termination
+	// with no time limit
+	SupervisorShutdownInfinity = time.Duration(-2)
+
+	supervisorShutdownWorker = 5 * time.Second
+
+	// Circuit states of the child:
+
+	// SupervisorChildCircuitClosed child is running normally
+	SupervisorChildCircuitClosed = SupervisorChildCircuit("closed")
+
+	// SupervisorChildCircuitOpen child has failed and is waiting for the backoff
+	// delay before the restart
+	SupervisorChildCircuitOpen = SupervisorChildCircuit("open")
+
+	// SupervisorChildCircuitHalfOpen child has been restarted after the backoff delay
+	// and hasn't yet been running long enough (SupervisorBackoff.Reset) to be considered
+	// healthy. The next failure increases the delay.
+	SupervisorChildCircuitHalfOpen = SupervisorChildCircuit("half_open")
+
+	supervisorBackoffMax    = 30 * time.Second
+	supervisorBackoffFactor = 2
+
+	// the delay before the next attempt to start the remote child
+	// if the backoff is disabled for it
+	supervisorRemoteRetry = time.Second
+
 	supervisorChildStateStart    = 0
 	supervisorChildStateRunning  = 1
 	supervisorChildStateDisabled = -1
+	supervisorChildStateBackoff  = 2
 )
 
 type supervisorChildState int
@@ -81,16 +171,77 @@ type SupervisorSpec struct {
 	Children []SupervisorChildSpec
 	Strategy SupervisorStrategy
 	restarts []int64
+	// exit signals received while the supervisor was waiting
+	// for the termination of the remote child
+	exits []ProcessGracefulExitRequest
 }
 
 type SupervisorChildSpec struct {
-	// Node to run child on remote node
-	Node    string
-	Name    string
-	Child   ProcessBehavior
-	Args    []etf.Term
+	// Node to run child on remote node. The child is spawned using RemoteSpawn with
+	// the RemoteBehavior name, so the Child value is not used.
+	Node string
+	// RemoteBehavior the name of the behavior provided by the remote node
+	// using ProvideRemoteSpawn
+	RemoteBehavior string
+	// FailoverNodes the list of nodes to try (in order) if the child can't be
+	// started on the Node
+	FailoverNodes []string
+
+	Name  string
+	Child ProcessBehavior
+	Args  []etf.Term
+	// Restart overrides the restart type of the supervisor strategy for this child
+	Restart SupervisorStrategyRestart
+	// Shutdown defines how the child process is terminated: SupervisorShutdownBrutalKill,
+	// SupervisorShutdownInfinity or the time to wait for its termination after sending
+	// the exit signal. It is killed once this time is exceeded. Default value is 5 seconds
+	// for a worker and infinity for a supervisor.
+	Shutdown time.Duration
+	// Type of the child process. It is detected by the Child value if not defined.
+	Type SupervisorChildType
+	// Significant child triggers the automatic shutdown of the supervisor
+	// (see SupervisorStrategy.AutoShutdown). It must be transient or temporary.
+	Significant bool
+	// Backoff overrides the backoff options of the supervisor strategy for this child
+	Backoff SupervisorBackoff
+
 	state   supervisorChildState // for internal usage
-	process Process
+	process supervisorChildProcess
+	// for the backoff
+	started    time.Time
+	failures   int
+	restartAt  time.Time
+	backoffRef etf.Ref
+}
+
+// SupervisorChildInfo describes the child of the supervisor. Returned by WhichChildren.
+type SupervisorChildInfo struct {
+	Name string
+	// Process is nil if the child is not running or is running on a remote node
+	Process Process
+	// Pid of the running child (local or remote)
+	Pid etf.Pid
+	// Restarting is true if the child has been terminated and is going to be restarted
+	Restarting bool
+	Type       SupervisorChildType
+	// Circuit state of the child (see SupervisorBackoff)
+	Circuit SupervisorChildCircuit
+	// Failures the number of the child failures in a row
+	Failures int
+	// RestartAt is the time of the next restart if the circuit is open
+	RestartAt time.Time
+}
+
+// SupervisorChildrenCount returned by CountChildren
+type SupervisorChildrenCount struct {
+	// Specs the number of children (running or not)
+	Specs int
+	// Active the number of running children
+	Active int
+	// Supervisors the number of children with type supervisor
+	Supervisors int
+	// Workers the number of children with type worker
+	Workers int
 }
 
 // Supervisor is implementation of ProcessBehavior interface
@@ -101,6 +252,85 @@ type messageStartChild struct {
 	args []etf.Term
 }
 
+type messageStartChildSpec struct {
+	spec SupervisorChildSpec
+}
+
+type messageTerminateChild struct {
+	child interface{}
+}
+
+type messageRestartChild struct {
+	name string
+}
+
+type messageDeleteChild struct {
+	name string
+}
+
+type messageWhichChildren struct{}
+type messageCountChildren struct{}
+
+type messageBackoffRestart struct {
+	ref etf.Ref
+}
+
+// supervisorChildProcess is the running child. It is a Process for the local
+// child or *remoteChild for the child running on a remote node.
+type supervisorChildProcess interface {
+	Self() etf.Pid
+	IsAlive() bool
+	Exit(reason string) error
+	Kill()
+	Wait()
+	WaitWithTimeout(d time.Duration) error
+}
+
+// remoteChild is the child process spawned on a remote node. The supervisor
+// closes the done channel once it gets the exit signal from this process.
+type remoteChild struct {
+	supervisor Process
+	pid        etf.Pid
+	done       chan struct{}
+}
+
+func (rc *remoteChild) Self() etf.Pid {
+	return rc.pid
+}
+
+func (rc *remoteChild) IsAlive() bool {
+	select {
+	case <-rc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (rc *remoteChild) Exit(reason string) error {
+	return rc.supervisor.SendExit(rc.pid, reason)
+}
+
+func (rc *remoteChild) Kill() {
+	rc.supervisor.SendExit(rc.pid, "kill")
+}
+
+func (rc *remoteChild) Wait() {
+	<-rc.done
+}
+
+func (rc *remoteChild) WaitWithTimeout(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return fmt.Errorf("timeout")
+	case <-rc.done:
+		return nil
+	}
+}
+
 func (sv *Supervisor) ProcessInit(p Process, args ...etf.Term) (ProcessState, error) {
 	behavior, ok := p.Behavior().(SupervisorBehavior)
 	if !ok {
@@ -112,6 +342,19 @@ func (sv *Supervisor) ProcessInit(p Process, args ...etf.Term) (ProcessState, er
 	}
 	lib.Log("Supervisor spec %#v\n", spec)
 
+	// children keep the state of running processes. make a copy to
+	// start the supervisor with the same spec more than once
+	spec.Children = append([]SupervisorChildSpec(nil), spec.Children...)
+
+	if err := validateBackoff(spec.Strategy.Backoff); err != nil {
+		return ProcessState{}, err
+	}
+	for i := range spec.Children {
+		if err := validateChildSpec(&spec, &spec.Children[i]); err != nil {
+			return ProcessState{}, err
+		}
+	}
+
 	p.SetTrapExit(true)
 	return ProcessState{
 		Process: p,
@@ -127,59 +370,276 @@ func (sv *Supervisor) ProcessLoop(ps ProcessState, started chan<- bool) string {
 
 	waitTerminatingProcesses := []etf.Pid{}
 	chs := ps.ProcessChannels()
+	sys := &supervisorSys{
+		Process: ps.Process,
+		spec:    spec,
+	}
 
 	started <- true
 	for {
-		select {
-		case ex := <-chs.GracefulExit:
+		var event interface{}
+		if sys.suspended == false && len(sys.queue) > 0 {
+			// the events received while the supervisor was suspended go first
+			event = sys.queue[0]
+			sys.queue = sys.queue[1:]
+		} else if len(spec.exits) > 0 {
+			ex := spec.exits[0]
+			spec.exits = spec.exits[1:]
 			if ex.From == ps.Self() {
 				// stop supervisor gracefully
-				for i := range spec.Children {
-					p := spec.Children[i].process
-					if p != nil && p.IsAlive() {
-						p.Exit(ex.Reason)
-					}
-				}
+				terminateChildren(spec, ex.Reason)
 				return ex.Reason
 			}
-			waitTerminatingProcesses = handleMessageExit(ps, ex, spec, waitTerminatingProcesses)
+			event = ex
+		} else {
+			select {
+			case ex := <-chs.GracefulExit:
+				if ex.From == ps.Self() {
+					// stop supervisor gracefully
+					terminateChildren(spec, ex.Reason)
+					return ex.Reason
+				}
+				event = ex
+
+			case <-ps.Context().Done():
+				return "kill"
 
-		case <-ps.Context().Done():
-			return "kill"
+			case direct := <-chs.Direct:
+				event = direct
+
+			case m := <-chs.Mailbox:
+				if system, ok := parseSystemMessage(m.Message); ok {
+					// sys:get_state, sys:suspend and others from the Erlang side
+					handleSystemMessage(sys, &sys.debug, system)
+					continue
+				}
+				event = m
+			}
+		}
+
+		if sys.suspended {
+			// keep it until the supervisor is resumed
+			sys.queue = append(sys.queue, event)
+			continue
+		}
+		sys.reductions++
+
+		switch e := event.(type) {
+		case ProcessGracefulExitRequest:
+			sys.debug.in(ps, "got EXIT from %s with reason %s", e.From, e.Reason)
+			var stop string
+			waitTerminatingProcesses, stop = handleMessageExit(ps, e, spec, waitTerminatingProcesses)
+			if stop != "" {
+				// automatic shutdown
+				terminateChildren(spec, stop)
+				return stop
+			}
 
-		case direct := <-chs.Direct:
-			value, err := handleDirect(ps, spec, direct.Message)
+		case ProcessDirectMessage:
+			value, err := handleDirect(ps, spec, e.Message)
 			if err != nil {
-				direct.Message = nil
-				direct.Err = err
-				direct.Reply <- direct
+				e.Message = nil
+				e.Err = err
+				e.Reply <- e
 				continue
 			}
-			direct.Message = value
-			direct.Err = nil
-			direct.Reply <- direct
+			e.Message = value
+			e.Err = nil
+			e.Reply <- e
+
+		case ProcessMailboxMessage:
+			if b, ok := e.Message.(messageBackoffRestart); ok {
+				handleBackoffRestart(ps, spec, b.ref, len(waitTerminatingProcesses) == 0)
+				continue
+			}
+			sys.debug.in(ps, "got %v", e.Message)
+			// supervisor:which_children and others from the Erlang side
+			handleCall(ps, spec, e.Message)
+		}
+	}
+}
+
+// supervisorSys handles the system messages of the supervisor
+type supervisorSys struct {
+	Process
+	spec       *SupervisorSpec
+	suspended  bool
+	queue      []interface{}
+	reductions uint64
+	debug      sysDebug
+}
+
+// sysGetState returns the state of the supervisor as a term
+// {state, Strategy, Intensity, Period, Children}, where Children
+// is in the format of supervisor:which_children
+func (s *supervisorSys) sysGetState() interface{} {
+	info, _ := handleDirect(s.Process, s.spec, messageWhichChildren{})
+	children, _ := info.([]SupervisorChildInfo)
+	return etf.Tuple{
+		etf.Atom("state"),
+		etf.Atom(s.spec.Strategy.Type),
+		int(s.spec.Strategy.Intensity),
+		int(s.spec.Strategy.Period),
+		childrenTerm(s.spec, children),
+	}
+}
+
+// sysReplaceState applies the strategy, intensity and period of the replaced
+// state. The children can't be replaced this way (use StartChild, TerminateChild
+// and DeleteChild for that).
+func (s *supervisorSys) sysReplaceState(fun interface{}) (state interface{}, err error) {
+	f, ok := fun.(SysReplaceStateFun)
+	if !ok {
+		return nil, ErrUnsupportedRequest
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%#v", r)
+		}
+	}()
+	current := s.sysGetState().(etf.Tuple)
+	replaced, ok := f(current).(etf.Tuple)
+	if !ok || len(replaced) != len(current) || replaced.Element(1) != current.Element(1) {
+		return nil, fmt.Errorf("malformed supervisor state")
+	}
+	if !reflect.DeepEqual(replaced.Element(5), current.Element(5)) {
+		return nil, fmt.Errorf("supervisor children can't be replaced")
+	}
+	strategy, ok := replaced.Element(2).(etf.Atom)
+	if !ok {
+		return nil, fmt.Errorf("malformed supervisor strategy")
+	}
+	intensity, ok := etf.TermToUint(replaced.Element(3), 16)
+	if !ok {
+		return nil, fmt.Errorf("malformed supervisor intensity")
+	}
+	period, ok := etf.TermToUint(replaced.Element(4), 16)
+	if !ok {
+		return nil, fmt.Errorf("malformed supervisor period")
+	}
+
+	switch SupervisorStrategyType(strategy) {
+	case SupervisorStrategyOneForOne, SupervisorStrategyOneForAll, SupervisorStrategyRestForOne,
+		SupervisorStrategySimpleOneForOne:
+	default:
+		return nil, fmt.Errorf("unknown supervisor strategy %q", strategy)
+	}
+	sofo := s.spec.Strategy.Type == SupervisorStrategySimpleOneForOne
+	if sofo != (SupervisorStrategyType(strategy) == SupervisorStrategySimpleOneForOne) {
+		return nil, fmt.Errorf("can't change strategy to/from %q", SupervisorStrategySimpleOneForOne)
+	}
+
+	s.spec.Strategy.Type = SupervisorStrategyType(strategy)
+	s.spec.Strategy.Intensity = uint16(intensity)
+	s.spec.Strategy.Period = uint16(period)
+	return s.sysGetState(), nil
+}
+
+func (s *supervisorSys) sysSuspend(suspend bool) {
+	s.suspended = suspend
+}
 
-		case <-chs.Mailbox:
-			// do nothing
+func (s *supervisorSys) sysReductions() uint64 {
+	return s.reductions
+}
+
+// StartChild dynamically starts a child process. The child value is the name of the child spec
+// which is defined by Init call or a new SupervisorChildSpec. Given the name, it starts a new instance
+// of this child spec (the name is not registered for these instances, use RestartChild to start the
+// child terminated by TerminateChild). Given the SupervisorChildSpec, it is added to the supervisor
+// and its child is started (the simple_one_for_one supervisor starts a new instance of it). Given
+// args (if any) replace the args of the child spec. Returns nil Process for the child started on
+// a remote node (use WhichChildren to get its pid).
+func (sv *Supervisor) StartChild(supervisor Process, child interface{}, args ...etf.Term) (Process, error) {
+	var message interface{}
+	switch c := child.(type) {
+	case string:
+		message = messageStartChild{
+			name: c,
+			args: args,
+		}
+	case SupervisorChildSpec:
+		if len(args) > 0 {
+			c.Args = args
+		}
+		message = messageStartChildSpec{
+			spec: c,
 		}
+	default:
+		return nil, fmt.Errorf("child must be the name or SupervisorChildSpec, got %T", child)
 	}
+	return startChildRequest(supervisor, message)
 }
 
-// StartChild dynamically starts a child process with given name of child spec which is defined by Init call.
-func (sv *Supervisor) StartChild(supervisor Process, name string, args ...etf.Term) (Process, error) {
-	message := messageStartChild{
+// TerminateChild terminates the child process according to its shutdown option. The child
+// is not restarted, but the child spec is kept by the supervisor unless the child is
+// a simple_one_for_one instance. The child value is the name of the child spec or,
+// for the simple_one_for_one supervisor, etf.Pid of the child process.
+func (sv *Supervisor) TerminateChild(supervisor Process, child interface{}) error {
+	message := messageTerminateChild{
+		child: child,
+	}
+	_, err := supervisor.Direct(message)
+	return err
+}
+
+// RestartChild restarts the child terminated by TerminateChild. Not supported by the
+// simple_one_for_one supervisor.
+func (sv *Supervisor) RestartChild(supervisor Process, name string) (Process, error) {
+	message := messageRestartChild{
 		name: name,
-		args: args,
 	}
-	value, err := supervisor.Direct(message)
+	return startChildRequest(supervisor, message)
+}
+
+// DeleteChild deletes the child spec of the terminated child. Not supported by the
+// simple_one_for_one supervisor.
+func (sv *Supervisor) DeleteChild(supervisor Process, name string) error {
+	message := messageDeleteChild{
+		name: name,
+	}
+	_, err := supervisor.Direct(message)
+	return err
+}
+
+// WhichChildren returns the list of children of the supervisor
+func (sv *Supervisor) WhichChildren(supervisor Process) ([]SupervisorChildInfo, error) {
+	value, err := supervisor.Direct(messageWhichChildren{})
 	if err != nil {
 		return nil, err
 	}
-	process, ok := value.(Process)
+	children, ok := value.([]SupervisorChildInfo)
 	if !ok {
-		return nil, fmt.Errorf("internal error: can't start child %#v", value)
+		return nil, fmt.Errorf("internal error: wrong reply %#v", value)
 	}
-	return process, nil
+	return children, nil
+}
+
+// CountChildren returns the counters of children of the supervisor
+func (sv *Supervisor) CountChildren(supervisor Process) (SupervisorChildrenCount, error) {
+	value, err := supervisor.Direct(messageCountChildren{})
+	if err != nil {
+		return SupervisorChildrenCount{}, err
+	}
+	count, ok := value.(SupervisorChildrenCount)
+	if !ok {
+		return count, fmt.Errorf("internal error: wrong reply %#v", value)
+	}
+	return count, nil
+}
+
+func startChildRequest(supervisor Process, message interface{}) (Process, error) {
+	value, err := supervisor.Direct(message)
+	if err != nil {
+		return nil, err
+	}
+	switch process := value.(type) {
+	case Process:
+		return process, nil
+	case *remoteChild:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("internal error: can't start child %#v", value)
 }
 
 func startChildren(supervisor Process, spec *SupervisorSpec) {
@@ -199,19 +659,53 @@ func startChildren(supervisor Process, spec *SupervisorSpec) {
 		switch spec.Children[i].state {
 		case supervisorChildStateDisabled:
 			spec.Children[i].process = nil
-		case supervisorChildStateRunning:
+		case supervisorChildStateRunning, supervisorChildStateBackoff:
 			continue
 		case supervisorChildStateStart:
-			spec.Children[i].state = supervisorChildStateRunning
-			process := startChild(supervisor, spec.Children[i].Name, spec.Children[i].Child, spec.Children[i].Args...)
-			spec.Children[i].process = process
+			startChild(supervisor, spec, &spec.Children[i])
 		default:
 			panic("Incorrect supervisorChildState")
 		}
 	}
 }
 
-func startChild(supervisor Process, name string, child ProcessBehavior, args ...etf.Term) Process {
+// startChild starts the child process. If the remote child can't be started
+// it makes another attempt later (after the backoff delay if it is enabled).
+func startChild(supervisor Process, spec *SupervisorSpec, child *SupervisorChildSpec) {
+	name := child.Name
+	if spec.Strategy.Type == SupervisorStrategySimpleOneForOne {
+		// Dinamically started child can't be registered with a name.
+		name = ""
+	}
+	process, err := spawnChild(supervisor, child, name)
+	if err != nil {
+		if child.Node == "" {
+			panic(err)
+		}
+		lib.Log("[%s] SUPERVISOR %s can't start child %q on node %q: %s", supervisor.NodeName(), supervisor.Self(), child.Name, child.Node, err)
+		child.process = nil
+		if backoffChild(supervisor, spec, child) == false {
+			scheduleRestart(supervisor, child, supervisorRemoteRetry)
+		}
+		return
+	}
+	child.state = supervisorChildStateRunning
+	child.process = process
+	child.started = time.Now()
+}
+
+func spawnChild(supervisor Process, child *SupervisorChildSpec, name string) (supervisorChildProcess, error) {
+	if child.Node != "" {
+		return spawnRemoteChild(supervisor, child, name)
+	}
+	process, err := spawnLocalChild(supervisor, name, child.Child, child.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+func spawnLocalChild(supervisor Process, name string, child ProcessBehavior, args ...etf.Term) (Process, error) {
 	opts := ProcessOptions{}
 
 	if leader := supervisor.GroupLeader(); leader != nil {
@@ -221,17 +715,44 @@ func startChild(supervisor Process, name string, child ProcessBehavior, args ...
 		opts.GroupLeader = supervisor
 	}
 	process, err := supervisor.Spawn(name, opts, child, args...)
-
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	supervisor.Link(process.Self())
 
-	return process
+	return process, nil
+}
+
+// spawnRemoteChild spawns the child on the remote node. Tries the failover nodes
+// if it can't be spawned on the node defined by the child spec.
+func spawnRemoteChild(supervisor Process, child *SupervisorChildSpec, name string) (supervisorChildProcess, error) {
+	var err error
+	opts := RemoteSpawnOptions{
+		RegisterName: name,
+	}
+	nodes := append([]string{child.Node}, child.FailoverNodes...)
+	for _, node := range nodes {
+		var pid etf.Pid
+		pid, err = supervisor.RemoteSpawn(node, child.RemoteBehavior, opts, child.Args...)
+		if err != nil {
+			lib.Log("[%s] SUPERVISOR can't spawn child %q on %q: %s", supervisor.NodeName(), child.Name, node, err)
+			continue
+		}
+		supervisor.Link(pid)
+		process := &remoteChild{
+			supervisor: supervisor,
+			pid:        pid,
+			done:       make(chan struct{}),
+		}
+		return process, nil
+	}
+	return nil, err
 }
 
 func handleDirect(supervisor Process, spec *SupervisorSpec, message interface{}) (interface{}, error) {
+	sofo := spec.Strategy.Type == SupervisorStrategySimpleOneForOne
+
 	switch m := message.(type) {
 	case MessageDirectChildren:
 		children := []etf.Pid{}
@@ -243,29 +764,288 @@ func handleDirect(supervisor Process, spec *SupervisorSpec, message interface{})
 		}
 
 		return children, nil
+
 	case messageStartChild:
-		childSpec, err := lookupSpecByName(m.name, spec.Children)
+		i := lookupSpecByName(m.name, spec.Children)
+		if i < 0 {
+			return nil, ErrSupervisorChildNotFound
+		}
+		// start a new instance of the child spec.
+		// Dinamically started child can't be registered with a name.
+		childSpec := spec.Children[i]
+		if len(m.args) > 0 {
+			childSpec.Args = m.args
+		}
+		if !sofo {
+			// the name is used to manage the child spec
+			// (simple_one_for_one keeps it for the instances)
+			childSpec.Name = ""
+		}
+		childSpec.failures = 0
+		childSpec.restartAt = time.Time{}
+		childSpec.backoffRef = etf.Ref{}
+		process, err := spawnChild(supervisor, &childSpec, "")
 		if err != nil {
 			return nil, err
 		}
+		childSpec.state = supervisorChildStateRunning
+		childSpec.process = process
+		childSpec.started = time.Now()
+		spec.Children = append(spec.Children, childSpec)
+		return process, nil
+
+	case messageStartChildSpec:
+		childSpec := m.spec
 		childSpec.state = supervisorChildStateStart
-		if len(m.args) > 0 {
-			childSpec.Args = m.args
+		childSpec.process = nil
+		childSpec.failures = 0
+		if err := validateChildSpec(spec, &childSpec); err != nil {
+			return nil, err
 		}
-		// Dinamically started child can't be registered with a name.
-		childSpec.Name = ""
-		process := startChild(supervisor, childSpec.Name, childSpec.Child, childSpec.Args...)
+		name := childSpec.Name
+		if sofo {
+			name = ""
+		} else if lookupSpecByName(childSpec.Name, spec.Children) >= 0 {
+			return nil, ErrSupervisorChildPresent
+		}
+		process, err := spawnChild(supervisor, &childSpec, name)
+		if err != nil {
+			return nil, err
+		}
+		childSpec.state = supervisorChildStateRunning
 		childSpec.process = process
+		childSpec.started = time.Now()
 		spec.Children = append(spec.Children, childSpec)
 		return process, nil
 
+	case messageTerminateChild:
+		i := -1
+		switch c := m.child.(type) {
+		case string:
+			if !sofo {
+				i = lookupSpecByName(c, spec.Children)
+			}
+		case etf.Pid:
+			if sofo {
+				i = lookupSpecByPid(c, spec.Children)
+			}
+		}
+		if i < 0 {
+			return nil, ErrSupervisorChildNotFound
+		}
+		childSpec := spec.Children[i]
+		spec.Children[i].state = supervisorChildStateDisabled
+		spec.Children[i].process = nil
+		if sofo {
+			spec.Children = append(spec.Children[:i], spec.Children[i+1:]...)
+		}
+		if childSpec.process != nil {
+			shutdownChild(spec, &childSpec, childSpec.process, "shutdown")
+		}
+		return nil, nil
+
+	case MessageDirectCodeChange:
+		// restarted children must use the new behavior
+		from := reflect.TypeOf(m.From)
+		for i := range spec.Children {
+			if reflect.TypeOf(spec.Children[i].Child) == from {
+				spec.Children[i].Child = m.To
+			}
+		}
+		return nil, nil
+
+	case messageRestartChild:
+		if sofo {
+			return nil, ErrSupervisorSimpleOneForOne
+		}
+		i := lookupSpecByName(m.name, spec.Children)
+		if i < 0 {
+			return nil, ErrSupervisorChildNotFound
+		}
+		if err := childNotRunning(&spec.Children[i]); err != nil {
+			return nil, err
+		}
+		return restartChild(supervisor, &spec.Children[i])
+
+	case messageDeleteChild:
+		if sofo {
+			return nil, ErrSupervisorSimpleOneForOne
+		}
+		i := lookupSpecByName(m.name, spec.Children)
+		if i < 0 {
+			return nil, ErrSupervisorChildNotFound
+		}
+		if err := childNotRunning(&spec.Children[i]); err != nil {
+			return nil, err
+		}
+		spec.Children = append(spec.Children[:i], spec.Children[i+1:]...)
+		return nil, nil
+
+	case messageWhichChildren:
+		children := []SupervisorChildInfo{}
+		for i := range spec.Children {
+			child := &spec.Children[i]
+			if sofo && child.state == supervisorChildStateStart {
+				// child spec of the simple_one_for_one supervisor
+				continue
+			}
+			circuit := childCircuit(spec, child)
+			info := SupervisorChildInfo{
+				Name: child.Name,
+				Restarting: child.process == nil &&
+					(child.state == supervisorChildStateStart || child.state == supervisorChildStateBackoff),
+				Type:     childType(child),
+				Circuit:  circuit,
+				Failures: child.failures,
+			}
+			if child.process != nil {
+				info.Pid = child.process.Self()
+				info.Process, _ = child.process.(Process)
+			}
+			if child.state == supervisorChildStateBackoff {
+				info.RestartAt = child.restartAt
+			}
+			children = append(children, info)
+		}
+		return children, nil
+
+	case messageCountChildren:
+		count := SupervisorChildrenCount{}
+		for i := range spec.Children {
+			child := &spec.Children[i]
+			if sofo && child.state == supervisorChildStateStart {
+				continue
+			}
+			count.Specs++
+			if child.process != nil && child.process.IsAlive() {
+				count.Active++
+			}
+			if childType(child) == SupervisorChildTypeSupervisor {
+				count.Supervisors++
+			} else {
+				count.Workers++
+			}
+		}
+		return count, nil
+
 	default:
 	}
 
 	return nil, ErrUnsupportedRequest
 }
 
-func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *SupervisorSpec, wait []etf.Pid) []etf.Pid {
+// handleCall handles the requests made by the Erlang's supervisor module
+// (which_children, count_children, terminate_child, restart_child, delete_child)
+func handleCall(supervisor Process, spec *SupervisorSpec, message etf.Term) {
+	m, ok := message.(etf.Tuple)
+	if !ok || len(m) != 3 || m.Element(1) != etf.Atom("$gen_call") {
+		return
+	}
+	from, ok := parseServerFrom(m.Element(2))
+	if !ok {
+		return
+	}
+
+	var request interface{}
+	switch r := m.Element(3).(type) {
+	case etf.Atom:
+		switch r {
+		case etf.Atom("which_children"):
+			request = messageWhichChildren{}
+		case etf.Atom("count_children"):
+			request = messageCountChildren{}
+		}
+	case etf.Tuple:
+		if len(r) != 2 {
+			break
+		}
+		var child interface{} = r.Element(2)
+		if name, ok := child.(etf.Atom); ok {
+			child = string(name)
+		}
+		name, _ := child.(string)
+		switch r.Element(1) {
+		case etf.Atom("terminate_child"):
+			request = messageTerminateChild{child: child}
+		case etf.Atom("restart_child"):
+			request = messageRestartChild{name: name}
+		case etf.Atom("delete_child"):
+			request = messageDeleteChild{name: name}
+		}
+	}
+	if request == nil {
+		sendReply(supervisor, from, etf.Tuple{etf.Atom("error"), etf.Atom("unsupported")})
+		return
+	}
+
+	value, err := handleDirect(supervisor, spec, request)
+	if err != nil {
+		var reason etf.Atom
+		switch err {
+		case ErrSupervisorChildNotFound:
+			reason = "not_found"
+		case ErrSupervisorChildRunning:
+			reason = "running"
+		case ErrSupervisorChildRestarting:
+			reason = "restarting"
+		case ErrSupervisorSimpleOneForOne:
+			reason = "simple_one_for_one"
+		default:
+			sendReply(supervisor, from, etf.Tuple{etf.Atom("error"), err.Error()})
+			return
+		}
+		sendReply(supervisor, from, etf.Tuple{etf.Atom("error"), reason})
+		return
+	}
+
+	var reply etf.Term
+	switch v := value.(type) {
+	case supervisorChildProcess:
+		reply = etf.Tuple{etf.Atom("ok"), v.Self()}
+	case []SupervisorChildInfo:
+		reply = childrenTerm(spec, v)
+	case SupervisorChildrenCount:
+		reply = etf.List{
+			etf.Tuple{etf.Atom("specs"), v.Specs},
+			etf.Tuple{etf.Atom("active"), v.Active},
+			etf.Tuple{etf.Atom("supervisors"), v.Supervisors},
+			etf.Tuple{etf.Atom("workers"), v.Workers},
+		}
+	default:
+		reply = etf.Atom("ok")
+	}
+	sendReply(supervisor, from, reply)
+}
+
+// childrenTerm makes the list of children in the format of supervisor:which_children
+// [{Id, Child, Type, Modules}]
+func childrenTerm(spec *SupervisorSpec, info []SupervisorChildInfo) etf.List {
+	sofo := spec.Strategy.Type == SupervisorStrategySimpleOneForOne
+	children := etf.List{}
+	for _, c := range info {
+		var id, child etf.Term
+		id = etf.Atom(c.Name)
+		if sofo {
+			id = etf.Atom("undefined")
+		}
+		switch {
+		case c.Pid != etf.Pid{}:
+			child = c.Pid
+		case c.Restarting:
+			child = etf.Atom("restarting")
+		default:
+			child = etf.Atom("undefined")
+		}
+		module := etf.Atom("undefined")
+		if i := lookupSpecByName(c.Name, spec.Children); i >= 0 {
+			module = childModule(&spec.Children[i])
+		}
+		children = append(children, etf.Tuple{id, child, etf.Atom(c.Type), etf.List{module}})
+	}
+	return children
+}
+
+func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *SupervisorSpec, wait []etf.Pid) ([]etf.Pid, string) {
 
 	terminated := exit.From
 	reason := exit.Reason
@@ -279,12 +1059,15 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 		}
 		if child.Self() == terminated {
 			isChild = true
+			if remote, ok := child.(*remoteChild); ok {
+				close(remote.done)
+			}
 			break
 		}
 	}
 
 	if !isChild && reason != "restart" {
-		return wait
+		return wait, ""
 	}
 
 	if len(wait) > 0 {
@@ -302,12 +1085,17 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 			startChildren(p, spec)
 		}
 
-		return wait
+		return wait, ""
+	}
+
+	if isChild && autoShutdown(spec, terminated, reason) {
+		return wait, "shutdown"
 	}
 
 	switch spec.Strategy.Type {
 
 	case SupervisorStrategyOneForAll:
+		delayed := false
 		for i := range spec.Children {
 			if spec.Children[i].state != supervisorChildStateRunning {
 				continue
@@ -320,31 +1108,36 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 
 			spec.Children[i].process = nil
 			if child.Self() == terminated {
-				if haveToDisableChild(spec.Strategy.Restart, reason) {
+				if haveToDisableChild(childRestart(spec, &spec.Children[i]), reason) {
 					spec.Children[i].state = supervisorChildStateDisabled
 				} else {
 					spec.Children[i].state = supervisorChildStateStart
+					delayed = backoffChild(p, spec, &spec.Children[i])
 				}
 
-				if len(spec.Children) == i+1 && len(wait) == 0 {
+				if len(spec.Children) == i+1 && len(wait) == 0 && !delayed {
 					// it was the last one. nothing to waiting for
 					startChildren(p, spec)
 				}
 				continue
 			}
 
-			if haveToDisableChild(spec.Strategy.Restart, "restart") {
+			if haveToDisableChild(childRestart(spec, &spec.Children[i]), "restart") {
 				spec.Children[i].state = supervisorChildStateDisabled
 			} else {
 				spec.Children[i].state = supervisorChildStateStart
 			}
-			child.Exit("restart")
+			terminateChild(&spec.Children[i], child, "restart")
 
 			wait = append(wait, child.Self())
 		}
+		if delayed {
+			backoffChildren(spec)
+		}
 
 	case SupervisorStrategyRestForOne:
 		isRest := false
+		delayed := false
 		for i := range spec.Children {
 			child := spec.Children[i].process
 			if child == nil {
@@ -353,13 +1146,14 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 			if child.Self() == terminated {
 				isRest = true
 				spec.Children[i].process = nil
-				if haveToDisableChild(spec.Strategy.Restart, reason) {
+				if haveToDisableChild(childRestart(spec, &spec.Children[i]), reason) {
 					spec.Children[i].state = supervisorChildStateDisabled
 				} else {
 					spec.Children[i].state = supervisorChildStateStart
+					delayed = backoffChild(p, spec, &spec.Children[i])
 				}
 
-				if len(spec.Children) == i+1 && len(wait) == 0 {
+				if len(spec.Children) == i+1 && len(wait) == 0 && !delayed {
 					// it was the last one. nothing to waiting for
 					startChildren(p, spec)
 				}
@@ -368,16 +1162,19 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 			}
 
 			if isRest && spec.Children[i].state == supervisorChildStateRunning {
-				child.Exit("restart")
+				terminateChild(&spec.Children[i], child, "restart")
 				spec.Children[i].process = nil
 				wait = append(wait, child.Self())
-				if haveToDisableChild(spec.Strategy.Restart, "restart") {
+				if haveToDisableChild(childRestart(spec, &spec.Children[i]), "restart") {
 					spec.Children[i].state = supervisorChildStateDisabled
 				} else {
 					spec.Children[i].state = supervisorChildStateStart
 				}
 			}
 		}
+		if delayed {
+			backoffChildren(spec)
+		}
 
 	case SupervisorStrategyOneForOne:
 		for i := range spec.Children {
@@ -387,10 +1184,14 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 			}
 			if child.Self() == terminated {
 				spec.Children[i].process = nil
-				if haveToDisableChild(spec.Strategy.Restart, reason) {
+				if haveToDisableChild(childRestart(spec, &spec.Children[i]), reason) {
 					spec.Children[i].state = supervisorChildStateDisabled
 				} else {
 					spec.Children[i].state = supervisorChildStateStart
+					if backoffChild(p, spec, &spec.Children[i]) {
+						// will be restarted later
+						break
+					}
 				}
 
 				startChildren(p, spec)
@@ -406,20 +1207,371 @@ func handleMessageExit(p Process, exit ProcessGracefulExitRequest, spec *Supervi
 			}
 			if child.Self() == terminated {
 
-				if haveToDisableChild(spec.Strategy.Restart, reason) {
+				if haveToDisableChild(childRestart(spec, &spec.Children[i]), reason) {
 					// wont be restarted due to restart strategy
-					spec.Children[i] = spec.Children[0]
-					spec.Children = spec.Children[1:]
+					spec.Children = append(spec.Children[:i], spec.Children[i+1:]...)
 					break
 				}
 
-				process := startChild(p, spec.Children[i].Name, spec.Children[i].Child, spec.Children[i].Args...)
-				spec.Children[i].process = process
+				spec.Children[i].process = nil
+				if backoffChild(p, spec, &spec.Children[i]) {
+					// will be restarted later
+					break
+				}
+				startChild(p, spec, &spec.Children[i])
 				break
 			}
 		}
 	}
-	return wait
+	return wait, ""
+}
+
+// backoffChild schedules the restart of the terminated child if the backoff is enabled.
+// Returns false if the child must be restarted immediately.
+func backoffChild(p Process, spec *SupervisorSpec, child *SupervisorChildSpec) bool {
+	delay := childBackoffDelay(spec, child)
+	if delay == 0 {
+		return false
+	}
+	scheduleRestart(p, child, delay)
+	return true
+}
+
+func scheduleRestart(p Process, child *SupervisorChildSpec, delay time.Duration) {
+	child.state = supervisorChildStateBackoff
+	child.restartAt = time.Now().Add(delay)
+	child.backoffRef = p.MakeRef()
+	p.SendAfter(p.Self(), messageBackoffRestart{ref: child.backoffRef}, delay)
+}
+
+// backoffChildren postpones the restart of all the children to be restarted
+// (one_for_all, rest_for_one) until the backoff timer of the failed child fires.
+func backoffChildren(spec *SupervisorSpec) {
+	for i := range spec.Children {
+		if spec.Children[i].state == supervisorChildStateStart {
+			spec.Children[i].state = supervisorChildStateBackoff
+		}
+	}
+}
+
+func handleBackoffRestart(p Process, spec *SupervisorSpec, ref etf.Ref, start bool) {
+	for i := range spec.Children {
+		child := &spec.Children[i]
+		if child.backoffRef != ref {
+			continue
+		}
+		child.backoffRef = etf.Ref{}
+
+		switch spec.Strategy.Type {
+		case SupervisorStrategyOneForAll, SupervisorStrategyRestForOne:
+			for j := range spec.Children {
+				if spec.Children[j].state == supervisorChildStateBackoff {
+					spec.Children[j].state = supervisorChildStateStart
+				}
+			}
+			if start {
+				// otherwise they will be started once the rest
+				// of the children are terminated
+				startChildren(p, spec)
+			}
+
+		case SupervisorStrategySimpleOneForOne:
+			if child.state != supervisorChildStateBackoff {
+				return
+			}
+			startChild(p, spec, child)
+
+		default:
+			if child.state != supervisorChildStateBackoff {
+				// has been terminated by TerminateChild
+				return
+			}
+			child.state = supervisorChildStateStart
+			startChildren(p, spec)
+		}
+		return
+	}
+}
+
+// childBackoffDelay increases the failure counter of the child and returns
+// the delay before its restart
+func childBackoffDelay(spec *SupervisorSpec, child *SupervisorChildSpec) time.Duration {
+	backoff := childBackoff(spec, child)
+	if backoff.Min == 0 {
+		return 0
+	}
+	if time.Since(child.started) >= backoff.Reset {
+		child.failures = 0
+	}
+	child.failures++
+
+	delay := float64(backoff.Min) * math.Pow(backoff.Factor, float64(child.failures-1))
+	if delay > float64(backoff.Max) {
+		delay = float64(backoff.Max)
+	}
+	delay -= delay * backoff.Jitter * rand.Float64()
+	if delay < 1 {
+		delay = 1
+	}
+	return time.Duration(delay)
+}
+
+// childBackoff returns the backoff options of the child with the default values applied
+func childBackoff(spec *SupervisorSpec, child *SupervisorChildSpec) SupervisorBackoff {
+	backoff := child.Backoff
+	if backoff.Min == 0 {
+		backoff = spec.Strategy.Backoff
+	}
+	if backoff.Min == 0 {
+		return backoff
+	}
+	if backoff.Max == 0 {
+		backoff.Max = supervisorBackoffMax
+		if backoff.Min > backoff.Max {
+			backoff.Max = backoff.Min
+		}
+	}
+	if backoff.Factor == 0 {
+		backoff.Factor = supervisorBackoffFactor
+	}
+	if backoff.Reset == 0 {
+		backoff.Reset = backoff.Max
+	}
+	return backoff
+}
+
+// childCircuit returns the circuit state of the child. Resets the failure counter
+// of the child if it has been running long enough.
+func childCircuit(spec *SupervisorSpec, child *SupervisorChildSpec) SupervisorChildCircuit {
+	if child.state == supervisorChildStateBackoff {
+		return SupervisorChildCircuitOpen
+	}
+	if child.failures == 0 || child.process == nil {
+		return SupervisorChildCircuitClosed
+	}
+	if time.Since(child.started) < childBackoff(spec, child).Reset {
+		return SupervisorChildCircuitHalfOpen
+	}
+	child.failures = 0
+	return SupervisorChildCircuitClosed
+}
+
+// autoShutdown returns true if the terminated child is significant, it won't be restarted
+// and the supervisor must shut down itself according to the AutoShutdown option.
+func autoShutdown(spec *SupervisorSpec, terminated etf.Pid, reason string) bool {
+	switch spec.Strategy.AutoShutdown {
+	case SupervisorAutoShutdownAnySignificant, SupervisorAutoShutdownAllSignificant:
+	default:
+		return false
+	}
+
+	significant := false
+	for i := range spec.Children {
+		child := &spec.Children[i]
+		if child.process == nil || child.process.Self() != terminated {
+			continue
+		}
+		significant = child.Significant && haveToDisableChild(childRestart(spec, child), reason)
+		break
+	}
+	if !significant {
+		return false
+	}
+	if spec.Strategy.AutoShutdown == SupervisorAutoShutdownAnySignificant {
+		return true
+	}
+
+	// all_significant. check whether the rest of significant children have terminated
+	for i := range spec.Children {
+		child := &spec.Children[i]
+		if !child.Significant || child.process == nil || child.process.Self() == terminated {
+			continue
+		}
+		if child.process.IsAlive() {
+			return false
+		}
+	}
+	return true
+}
+
+// terminateChildren terminates the children in the reverse start order
+// according to their shutdown options
+func terminateChildren(spec *SupervisorSpec, reason string) {
+	for i := len(spec.Children) - 1; i >= 0; i-- {
+		child := spec.Children[i].process
+		if child == nil || !child.IsAlive() {
+			continue
+		}
+		shutdownChild(spec, &spec.Children[i], child, reason)
+	}
+}
+
+// shutdownChild terminates the child process and waits for its termination
+// according to the shutdown option of the child spec
+func shutdownChild(spec *SupervisorSpec, childSpec *SupervisorChildSpec, child supervisorChildProcess, reason string) {
+	shutdown := childShutdown(childSpec)
+	if shutdown == SupervisorShutdownBrutalKill {
+		child.Kill()
+		return
+	}
+	if remote, ok := child.(*remoteChild); ok {
+		// the restarted child must not be spawned until the old one
+		// releases its registered name on the remote node
+		remote.Exit(reason)
+		if err := waitRemoteChild(spec, remote, shutdown); err != nil {
+			remote.Kill()
+		}
+		return
+	}
+
+	child.Exit(reason)
+	if shutdown == SupervisorShutdownInfinity {
+		child.Wait()
+		return
+	}
+	if err := child.WaitWithTimeout(shutdown); err != nil {
+		child.Kill()
+	}
+}
+
+// waitRemoteChild waits for the exit signal of the remote child. It comes to the channel
+// the supervisor is reading in ProcessLoop, so the other exit signals are kept in the spec
+// to be handled later.
+func waitRemoteChild(spec *SupervisorSpec, child *remoteChild, timeout time.Duration) error {
+	if child.IsAlive() == false {
+		return nil
+	}
+	var expired <-chan time.Time
+	if timeout != SupervisorShutdownInfinity {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	chs := child.supervisor.ProcessChannels()
+	for {
+		select {
+		case ex := <-chs.GracefulExit:
+			if ex.From == child.pid {
+				close(child.done)
+				return nil
+			}
+			spec.exits = append(spec.exits, ex)
+		case <-expired:
+			return fmt.Errorf("timeout")
+		case <-child.supervisor.Context().Done():
+			return child.supervisor.Context().Err()
+		}
+	}
+}
+
+// terminateChild sends the exit signal to the child process. Unlike terminateChildren
+// it doesn't wait for the termination. The exit message comes to the supervisor as usual.
+func terminateChild(spec *SupervisorChildSpec, child supervisorChildProcess, reason string) {
+	shutdown := childShutdown(spec)
+	if shutdown == SupervisorShutdownBrutalKill {
+		child.Kill()
+		return
+	}
+
+	child.Exit(reason)
+	if shutdown == SupervisorShutdownInfinity {
+		return
+	}
+	go func() {
+		if err := child.WaitWithTimeout(shutdown); err != nil {
+			child.Kill()
+		}
+	}()
+}
+
+func childRestart(spec *SupervisorSpec, child *SupervisorChildSpec) SupervisorStrategyRestart {
+	if child.Restart != "" {
+		return child.Restart
+	}
+	return spec.Strategy.Restart
+}
+
+func childType(child *SupervisorChildSpec) SupervisorChildType {
+	if child.Type != "" {
+		return child.Type
+	}
+	if _, ok := child.Child.(SupervisorBehavior); ok {
+		return SupervisorChildTypeSupervisor
+	}
+	return SupervisorChildTypeWorker
+}
+
+func childShutdown(child *SupervisorChildSpec) time.Duration {
+	if child.Shutdown != SupervisorShutdownDefault {
+		return child.Shutdown
+	}
+	if childType(child) == SupervisorChildTypeSupervisor {
+		return SupervisorShutdownInfinity
+	}
+	return supervisorShutdownWorker
+}
+
+func validateChildSpec(spec *SupervisorSpec, child *SupervisorChildSpec) error {
+	restart := childRestart(spec, child)
+	switch restart {
+	case "", SupervisorStrategyRestartPermanent, SupervisorStrategyRestartTemporary, SupervisorStrategyRestartTransient:
+	default:
+		return fmt.Errorf("child %q: unknown restart type %q", child.Name, restart)
+	}
+
+	switch childType(child) {
+	case SupervisorChildTypeWorker, SupervisorChildTypeSupervisor:
+	default:
+		return fmt.Errorf("child %q: unknown type %q", child.Name, child.Type)
+	}
+
+	if child.Node != "" && child.RemoteBehavior == "" {
+		return fmt.Errorf("child %q: remote behavior name is not defined", child.Name)
+	}
+	if child.Node == "" && len(child.FailoverNodes) > 0 {
+		return fmt.Errorf("child %q: failover nodes are defined for the local child", child.Name)
+	}
+
+	if child.Shutdown < 0 && child.Shutdown != SupervisorShutdownBrutalKill &&
+		child.Shutdown != SupervisorShutdownInfinity {
+		return fmt.Errorf("child %q: wrong shutdown value %s", child.Name, child.Shutdown)
+	}
+
+	if err := validateBackoff(child.Backoff); err != nil {
+		return fmt.Errorf("child %q: %s", child.Name, err)
+	}
+
+	if child.Significant == false {
+		return nil
+	}
+	switch restart {
+	case SupervisorStrategyRestartTemporary, SupervisorStrategyRestartTransient:
+	default:
+		return fmt.Errorf("child %q: significant child must be transient or temporary", child.Name)
+	}
+	switch spec.Strategy.AutoShutdown {
+	case SupervisorAutoShutdownAnySignificant, SupervisorAutoShutdownAllSignificant:
+	default:
+		return fmt.Errorf("child %q: significant child is not allowed with auto shutdown 'never'", child.Name)
+	}
+	return nil
+}
+
+func validateBackoff(backoff SupervisorBackoff) error {
+	if backoff.Min < 0 || backoff.Max < 0 || backoff.Reset < 0 {
+		return fmt.Errorf("backoff: negative duration")
+	}
+	if backoff.Max > 0 && backoff.Max < backoff.Min {
+		return fmt.Errorf("backoff: max delay is less than min delay")
+	}
+	if backoff.Factor != 0 && backoff.Factor < 1 {
+		return fmt.Errorf("backoff: factor must be >= 1")
+	}
+	if backoff.Jitter < 0 || backoff.Jitter > 1 {
+		return fmt.Errorf("backoff: jitter must be within 0..1")
+	}
+	return nil
 }
 
 func haveToDisableChild(strategy SupervisorStrategyRestart, reason string) bool {
@@ -436,11 +1588,58 @@ func haveToDisableChild(strategy SupervisorStrategyRestart, reason string) bool
 	return false
 }
 
-func lookupSpecByName(specName string, spec []SupervisorChildSpec) (SupervisorChildSpec, error) {
+func lookupSpecByName(specName string, spec []SupervisorChildSpec) int {
 	for i := range spec {
 		if spec[i].Name == specName {
-			return spec[i], nil
+			return i
 		}
 	}
-	return SupervisorChildSpec{}, fmt.Errorf("unknown child")
+	return -1
+}
+
+func lookupSpecByPid(pid etf.Pid, spec []SupervisorChildSpec) int {
+	for i := range spec {
+		if spec[i].process != nil && spec[i].process.Self() == pid {
+			return i
+		}
+	}
+	return -1
+}
+
+// childNotRunning returns error if the child is running or is going to be restarted
+func childNotRunning(child *SupervisorChildSpec) error {
+	if child.process != nil {
+		return ErrSupervisorChildRunning
+	}
+	if child.state == supervisorChildStateStart || child.state == supervisorChildStateBackoff {
+		return ErrSupervisorChildRestarting
+	}
+	return nil
+}
+
+func restartChild(supervisor Process, child *SupervisorChildSpec) (supervisorChildProcess, error) {
+	process, err := spawnChild(supervisor, child, child.Name)
+	if err != nil {
+		return nil, err
+	}
+	child.state = supervisorChildStateRunning
+	child.process = process
+	child.started = time.Now()
+	return process, nil
+}
+
+// childModule returns the name of the child behavior type to be used as a module name
+// in the replies to the Erlang's supervisor module
+func childModule(child *SupervisorChildSpec) etf.Atom {
+	if child.Node != "" {
+		return etf.Atom(child.RemoteBehavior)
+	}
+	t := reflect.TypeOf(child.Child)
+	if t == nil {
+		return etf.Atom("undefined")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return etf.Atom(t.Name())
 }
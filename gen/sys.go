@@ -0,0 +1,348 @@
+package gen
+
+// http://erlang.org/doc/man/sys.html
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
+)
+
+const (
+	defaultSysLogSize = 10
+)
+
+// SysReplaceStateFun is used with ServerProcess.SysReplaceState. Returns the new state.
+type SysReplaceStateFun func(state interface{}) interface{}
+
+// systemMessage is the request {system, From, Request} made by the sys module
+type systemMessage struct {
+	from    ServerFrom
+	request etf.Term
+}
+
+// sysProcess is implemented by the processes handling the system messages
+type sysProcess interface {
+	Process
+	sysGetState() interface{}
+	sysReplaceState(fun interface{}) (interface{}, error)
+	sysSuspend(suspend bool)
+	sysReductions() uint64
+}
+
+// sysDebug keeps the debug options enabled with the system messages
+type sysDebug struct {
+	trace      bool
+	logSize    int
+	log        []string
+	statistics *sysStatistics
+}
+
+type sysStatistics struct {
+	startTime   time.Time
+	reductions  uint64
+	messagesIn  uint64
+	messagesOut uint64
+}
+
+func parseSystemMessage(message etf.Term) (systemMessage, bool) {
+	m, ok := message.(etf.Tuple)
+	if !ok || len(m) != 3 || m.Element(1) != etf.Atom("system") {
+		return systemMessage{}, false
+	}
+	from, ok := parseServerFrom(m.Element(2))
+	if !ok {
+		return systemMessage{}, false
+	}
+	return systemMessage{from: from, request: m.Element(3)}, true
+}
+
+// handleSystemMessage handles the system request and sends the reply
+func handleSystemMessage(p sysProcess, debug *sysDebug, m systemMessage) {
+	reply := handleSystemRequest(p, debug, m.request)
+	if string(m.from.Pid.Node) != p.NodeName() {
+		// the state might have the values that can't be encoded
+		b := lib.TakeBuffer()
+		if err := etf.Encode(reply, b, etf.EncodeOptions{}); err != nil {
+			reply = fmt.Sprintf("%#v", reply)
+		}
+		lib.ReleaseBuffer(b)
+	}
+	sendReply(p, m.from, reply)
+}
+
+func handleSystemRequest(p sysProcess, debug *sysDebug, request etf.Term) etf.Term {
+	switch r := request.(type) {
+	case etf.Atom:
+		switch r {
+		case etf.Atom("get_state"):
+			return p.sysGetState()
+		case etf.Atom("suspend"):
+			p.sysSuspend(true)
+			return etf.Atom("ok")
+		case etf.Atom("resume"):
+			p.sysSuspend(false)
+			return etf.Atom("ok")
+		}
+
+	case etf.Tuple:
+		if len(r) != 2 {
+			break
+		}
+		switch r.Element(1) {
+		case etf.Atom("replace_state"):
+			state, err := p.sysReplaceState(r.Element(2))
+			if err != nil {
+				return etf.Tuple{etf.Atom("error"),
+					etf.Tuple{etf.Atom("callback_failed"), err.Error()}}
+			}
+			return etf.Tuple{etf.Atom("ok"), state}
+		case etf.Atom("debug"):
+			return debug.handle(p, r.Element(2))
+		}
+	}
+	return etf.Tuple{etf.Atom("error"), etf.Tuple{etf.Atom("unknown_system_msg"), request}}
+}
+
+func (d *sysDebug) handle(p sysProcess, option etf.Term) etf.Term {
+	if option == etf.Atom("no_debug") {
+		*d = sysDebug{}
+		return etf.Atom("ok")
+	}
+
+	opt, ok := option.(etf.Tuple)
+	if !ok || len(opt) != 2 {
+		return etf.Atom("unknown_debug")
+	}
+
+	switch opt.Element(1) {
+	case etf.Atom("trace"):
+		flag, ok := opt.Element(2).(bool)
+		if !ok {
+			break
+		}
+		d.trace = flag
+		return etf.Atom("ok")
+
+	case etf.Atom("log"):
+		switch flag := opt.Element(2).(type) {
+		case bool:
+			d.log = nil
+			d.logSize = 0
+			if flag {
+				d.logSize = defaultSysLogSize
+			}
+			return etf.Atom("ok")
+		case etf.Tuple:
+			// {true, N}
+			if len(flag) != 2 || flag.Element(1) != true {
+				break
+			}
+			size, ok := etf.TermToInt(flag.Element(2), 0)
+			if !ok || size < 1 {
+				break
+			}
+			d.logSize = int(size)
+			if len(d.log) > d.logSize {
+				d.log = d.log[len(d.log)-d.logSize:]
+			}
+			return etf.Atom("ok")
+		case etf.Atom:
+			switch flag {
+			case etf.Atom("get"):
+				events := etf.List{}
+				for _, event := range d.log {
+					events = append(events, event)
+				}
+				return etf.Tuple{etf.Atom("ok"), events}
+			case etf.Atom("print"):
+				for _, event := range d.log {
+					fmt.Printf("*DBG* %s %s\n", p.Self(), event)
+				}
+				return etf.Atom("ok")
+			}
+		}
+
+	case etf.Atom("statistics"):
+		switch flag := opt.Element(2); flag {
+		case true:
+			d.statistics = &sysStatistics{
+				startTime:  time.Now(),
+				reductions: p.sysReductions(),
+			}
+			return etf.Atom("ok")
+		case false:
+			d.statistics = nil
+			return etf.Atom("ok")
+		case etf.Atom("get"):
+			if d.statistics == nil {
+				return etf.Atom("no_statistics")
+			}
+			stats := etf.List{
+				etf.Tuple{etf.Atom("start_time"), sysDateTime(d.statistics.startTime)},
+				etf.Tuple{etf.Atom("current_time"), sysDateTime(time.Now())},
+				etf.Tuple{etf.Atom("reductions"), p.sysReductions() - d.statistics.reductions},
+				etf.Tuple{etf.Atom("messages_in"), d.statistics.messagesIn},
+				etf.Tuple{etf.Atom("messages_out"), d.statistics.messagesOut},
+			}
+			return etf.Tuple{etf.Atom("ok"), stats}
+		}
+	}
+
+	return etf.Atom("unknown_debug")
+}
+
+// in records the incoming message
+func (d *sysDebug) in(p Process, format string, args ...interface{}) {
+	if d.statistics != nil {
+		d.statistics.messagesIn++
+	}
+	d.event(p, format, args...)
+}
+
+// out records the outgoing message
+func (d *sysDebug) out(p Process, format string, args ...interface{}) {
+	if d.statistics != nil {
+		d.statistics.messagesOut++
+	}
+	d.event(p, format, args...)
+}
+
+func (d *sysDebug) event(p Process, format string, args ...interface{}) {
+	if d.trace == false && d.logSize == 0 {
+		return
+	}
+	event := fmt.Sprintf(format, args...)
+	if d.trace {
+		fmt.Printf("*DBG* %s %s\n", p.Self(), event)
+	}
+	if d.logSize > 0 {
+		d.log = append(d.log, event)
+		if len(d.log) > d.logSize {
+			d.log = d.log[1:]
+		}
+	}
+}
+
+// sysDateTime returns the time in the format of calendar:datetime()
+func sysDateTime(t time.Time) etf.Tuple {
+	return etf.Tuple{
+		etf.Tuple{t.Year(), int(t.Month()), t.Day()},
+		etf.Tuple{t.Hour(), t.Minute(), t.Second()},
+	}
+}
+
+// SysGetState returns the state of the process in fashion of 'sys:get_state'.
+// 'to' can be Pid, registered local name or gen.ProcessID{RegisteredName, NodeName}.
+// The state of the process on a remote node is returned as a string if it can't be
+// encoded. This method shouldn't be used outside of the actor (see ServerProcess.Call).
+func (sp *ServerProcess) SysGetState(to interface{}) (etf.Term, error) {
+	return sp.sysCall(to, etf.Atom("get_state"))
+}
+
+// SysReplaceState replaces the state of the process in fashion of 'sys:replace_state'.
+// Returns the new state. The process on a remote node can't be handled.
+func (sp *ServerProcess) SysReplaceState(to interface{}, fun SysReplaceStateFun) (etf.Term, error) {
+	reply, err := sp.sysCall(to, etf.Tuple{etf.Atom("replace_state"), fun})
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := reply.(etf.Tuple); ok && len(r) == 2 && r.Element(1) == etf.Atom("ok") {
+		return r.Element(2), nil
+	}
+	return nil, fmt.Errorf("malformed reply: %s", etf.Format(reply))
+}
+
+// SysSuspend suspends the process in fashion of 'sys:suspend'. The suspended process
+// handles the system messages only. The other messages are kept until it's resumed.
+func (sp *ServerProcess) SysSuspend(to interface{}) error {
+	_, err := sp.sysCall(to, etf.Atom("suspend"))
+	return err
+}
+
+// SysResume resumes the suspended process in fashion of 'sys:resume'
+func (sp *ServerProcess) SysResume(to interface{}) error {
+	_, err := sp.sysCall(to, etf.Atom("resume"))
+	return err
+}
+
+// SysStatistics enables (true), disables (false) or returns (etf.Atom("get")) the statistics
+// of the process in fashion of 'sys:statistics'
+func (sp *ServerProcess) SysStatistics(to interface{}, flag etf.Term) (etf.Term, error) {
+	return sp.sysCall(to, etf.Tuple{etf.Atom("debug"), etf.Tuple{etf.Atom("statistics"), flag}})
+}
+
+// SysLog enables (true, etf.Tuple{true, N}), disables (false), returns (etf.Atom("get"))
+// or prints (etf.Atom("print")) the log of the events of the process in fashion of 'sys:log'
+func (sp *ServerProcess) SysLog(to interface{}, flag etf.Term) (etf.Term, error) {
+	return sp.sysCall(to, etf.Tuple{etf.Atom("debug"), etf.Tuple{etf.Atom("log"), flag}})
+}
+
+// SysTrace enables or disables printing the events of the process in fashion of 'sys:trace'
+func (sp *ServerProcess) SysTrace(to interface{}, flag bool) error {
+	_, err := sp.sysCall(to, etf.Tuple{etf.Atom("debug"), etf.Tuple{etf.Atom("trace"), flag}})
+	return err
+}
+
+// SysNoDebug disables all the debug options of the process in fashion of 'sys:no_debug'
+func (sp *ServerProcess) SysNoDebug(to interface{}) error {
+	_, err := sp.sysCall(to, etf.Tuple{etf.Atom("debug"), etf.Atom("no_debug")})
+	return err
+}
+
+func (sp *ServerProcess) sysCall(to interface{}, request etf.Term) (etf.Term, error) {
+	ref := sp.MakeRef()
+	from := etf.Tuple{sp.Self(), ref}
+	msg := etf.Term(etf.Tuple{etf.Atom("system"), from, request})
+	if err := sp.SendSyncRequest(ref, to, msg); err != nil {
+		return nil, err
+	}
+	sp.callbackWaitReply <- &ref
+	reply, err := sp.WaitSyncReply(ref, DefaultCallTimeout)
+	if err != nil {
+		return nil, err
+	}
+	switch r := reply.(type) {
+	case etf.Atom:
+		if r == etf.Atom("unknown_debug") {
+			return nil, ErrUnsupportedRequest
+		}
+	case etf.Tuple:
+		if len(r) == 2 && r.Element(1) == etf.Atom("error") {
+			return nil, fmt.Errorf("%s", etf.Format(r.Element(2)))
+		}
+	}
+	return reply, nil
+}
+
+//
+// sysProcess interface
+//
+
+func (gsp *ServerProcess) sysGetState() interface{} {
+	return gsp.State
+}
+
+func (gsp *ServerProcess) sysReplaceState(fun interface{}) (state interface{}, err error) {
+	f, ok := fun.(SysReplaceStateFun)
+	if !ok {
+		return nil, ErrUnsupportedRequest
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%#v", r)
+		}
+	}()
+	gsp.State = f(gsp.State)
+	return gsp.State, nil
+}
+
+func (gsp *ServerProcess) sysSuspend(suspend bool) {
+	gsp.suspended = suspend
+}
+
+func (gsp *ServerProcess) sysReductions() uint64 {
+	return gsp.reductions
+}
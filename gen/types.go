@@ -11,6 +11,14 @@ import (
 var (
 	ErrUnsupportedRequest = fmt.Errorf("Unsupported request")
 	ErrServerTerminated   = fmt.Errorf("Server terminated")
+	ErrFunArity           = fmt.Errorf("Wrong number of arguments for the fun")
+	ErrFunUnsupported     = fmt.Errorf("Unsupported fun")
+
+	ErrSupervisorChildNotFound   = fmt.Errorf("Child not found")
+	ErrSupervisorChildRunning    = fmt.Errorf("Child is running")
+	ErrSupervisorChildRestarting = fmt.Errorf("Child is restarting")
+	ErrSupervisorChildPresent    = fmt.Errorf("Child is already present")
+	ErrSupervisorSimpleOneForOne = fmt.Errorf("Not supported by the simple_one_for_one supervisor")
 )
 
 type Process interface {
@@ -46,6 +54,11 @@ type Process interface {
 	// or gen.ProcessID{RegisteredName, NodeName}
 	Send(to interface{}, message etf.Term) error
 
+	// TrySend makes the same as Send does, but never blocks. Returns an error (node.ErrBusy)
+	// if the mailbox of the local process or the send queue of the remote peer is full.
+	// It doesn't connect to the remote peer, returns node.ErrPeerUnknown if it's not connected.
+	TrySend(to interface{}, message etf.Term) error
+
 	// SendAfter starts a timer. When the timer expires, the message sends to the process
 	// identified by 'to'.  'to' can be a Pid, registered local name or
 	// gen.ProcessID{RegisteredName, NodeName}. Returns cancel function in order to discard
@@ -58,6 +71,11 @@ type Process interface {
 	// Kill immidiately stops process
 	Kill()
 
+	// SendExit sends an exit signal with the given reason to the local or remote
+	// process (in fashion of 'erlang:exit/2'). The reason "kill" stops the process
+	// unconditionally.
+	SendExit(to etf.Pid, reason string) error
+
 	// CreateAlias creates a new alias for the Process
 	CreateAlias() (etf.Alias, error)
 
@@ -311,6 +329,38 @@ type MessageExit struct {
 	Reason string
 }
 
+// MessageSystemMonitorBusyDist delivers to the system monitor process (see Node.SystemMonitor)
+// once the number of messages in the send queue of the connection with the remote node
+// reaches the given threshold
+type MessageSystemMonitorBusyDist struct {
+	Node            string
+	SendQueueLength int
+	SendQueueSize   int
+}
+
+// MessageSystemMonitorLongCallback delivers to the system monitor process if the
+// callback of the process has been running longer than the given threshold
+type MessageSystemMonitorLongCallback struct {
+	Pid      etf.Pid
+	Callback string
+	Message  etf.Term
+	Duration time.Duration
+}
+
+// MessageSystemMonitorLargeMailbox delivers to the system monitor process once
+// the number of messages in the mailbox of the process reaches the given threshold
+type MessageSystemMonitorLargeMailbox struct {
+	Pid           etf.Pid
+	MailboxLength int
+	MailboxSize   int
+}
+
+// MessageSystemMonitorLongSchedule delivers to the system monitor process if the
+// goroutines were not scheduled for longer than the given threshold
+type MessageSystemMonitorLongSchedule struct {
+	Duration time.Duration
+}
+
 // RPC defines rpc function type
 type RPC func(...etf.Term) etf.Term
 
@@ -322,8 +372,32 @@ type MessageManageRPC struct {
 	Fun      RPC
 }
 
+// MessageLookupRPC is using to check whether the RPC method is provided by "rex" process
+type MessageLookupRPC struct {
+	Module   string
+	Function string
+}
+
 type MessageDirectChildren struct{}
 
+// MessageDirectSuspend suspends the Server process. The suspended process handles
+// the system direct requests only (suspend, resume, code change). The other messages
+// are kept and handled in the order they came once the process is resumed.
+type MessageDirectSuspend struct{}
+
+// MessageDirectResume resumes the suspended Server process
+type MessageDirectResume struct{}
+
+// MessageDirectCodeChange replaces the behavior of the Server process with the new one
+// (see ServerBehavior.CodeChange). Supervisor replaces the behavior in the specs
+// of its children, so the restarted children use the new one.
+type MessageDirectCodeChange struct {
+	// From the behavior to be replaced (matched by type)
+	From ProcessBehavior
+	// To the new behavior
+	To ServerBehavior
+}
+
 func IsMessageDown(message etf.Term) (MessageDown, bool) {
 	var md MessageDown
 	switch m := message.(type) {
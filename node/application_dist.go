@@ -0,0 +1,272 @@
+package node
+
+// http://erlang.org/doc/design_principles/distributed_applications.html
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+)
+
+const (
+	// time to get the state of the application on the other nodes
+	// before making decision where it should be started
+	distACSyncTimeout = 300 * time.Millisecond
+)
+
+// distAC controls the distributed application (an analogue of Erlang's dist_ac).
+// It is started on every node the application is started on and makes sure the
+// application is running on exactly one of them - the available node with
+// the highest priority.
+type distAC struct {
+	gen.Server
+	node *node
+}
+
+type distACState struct {
+	spec     *gen.ApplicationSpec
+	behavior gen.ProcessBehavior
+	args     []etf.Term
+	included []*gen.ApplicationSpec
+	started  chan gen.Process
+	synced   bool
+	peers    map[string]*distACPeer
+	app      gen.Process
+	appRef   etf.Ref
+}
+
+type distACPeer struct {
+	monitor etf.Ref
+	running bool
+}
+
+type messageDistACSync struct{}
+
+func distACName(appName string) string {
+	return "dist_ac_" + appName
+}
+
+func distACPriority(spec *gen.ApplicationSpec, name string) int {
+	for i := range spec.Nodes {
+		if spec.Nodes[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Init
+func (d *distAC) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	state := &distACState{
+		spec:     args[0].(*gen.ApplicationSpec),
+		behavior: args[1].(gen.ProcessBehavior),
+		started:  args[2].(chan gen.Process),
+		args:     args[3].([]etf.Term),
+		included: args[4].([]*gen.ApplicationSpec),
+		peers:    make(map[string]*distACPeer),
+	}
+	process.State = state
+	// application must be stopped before this process is terminated
+	process.SetTrapExit(true)
+
+	for _, name := range state.spec.Nodes {
+		if name == process.NodeName() {
+			continue
+		}
+		d.send(process, name, "hello", false)
+	}
+	process.SendAfter(process.Self(), messageDistACSync{}, distACSyncTimeout)
+	return nil
+}
+
+// HandleInfo
+func (d *distAC) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	state := process.State.(*distACState)
+
+	switch m := message.(type) {
+	case messageDistACSync:
+		state.synced = true
+		d.elect(process, gen.ApplicationStartReasonNormal)
+		state.started <- state.app
+
+	case gen.MessageNodeDown:
+		d.peerDown(process, m.Name)
+
+	case gen.MessageDown:
+		if m.Ref != state.appRef {
+			break
+		}
+		// application has been terminated. leave the others so one of them
+		// could fail over it
+		return gen.ServerStatusStopWithReason(m.Reason)
+
+	case gen.MessageExit:
+		return gen.ServerStatusStopWithReason(m.Reason)
+
+	case etf.Tuple:
+		// {'$dist_ac', Kind, Node, Running}
+		if len(m) != 4 || m[0] != etf.Atom("$dist_ac") {
+			break
+		}
+		kind, _ := m[1].(etf.Atom)
+		peer, _ := m[2].(etf.Atom)
+		running, _ := m[3].(bool)
+		if distACPriority(state.spec, string(peer)) < 0 {
+			break
+		}
+
+		switch kind {
+		case "hello":
+			if d.peerUp(process, string(peer), running) {
+				d.send(process, string(peer), "status", state.app != nil)
+				d.elect(process, gen.ApplicationStartReasonNormal)
+			}
+		case "status":
+			if d.peerUp(process, string(peer), running) {
+				d.elect(process, gen.ApplicationStartReasonNormal)
+			}
+		case "leave":
+			d.peerDown(process, string(peer))
+		case "takeover":
+			d.stopApplication(process, "normal")
+			d.broadcast(process, "status", false)
+		}
+	}
+
+	return gen.ServerStatusOK
+}
+
+// Terminate
+func (d *distAC) Terminate(process *gen.ServerProcess, reason string) {
+	state := process.State.(*distACState)
+	running := state.app != nil
+	d.stopApplication(process, reason)
+	d.broadcast(process, "leave", running)
+}
+
+// elect starts the application if this node has the highest priority among the
+// available ones. It is taken over if the application is running on the other node.
+func (d *distAC) elect(process *gen.ServerProcess, reason gen.ApplicationStartReason) {
+	state := process.State.(*distACState)
+	if !state.synced || state.app != nil {
+		return
+	}
+
+	for _, name := range state.spec.Nodes {
+		if name == process.NodeName() {
+			break
+		}
+		if _, ok := state.peers[name]; ok {
+			// there is available node with higher priority
+			return
+		}
+	}
+
+	takeover := ""
+	for name, peer := range state.peers {
+		if peer.running {
+			takeover = name
+			reason = gen.ApplicationStartReasonTakeover
+			break
+		}
+	}
+
+	if err := d.startApplication(process, reason); err != nil {
+		fmt.Printf("WARNING! can't start distributed application %q: %s\n", state.spec.Name, err)
+		return
+	}
+	if takeover != "" {
+		d.send(process, takeover, "takeover", true)
+	}
+	d.broadcast(process, "status", true)
+}
+
+// peerUp updates the state of the given node. Returns false if this node is not
+// available anymore.
+func (d *distAC) peerUp(process *gen.ServerProcess, name string, running bool) bool {
+	state := process.State.(*distACState)
+	peer, ok := state.peers[name]
+	if !ok {
+		monitor := process.MonitorNode(name)
+		if d.node.getPeer(name) == nil {
+			// this message has been received right before the connection was closed
+			process.DemonitorNode(monitor)
+			return false
+		}
+		peer = &distACPeer{
+			monitor: monitor,
+		}
+		state.peers[name] = peer
+	}
+	peer.running = running
+	return true
+}
+
+func (d *distAC) peerDown(process *gen.ServerProcess, name string) {
+	state := process.State.(*distACState)
+	peer, ok := state.peers[name]
+	if !ok {
+		return
+	}
+	process.DemonitorNode(peer.monitor)
+	delete(state.peers, name)
+
+	// the application might be running on this node even if we haven't
+	// got its status yet
+	d.elect(process, gen.ApplicationStartReasonFailover)
+}
+
+func (d *distAC) startApplication(process *gen.ServerProcess, reason gen.ApplicationStartReason) error {
+	state := process.State.(*distACState)
+	env := map[string]interface{}{
+		"spec":                state.spec,
+		gen.EnvKeyStartReason: reason,
+		"included":            state.included,
+	}
+	options := gen.ProcessOptions{
+		Env: env,
+	}
+	app, err := d.node.Spawn("", options, state.behavior, state.args...)
+	if err != nil {
+		return err
+	}
+	state.app = app
+	state.appRef = process.MonitorProcess(app.Self())
+	return nil
+}
+
+func (d *distAC) stopApplication(process *gen.ServerProcess, reason string) {
+	state := process.State.(*distACState)
+	if state.app == nil {
+		return
+	}
+	process.DemonitorProcess(state.appRef)
+	deadline, ok := process.Env(gen.EnvKeyStopDeadline).(time.Time)
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	state.app.SetEnv(gen.EnvKeyStopDeadline, deadline)
+	if state.app.Exit(reason) == nil {
+		state.app.WaitWithTimeout(time.Until(deadline))
+	}
+	state.app = nil
+}
+
+func (d *distAC) send(process *gen.ServerProcess, name string, kind string, running bool) {
+	to := gen.ProcessID{
+		Name: distACName(process.State.(*distACState).spec.Name),
+		Node: name,
+	}
+	message := etf.Tuple{etf.Atom("$dist_ac"), etf.Atom(kind), etf.Atom(process.NodeName()), running}
+	// node might be unavailable. it sends 'hello' once it is up
+	process.Send(to, message)
+}
+
+func (d *distAC) broadcast(process *gen.ServerProcess, kind string, running bool) {
+	state := process.State.(*distACState)
+	for name := range state.peers {
+		d.send(process, name, kind, running)
+	}
+}
@@ -0,0 +1,353 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Carrier defines the transport the distribution links are running on.
+type Carrier interface {
+	// Listen creates listener for the incoming connections. Returns the port
+	// number the node must be registered with in EPMD. Zero value means
+	// this carrier doesn't use EPMD for the name resolving.
+	Listen(ctx context.Context, name string, opts Options) (net.Listener, uint16, error)
+	// Dial makes connection to the node with the given name. Route contains
+	// resolved port number (for the carrier using EPMD).
+	Dial(ctx context.Context, name string, route NetworkRoute) (net.Conn, error)
+}
+
+//
+// TCP carrier
+//
+
+// TCPCarrier default carrier. Uses TCP and EPMD for the name resolving.
+type TCPCarrier struct{}
+
+// Listen starts listening on the first available port within the range
+// Options.ListenRangeBegin...Options.ListenRangeEnd
+func (tc TCPCarrier) Listen(ctx context.Context, name string, opts Options) (net.Listener, uint16, error) {
+	lc := net.ListenConfig{}
+	host := nodeHost(name)
+	for p := opts.ListenRangeBegin; p <= opts.ListenRangeEnd; p++ {
+		l, err := lc.Listen(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(p))))
+		if err != nil {
+			continue
+		}
+		return l, p, nil
+	}
+
+	// all the ports within a given range are taken
+	return nil, 0, fmt.Errorf("Can't start listener. Port range is taken")
+}
+
+// Dial connects to the port (resolved by EPMD or static route) on the host of the given node
+func (tc TCPCarrier) Dial(ctx context.Context, name string, route NetworkRoute) (net.Conn, error) {
+	dialer := net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(nodeHost(name), strconv.Itoa(route.Port)))
+}
+
+//
+// Unix domain socket carrier
+//
+
+// UnixCarrier uses Unix domain sockets for the nodes running on the same host.
+// Socket file is created in Dir (os.TempDir() by default) and named as the node.
+// EPMD is not used with this carrier.
+type UnixCarrier struct {
+	Dir string
+}
+
+func (uc UnixCarrier) socketPath(name string) string {
+	dir := uc.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, name+".sock")
+}
+
+// Listen creates socket file for the given node name. Socket file is removed
+// on node termination.
+func (uc UnixCarrier) Listen(ctx context.Context, name string, opts Options) (net.Listener, uint16, error) {
+	path := uc.socketPath(name)
+
+	// remove stale socket file left by the previous run. make sure nobody is using it.
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return nil, 0, ErrTaken
+	}
+	os.Remove(path)
+
+	lc := net.ListenConfig{}
+	l, err := lc.Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return l, 0, nil
+}
+
+// Dial connects to the socket file of the given node name
+func (uc UnixCarrier) Dial(ctx context.Context, name string, route NetworkRoute) (net.Conn, error) {
+	dialer := net.Dialer{}
+	return dialer.DialContext(ctx, "unix", uc.socketPath(name))
+}
+
+//
+// In-memory carrier
+//
+
+// PipeCarrier is an in-memory carrier for the nodes running within the same
+// binary (mostly useful for testing). All the nodes must share the same
+// PipeCarrier instance created with NewPipeCarrier. EPMD is not used with this carrier.
+type PipeCarrier struct {
+	mutex     sync.Mutex
+	listeners map[string]*pipeListener
+}
+
+// NewPipeCarrier creates a new in-memory carrier
+func NewPipeCarrier() *PipeCarrier {
+	return &PipeCarrier{
+		listeners: make(map[string]*pipeListener),
+	}
+}
+
+// Listen registers the given node name within this carrier. Name is
+// unregistered on node termination.
+func (pc *PipeCarrier) Listen(ctx context.Context, name string, opts Options) (net.Listener, uint16, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if _, exist := pc.listeners[name]; exist {
+		return nil, 0, ErrTaken
+	}
+
+	l := &pipeListener{
+		addr:   pipeAddr(name),
+		accept: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+	l.close = func() {
+		pc.mutex.Lock()
+		if pc.listeners[name] == l {
+			delete(pc.listeners, name)
+		}
+		pc.mutex.Unlock()
+	}
+	pc.listeners[name] = l
+	return l, 0, nil
+}
+
+// Dial creates an in-memory connection with the node registered with the given name
+func (pc *PipeCarrier) Dial(ctx context.Context, name string, route NetworkRoute) (net.Conn, error) {
+	pc.mutex.Lock()
+	l, exist := pc.listeners[name]
+	pc.mutex.Unlock()
+	if !exist {
+		return nil, fmt.Errorf("Can't resolve %s", name)
+	}
+
+	a := newPipeBuffer()
+	b := newPipeBuffer()
+	local := &pipeConn{
+		r:      a,
+		w:      b,
+		local:  pipeAddr(fmt.Sprintf("%s-%p", name, a)),
+		remote: l.addr,
+	}
+	remote := &pipeConn{
+		r:      b,
+		w:      a,
+		local:  l.addr,
+		remote: local.local,
+	}
+
+	select {
+	case l.accept <- remote:
+		return local, nil
+	case <-l.done:
+		return nil, fmt.Errorf("Can't connect to %s: listener is closed", name)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr string
+
+func (pa pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (pa pipeAddr) String() string {
+	return string(pa)
+}
+
+type pipeListener struct {
+	addr      pipeAddr
+	accept    chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	close     func()
+}
+
+func (pl *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-pl.accept:
+		return c, nil
+	case <-pl.done:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+func (pl *pipeListener) Close() error {
+	pl.closeOnce.Do(func() {
+		close(pl.done)
+		pl.close()
+	})
+	return nil
+}
+
+func (pl *pipeListener) Addr() net.Addr {
+	return pl.addr
+}
+
+// pipeBuffer is an unbounded one-way stream. Unlike net.Pipe, writing doesn't
+// block until the data is read by the other side, which makes possible writing
+// simultaneously on both sides (keepalive packets).
+type pipeBuffer struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	data     []byte
+	closed   bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newPipeBuffer() *pipeBuffer {
+	pb := &pipeBuffer{}
+	pb.cond = sync.NewCond(&pb.mutex)
+	return pb
+}
+
+func (pb *pipeBuffer) read(b []byte) (int, error) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	for len(pb.data) == 0 {
+		if pb.closed {
+			return 0, io.EOF
+		}
+		if !pb.deadline.IsZero() && time.Now().After(pb.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		pb.cond.Wait()
+	}
+
+	n := copy(b, pb.data)
+	pb.data = pb.data[n:]
+	if len(pb.data) == 0 {
+		// release underlying array
+		pb.data = nil
+	}
+	return n, nil
+}
+
+func (pb *pipeBuffer) write(b []byte) (int, error) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	if pb.closed {
+		return 0, io.ErrClosedPipe
+	}
+	pb.data = append(pb.data, b...)
+	pb.cond.Broadcast()
+	return len(b), nil
+}
+
+func (pb *pipeBuffer) close() {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	pb.closed = true
+	if pb.timer != nil {
+		pb.timer.Stop()
+	}
+	pb.cond.Broadcast()
+}
+
+func (pb *pipeBuffer) setDeadline(t time.Time) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	pb.deadline = t
+	if pb.timer != nil {
+		pb.timer.Stop()
+		pb.timer = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	pb.timer = time.AfterFunc(time.Until(t), func() {
+		pb.mutex.Lock()
+		pb.cond.Broadcast()
+		pb.mutex.Unlock()
+	})
+	pb.cond.Broadcast()
+}
+
+type pipeConn struct {
+	r      *pipeBuffer
+	w      *pipeBuffer
+	local  pipeAddr
+	remote pipeAddr
+}
+
+func (pc *pipeConn) Read(b []byte) (int, error) {
+	return pc.r.read(b)
+}
+
+func (pc *pipeConn) Write(b []byte) (int, error) {
+	return pc.w.write(b)
+}
+
+func (pc *pipeConn) Close() error {
+	pc.r.close()
+	pc.w.close()
+	return nil
+}
+
+func (pc *pipeConn) LocalAddr() net.Addr {
+	return pc.local
+}
+
+func (pc *pipeConn) RemoteAddr() net.Addr {
+	return pc.remote
+}
+
+func (pc *pipeConn) SetDeadline(t time.Time) error {
+	pc.r.setDeadline(t)
+	return nil
+}
+
+func (pc *pipeConn) SetReadDeadline(t time.Time) error {
+	pc.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline has no effect since writing never blocks
+func (pc *pipeConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func nodeHost(name string) string {
+	ns := strings.Split(name, "@")
+	if len(ns) != 2 {
+		return name
+	}
+	return ns[1]
+}
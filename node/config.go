@@ -0,0 +1,111 @@
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ergo-services/ergo/etf"
+)
+
+// readConfig reads the environment of applications from the given file. The format is
+// defined by the file extension:
+//
+//	.config - Erlang terms (sys.config): [{app, [{key, value}, ...]}, ...].
+//	.toml   - tables [app] with the key/value pairs
+//	.json   - {"app": {"key": value, ...}, ...}
+func readConfig(filename string) (map[string]map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(filename) {
+	case ".config":
+		terms, err := etf.Consult(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(terms) != 1 {
+			return nil, fmt.Errorf("malformed config %q: must be a single list", filename)
+		}
+		return configFromTerms(terms[0])
+
+	case ".toml":
+		term, err := tomlToTerm(data)
+		if err != nil {
+			return nil, err
+		}
+		return configFromMap(term)
+
+	case ".json":
+		term, err := etf.JSONToTerm(data, etf.BridgeOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return configFromMap(term)
+	}
+
+	return nil, fmt.Errorf("unsupported config format %q", filename)
+}
+
+// configFromTerms handles [{app, [{key, value}, ...]}, ...]
+func configFromTerms(term etf.Term) (map[string]map[string]interface{}, error) {
+	apps, ok := term.(etf.List)
+	if !ok {
+		return nil, fmt.Errorf("malformed config: must be a list")
+	}
+
+	config := make(map[string]map[string]interface{})
+	for _, a := range apps {
+		app, ok := a.(etf.Tuple)
+		if !ok || len(app) != 2 {
+			return nil, fmt.Errorf("malformed config: %s", etf.Format(a))
+		}
+		name, ok := app[0].(etf.Atom)
+		if !ok {
+			return nil, fmt.Errorf("malformed config: %s", etf.Format(a))
+		}
+		pairs, ok := app[1].(etf.List)
+		if !ok {
+			return nil, fmt.Errorf("malformed config of %q: must be a list", name)
+		}
+
+		env := make(map[string]interface{})
+		for _, p := range pairs {
+			pair, ok := p.(etf.Tuple)
+			if !ok || len(pair) != 2 {
+				return nil, fmt.Errorf("malformed config of %q: %s", name, etf.Format(p))
+			}
+			key, ok := pair[0].(etf.Atom)
+			if !ok {
+				return nil, fmt.Errorf("malformed config of %q: %s", name, etf.Format(p))
+			}
+			env[string(key)] = pair[1]
+		}
+		config[string(name)] = env
+	}
+	return config, nil
+}
+
+// configFromMap handles {"app": {"key": value, ...}, ...}
+func configFromMap(term etf.Term) (map[string]map[string]interface{}, error) {
+	apps, ok := term.(etf.Map)
+	if !ok {
+		return nil, fmt.Errorf("malformed config: must be a map")
+	}
+
+	config := make(map[string]map[string]interface{})
+	for name, value := range apps {
+		pairs, ok := value.(etf.Map)
+		if !ok {
+			return nil, fmt.Errorf("malformed config of %q: must be a map", name)
+		}
+		env := make(map[string]interface{})
+		for key, value := range pairs {
+			env[fmt.Sprint(key)] = value
+		}
+		config[fmt.Sprint(name)] = env
+	}
+	return config, nil
+}
@@ -0,0 +1,534 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ergo-services/ergo/etf"
+)
+
+var (
+	errMalformedTOML = fmt.Errorf("Malformed TOML")
+)
+
+// tomlToTerm converts TOML document into the term. Tables (including inline tables)
+// are etf.Map with the string keys, arrays (and arrays of tables) are etf.List, integers
+// are int, floats are float64, strings are string. Date and time values
+// are not supported.
+func tomlToTerm(data []byte) (etf.Term, error) {
+	p := &tomlParser{
+		s:       string(data),
+		defined: make(map[string]bool),
+	}
+	root := etf.Map{}
+	table := root
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return root, nil
+		}
+
+		switch p.peek() {
+		case '#', '\r', '\n':
+		case '[':
+			t, err := p.header(root)
+			if err != nil {
+				return nil, err
+			}
+			table = t
+		default:
+			if err := p.keyValue(table); err != nil {
+				return nil, err
+			}
+		}
+
+		p.skipSpace()
+		p.skipComment()
+		if p.eof() {
+			return root, nil
+		}
+		if err := p.newline(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	s   string
+	pos int
+	// explicitly defined tables
+	defined map[string]bool
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.pos], "\n") + 1
+	return fmt.Errorf("%w at line %d: %s", errMalformedTOML, line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.s[p.pos:], prefix)
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	if p.peek() != '#' {
+		return
+	}
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// skipBlank skips spaces, newlines and comments (within arrays)
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		switch p.peek() {
+		case '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) newline() error {
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		return nil
+	}
+	if p.peek() == '\n' {
+		p.pos++
+		return nil
+	}
+	return p.errorf("expected new line, got %q", p.peek())
+}
+
+// header handles [table] and [[array.of.tables]]. Returns the table
+// the following key/value pairs belong to.
+func (p *tomlParser) header(root etf.Map) (etf.Map, error) {
+	p.pos++
+	array := p.peek() == '['
+	if array {
+		p.pos++
+	}
+	p.skipSpace()
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.hasPrefix(closing) {
+		return nil, p.errorf("expected %q", closing)
+	}
+	p.pos += len(closing)
+
+	parent, err := p.lookup(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	path := strings.Join(keys, "\x00")
+
+	if array {
+		table := etf.Map{}
+		switch value := parent[last].(type) {
+		case nil:
+			parent[last] = etf.List{table}
+		case etf.List:
+			parent[last] = append(value, table)
+		default:
+			return nil, p.errorf("key %q is already defined", last)
+		}
+		// sub tables are defined for each element of the array separately
+		for defined := range p.defined {
+			if strings.HasPrefix(defined, path+"\x00") {
+				delete(p.defined, defined)
+			}
+		}
+		return table, nil
+	}
+
+	if p.defined[path] {
+		return nil, p.errorf("table %q is already defined", strings.Join(keys, "."))
+	}
+	p.defined[path] = true
+
+	switch value := parent[last].(type) {
+	case nil:
+		table := etf.Map{}
+		parent[last] = table
+		return table, nil
+	case etf.Map:
+		// has been created implicitly
+		return value, nil
+	}
+	return nil, p.errorf("key %q is already defined", last)
+}
+
+// lookup returns the table by the given keys creating the missing ones.
+// The last table of the array of tables is used.
+func (p *tomlParser) lookup(table etf.Map, keys []string) (etf.Map, error) {
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case nil:
+			t := etf.Map{}
+			table[key] = t
+			table = t
+		case etf.Map:
+			table = value
+		case etf.List:
+			if len(value) == 0 {
+				return nil, p.errorf("key %q is not a table", key)
+			}
+			t, ok := value[len(value)-1].(etf.Map)
+			if !ok {
+				return nil, p.errorf("key %q is not a table", key)
+			}
+			table = t
+		default:
+			return nil, p.errorf("key %q is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+func (p *tomlParser) keyValue(table etf.Map) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expected '='")
+	}
+	p.pos++
+	p.skipSpace()
+
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	table, err = p.lookup(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exist := table[last]; exist {
+		return p.errorf("key %q is already defined", last)
+	}
+	table[last] = value
+	return nil
+}
+
+// key parses the (dotted) key
+func (p *tomlParser) key() ([]string, error) {
+	keys := []string{}
+	for {
+		var key string
+		var err error
+
+		switch p.peek() {
+		case '"':
+			key, err = p.basicString()
+		case '\'':
+			key, err = p.literalString()
+		default:
+			start := p.pos
+			for !p.eof() && isTOMLBareKey(p.peek()) {
+				p.pos++
+			}
+			key = p.s[start:p.pos]
+			if key == "" {
+				err = p.errorf("expected key")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+		p.skipSpace()
+	}
+}
+
+func isTOMLBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (etf.Term, error) {
+	switch {
+	case p.hasPrefix(`"""`):
+		return p.multilineString(`"""`)
+	case p.hasPrefix(`'''`):
+		return p.multilineString(`'''`)
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	switch token {
+	case "":
+		return nil, p.errorf("expected value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	return p.number(token)
+}
+
+func (p *tomlParser) number(token string) (etf.Term, error) {
+	if len(token) > 4 && (token[4] == '-' || token[2] == ':') {
+		return nil, p.errorf("date and time values are not supported")
+	}
+	digits := strings.Replace(token, "_", "", -1)
+
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+
+	if base == 10 && strings.ContainsAny(digits, ".eE") {
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, p.errorf("malformed float %q", token)
+		}
+		return f, nil
+	}
+
+	i, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return nil, p.errorf("malformed integer %q", token)
+	}
+	return int(i), nil
+}
+
+func (p *tomlParser) array() (etf.Term, error) {
+	p.pos++
+	list := etf.List{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (etf.Term, error) {
+	p.pos++
+	table := etf.Map{}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		p.skipSpace()
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.s[p.pos:], "'\n")
+	if end < 0 || p.s[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		switch c := p.peek(); c {
+		case 0, '\n':
+			return "", p.errorf("unterminated string")
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) multilineString(quotes string) (string, error) {
+	p.pos += len(quotes)
+	// a newline immediately following the opening delimiter is trimmed
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+	} else if p.peek() == '\n' {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if p.hasPrefix(quotes) {
+			p.pos += len(quotes)
+			// up to two quotes are allowed right before the closing delimiter
+			for i := 0; i < 2 && p.hasPrefix(quotes[:1]); i++ {
+				b.WriteByte(quotes[0])
+				p.pos++
+			}
+			return b.String(), nil
+		}
+
+		c := p.peek()
+		if c != '\\' || quotes == `'''` {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		// line ending backslash trims all the whitespaces up to the next
+		// non-whitespace character
+		i := p.pos + 1
+		for i < len(p.s) && (p.s[i] == ' ' || p.s[i] == '\t') {
+			i++
+		}
+		if i < len(p.s) && (p.s[i] == '\n' || p.s[i] == '\r') {
+			p.pos = i
+			for strings.IndexByte(" \t\r\n", p.peek()) >= 0 && !p.eof() {
+				p.pos++
+			}
+			continue
+		}
+		if err := p.escape(&b); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *tomlParser) escape(b *strings.Builder) error {
+	p.pos++
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"':
+		b.WriteByte('"')
+	case '\\':
+		b.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("malformed escape sequence")
+		}
+		code, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("malformed escape sequence")
+		}
+		b.WriteRune(rune(code))
+		p.pos += n
+	default:
+		return p.errorf("unknown escape sequence \\%c", c)
+	}
+	return nil
+}
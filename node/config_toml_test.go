@@ -0,0 +1,83 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ergo-services/ergo/etf"
+)
+
+func TestTOMLConfigToTerm(t *testing.T) {
+	text := `
+# application config
+title = "config" # comment
+
+[myapp]
+port = 8_080
+rate = 0.5
+enabled = true
+hosts = [
+	"a", 'b', # comment
+	"c\t\u00e9",
+]
+limits = { rps = 100, burst = 0x10 }
+"quoted key".nested = '''
+raw \n'''
+
+[myapp.db]
+dsn = """\
+	postgres://\
+	localhost"""
+
+[[myapp.workers]]
+name = "w1"
+
+[[myapp.workers]]
+name = "w2"
+`
+	term, err := tomlToTerm([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := etf.Map{
+		"title": "config",
+		"myapp": etf.Map{
+			"port":    8080,
+			"rate":    0.5,
+			"enabled": true,
+			"hosts":   etf.List{"a", "b", "c\té"},
+			"limits":  etf.Map{"rps": 100, "burst": 16},
+			"quoted key": etf.Map{
+				"nested": "raw \\n",
+			},
+			"db": etf.Map{
+				"dsn": "postgres://localhost",
+			},
+			"workers": etf.List{
+				etf.Map{"name": "w1"},
+				etf.Map{"name": "w2"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+
+	wrong := []string{
+		"key",
+		"key = ",
+		"key = 1\nkey = 2",
+		"[a]\n[a]",
+		"a = 1\n[a]",
+		"key = \"unterminated",
+		"key = [1, 2",
+		"key = 1979-05-27",
+		"key = 1 2",
+		"key = \"\\x\"",
+	}
+	for _, text := range wrong {
+		if _, err := tomlToTerm([]byte(text)); err == nil {
+			t.Fatalf("%q: expected error", text)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -76,6 +77,13 @@ const (
 	NAME_ME = 1 << 33
 	V4_NC   = 1 << 34
 	ALIAS   = 1 << 35
+
+	// Ergo specific flags. Erlang nodes just ignore them.
+	// MULTI_LINK allows multiple connections between two nodes
+	MULTI_LINK = 1 << 60
+	// the number of links the dialing side opens is kept in the bits 52-59
+	multiLinkCountShift = 52
+	multiLinkCountMax   = 0xff
 )
 
 type HandshakeOptions struct {
@@ -85,8 +93,34 @@ type HandshakeOptions struct {
 	TLS      bool
 	Hidden   bool
 	Creation uint32
+	// Authenticate is invoked as soon as the name of the remote peer is known.
+	// Optional.
+	Authenticate HandshakeAuthFunc
+	// Links the number of links the dialing side is going to open to the peer
+	// (with MULTI_LINK). Ignored by HandshakeAccept.
+	Links int
+}
+
+// HandshakeAuthInfo contains the details about the remote peer
+// passed to the HandshakeAuthFunc
+type HandshakeAuthInfo struct {
+	// Name of the remote node
+	Name string
+	// Flags distribution flags the remote node has announced
+	Flags uint64
+	// RemoteAddr address of the remote side of connection
+	RemoteAddr net.Addr
+	// TLS state of the connection. It is nil if TLS is disabled.
+	TLS *tls.ConnectionState
+	// Accept is true if this connection was initiated by the remote peer
+	Accept bool
 }
 
+// HandshakeAuthFunc decides whether the remote peer is allowed to connect.
+// Returning a non-empty cookie overrides the cookie used for this peer.
+// Returning an error rejects connection.
+type HandshakeAuthFunc func(info HandshakeAuthInfo) (string, error)
+
 func (nf nodeFlag) toUint32() uint32 {
 	return uint32(nf)
 }
@@ -257,6 +291,7 @@ func Handshake(conn net.Conn, options HandshakeOptions) (*Link, error) {
 			DIST_HDR_ATOM_CACHE, HIDDEN_ATOM_CACHE, NEW_FUN_TAGS,
 			SMALL_ATOM_TAGS, UTF8_ATOMS, MAP_TAG,
 			FRAGMENTS, HANDSHAKE23, BIG_CREATION, SPAWN, V4_NC, ALIAS,
+			MULTI_LINK,
 		),
 
 		conn:       conn,
@@ -264,6 +299,13 @@ func Handshake(conn net.Conn, options HandshakeOptions) (*Link, error) {
 		version:    uint16(options.Version),
 		creation:   options.Creation,
 	}
+	if options.Links > 1 {
+		links := options.Links
+		if links > multiLinkCountMax {
+			links = multiLinkCountMax
+		}
+		link.flags |= nodeFlag(uint64(links) << multiLinkCountShift)
+	}
 
 	b := lib.TakeBuffer()
 	defer lib.ReleaseBuffer(b)
@@ -340,6 +382,9 @@ func Handshake(conn net.Conn, options HandshakeOptions) (*Link, error) {
 				if challenge == 0 {
 					return nil, fmt.Errorf("malformed handshake (mismatch handshake version")
 				}
+				if e := link.authenticate(options.Authenticate, false); e != nil {
+					return nil, e
+				}
 				b.Reset()
 
 				link.composeChallengeReply(b, challenge, options.TLS)
@@ -359,6 +404,9 @@ func Handshake(conn net.Conn, options HandshakeOptions) (*Link, error) {
 					return nil, fmt.Errorf("malformed handshake ('N' length)")
 				}
 				challenge := link.readChallengeVersion6(buffer[1:])
+				if e := link.authenticate(options.Authenticate, false); e != nil {
+					return nil, e
+				}
 				b.Reset()
 
 				if link.version == ProtoHandshake5 {
@@ -429,6 +477,7 @@ func HandshakeAccept(conn net.Conn, options HandshakeOptions) (*Link, error) {
 			DIST_HDR_ATOM_CACHE, HIDDEN_ATOM_CACHE, NEW_FUN_TAGS,
 			SMALL_ATOM_TAGS, UTF8_ATOMS, MAP_TAG,
 			FRAGMENTS, HANDSHAKE23, BIG_CREATION, SPAWN, V4_NC, ALIAS,
+			MULTI_LINK,
 		),
 
 		conn:       conn,
@@ -503,6 +552,11 @@ func HandshakeAccept(conn net.Conn, options HandshakeOptions) (*Link, error) {
 
 				link.peer = link.readName(buffer[1:])
 				b.Reset()
+				if e := link.authenticate(options.Authenticate, true); e != nil {
+					link.composeStatusNotAllowed(b, options.TLS)
+					b.WriteDataTo(conn)
+					return nil, e
+				}
 				link.composeStatus(b, options.TLS)
 				if e := b.WriteDataTo(conn); e != nil {
 					return nil, fmt.Errorf("malformed handshake ('n' accept name)")
@@ -529,6 +583,11 @@ func HandshakeAccept(conn net.Conn, options HandshakeOptions) (*Link, error) {
 				}
 				link.peer = link.readNameVersion6(buffer[1:])
 				b.Reset()
+				if e := link.authenticate(options.Authenticate, true); e != nil {
+					link.composeStatusNotAllowed(b, options.TLS)
+					b.WriteDataTo(conn)
+					return nil, e
+				}
 				link.composeStatus(b, options.TLS)
 				if e := b.WriteDataTo(conn); e != nil {
 					return nil, fmt.Errorf("malformed handshake ('N' accept name)")
@@ -1301,6 +1360,35 @@ func (l *Link) GetRemoteName() string {
 	return l.peer.Name
 }
 
+// PeerCreation returns the creation value of the remote peer
+func (l *Link) PeerCreation() uint32 {
+	if l.peer == nil {
+		return 0
+	}
+	return l.peer.creation
+}
+
+// MultiLink returns true if both sides support multiple links between them
+func (l *Link) MultiLink() bool {
+	if l.peer == nil {
+		return false
+	}
+	return l.flags.isSet(MULTI_LINK) && l.peer.flags.isSet(MULTI_LINK)
+}
+
+// PeerLinks returns the number of links the remote peer is going to open to this
+// node (announced on handshaking). Returns 1 if it is not a multi link peer.
+func (l *Link) PeerLinks() int {
+	if l.MultiLink() == false {
+		return 1
+	}
+	links := int(l.peer.flags.toUint64()>>multiLinkCountShift) & multiLinkCountMax
+	if links == 0 {
+		return 1
+	}
+	return links
+}
+
 func (l *Link) composeName(b *lib.Buffer, tls bool) {
 	if tls {
 		b.Allocate(11)
@@ -1384,6 +1472,47 @@ func (l *Link) composeStatus(b *lib.Buffer, tls bool) {
 
 }
 
+func (l *Link) composeStatusNotAllowed(b *lib.Buffer, tls bool) {
+	if tls {
+		b.Allocate(4)
+		dataLength := 12 // 's' + "not_allowed"
+		binary.BigEndian.PutUint32(b.B[0:4], uint32(dataLength))
+		b.Append([]byte("snot_allowed"))
+		return
+	}
+
+	b.Allocate(2)
+	dataLength := 12 // 's' + "not_allowed"
+	binary.BigEndian.PutUint16(b.B[0:2], uint16(dataLength))
+	b.Append([]byte("snot_allowed"))
+}
+
+func (l *Link) authenticate(auth HandshakeAuthFunc, accept bool) error {
+	if auth == nil {
+		return nil
+	}
+
+	info := HandshakeAuthInfo{
+		Name:       l.peer.Name,
+		Flags:      l.peer.flags.toUint64(),
+		RemoteAddr: l.conn.RemoteAddr(),
+		Accept:     accept,
+	}
+	if c, ok := l.conn.(*tls.Conn); ok {
+		state := c.ConnectionState()
+		info.TLS = &state
+	}
+
+	cookie, err := auth(info)
+	if err != nil {
+		return err
+	}
+	if cookie != "" {
+		l.Cookie = cookie
+	}
+	return nil
+}
+
 func (l *Link) readStatus(msg []byte) bool {
 	if string(msg[:2]) == "ok" {
 		return true
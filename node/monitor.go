@@ -397,6 +397,8 @@ func (m *monitor) nodeDown(name string) {
 			if processID.Node != name {
 				continue
 			}
+		} else if string(pid.Node) != name {
+			continue
 		}
 		for i := range ps {
 			m.notifyProcessTerminated(ps[i].ref, ps[i].pid, pid, "noconnection")
@@ -7,6 +7,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"sync"
+	"sync/atomic"
 
 	//"crypto/rsa"
 	"crypto/tls"
@@ -26,13 +27,17 @@ import (
 	"net"
 
 	//	"net/http"
-	"strconv"
+	"path"
 	"strings"
 	"time"
 )
 
 const (
 	remoteBehaviorGroup = "ergo:remote"
+
+	// peerLinksTimeout how long the accepted links of the multi link peer are
+	// held waiting for the rest of them
+	peerLinksTimeout = 3 * time.Second
 )
 
 type networkInternal interface {
@@ -50,25 +55,53 @@ type network struct {
 	epmd             *epmd
 	tlscertServer    tls.Certificate
 	tlscertClient    tls.Certificate
+	withoutEPMD      bool
+
+	peerPolicyMutex sync.Mutex
+	peerPolicy      map[string]peerSendQueuePolicy
+
+	pendingLinksMutex sync.Mutex
+	pendingLinks      map[string]*pendingLinks
+}
+
+// pendingLinks the accepted links of the multi link peer waiting for the rest of them
+type pendingLinks struct {
+	creation uint32
+	links    []*dist.Link
+	timer    *time.Timer
+}
+
+type peerSendQueuePolicy struct {
+	policy  SendQueuePolicy
+	timeout time.Duration
 }
 
 func newNetwork(ctx context.Context, name string, opts Options, r registrarInternal) (networkInternal, error) {
 	n := &network{
-		name:      name,
-		opts:      opts,
-		ctx:       ctx,
-		registrar: r,
+		name:         name,
+		opts:         opts,
+		ctx:          ctx,
+		registrar:    r,
+		peerPolicy:   make(map[string]peerSendQueuePolicy),
+		pendingLinks: make(map[string]*pendingLinks),
 	}
 	ns := strings.Split(name, "@")
 	if len(ns) != 2 {
 		return nil, fmt.Errorf("(EMPD) FQDN for node name is required (example: node@hostname)")
 	}
 
-	port, err := n.listen(ctx, ns[1])
+	port, err := n.listen(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 	n.epmd = &epmd{}
+	if port == 0 {
+		// carrier doesn't use EPMD. keep static routes only
+		n.epmd.staticOnly = true
+		n.epmd.staticRoutes = make(map[string]NetworkRoute)
+		n.withoutEPMD = true
+		return n, nil
+	}
 	if err := n.epmd.Init(ctx, name, port, opts); err != nil {
 		return nil, err
 	}
@@ -85,6 +118,42 @@ func (n *network) AddStaticRouteExt(name string, port uint16, cookie string, tls
 	return n.epmd.AddStaticRoute(name, port, cookie, tls)
 }
 
+// SetPeerSendQueuePolicy overrides the send queue policy for the given peer.
+// It is applied immediately if the peer is connected.
+func (n *network) SetPeerSendQueuePolicy(name string, policy SendQueuePolicy, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = n.opts.SendQueueTimeout
+	}
+	n.peerPolicyMutex.Lock()
+	n.peerPolicy[name] = peerSendQueuePolicy{policy, timeout}
+	n.peerPolicyMutex.Unlock()
+
+	if p := n.registrar.getPeer(name); p != nil {
+		p.mutex.Lock()
+		p.policy = policy
+		p.timeout = timeout
+		p.mutex.Unlock()
+	}
+}
+
+func (n *network) peerSendQueuePolicy(name string) (SendQueuePolicy, time.Duration) {
+	n.peerPolicyMutex.Lock()
+	defer n.peerPolicyMutex.Unlock()
+	if pp, ok := n.peerPolicy[name]; ok {
+		return pp.policy, pp.timeout
+	}
+	return n.opts.SendQueuePolicy, n.opts.SendQueueTimeout
+}
+
+// PeerStats returns the state of the send queue of the given connected peer
+func (n *network) PeerStats(name string) (PeerStats, error) {
+	p := n.registrar.getPeer(name)
+	if p == nil {
+		return PeerStats{}, ErrPeerUnknown
+	}
+	return p.stats(), nil
+}
+
 // RemoveStaticRoute removes static route record from the EPMD client
 func (n *network) RemoveStaticRoute(name string) {
 	n.epmd.RemoveStaticRoute(name)
@@ -95,98 +164,103 @@ func (n *network) listen(ctx context.Context, name string) (uint16, error) {
 	var version Version
 	version, _ = ctx.Value("version").(Version)
 
-	lc := net.ListenConfig{}
-	for p := n.opts.ListenRangeBegin; p <= n.opts.ListenRangeEnd; p++ {
-		l, err := lc.Listen(ctx, "tcp", net.JoinHostPort(name, strconv.Itoa(int(p))))
+	l, port, err := n.opts.Carrier.Listen(ctx, name, n.opts)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.opts.TLSMode {
+	case TLSModeAuto:
+		cert, err := generateSelfSignedCert(version)
 		if err != nil {
-			continue
+			l.Close()
+			return 0, fmt.Errorf("Can't generate certificate: %s\n", err)
 		}
 
-		switch n.opts.TLSMode {
-		case TLSModeAuto:
-			cert, err := generateSelfSignedCert(version)
-			if err != nil {
-				return 0, fmt.Errorf("Can't generate certificate: %s\n", err)
-			}
+		n.tlscertServer = cert
+		n.tlscertClient = cert
 
-			n.tlscertServer = cert
-			n.tlscertClient = cert
-
-			TLSconfig := &tls.Config{
-				Certificates:       []tls.Certificate{cert},
-				InsecureSkipVerify: true,
-			}
-			l = tls.NewListener(l, TLSconfig)
-
-		case TLSModeStrict:
-			certServer, err := tls.LoadX509KeyPair(n.opts.TLScrtServer, n.opts.TLSkeyServer)
-			if err != nil {
-				return 0, fmt.Errorf("Can't load server certificate: %s\n", err)
-			}
-			certClient, err := tls.LoadX509KeyPair(n.opts.TLScrtServer, n.opts.TLSkeyServer)
-			if err != nil {
-				return 0, fmt.Errorf("Can't load client certificate: %s\n", err)
-			}
+		TLSconfig := &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+		}
+		l = tls.NewListener(l, TLSconfig)
 
-			n.tlscertServer = certServer
-			n.tlscertClient = certClient
+	case TLSModeStrict:
+		certServer, err := tls.LoadX509KeyPair(n.opts.TLScrtServer, n.opts.TLSkeyServer)
+		if err != nil {
+			l.Close()
+			return 0, fmt.Errorf("Can't load server certificate: %s\n", err)
+		}
+		certClient, err := tls.LoadX509KeyPair(n.opts.TLScrtServer, n.opts.TLSkeyServer)
+		if err != nil {
+			l.Close()
+			return 0, fmt.Errorf("Can't load client certificate: %s\n", err)
+		}
 
-			TLSconfig := &tls.Config{
-				Certificates: []tls.Certificate{certServer},
-				ServerName:   "localhost",
-			}
-			l = tls.NewListener(l, TLSconfig)
+		n.tlscertServer = certServer
+		n.tlscertClient = certClient
 
-		default:
-			TLSenabled = false
+		TLSconfig := &tls.Config{
+			Certificates: []tls.Certificate{certServer},
+			ServerName:   "localhost",
 		}
+		l = tls.NewListener(l, TLSconfig)
 
-		go func() {
-			for {
-				c, err := l.Accept()
-				lib.Log("[%s] Accepted new connection from %s", n.name, c.RemoteAddr().String())
+	default:
+		TLSenabled = false
+	}
+
+	go func() {
+		// release the listener on node termination
+		<-ctx.Done()
+		l.Close()
+	}()
 
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
 				if ctx.Err() != nil {
 					// Context was canceled
-					c.Close()
 					return
 				}
+				lib.Log(err.Error())
+				continue
+			}
+			lib.Log("[%s] Accepted new connection from %s", n.name, c.RemoteAddr().String())
 
-				if err != nil {
-					lib.Log(err.Error())
-					continue
-				}
-				handshakeOptions := dist.HandshakeOptions{
-					Name:     n.name,
-					Cookie:   n.opts.cookie,
-					TLS:      TLSenabled,
-					Hidden:   n.opts.Hidden,
-					Creation: n.opts.creation,
-					Version:  n.opts.HandshakeVersion,
-				}
-
-				link, e := dist.HandshakeAccept(c, handshakeOptions)
-				if e != nil {
-					lib.Log("[%s] Can't handshake with %s: %s", n.name, c.RemoteAddr().String(), e)
-					c.Close()
-					continue
-				}
+			if ctx.Err() != nil {
+				// Context was canceled
+				c.Close()
+				return
+			}
 
-				// start serving this link
-				if err := n.serve(ctx, link); err != nil {
-					lib.Log("Can't serve connection link due to: %s", err)
-					c.Close()
-				}
+			handshakeOptions := dist.HandshakeOptions{
+				Name:         n.name,
+				Cookie:       n.opts.cookie,
+				TLS:          TLSenabled,
+				Hidden:       n.opts.Hidden,
+				Creation:     n.opts.creation,
+				Version:      n.opts.HandshakeVersion,
+				Authenticate: n.authenticate,
+			}
 
+			link, e := dist.HandshakeAccept(c, handshakeOptions)
+			if e != nil {
+				lib.Log("[%s] Can't handshake with %s: %s", n.name, c.RemoteAddr().String(), e)
+				c.Close()
+				continue
 			}
-		}()
 
-		// return port number this node listenig on for the incoming connections
-		return p, nil
-	}
+			// start serving this link
+			n.accept(ctx, link)
 
-	// all the ports within a given range are taken
-	return 0, fmt.Errorf("Can't start listener. Port range is taken")
+		}
+	}()
+
+	// return port number this node listenig on for the incoming connections
+	return port, nil
 }
 
 func (n *network) ProvideRemoteSpawn(name string, behavior gen.ProcessBehavior) error {
@@ -201,10 +275,116 @@ func (n *network) Resolve(name string) (NetworkRoute, error) {
 	return n.epmd.resolve(name)
 }
 
-func (n *network) serve(ctx context.Context, link *dist.Link) error {
+// accept serves the accepted link. Links of the multi link peer are held until all of
+// them are accepted (or peerLinksTimeout is expired) and then served together, so
+// the outgoing messages to this peer are sharded over all of them.
+func (n *network) accept(ctx context.Context, link *dist.Link) {
+	name := link.GetRemoteName()
+	expected := link.PeerLinks()
+	if expected < 2 || n.registrar.getPeer(name) != nil {
+		if err := n.serve(ctx, link); err != nil {
+			lib.Log("Can't serve connection link due to: %s", err)
+			link.Close()
+		}
+		return
+	}
+
+	n.pendingLinksMutex.Lock()
+	pending, ok := n.pendingLinks[name]
+	if ok && pending.creation != link.PeerCreation() {
+		// remote node has been restarted
+		pending.timer.Stop()
+		for i := range pending.links {
+			pending.links[i].Close()
+		}
+		ok = false
+	}
+	if !ok {
+		p := &pendingLinks{creation: link.PeerCreation()}
+		p.timer = time.AfterFunc(peerLinksTimeout, func() {
+			// some of the links haven't been opened. serve the accepted ones
+			n.servePending(ctx, name, p)
+		})
+		n.pendingLinks[name] = p
+		pending = p
+	}
+	pending.links = append(pending.links, link)
+	if len(pending.links) < expected {
+		n.pendingLinksMutex.Unlock()
+		return
+	}
+	n.pendingLinksMutex.Unlock()
+	pending.timer.Stop()
+	n.servePending(ctx, name, pending)
+}
+
+func (n *network) servePending(ctx context.Context, name string, pending *pendingLinks) {
+	n.pendingLinksMutex.Lock()
+	if n.pendingLinks[name] != pending {
+		// already served
+		n.pendingLinksMutex.Unlock()
+		return
+	}
+	delete(n.pendingLinks, name)
+	n.pendingLinksMutex.Unlock()
+
+	if err := n.serve(ctx, pending.links...); err != nil {
+		lib.Log("Can't serve connection links due to: %s", err)
+		for i := range pending.links {
+			pending.links[i].Close()
+		}
+	}
+}
+
+// serve registers the given links as a peer and runs their readers and writers.
+// The send channels of all the links are used for the sharding, so their number
+// is fixed once the peer is registered. An additional link of the already registered
+// peer (opened after its registration) is used for the incoming messages only.
+func (n *network) serve(ctx context.Context, links ...*dist.Link) error {
 	// define the total number of reader/writer goroutines
 	numHandlers := runtime.GOMAXPROCS(n.opts.ConnectionHandlers)
 
+	link := links[0]
+	sends := make([][]chan []etf.Term, len(links))
+	p := &peer{
+		name:     link.GetRemoteName(),
+		creation: link.PeerCreation(),
+		links:    links,
+	}
+	for l := range links {
+		sends[l] = make([]chan []etf.Term, numHandlers)
+		for i := 0; i < numHandlers; i++ {
+			sends[l][i] = make(chan []etf.Term, n.opts.SendQueueLength)
+		}
+		p.send = append(p.send, sends[l]...)
+	}
+	p.n = len(p.send)
+	p.policy, p.timeout = n.peerSendQueuePolicy(p.name)
+	p.reportBusy = n.registrar.reportBusyDist
+
+	if err := n.registrar.registerPeer(p); err != nil {
+		// duplicate link or additional link for the existing peer
+		if len(links) > 1 || !link.MultiLink() {
+			return err
+		}
+		existing := n.registrar.getPeer(p.name)
+		if existing == nil || existing.attach(link) == false {
+			return err
+		}
+		lib.Log("[%s] Attached additional link to the peer %s", n.name, p.name)
+		p = existing
+	}
+
+	for l := range links {
+		n.serveLink(ctx, p, links[l], sends[l])
+	}
+	return nil
+}
+
+// serveLink runs the readers and writers of the given link
+func (n *network) serveLink(ctx context.Context, p *peer, link *dist.Link, send []chan []etf.Term) {
+	numHandlers := len(send)
+
 	// do not use shared channels within intencive code parts, impacts on a performance
 	receivers := struct {
 		recv []chan *lib.Buffer
@@ -215,17 +395,6 @@ func (n *network) serve(ctx context.Context, link *dist.Link) error {
 		n:    numHandlers,
 	}
 
-	p := &peer{
-		name: link.GetRemoteName(),
-		send: make([]chan []etf.Term, numHandlers),
-		n:    numHandlers,
-	}
-
-	if err := n.registrar.registerPeer(p); err != nil {
-		// duplicate link?
-		return err
-	}
-
 	// run readers for incoming messages
 	for i := 0; i < numHandlers; i++ {
 		// run packet reader/handler routines (decoder)
@@ -261,19 +430,17 @@ func (n *network) serve(ctx context.Context, link *dist.Link) error {
 
 		defer func() {
 			link.Close()
-			n.registrar.unregisterPeer(link.GetRemoteName())
+			// all the links of this peer must be closed as well in
+			// order to keep the messaging order
+			if p.detach(link) {
+				n.registrar.unregisterPeer(link.GetRemoteName())
+			}
 
 			// close handlers channel
-			p.mutex.Lock()
 			for i := 0; i < numHandlers; i++ {
-				if p.send[i] != nil {
-					close(p.send[i])
-				}
-				if receivers.recv[i] != nil {
-					close(receivers.recv[i])
-				}
+				close(send[i])
+				close(receivers.recv[i])
 			}
-			p.mutex.Unlock()
 		}()
 
 		b := lib.TakeBuffer()
@@ -315,17 +482,11 @@ func (n *network) serve(ctx context.Context, link *dist.Link) error {
 	// we should make sure if the cache is ready before we start writers
 	<-cacheIsReady
 
-	// run readers/writers for incoming/outgoing messages
+	// run writers for outgoing messages
 	for i := 0; i < numHandlers; i++ {
 		// run writer routines (encoder)
-		send := make(chan []etf.Term, n.opts.SendQueueLength)
-		p.mutex.Lock()
-		p.send[i] = send
-		p.mutex.Unlock()
-		go link.Writer(send, n.opts.FragmentationUnit)
+		go link.Writer(send[i], n.opts.FragmentationUnit)
 	}
-
-	return nil
 }
 
 func (n *network) handleMessage(fromNode string, control, message etf.Term) (err error) {
@@ -372,7 +533,18 @@ func (n *network) handleMessage(fromNode string, control, message etf.Term) (err
 				n.registrar.processTerminated(terminated, "", string(reason))
 
 			case distProtoEXIT2:
+				// {8, FromPid, ToPid, Reason}
 				lib.Log("[%s] CONTROL EXIT2 [from %s]: %#v", n.registrar.NodeName(), fromNode, control)
+				from := t.Element(2).(etf.Pid)
+				to := t.Element(3).(etf.Pid)
+				reason := fmt.Sprint(t.Element(4))
+				if process := n.registrar.getProcessByPid(to); process != nil {
+					if reason == "kill" {
+						process.Kill()
+					} else {
+						process.exit(from, reason)
+					}
+				}
 
 			case distProtoMONITOR:
 				// {19, FromPid, ToProc, Ref}, where FromPid = monitoring process
@@ -497,65 +669,125 @@ func (n *network) handleMessage(fromNode string, control, message etf.Term) (err
 func (n *network) connect(to string) error {
 	var nr NetworkRoute
 	var err error
-	var c net.Conn
-	if nr, err = n.epmd.resolve(string(to)); err != nil {
+	if nr, err = n.epmd.resolve(string(to)); err != nil && !n.withoutEPMD {
 		return fmt.Errorf("Can't resolve port for %s: %s", to, err)
 	}
 	if nr.Cookie == "" {
 		nr.Cookie = n.opts.cookie
 	}
-	ns := strings.Split(to, "@")
+
+	link, err := n.connectLink(to, nr, n.opts.PeerConnections)
+	if err != nil {
+		return err
+	}
+	links := []*dist.Link{link}
+
+	if n.opts.PeerConnections > 1 && link.MultiLink() {
+		// open additional links to this peer. all of them must be opened
+		// before registering the peer, so the sharding of the messages
+		// never changes
+		for i := 1; i < n.opts.PeerConnections; i++ {
+			l, err := n.connectLink(to, nr, n.opts.PeerConnections)
+			if err != nil {
+				lib.Log("[%s] Can't open additional link to %s: %s", n.name, to, err)
+				break
+			}
+			links = append(links, l)
+		}
+	}
+
+	if err := n.serve(n.ctx, links...); err != nil {
+		for i := range links {
+			links[i].Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// connectLink dials the peer and makes handshake. The number of links is announced
+// to the peer, so it can wait for all of them before it starts serving.
+func (n *network) connectLink(to string, nr NetworkRoute, links int) (*dist.Link, error) {
+	c, err := n.opts.Carrier.Dial(n.ctx, to, nr)
+	if err != nil {
+		lib.Log("Error calling Carrier.Dial : %s", err.Error())
+		return nil, err
+	}
 
 	TLSenabled := false
 
 	switch n.opts.TLSMode {
 	case TLSModeAuto:
-		tlsdialer := tls.Dialer{
-			Config: &tls.Config{
-				Certificates:       []tls.Certificate{n.tlscertClient},
-				InsecureSkipVerify: true,
-			},
+		tlsconn := tls.Client(c, &tls.Config{
+			Certificates:       []tls.Certificate{n.tlscertClient},
+			InsecureSkipVerify: true,
+		})
+		if err := tlsconn.Handshake(); err != nil {
+			c.Close()
+			return nil, err
 		}
-		c, err = tlsdialer.DialContext(n.ctx, "tcp", net.JoinHostPort(ns[1], strconv.Itoa(nr.Port)))
+		c = tlsconn
 		TLSenabled = true
 
 	case TLSModeStrict:
-		tlsdialer := tls.Dialer{
-			Config: &tls.Config{
-				Certificates: []tls.Certificate{n.tlscertClient},
-			},
+		tlsconn := tls.Client(c, &tls.Config{
+			Certificates: []tls.Certificate{n.tlscertClient},
+			ServerName:   nodeHost(to),
+		})
+		if err := tlsconn.Handshake(); err != nil {
+			c.Close()
+			return nil, err
 		}
-		c, err = tlsdialer.DialContext(n.ctx, "tcp", net.JoinHostPort(ns[1], strconv.Itoa(nr.Port)))
+		c = tlsconn
 		TLSenabled = true
-
-	default:
-		dialer := net.Dialer{}
-		c, err = dialer.DialContext(n.ctx, "tcp", net.JoinHostPort(ns[1], strconv.Itoa(nr.Port)))
-	}
-
-	if err != nil {
-		lib.Log("Error calling net.Dialer.DialerContext : %s", err.Error())
-		return err
 	}
 
 	handshakeOptions := dist.HandshakeOptions{
-		Name:     n.name,
-		Cookie:   nr.Cookie,
-		TLS:      TLSenabled,
-		Hidden:   false,
-		Creation: n.opts.creation,
-		Version:  n.opts.HandshakeVersion,
+		Name:         n.name,
+		Cookie:       nr.Cookie,
+		TLS:          TLSenabled,
+		Hidden:       false,
+		Creation:     n.opts.creation,
+		Version:      n.opts.HandshakeVersion,
+		Authenticate: n.authenticate,
+		Links:        links,
 	}
 	link, e := dist.Handshake(c, handshakeOptions)
 	if e != nil {
-		return e
+		c.Close()
+		return nil, e
 	}
+	return link, nil
+}
 
-	if err := n.serve(n.ctx, link); err != nil {
-		c.Close()
-		return err
+// authenticate applies the DenyNodes/AllowNodes lists and invokes
+// the custom Authenticate function (if it was defined in the Options)
+func (n *network) authenticate(info dist.HandshakeAuthInfo) (string, error) {
+	for _, pattern := range n.opts.DenyNodes {
+		if matched, _ := path.Match(pattern, info.Name); matched {
+			lib.Log("[%s] Node %s is denied by pattern %q", n.name, info.Name, pattern)
+			return "", ErrNodeNotAllowed
+		}
 	}
-	return nil
+
+	if len(n.opts.AllowNodes) > 0 {
+		allowed := false
+		for _, pattern := range n.opts.AllowNodes {
+			if matched, _ := path.Match(pattern, info.Name); matched {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			lib.Log("[%s] Node %s is not in the list of allowed nodes", n.name, info.Name)
+			return "", ErrNodeNotAllowed
+		}
+	}
+
+	if n.opts.Authenticate == nil {
+		return "", nil
+	}
+	return n.opts.Authenticate(info)
 }
 
 func generateSelfSignedCert(version Version) (tls.Certificate, error) {
@@ -610,17 +842,117 @@ func generateSelfSignedCert(version Version) (tls.Certificate, error) {
 }
 
 type peer struct {
-	name string
-	send []chan []etf.Term
-	i    int
-	n    int
+	name     string
+	creation uint32
+	links    []*dist.Link
+	send     []chan []etf.Term
+	i        int
+	n        int
+	closed   bool
+
+	policy  SendQueuePolicy
+	timeout time.Duration
+
+	// counters (atomic)
+	queueFull uint64
+	dropped   uint64
+
+	// busy is set once the busy dist has been reported. reset on draining the queue (atomic)
+	busy       int32
+	reportBusy func(p *peer, send chan []etf.Term)
 
 	mutex sync.Mutex
 }
 
-func (p *peer) getChannel() chan []etf.Term {
+// push puts messages into the given send channel. If the channel is full
+// the peer send queue policy is applied. With try = true it returns ErrBusy
+// right away regardless of the policy.
+func (p *peer) push(send chan []etf.Term, messages []etf.Term, try bool) error {
+	select {
+	case send <- messages:
+		if p.reportBusy != nil {
+			p.reportBusy(p, send)
+		}
+		return nil
+	default:
+	}
+
+	atomic.AddUint64(&p.queueFull, 1)
+	if p.reportBusy != nil {
+		p.reportBusy(p, send)
+	}
+	if try {
+		return ErrBusy
+	}
+
+	p.mutex.Lock()
+	policy := p.policy
+	timeout := p.timeout
+	p.mutex.Unlock()
+
+	switch policy {
+	case SendQueuePolicyWait:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case send <- messages:
+			return nil
+		case <-timer.C:
+			atomic.AddUint64(&p.dropped, 1)
+			return ErrBusy
+		}
+
+	case SendQueuePolicyDrop:
+		atomic.AddUint64(&p.dropped, 1)
+		return ErrBusy
+
+	case SendQueuePolicyDisconnect:
+		atomic.AddUint64(&p.dropped, 1)
+		lib.Log("Send queue of the peer %s is full. Disconnecting", p.name)
+		p.mutex.Lock()
+		for i := range p.links {
+			p.links[i].Close()
+		}
+		p.mutex.Unlock()
+		return ErrBusy
+	}
+
+	send <- messages
+	return nil
+}
+
+func (p *peer) stats() PeerStats {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	stats := PeerStats{
+		Name:        p.name,
+		Connections: len(p.links),
+		Policy:      p.policy,
+		QueueFull:   atomic.LoadUint64(&p.queueFull),
+		Dropped:     atomic.LoadUint64(&p.dropped),
+	}
+	for _, c := range p.send {
+		stats.SendQueueLength += len(c)
+		stats.SendQueueCapacity += cap(c)
+	}
+	return stats
+}
+
+// getChannel returns the send channel for the given sender. Messages of the same
+// sender always go through the same channel (and link) in order to keep the ordering.
+// Empty sender gets the channel in round-robin fashion.
+func (p *peer) getChannel(from etf.Pid) chan []etf.Term {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.n == 0 {
+		// connection was closed
+		return nil
+	}
+
+	if from.ID > 0 {
+		return p.send[from.ID%uint64(p.n)]
+	}
 
 	c := p.send[p.i]
 
@@ -632,3 +964,37 @@ func (p *peer) getChannel() chan []etf.Term {
 	p.i = 0
 	return c
 }
+
+// attach adds an additional link opened after the registration of this peer. Its send
+// channels are not used for the sharding (see network.serve), it handles the incoming
+// messages only.
+func (p *peer) attach(link *dist.Link) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed || p.creation != link.PeerCreation() {
+		return false
+	}
+	p.links = append(p.links, link)
+	return true
+}
+
+// detach closes all the links of this peer. Returns true if it was the first call.
+func (p *peer) detach(link *dist.Link) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.closed = true
+	// connection is closed. no more messages
+	p.n = 0
+	p.i = 0
+	for i := range p.links {
+		if p.links[i] != link {
+			p.links[i].Close()
+		}
+	}
+	return true
+}
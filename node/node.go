@@ -3,7 +3,11 @@ package node
 import (
 	"context"
 	"fmt"
+	"path"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ergo-services/ergo/etf"
@@ -32,6 +36,14 @@ type node struct {
 	context  context.Context
 	stop     context.CancelFunc
 	version  Version
+
+	// environment of applications loaded from the config files
+	config      map[string]map[string]interface{}
+	mutexConfig sync.Mutex
+
+	// names of the started applications in the start order
+	startedApplications []string
+	mutexApplications   sync.Mutex
 }
 
 // StartWithContext create new node with specified context, name and cookie string
@@ -48,6 +60,7 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 		context:  nodectx,
 		stop:     nodestop,
 		creation: creation,
+		config:   make(map[string]map[string]interface{}),
 	}
 
 	if name == "" {
@@ -73,6 +86,10 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 		opts.SendQueueLength = defaultSendQueueLength
 	}
 
+	if opts.SendQueueTimeout == 0 {
+		opts.SendQueueTimeout = defaultSendQueueTimeout
+	}
+
 	if opts.RecvQueueLength == 0 {
 		opts.RecvQueueLength = defaultRecvQueueLength
 	}
@@ -90,10 +107,25 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 		lib.Log("Running as hidden node")
 	}
 
+	if opts.Carrier == nil {
+		opts.Carrier = TCPCarrier{}
+	}
+
 	if len(strings.Split(name, "@")) != 2 {
 		return nil, fmt.Errorf("incorrect FQDN node name (example: node@localhost)")
 	}
 
+	for _, pattern := range opts.AllowNodes {
+		if _, err := path.Match(pattern, name); err != nil {
+			return nil, fmt.Errorf("incorrect node name pattern %q: %s", pattern, err)
+		}
+	}
+	for _, pattern := range opts.DenyNodes {
+		if _, err := path.Match(pattern, name); err != nil {
+			return nil, fmt.Errorf("incorrect node name pattern %q: %s", pattern, err)
+		}
+	}
+
 	opts.cookie = cookie
 	opts.creation = creation
 	node.opts = opts
@@ -108,6 +140,13 @@ func StartWithContext(ctx context.Context, name string, cookie string, opts Opti
 	node.registrarInternal = registrar
 	node.networkInternal = network
 
+	if opts.Config != "" {
+		if err := node.LoadConfig(opts.Config); err != nil {
+			nodestop()
+			return nil, err
+		}
+	}
+
 	// load applications
 	for _, app := range opts.Applications {
 		name, err := node.ApplicationLoad(app)
@@ -192,6 +231,56 @@ func (n *node) WhichApplications() []gen.ApplicationInfo {
 	return n.listApplications(true)
 }
 
+// WhichApplicationsTree returns the running applications along with the applications
+// they depend on and the included ones. The applications required by other running
+// applications are listed as their dependencies only.
+func (n *node) WhichApplicationsTree() []gen.ApplicationTree {
+	running := n.listApplications(true)
+	required := make(map[string]bool)
+	for _, info := range running {
+		spec := n.applicationSpec(info.Name)
+		if spec == nil {
+			continue
+		}
+		for _, name := range spec.Applications {
+			required[name] = true
+		}
+	}
+
+	tree := []gen.ApplicationTree{}
+	for _, info := range running {
+		if required[info.Name] {
+			continue
+		}
+		tree = append(tree, n.applicationTree(info.Name))
+	}
+	sort.Slice(tree, func(i, j int) bool {
+		return tree[i].Name < tree[j].Name
+	})
+	return tree
+}
+
+func (n *node) applicationTree(name string) gen.ApplicationTree {
+	info, err := n.ApplicationInfo(name)
+	if err != nil {
+		// not loaded
+		info.Name = name
+		return gen.ApplicationTree{ApplicationInfo: info}
+	}
+	tree := gen.ApplicationTree{ApplicationInfo: info}
+	spec := n.applicationSpec(name)
+	if spec == nil {
+		return tree
+	}
+	for _, dep := range spec.Applications {
+		tree.Applications = append(tree.Applications, n.applicationTree(dep))
+	}
+	for _, included := range spec.IncludedApplications {
+		tree.Included = append(tree.Included, n.applicationTree(included))
+	}
+	return tree
+}
+
 // WhichApplications returns a list of running applications
 func (n *node) listApplications(onlyRunning bool) []gen.ApplicationInfo {
 	info := []gen.ApplicationInfo{}
@@ -252,6 +341,23 @@ func (n *node) ApplicationLoad(app gen.ApplicationBehavior, args ...etf.Term) (s
 	if err != nil {
 		return "", err
 	}
+
+	// environment from the config file overrides the default one
+	n.mutexConfig.Lock()
+	if env, ok := n.config[spec.Name]; ok {
+		if spec.Environment == nil {
+			spec.Environment = make(map[string]interface{})
+		}
+		for key, value := range env {
+			spec.Environment[key] = value
+		}
+	}
+	n.mutexConfig.Unlock()
+
+	if err := n.applicationCheckGraph(&spec); err != nil {
+		return "", err
+	}
+
 	err = n.RegisterBehavior(appBehaviorGroup, spec.Name, app, &spec)
 	if err != nil {
 		return "", err
@@ -259,6 +365,198 @@ func (n *node) ApplicationLoad(app gen.ApplicationBehavior, args ...etf.Term) (s
 	return spec.Name, nil
 }
 
+// applicationCheckGraph checks the dependencies and the included applications of the
+// application being loaded. Every cycle must go through this application since the
+// graph of the loaded ones has no cycles. Applications that aren't loaded yet are
+// checked on their loading.
+func (n *node) applicationCheckGraph(spec *gen.ApplicationSpec) error {
+	for _, name := range spec.IncludedApplications {
+		if including := n.applicationIncludedBy(name); including != "" && including != spec.Name {
+			return fmt.Errorf("%w: %q by %q", ErrAppAlreadyIncluded, name, including)
+		}
+	}
+
+	lookup := func(name string) *gen.ApplicationSpec {
+		if name == spec.Name {
+			return spec
+		}
+		return n.applicationSpec(name)
+	}
+
+	visited := make(map[string]bool)
+	var visit func(path []string) error
+	visit = func(path []string) error {
+		current := lookup(path[len(path)-1])
+		if current == nil {
+			return nil
+		}
+		next := append([]string{}, current.Applications...)
+		next = append(next, current.IncludedApplications...)
+		for _, name := range next {
+			p := append(path[:len(path):len(path)], name)
+			if name == spec.Name {
+				return fmt.Errorf("%w: %s", ErrAppDependencyCycle, strings.Join(p, " -> "))
+			}
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit([]string{spec.Name})
+}
+
+// applicationIncluded returns the specs of the included applications (recursively)
+func (n *node) applicationIncluded(spec *gen.ApplicationSpec) ([]*gen.ApplicationSpec, error) {
+	included := []*gen.ApplicationSpec{}
+	for _, name := range spec.IncludedApplications {
+		includedSpec := n.applicationSpec(name)
+		if includedSpec == nil {
+			return nil, fmt.Errorf("%w: %q included by %q", ErrAppUnknown, name, spec.Name)
+		}
+		included = append(included, includedSpec)
+		nested, err := n.applicationIncluded(includedSpec)
+		if err != nil {
+			return nil, err
+		}
+		included = append(included, nested...)
+	}
+	return included, nil
+}
+
+// applicationIncludedBy returns the name of the application including the given one
+func (n *node) applicationIncludedBy(name string) string {
+	for _, rb := range n.RegisteredBehaviorGroup(appBehaviorGroup) {
+		spec, ok := rb.Data.(*gen.ApplicationSpec)
+		if !ok {
+			continue
+		}
+		for _, included := range spec.IncludedApplications {
+			if included == name {
+				return spec.Name
+			}
+		}
+	}
+	return ""
+}
+
+func (n *node) applicationSpec(name string) *gen.ApplicationSpec {
+	rb, err := n.RegisteredBehavior(appBehaviorGroup, name)
+	if err != nil {
+		return nil
+	}
+	spec, _ := rb.Data.(*gen.ApplicationSpec)
+	return spec
+}
+
+// LoadConfig reads the environment of applications from the given file (see Options.Config)
+// and applies it to the loaded applications. Keys missing in the file are kept as they are.
+func (n *node) LoadConfig(filename string) error {
+	config, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	for name, env := range config {
+		n.mutexConfig.Lock()
+		appConfig, ok := n.config[name]
+		if !ok {
+			appConfig = make(map[string]interface{})
+			n.config[name] = appConfig
+		}
+		for key, value := range env {
+			appConfig[key] = value
+		}
+		n.mutexConfig.Unlock()
+
+		err := n.ApplicationSetEnv(name, env)
+		if err == ErrAppUnknown {
+			// will be applied on loading
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplicationSetEnv updates the environment of the given application. The key with
+// nil value is removed. If the application is running, its processes get the new
+// values and the ConfigChange callback is invoked with the changed, added and removed keys.
+func (n *node) ApplicationSetEnv(appName string, env map[string]interface{}) error {
+	rb, err := n.RegisteredBehavior(appBehaviorGroup, appName)
+	if err != nil {
+		return ErrAppUnknown
+	}
+
+	spec, ok := rb.Data.(*gen.ApplicationSpec)
+	if !ok {
+		return ErrAppUnknown
+	}
+
+	changed := make(map[string]interface{})
+	added := make(map[string]interface{})
+	removed := []string{}
+
+	spec.Lock()
+	if spec.Environment == nil {
+		spec.Environment = make(map[string]interface{})
+	}
+	for key, value := range env {
+		current, exist := spec.Environment[key]
+		switch {
+		case value == nil:
+			if !exist {
+				continue
+			}
+			delete(spec.Environment, key)
+			removed = append(removed, key)
+			continue
+		case !exist:
+			added[key] = value
+		case !reflect.DeepEqual(current, value):
+			changed[key] = value
+		default:
+			continue
+		}
+		spec.Environment[key] = value
+	}
+	process := spec.Process
+	spec.Unlock()
+
+	if process == nil {
+		return nil
+	}
+	if len(changed) == 0 && len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	// application process is the group leader of its processes,
+	// so they get the new values as well
+	for key, value := range changed {
+		process.SetEnv(key, value)
+	}
+	for key, value := range added {
+		process.SetEnv(key, value)
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		process.SetEnv(key, nil)
+	}
+
+	behavior, ok := rb.Behavior.(gen.ApplicationBehavior)
+	if !ok {
+		return ErrAppUnknown
+	}
+	behavior.ConfigChange(process, changed, added, removed)
+	return nil
+}
+
 // ApplicationUnload unloads given application
 func (n *node) ApplicationUnload(appName string) error {
 	rb, err := n.RegisteredBehavior(appBehaviorGroup, appName)
@@ -270,7 +568,7 @@ func (n *node) ApplicationUnload(appName string) error {
 	if !ok {
 		return ErrAppUnknown
 	}
-	if spec.Process != nil {
+	if spec.Process != nil || n.ProcessByName(distACName(appName)) != nil {
 		return ErrAppAlreadyStarted
 	}
 
@@ -310,38 +608,90 @@ func (n *node) applicationStart(startType, appName string, args ...etf.Term) (ge
 		return nil, ErrAppUnknown
 	}
 
-	spec.StartType = startType
-
 	// to prevent race condition on starting application we should
 	// make sure that nobodyelse starting it
 	spec.Lock()
 	defer spec.Unlock()
 
-	if spec.Process != nil {
+	if spec.Process != nil || n.ProcessByName(distACName(appName)) != nil {
 		return nil, ErrAppAlreadyStarted
 	}
 
-	// start dependencies
-	for _, depAppName := range spec.Applications {
-		if _, e := n.ApplicationStart(depAppName); e != nil && e != ErrAppAlreadyStarted {
+	if including := n.applicationIncludedBy(appName); including != "" {
+		return nil, fmt.Errorf("%w: %q", ErrAppIncluded, including)
+	}
+
+	if len(spec.Nodes) > 0 && distACPriority(spec, n.name) < 0 {
+		return nil, ErrAppNodeUnknown
+	}
+
+	included, err := n.applicationIncluded(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// start dependencies (including the ones of the included applications)
+	// with the same start type
+	dependencies := append([]string{}, spec.Applications...)
+	for i := range included {
+		dependencies = append(dependencies, included[i].Applications...)
+	}
+	for _, depAppName := range dependencies {
+		if n.applicationSpec(depAppName) == nil {
+			return nil, fmt.Errorf("%w: %q required by %q", ErrAppUnknown, depAppName, appName)
+		}
+		if _, e := n.applicationStart(startType, depAppName); e != nil && e != ErrAppAlreadyStarted {
 			return nil, e
 		}
 	}
 
-	env := map[string]interface{}{
-		"spec": spec,
-	}
-	options := gen.ProcessOptions{
-		Env: env,
+	spec.StartType = startType
+
+	var process gen.Process
+	var e error
+	if len(spec.Nodes) > 0 {
+		process, e = n.applicationStartDistributed(spec, rb.Behavior, included, args...)
+	} else {
+		env := map[string]interface{}{
+			"spec":     spec,
+			"included": included,
+		}
+		options := gen.ProcessOptions{
+			Env: env,
+		}
+		process, e = n.Spawn("", options, rb.Behavior, args...)
 	}
-	process, e := n.Spawn("", options, rb.Behavior, args...)
 	if e != nil {
 		return nil, e
 	}
 
+	// keep the start order to stop applications in the reverse one on shutdown
+	n.mutexApplications.Lock()
+	n.removeStartedApplication(appName)
+	n.startedApplications = append(n.startedApplications, appName)
+	n.mutexApplications.Unlock()
+
 	return process, nil
 }
 
+// applicationStartDistributed starts the controller of the distributed application.
+// Returns the application process if it has been started on this node, otherwise nil.
+func (n *node) applicationStartDistributed(spec *gen.ApplicationSpec, behavior gen.ProcessBehavior, included []*gen.ApplicationSpec, args ...etf.Term) (gen.Process, error) {
+	started := make(chan gen.Process, 1)
+	controller := &distAC{node: n}
+	ac, e := n.Spawn(distACName(spec.Name), gen.ProcessOptions{}, controller, spec, behavior, started, args, included)
+	if e != nil {
+		return nil, e
+	}
+
+	select {
+	case process := <-started:
+		return process, nil
+	case <-ac.Context().Done():
+		return nil, ErrProcessTerminated
+	}
+}
+
 // ApplicationStop stop running application
 func (n *node) ApplicationStop(name string) error {
 	rb, err := n.RegisteredBehavior(appBehaviorGroup, name)
@@ -354,21 +704,97 @@ func (n *node) ApplicationStop(name string) error {
 		return ErrAppUnknown
 	}
 
+	return n.applicationStop(spec, "normal", 5*time.Second)
+}
+
+func (n *node) applicationStop(spec *gen.ApplicationSpec, reason string, timeout time.Duration) error {
 	spec.Lock()
 	defer spec.Unlock()
-	if spec.Process == nil {
+
+	// distributed application is stopped by its controller
+	process := n.ProcessByName(distACName(spec.Name))
+	if process == nil {
+		process = spec.Process
+	}
+	if process == nil {
 		return ErrAppIsNotRunning
 	}
 
-	if e := spec.Process.Exit("normal"); e != nil {
+	// the application must not wait for its children longer than we do
+	process.SetEnv(gen.EnvKeyStopDeadline, time.Now().Add(timeout))
+	if e := process.Exit(reason); e != nil {
 		return e
 	}
 	// we should wait until children process stopped.
-	if e := spec.Process.WaitWithTimeout(5 * time.Second); e != nil {
+	if e := process.WaitWithTimeout(timeout); e != nil {
 		return ErrProcessBusy
 	}
+
+	n.mutexApplications.Lock()
+	n.removeStartedApplication(spec.Name)
+	n.mutexApplications.Unlock()
 	return nil
 }
+
+// Shutdown stops the node gracefully. Applications are stopped in the reverse start order
+// (supervisors terminate their children respecting the shutdown options), then the send
+// queues of the connected peers are drained. Returns ErrTimeout if it takes longer than
+// the given timeout. The node is stopped anyway.
+func (n *node) Shutdown(timeout time.Duration) error {
+	defer n.stop()
+	deadline := time.Now().Add(timeout)
+
+	n.mutexApplications.Lock()
+	started := make([]string, len(n.startedApplications))
+	copy(started, n.startedApplications)
+	n.mutexApplications.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		rb, err := n.RegisteredBehavior(appBehaviorGroup, started[i])
+		if err != nil {
+			continue
+		}
+		spec, ok := rb.Data.(*gen.ApplicationSpec)
+		if !ok {
+			continue
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return ErrTimeout
+		}
+		if n.applicationStop(spec, "shutdown", left) == ErrProcessBusy {
+			return ErrTimeout
+		}
+	}
+
+	// drain the send queues
+	for {
+		queued := 0
+		for _, name := range n.PeerList() {
+			if stats, err := n.PeerStats(name); err == nil {
+				queued += stats.SendQueueLength
+			}
+		}
+		if queued == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// removeStartedApplication must be called with locked mutexApplications
+func (n *node) removeStartedApplication(name string) {
+	for i := range n.startedApplications {
+		if n.startedApplications[i] == name {
+			n.startedApplications = append(n.startedApplications[:i], n.startedApplications[i+1:]...)
+			return
+		}
+	}
+}
 func (n *node) Links(process etf.Pid) []etf.Pid {
 	return n.processLinks(process)
 }
@@ -403,6 +829,30 @@ func (n *node) ProvideRPC(module string, function string, fun gen.RPC) error {
 	return nil
 }
 
+// ExportRPC returns the external fun pointing to the given RPC method provided by ProvideRPC.
+// Erlang code can call it back using erpc:call(Node, Fun) or rpc:call(Node, erlang, apply, [Fun, Args]).
+func (n *node) ExportRPC(module, function string, arity int) (etf.Export, error) {
+	rex := n.ProcessByName("rex")
+	if rex == nil {
+		return etf.Export{}, fmt.Errorf("RPC is disabled")
+	}
+
+	message := gen.MessageLookupRPC{
+		Module:   module,
+		Function: function,
+	}
+	if _, err := rex.Direct(message); err != nil {
+		return etf.Export{}, err
+	}
+
+	export := etf.Export{
+		Module:   etf.Atom(module),
+		Function: etf.Atom(function),
+		Arity:    arity,
+	}
+	return export, nil
+}
+
 // RevokeRPC unregister given module/function
 func (n *node) RevokeRPC(module, function string) error {
 	lib.Log("[%s] RPC revoke: %s:%s", n.name, module, function)
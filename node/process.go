@@ -40,6 +40,9 @@ type process struct {
 	reply      map[etf.Ref]chan etf.Term
 
 	trapExit bool
+
+	// largeMailbox is set once the system monitor reported about the large mailbox (atomic)
+	largeMailbox int32
 }
 
 type processOptions struct {
@@ -92,6 +95,26 @@ func (p *process) Exit(reason string) error {
 	return p.exit(p.self, reason)
 }
 
+func (p *process) SendExit(to etf.Pid, reason string) error {
+	if p.behavior == nil {
+		return ErrProcessTerminated
+	}
+	if string(to.Node) != p.NodeName() {
+		// {8, FromPid, ToPid, Reason}
+		message := etf.Tuple{distProtoEXIT2, p.self, to, etf.Atom(reason)}
+		return p.routeRaw(to.Node, message)
+	}
+	target := p.getProcessByPid(to)
+	if target == nil {
+		return ErrProcessUnknown
+	}
+	if reason == "kill" {
+		target.Kill()
+		return nil
+	}
+	return target.exit(p.self, reason)
+}
+
 func (p *process) Context() context.Context {
 	return p.context
 }
@@ -161,6 +184,19 @@ func (p *process) Send(to interface{}, message etf.Term) error {
 	return p.route(p.self, to, message)
 }
 
+func (p *process) TrySend(to interface{}, message etf.Term) error {
+	if p.behavior == nil {
+		return ErrProcessTerminated
+	}
+	return p.routeTry(p.self, to, message)
+}
+
+// ReportCallbackDuration is used by gen.Server to report the duration of its callbacks
+// to the system monitor. It isn't a part of the gen.Process interface.
+func (p *process) ReportCallbackDuration(callback string, message etf.Term, duration time.Duration) {
+	p.reportCallback(p.self, callback, message, duration)
+}
+
 func (p *process) SendAfter(to interface{}, message etf.Term, after time.Duration) context.CancelFunc {
 	//TODO: should we control the number of timers/goroutines have been created this way?
 	ctx, cancel := context.WithCancel(p.context)
@@ -360,7 +396,12 @@ func (p *process) RemoteSpawn(node string, object string, opts gen.RemoteSpawnOp
 		etf.Tuple{etf.Atom(object), etf.Atom(opts.Function), len(args)},
 		optlist,
 	}
-	p.SendSyncRequestRaw(ref, etf.Atom(node), append([]etf.Term{control}, args)...)
+	if err := p.SendSyncRequestRaw(ref, etf.Atom(node), append([]etf.Term{control}, args)...); err != nil {
+		p.replyMutex.Lock()
+		delete(p.reply, ref)
+		p.replyMutex.Unlock()
+		return etf.Pid{}, err
+	}
 	reply, err := p.WaitSyncReply(ref, opts.Timeout)
 	if err != nil {
 		return etf.Pid{}, err
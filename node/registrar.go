@@ -19,6 +19,7 @@ const (
 
 type registrar struct {
 	monitor
+	systemMonitor
 	ctx context.Context
 
 	nextPID  uint64
@@ -45,17 +46,21 @@ type registrar struct {
 type registrarInternal interface {
 	gen.Registrar
 	monitorInternal
+	systemMonitorInternal
 
 	spawn(name string, opts processOptions, behavior gen.ProcessBehavior, args ...etf.Term) (gen.Process, error)
 	registerName(name string, pid etf.Pid) error
 	unregisterName(name string) error
 	registerPeer(peer *peer) error
 	unregisterPeer(name string)
+	getPeer(name string) *peer
+	PeerList() []string
 	newAlias(p *process) (etf.Alias, error)
 	deleteAlias(owner *process, alias etf.Alias) error
 	getProcessByPid(etf.Pid) *process
 
 	route(from etf.Pid, to etf.Term, message etf.Term) error
+	routeTry(from etf.Pid, to etf.Term, message etf.Term) error
 	routeRaw(nodename etf.Atom, messages ...etf.Term) error
 }
 
@@ -75,6 +80,7 @@ func newRegistrar(ctx context.Context, nodename string, creation uint32, node no
 		behaviors: make(map[string]map[string]gen.RegisteredBehavior),
 	}
 	r.monitor = newMonitor(r)
+	r.systemMonitor = newSystemMonitor(ctx, r)
 	return r
 }
 
@@ -444,6 +450,12 @@ func (r *registrar) unregisterPeer(name string) {
 	r.mutexPeers.Unlock()
 }
 
+func (r *registrar) getPeer(name string) *peer {
+	r.mutexPeers.Lock()
+	defer r.mutexPeers.Unlock()
+	return r.peers[name]
+}
+
 func (r *registrar) RegisterBehavior(group, name string, behavior gen.ProcessBehavior, data interface{}) error {
 	lib.Log("[%s] REGISTRAR registering behavior %q in group %q ", r.nodename, name, group)
 	var groupBehaviors map[string]gen.RegisteredBehavior
@@ -609,14 +621,26 @@ func (r *registrar) ProcessList() []gen.Process {
 
 func (r *registrar) PeerList() []string {
 	list := []string{}
+	r.mutexPeers.Lock()
 	for n, _ := range r.peers {
 		list = append(list, n)
 	}
+	r.mutexPeers.Unlock()
 	return list
 }
 
 // route message to a local/remote process
 func (r *registrar) route(from etf.Pid, to etf.Term, message etf.Term) error {
+	return r.routeMessage(from, to, message, false)
+}
+
+// routeTry makes the same as route does, but returns ErrBusy if the mailbox of
+// the local process or the send queue of the peer is full instead of blocking
+func (r *registrar) routeTry(from etf.Pid, to etf.Term, message etf.Term) error {
+	return r.routeMessage(from, to, message, true)
+}
+
+func (r *registrar) routeMessage(from etf.Pid, to etf.Term, message etf.Term, try bool) error {
 next:
 	switch tto := to.(type) {
 	case etf.Pid:
@@ -631,28 +655,18 @@ next:
 			}
 			select {
 			case p.mailBox <- gen.ProcessMailboxMessage{from, message}:
+				r.reportMailbox(p)
 			default:
+				r.reportMailbox(p)
+				if try {
+					return ErrBusy
+				}
 				return fmt.Errorf("WARNING! mailbox of %s is full. dropped message from %s", p.Self(), from)
 			}
 			return nil
 		}
 
-		r.mutexPeers.Lock()
-		peer, ok := r.peers[string(tto.Node)]
-		r.mutexPeers.Unlock()
-		if !ok {
-			if err := r.net.connect(string(tto.Node)); err != nil {
-				lib.Log("[%s] Can't connect to %v: %s", r.nodename, tto.Node, err)
-				return fmt.Errorf("Can't connect to %s: %s", tto.Node, err)
-			}
-
-			r.mutexPeers.Lock()
-			peer, _ = r.peers[string(tto.Node)]
-			r.mutexPeers.Unlock()
-		}
-
-		send := peer.getChannel()
-		send <- []etf.Term{etf.Tuple{distProtoSEND, etf.Atom(""), tto}, message}
+		return r.routePeer(string(tto.Node), from, try, etf.Tuple{distProtoSEND, etf.Atom(""), tto}, message)
 
 	case gen.ProcessID:
 		lib.Log("[%s] REGISTRAR sending message by gen.ProcessID %#v", r.nodename, tto)
@@ -664,23 +678,7 @@ next:
 		}
 
 		// sending to remote node
-		r.mutexPeers.Lock()
-		peer, ok := r.peers[tto.Node]
-		r.mutexPeers.Unlock()
-		if !ok {
-			// initiate connection and make yet another attempt to deliver this message
-			if err := r.net.connect(tto.Node); err != nil {
-				lib.Log("[%s] Can't connect to %v: %s", r.nodename, tto.Node, err)
-				return fmt.Errorf("Can't connect to %s: %s", tto.Node, err)
-			}
-
-			r.mutexPeers.Lock()
-			peer, _ = r.peers[tto.Node]
-			r.mutexPeers.Unlock()
-		}
-
-		send := peer.getChannel()
-		send <- []etf.Term{etf.Tuple{distProtoREG_SEND, from, etf.Atom(""), etf.Atom(tto.Name)}, message}
+		return r.routePeer(tto.Node, from, try, etf.Tuple{distProtoREG_SEND, from, etf.Atom(""), etf.Atom(tto.Name)}, message)
 
 	case string:
 		lib.Log("[%s] REGISTRAR sending message by name %#v", r.nodename, tto)
@@ -715,22 +713,7 @@ next:
 		}
 		r.mutexAliases.Unlock()
 
-		r.mutexPeers.Lock()
-		peer, ok := r.peers[string(tto.Node)]
-		r.mutexPeers.Unlock()
-		if !ok {
-			if err := r.net.connect(string(tto.Node)); err != nil {
-				lib.Log("[%s] Can't connect to %v: %s", r.nodename, tto.Node, err)
-				return fmt.Errorf("Can't connect to %s: %s", tto.Node, err)
-			}
-
-			r.mutexPeers.Lock()
-			peer, _ = r.peers[string(tto.Node)]
-			r.mutexPeers.Unlock()
-		}
-
-		send := peer.getChannel()
-		send <- []etf.Term{etf.Tuple{distProtoALIAS_SEND, from, tto}, message}
+		return r.routePeer(string(tto.Node), from, try, etf.Tuple{distProtoALIAS_SEND, from, tto}, message)
 
 	default:
 		lib.Log("[%s] unsupported receiver type %#v", r.nodename, tto)
@@ -741,25 +724,55 @@ next:
 }
 
 func (r *registrar) routeRaw(nodename etf.Atom, messages ...etf.Term) error {
-	r.mutexPeers.Lock()
-	peer, ok := r.peers[string(nodename)]
-	r.mutexPeers.Unlock()
 	if len(messages) == 0 {
 		return fmt.Errorf("nothing to send")
 	}
+	return r.routePeer(string(nodename), senderOf(messages[0]), false, messages...)
+}
+
+// routePeer sends control message (and payload message if present) to the given peer.
+// Initiates connection if this node has not connected to the peer yet.
+func (r *registrar) routePeer(nodename string, from etf.Pid, try bool, messages ...etf.Term) error {
+	r.mutexPeers.Lock()
+	peer, ok := r.peers[nodename]
+	r.mutexPeers.Unlock()
 	if !ok {
+		if try {
+			// connecting might take a while
+			return ErrPeerUnknown
+		}
 		// initiate connection and make yet another attempt to deliver this message
-		if err := r.net.connect(string(nodename)); err != nil {
+		if err := r.net.connect(nodename); err != nil {
 			lib.Log("[%s] Can't connect to %v: %s", r.nodename, nodename, err)
-			return err
+			return fmt.Errorf("Can't connect to %s: %s", nodename, err)
 		}
 
 		r.mutexPeers.Lock()
-		peer, _ = r.peers[string(nodename)]
+		peer, ok = r.peers[nodename]
 		r.mutexPeers.Unlock()
+		if !ok {
+			return fmt.Errorf("Can't connect to %s: connection was closed", nodename)
+		}
 	}
 
-	send := peer.getChannel()
-	send <- messages
-	return nil
+	send := peer.getChannel(from)
+	if send == nil {
+		return fmt.Errorf("Connection with %s was closed", nodename)
+	}
+	return peer.push(send, messages, try)
+}
+
+// senderOf returns the sender pid of the given control message.
+// Most of them have the sender pid right after the operation code.
+func senderOf(control etf.Term) etf.Pid {
+	t, ok := control.(etf.Tuple)
+	if !ok {
+		return etf.Pid{}
+	}
+	for i := 1; i < len(t) && i < 3; i++ {
+		if pid, ok := t[i].(etf.Pid); ok {
+			return pid
+		}
+	}
+	return etf.Pid{}
 }
@@ -0,0 +1,215 @@
+package node
+
+// http://erlang.org/doc/man/erlang.html#system_monitor-2
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+)
+
+const (
+	// how often the scheduling gap is measured
+	systemMonitorScheduleInterval = 100 * time.Millisecond
+)
+
+type systemMonitorInternal interface {
+	SystemMonitor(pid etf.Pid, opts SystemMonitorOptions) error
+	SystemMonitorInfo() (etf.Pid, SystemMonitorOptions)
+
+	reportBusyDist(p *peer, send chan []etf.Term)
+	reportMailbox(p *process)
+	reportCallback(pid etf.Pid, callback string, message etf.Term, duration time.Duration)
+}
+
+type systemMonitor struct {
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+	// enabled keeps *systemMonitorEnabled (nil if the system monitoring is disabled).
+	// It is loaded on every report, so the disabled monitor costs a single atomic load.
+	enabled atomic.Value
+
+	ctx       context.Context
+	registrar registrarInternal
+}
+
+type systemMonitorEnabled struct {
+	pid  etf.Pid
+	opts SystemMonitorOptions
+}
+
+func newSystemMonitor(ctx context.Context, registrar registrarInternal) systemMonitor {
+	return systemMonitor{
+		ctx:       ctx,
+		registrar: registrar,
+	}
+}
+
+// SystemMonitor sets the local process (pid) to receive the system monitor messages
+// enabled by the given options. Previous settings are overridden. Use empty pid
+// to disable system monitoring.
+func (sm *systemMonitor) SystemMonitor(pid etf.Pid, opts SystemMonitorOptions) error {
+	if pid != (etf.Pid{}) {
+		if string(pid.Node) != sm.registrar.NodeName() {
+			return ErrUnsupported
+		}
+		if sm.registrar.ProcessByPid(pid) == nil {
+			return ErrProcessUnknown
+		}
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if sm.cancel != nil {
+		sm.cancel()
+		sm.cancel = nil
+	}
+
+	if pid == (etf.Pid{}) {
+		sm.enabled.Store((*systemMonitorEnabled)(nil))
+		return nil
+	}
+	sm.enabled.Store(&systemMonitorEnabled{pid: pid, opts: opts})
+
+	if opts.LongSchedule > 0 {
+		ctx, cancel := context.WithCancel(sm.ctx)
+		sm.cancel = cancel
+		go sm.schedule(ctx, pid, opts.LongSchedule)
+	}
+	lib.Log("[%s] System monitor %s is set with %#v", pid.Node, pid, opts)
+	return nil
+}
+
+// SystemMonitorInfo returns the current system monitor process and its options.
+// Returns empty pid if system monitoring is disabled.
+func (sm *systemMonitor) SystemMonitorInfo() (etf.Pid, SystemMonitorOptions) {
+	if enabled := sm.monitor(); enabled != nil {
+		return enabled.pid, enabled.opts
+	}
+	return etf.Pid{}, SystemMonitorOptions{}
+}
+
+func (sm *systemMonitor) monitor() *systemMonitorEnabled {
+	enabled, _ := sm.enabled.Load().(*systemMonitorEnabled)
+	return enabled
+}
+
+func (sm *systemMonitor) reportBusyDist(p *peer, send chan []etf.Term) {
+	enabled := sm.monitor()
+	if enabled == nil || enabled.opts.BusyDist == false {
+		return
+	}
+
+	threshold := enabled.opts.BusyDistQueueLength
+	if threshold < 1 || threshold > cap(send) {
+		threshold = cap(send)
+	}
+	length := len(send)
+	if length < threshold {
+		// send queue is drained. allow reporting again
+		atomic.StoreInt32(&p.busy, 0)
+		return
+	}
+
+	// report once until the send queue is drained
+	if atomic.CompareAndSwapInt32(&p.busy, 0, 1) == false {
+		return
+	}
+
+	message := gen.MessageSystemMonitorBusyDist{
+		Node:            p.name,
+		SendQueueLength: length,
+		SendQueueSize:   cap(send),
+	}
+	sm.send(enabled.pid, message)
+}
+
+func (sm *systemMonitor) reportMailbox(p *process) {
+	enabled := sm.monitor()
+	if enabled == nil || enabled.opts.LargeMailbox == 0 || p.self == enabled.pid {
+		return
+	}
+	pid := enabled.pid
+
+	length := len(p.mailBox)
+	if length < enabled.opts.LargeMailbox {
+		// mailbox is drained. allow reporting again
+		atomic.StoreInt32(&p.largeMailbox, 0)
+		return
+	}
+
+	// report once until the mailbox is drained
+	if atomic.CompareAndSwapInt32(&p.largeMailbox, 0, 1) == false {
+		return
+	}
+
+	message := gen.MessageSystemMonitorLargeMailbox{
+		Pid:           p.self,
+		MailboxLength: length,
+		MailboxSize:   cap(p.mailBox),
+	}
+	sm.send(pid, message)
+}
+
+func (sm *systemMonitor) reportCallback(pid etf.Pid, callback string, message etf.Term, duration time.Duration) {
+	enabled := sm.monitor()
+	if enabled == nil || enabled.opts.LongCallback == 0 || duration < enabled.opts.LongCallback || pid == enabled.pid {
+		return
+	}
+	monitor := enabled.pid
+	m := gen.MessageSystemMonitorLongCallback{
+		Pid:      pid,
+		Callback: callback,
+		Message:  message,
+		Duration: duration,
+	}
+	sm.send(monitor, m)
+}
+
+func (sm *systemMonitor) schedule(ctx context.Context, pid etf.Pid, threshold time.Duration) {
+	timer := time.NewTimer(systemMonitorScheduleInterval)
+	defer timer.Stop()
+
+	for {
+		started := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		gap := time.Since(started) - systemMonitorScheduleInterval
+		if gap > threshold {
+			sm.send(pid, gen.MessageSystemMonitorLongSchedule{Duration: gap})
+		}
+		timer.Reset(systemMonitorScheduleInterval)
+	}
+}
+
+// send delivers message to the system monitor process. It never blocks
+// in order to keep the monitored subsystem working if the monitor is slow.
+func (sm *systemMonitor) send(pid etf.Pid, message etf.Term) {
+	err := sm.registrar.routeTry(etf.Pid{}, pid, message)
+	if err == ErrProcessUnknown {
+		// system monitor process is terminated. disable monitoring
+		sm.mutex.Lock()
+		if enabled := sm.monitor(); enabled != nil && enabled.pid == pid {
+			if sm.cancel != nil {
+				sm.cancel()
+				sm.cancel = nil
+			}
+			sm.enabled.Store((*systemMonitorEnabled)(nil))
+		}
+		sm.mutex.Unlock()
+		return
+	}
+	if err != nil {
+		lib.Log("[%s] Can't deliver system monitor message %#v: %s", pid.Node, message, err)
+	}
+}
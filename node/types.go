@@ -6,6 +6,7 @@ import (
 
 	"github.com/ergo-services/ergo/etf"
 	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node/dist"
 )
 
 var (
@@ -13,6 +14,10 @@ var (
 	ErrAppAlreadyStarted    = fmt.Errorf("Application is already started")
 	ErrAppUnknown           = fmt.Errorf("Unknown application name")
 	ErrAppIsNotRunning      = fmt.Errorf("Application is not running")
+	ErrAppNodeUnknown       = fmt.Errorf("Node is not in the list of the application nodes")
+	ErrAppDependencyCycle   = fmt.Errorf("Cyclic dependency of applications")
+	ErrAppAlreadyIncluded   = fmt.Errorf("Application is already included by another application")
+	ErrAppIncluded          = fmt.Errorf("Application is included by another application")
 	ErrNameUnknown          = fmt.Errorf("Unknown name")
 	ErrNameOwner            = fmt.Errorf("Not an owner")
 	ErrProcessBusy          = fmt.Errorf("Process is busy")
@@ -25,6 +30,10 @@ var (
 	ErrTaken                = fmt.Errorf("Resource is taken")
 	ErrTimeout              = fmt.Errorf("Timed out")
 	ErrFragmented           = fmt.Errorf("Fragmented data")
+	ErrNodeNotAllowed       = fmt.Errorf("Node is not allowed")
+	ErrBusy                 = fmt.Errorf("Busy")
+	ErrPeerUnknown          = fmt.Errorf("Unknown peer")
+	ErrUnsupported          = fmt.Errorf("Not supported")
 )
 
 // Distributed operations codes (http://www.erlang.org/doc/apps/erts/erl_dist_protocol.html)
@@ -64,6 +73,7 @@ const (
 	defaultListenRangeEnd    uint16 = 65000
 	defaultEPMDPort          uint16 = 4369
 	defaultSendQueueLength   int    = 100
+	defaultSendQueueTimeout         = time.Second
 	defaultRecvQueueLength   int    = 100
 	defaultFragmentationUnit        = 65000
 	defaultHandshakeVersion         = 5
@@ -82,6 +92,9 @@ type Node interface {
 	UnregisterName(name string) error
 	LoadedApplications() []gen.ApplicationInfo
 	WhichApplications() []gen.ApplicationInfo
+	// WhichApplicationsTree returns the running applications along with
+	// the applications they depend on and the included ones
+	WhichApplicationsTree() []gen.ApplicationTree
 	ApplicationInfo(name string) (gen.ApplicationInfo, error)
 	ApplicationLoad(app gen.ApplicationBehavior, args ...etf.Term) (string, error)
 	ApplicationUnload(appName string) error
@@ -89,15 +102,34 @@ type Node interface {
 	ApplicationStartPermanent(appName string, args ...etf.Term) (gen.Process, error)
 	ApplicationStartTransient(appName string, args ...etf.Term) (gen.Process, error)
 	ApplicationStop(appName string) error
+	ApplicationSetEnv(appName string, env map[string]interface{}) error
+	// ApplicationUpgrade upgrades the loaded application using the upgrade instructions
+	// of the spec returned by the Load callback of the given application
+	ApplicationUpgrade(app gen.ApplicationBehavior, args ...etf.Term) error
+	LoadConfig(filename string) error
+	// CodeChange replaces the behavior of the running processes with the behavior of the
+	// same type as 'from'. Their state is migrated using the CodeChange callback of 'to'.
+	CodeChange(from gen.ProcessBehavior, to gen.ServerBehavior) error
 	ProvideRPC(module string, function string, fun gen.RPC) error
 	RevokeRPC(module, function string) error
+	ExportRPC(module, function string, arity int) (etf.Export, error)
 
 	Links(process etf.Pid) []etf.Pid
 	Monitors(process etf.Pid) []etf.Pid
 	MonitorsByName(process etf.Pid) []gen.ProcessID
 	MonitoredBy(process etf.Pid) []etf.Pid
 
+	// SystemMonitor sets the local process to receive the system monitor messages
+	// (gen.MessageSystemMonitor*) enabled by the given options. It overrides the
+	// previous settings. Use empty pid to disable system monitoring.
+	SystemMonitor(pid etf.Pid, opts SystemMonitorOptions) error
+	// SystemMonitorInfo returns the current system monitor process and its options
+	SystemMonitorInfo() (etf.Pid, SystemMonitorOptions)
+
 	Stop()
+	// Shutdown stops the node gracefully. Applications are stopped in the reverse
+	// start order, then the send queues of the connected peers are drained.
+	Shutdown(timeout time.Duration) error
 	Wait()
 	WaitWithTimeout(d time.Duration) error
 }
@@ -116,6 +148,66 @@ type Network interface {
 
 	ProvideRemoteSpawn(name string, object gen.ProcessBehavior) error
 	RevokeRemoteSpawn(name string) error
+
+	// SetPeerSendQueuePolicy overrides Options.SendQueuePolicy/SendQueueTimeout for the given peer.
+	SetPeerSendQueuePolicy(name string, policy SendQueuePolicy, timeout time.Duration)
+	// PeerStats returns the state of the send queue of the given connected peer
+	PeerStats(name string) (PeerStats, error)
+}
+
+// SystemMonitorOptions defines the events the system monitor process is notified about.
+// Zero value disables the event.
+type SystemMonitorOptions struct {
+	// BusyDist reports (gen.MessageSystemMonitorBusyDist) once the number of messages
+	// in the send queue of the connected peer reaches BusyDistQueueLength. Reported
+	// again after the queue is drained.
+	BusyDist bool
+	// BusyDistQueueLength defines the threshold for the BusyDist. Zero value (or
+	// the value exceeding Options.SendQueueLength) means the send queue is full.
+	BusyDistQueueLength int
+	// LongCallback reports (gen.MessageSystemMonitorLongCallback) HandleCall, HandleCast
+	// and HandleInfo callbacks of gen.Server running longer than the given duration.
+	LongCallback time.Duration
+	// LargeMailbox reports (gen.MessageSystemMonitorLargeMailbox) once the number of
+	// messages in the mailbox of the process reaches the given value. Reported again
+	// after the mailbox is drained.
+	LargeMailbox int
+	// LongSchedule reports (gen.MessageSystemMonitorLongSchedule) if the goroutines
+	// were not scheduled for longer than the given duration.
+	LongSchedule time.Duration
+}
+
+// SendQueuePolicy defines the behavior on sending a message to the peer
+// whose send queue is full (the peer is slow or connection is stalled)
+type SendQueuePolicy int
+
+const (
+	// SendQueuePolicyBlock blocks the sender until the send queue has a free space. Default.
+	SendQueuePolicyBlock SendQueuePolicy = 0
+	// SendQueuePolicyWait blocks the sender for the given timeout (Options.SendQueueTimeout).
+	// Returns ErrBusy if the timeout is exceeded.
+	SendQueuePolicyWait SendQueuePolicy = 1
+	// SendQueuePolicyDrop drops the message and returns ErrBusy
+	SendQueuePolicyDrop SendQueuePolicy = 2
+	// SendQueuePolicyDisconnect closes connection with the peer and returns ErrBusy
+	SendQueuePolicyDisconnect SendQueuePolicy = 3
+)
+
+// PeerStats contains the details about the send queue of the connected peer
+type PeerStats struct {
+	Name string
+	// Connections number of connections to this peer
+	Connections int
+	// SendQueueLength total number of the messages in the send queues
+	SendQueueLength int
+	// SendQueueCapacity total capacity of the send queues
+	SendQueueCapacity int
+	// Policy applied to this peer
+	Policy SendQueuePolicy
+	// QueueFull how many times the send queue was found full
+	QueueFull uint64
+	// Dropped number of the dropped messages
+	Dropped uint64
 }
 
 type NetworkRoute struct {
@@ -126,15 +218,25 @@ type NetworkRoute struct {
 
 // Options struct with bootstrapping options for CreateNode
 type Options struct {
-	Applications           []gen.ApplicationBehavior
-	ListenRangeBegin       uint16
-	ListenRangeEnd         uint16
-	Hidden                 bool
-	EPMDPort               uint16
-	DisableEPMDServer      bool
-	DisableEPMD            bool // use static routes only
-	SendQueueLength        int
-	RecvQueueLength        int
+	Applications []gen.ApplicationBehavior
+	// Config is the path to the file with the environment of applications keyed by
+	// the application name. It overrides the environment defined by the application
+	// spec. Supported formats (by the file extension): Erlang terms like sys.config
+	// (.config), TOML (.toml) and JSON (.json).
+	Config            string
+	ListenRangeBegin  uint16
+	ListenRangeEnd    uint16
+	Hidden            bool
+	EPMDPort          uint16
+	DisableEPMDServer bool
+	DisableEPMD       bool // use static routes only
+	SendQueueLength   int
+	RecvQueueLength   int
+	// SendQueuePolicy defines the behavior on sending a message to the peer whose
+	// send queue (SendQueueLength) is full. Default is SendQueuePolicyBlock
+	SendQueuePolicy SendQueuePolicy
+	// SendQueueTimeout is used with SendQueuePolicyWait. Default is 1 second.
+	SendQueueTimeout       time.Duration
 	FragmentationUnit      int
 	DisableHeaderAtomCache bool
 	TLSMode                TLSModeType
@@ -146,6 +248,27 @@ type Options struct {
 	HandshakeVersion int
 	// ConnectionHandlers defines the number of readers/writers per connection. Default is the number of CPU.
 	ConnectionHandlers int
+	// PeerConnections defines the number of connections this node opens to the peer.
+	// Messages are sharded by the sender pid (keeping the ordering per sender). All of
+	// them are opened before the peer is registered, so the sharding never changes.
+	// The remote node waits for all of them as well and shards its messages the same way.
+	// Takes effect with Ergo nodes only, Erlang peers always use a single connection.
+	// Default is 1.
+	PeerConnections int
+	// Authenticate is invoked on handshaking with the remote peer (for both incoming
+	// and outgoing connections). It can reject connection by returning an error or
+	// override the cookie for this peer by returning a non-empty value.
+	Authenticate dist.HandshakeAuthFunc
+	// AllowNodes list of the node name patterns (path.Match syntax, e.g. "worker*@host")
+	// allowed to be connected with. Empty list means any node is allowed.
+	AllowNodes []string
+	// DenyNodes list of the node name patterns (path.Match syntax) are not allowed
+	// to be connected with. It has priority over the AllowNodes.
+	DenyNodes []string
+	// Carrier defines the transport for the distribution links. Default is TCPCarrier.
+	// Use UnixCarrier for the nodes running on the same host or PipeCarrier for the nodes
+	// running within the same binary.
+	Carrier Carrier
 
 	cookie   string
 	creation uint32
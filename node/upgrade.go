@@ -0,0 +1,119 @@
+package node
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+)
+
+// CodeChange upgrades the running processes with the behavior of the same type as 'from'.
+// All of them are suspended first, then their behavior is replaced with 'to' and the state
+// is migrated using its CodeChange callback. Supervisors replace the behavior in the specs
+// of their children. Once it's done the processes are resumed. The process keeps the old
+// behavior if its CodeChange callback has failed, the first error is returned.
+func (n *node) CodeChange(from gen.ProcessBehavior, to gen.ServerBehavior) error {
+	if from == nil || to == nil {
+		return ErrBehaviorUnknown
+	}
+
+	fromType := reflect.TypeOf(from)
+	processes := []*process{}
+	supervisors := []*process{}
+	for _, p := range n.ProcessList() {
+		proc, ok := p.(*process)
+		if !ok {
+			continue
+		}
+		behavior := proc.Behavior()
+		if behavior == nil {
+			// terminated
+			continue
+		}
+		if reflect.TypeOf(behavior) == fromType {
+			processes = append(processes, proc)
+			continue
+		}
+		if _, ok := behavior.(gen.SupervisorBehavior); ok {
+			supervisors = append(supervisors, proc)
+		}
+	}
+
+	suspended := []*process{}
+	defer func() {
+		for _, p := range suspended {
+			p.Direct(gen.MessageDirectResume{})
+		}
+	}()
+
+	for _, p := range processes {
+		if _, err := p.Direct(gen.MessageDirectSuspend{}); err != nil {
+			if p.IsAlive() == false {
+				continue
+			}
+			return fmt.Errorf("can't suspend %s: %w", p.Self(), err)
+		}
+		suspended = append(suspended, p)
+	}
+
+	var codeChangeErr error
+	message := gen.MessageDirectCodeChange{
+		From: from,
+		To:   to,
+	}
+	for _, p := range suspended {
+		if _, err := p.Direct(message); err != nil {
+			if codeChangeErr == nil {
+				codeChangeErr = fmt.Errorf("code change of %s failed: %w", p.Self(), err)
+			}
+			continue
+		}
+		p.Lock()
+		p.behavior = to
+		p.Unlock()
+	}
+
+	for _, p := range supervisors {
+		p.Direct(message)
+	}
+
+	return codeChangeErr
+}
+
+// ApplicationUpgrade upgrades the loaded application to the version returned by the Load
+// callback of the given application. The upgrade instructions (ApplicationSpec.Upgrade)
+// are applied in the given order using CodeChange.
+func (n *node) ApplicationUpgrade(app gen.ApplicationBehavior, args ...etf.Term) error {
+	newSpec, err := app.Load(args...)
+	if err != nil {
+		return err
+	}
+
+	spec := n.applicationSpec(newSpec.Name)
+	if spec == nil {
+		return ErrAppUnknown
+	}
+
+	for _, upgrade := range newSpec.Upgrade {
+		if err := n.CodeChange(upgrade.From, upgrade.To); err != nil {
+			return err
+		}
+
+		// the application children started later must use the new behavior
+		spec.Lock()
+		for i := range spec.Children {
+			if reflect.TypeOf(spec.Children[i].Child) == reflect.TypeOf(upgrade.From) {
+				spec.Children[i].Child = upgrade.To
+			}
+		}
+		spec.Unlock()
+	}
+
+	spec.Lock()
+	spec.Version = newSpec.Version
+	spec.Description = newSpec.Description
+	spec.Upgrade = newSpec.Upgrade
+	spec.Unlock()
+	return nil
+}
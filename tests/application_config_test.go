@@ -0,0 +1,207 @@
+package tests
+
+// - Application config
+//    start node with sys.config file. application env is overridden by the config
+//    ApplicationSetEnv: changed, added and removed keys -> ConfigChange callback
+//    LoadConfig (TOML, JSON): the running application gets the new values,
+//    the config of the application which is not loaded yet is applied on loading
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testConfigApplication struct {
+	gen.Application
+	ch chan interface{}
+}
+
+type testConfigChange struct {
+	changed map[string]interface{}
+	added   map[string]interface{}
+	removed []string
+}
+
+func (a *testConfigApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	name := args[0].(string)
+	return gen.ApplicationSpec{
+		Name:    name,
+		Version: "v.0.1",
+		Environment: map[string]interface{}{
+			"rate_limit": 10,
+			"name":       name,
+		},
+		Children: []gen.ApplicationChildSpec{
+			gen.ApplicationChildSpec{
+				Child: &testAppGenServer{},
+				Name:  name + "GS",
+			},
+		},
+	}, nil
+}
+
+func (a *testConfigApplication) Start(p gen.Process, args ...etf.Term) {
+}
+
+func (a *testConfigApplication) ConfigChange(p gen.Process, changed, added map[string]interface{}, removed []string) {
+	a.ch <- testConfigChange{
+		changed: changed,
+		added:   added,
+		removed: removed,
+	}
+}
+
+func TestApplicationConfig(t *testing.T) {
+	fmt.Printf("\n=== Test Application - config\n")
+
+	dir, err := ioutil.TempDir("", "ergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfig := func(name, text string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	sysConfig := writeConfig("sys.config", `
+	%% rate limits
+	[{testConfigApp, [{rate_limit, 100}, {mode, fast}]}].
+	`)
+	fmt.Printf("Starting node nodeAppConfig@localhost with sys.config: ")
+	node1, err := ergo.StartNode("nodeAppConfig@localhost", "cookies", node.Options{Config: sysConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	waitConfigChange := func(expected testConfigChange) {
+		select {
+		case m := <-ch:
+			if !reflect.DeepEqual(m, expected) {
+				t.Fatalf("expected %#v, got %#v", expected, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	checkEnv := func(name string, expected map[string]interface{}) {
+		process := node1.ProcessByName(name)
+		if process == nil {
+			t.Fatal("no process", name)
+		}
+		for key, value := range expected {
+			if v := process.Env(key); !reflect.DeepEqual(v, value) {
+				t.Fatalf("%s: expected %#v, got %#v", key, value, v)
+			}
+		}
+	}
+
+	fmt.Printf("... starting application. env must be overridden by sys.config: ")
+	if _, err := node1.ApplicationLoad(&testConfigApplication{ch: ch}, "testConfigApp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("testConfigApp"); err != nil {
+		t.Fatal(err)
+	}
+	checkEnv("testConfigAppGS", map[string]interface{}{
+		"rate_limit": 100,
+		"mode":       etf.Atom("fast"),
+		"name":       "testConfigApp",
+	})
+	fmt.Println("OK")
+
+	fmt.Printf("... ApplicationSetEnv. must be changed, added and removed: ")
+	err = node1.ApplicationSetEnv("testConfigApp", map[string]interface{}{
+		"rate_limit": 200,
+		"burst":      5,
+		"name":       "testConfigApp",
+		"mode":       nil,
+		"unknown":    nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitConfigChange(testConfigChange{
+		changed: map[string]interface{}{"rate_limit": 200},
+		added:   map[string]interface{}{"burst": 5},
+		removed: []string{"mode"},
+	})
+	checkEnv("testConfigAppGS", map[string]interface{}{
+		"rate_limit": 200,
+		"burst":      5,
+		"mode":       nil,
+	})
+	if err := node1.ApplicationSetEnv("unknownApp", nil); err != node.ErrAppUnknown {
+		t.Fatal("expected", node.ErrAppUnknown, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... LoadConfig (TOML): ")
+	tomlConfig := writeConfig("app.toml", `
+	[testConfigApp]
+	rate_limit = 300
+	burst = 5
+	`)
+	if err := node1.LoadConfig(tomlConfig); err != nil {
+		t.Fatal(err)
+	}
+	waitConfigChange(testConfigChange{
+		changed: map[string]interface{}{"rate_limit": 300},
+		added:   map[string]interface{}{},
+		removed: []string{},
+	})
+	checkEnv("testConfigAppGS", map[string]interface{}{"rate_limit": 300})
+	fmt.Println("OK")
+
+	fmt.Printf("... LoadConfig (JSON). config of the application is applied on loading: ")
+	jsonConfig := writeConfig("app.json", `{
+		"testConfigApp": {"rate_limit": 400},
+		"testConfigApp2": {"rate_limit": 1, "hosts": ["a", "b"]}
+	}`)
+	if err := node1.LoadConfig(jsonConfig); err != nil {
+		t.Fatal(err)
+	}
+	waitConfigChange(testConfigChange{
+		changed: map[string]interface{}{"rate_limit": 400},
+		added:   map[string]interface{}{},
+		removed: []string{},
+	})
+	checkEnv("testConfigAppGS", map[string]interface{}{"rate_limit": 400})
+
+	if _, err := node1.ApplicationLoad(&testConfigApplication{ch: ch}, "testConfigApp2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("testConfigApp2"); err != nil {
+		t.Fatal(err)
+	}
+	checkEnv("testConfigApp2GS", map[string]interface{}{
+		"rate_limit": 1,
+		"hosts":      etf.List{"a", "b"},
+	})
+	fmt.Println("OK")
+
+	fmt.Printf("... LoadConfig with unsupported format (must fail): ")
+	if err := node1.LoadConfig(writeConfig("app.yaml", "")); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := node1.LoadConfig(writeConfig("wrong.config", "{app, []}.")); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+}
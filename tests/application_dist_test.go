@@ -0,0 +1,192 @@
+package tests
+
+// - Distributed application
+//    start nodes node1, node2, node3. application nodes (by priority): node1, node2, node3
+//    start app on node2 -> started on node2 (normal)
+//    start app on node3 -> node3 is standby
+//    start app on node1 -> started on node1 (takeover), stopped on node2
+//    stop app on node1 -> started on node2 (failover)
+//    start app on node1 -> started on node1 (takeover)
+//    node1.stop -> started on node2 (failover)
+//    node2.stop -> started on node3 (failover)
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testDistApplication struct {
+	gen.Application
+	ch chan interface{}
+}
+
+type testDistApplicationStarted struct {
+	node   string
+	reason gen.ApplicationStartReason
+}
+
+func (a *testDistApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	return gen.ApplicationSpec{
+		Name:    args[0].(string),
+		Version: "v.0.1",
+		Nodes:   args[1].([]string),
+		Children: []gen.ApplicationChildSpec{
+			gen.ApplicationChildSpec{
+				Child: &testAppGenServer{},
+				Name:  "testDistAppGS",
+			},
+		},
+	}, nil
+}
+
+func (a *testDistApplication) Start(p gen.Process, args ...etf.Term) {
+	a.ch <- fmt.Errorf("Start must not be invoked if StartWithReason is implemented")
+}
+
+func (a *testDistApplication) StartWithReason(p gen.Process, reason gen.ApplicationStartReason, args ...etf.Term) {
+	if p.Env(gen.EnvKeyStartReason) != nil {
+		a.ch <- fmt.Errorf("start reason must be removed from the env")
+		return
+	}
+	a.ch <- testDistApplicationStarted{
+		node:   p.NodeName(),
+		reason: reason,
+	}
+}
+
+func TestApplicationDistributed(t *testing.T) {
+	fmt.Printf("\n=== Test Application - distributed\n")
+	fmt.Printf("Starting nodes nodeDistApp1@localhost, nodeDistApp2@localhost, nodeDistApp3@localhost: ")
+	node1, _ := ergo.StartNode("nodeDistApp1@localhost", "cookies", node.Options{})
+	node2, _ := ergo.StartNode("nodeDistApp2@localhost", "cookies", node.Options{})
+	node3, _ := ergo.StartNode("nodeDistApp3@localhost", "cookies", node.Options{})
+	if node1 == nil || node2 == nil || node3 == nil {
+		t.Fatal("can't start nodes")
+	}
+	defer node1.Stop()
+	defer node2.Stop()
+	defer node3.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	nodes := []string{node1.Name(), node2.Name(), node3.Name()}
+
+	fmt.Printf("... loading distributed application on all nodes: ")
+	for _, n := range []node.Node{node1, node2, node3} {
+		if _, err := n.ApplicationLoad(&testDistApplication{ch: ch}, "testDistApp", nodes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fmt.Println("OK")
+
+	waitStarted := func(n node.Node, reason gen.ApplicationStartReason) {
+		expected := testDistApplicationStarted{node: n.Name(), reason: reason}
+		select {
+		case m := <-ch:
+			if m != expected {
+				t.Fatalf("expected %#v, got %#v", expected, m)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	isRunning := func(n node.Node) bool {
+		for _, app := range n.WhichApplications() {
+			if app.Name == "testDistApp" {
+				return true
+			}
+		}
+		return false
+	}
+	waitStopped := func(n node.Node) {
+		for i := 0; i < 10; i++ {
+			if !isRunning(n) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatal("application is still running on", n.Name())
+	}
+
+	fmt.Printf("... starting application on node2. must be started there (normal): ")
+	p2, err := node2.ApplicationStart("testDistApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(node2, gen.ApplicationStartReasonNormal)
+	if p2 == nil || !isRunning(node2) {
+		t.Fatal("application is not running on node2")
+	}
+	if _, err := node2.ApplicationStart("testDistApp"); err != node.ErrAppAlreadyStarted {
+		t.Fatal("expected", node.ErrAppAlreadyStarted, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application on node3. must be standby: ")
+	p3, err := node3.ApplicationStart("testDistApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p3 != nil || isRunning(node3) {
+		t.Fatal("application is running on node3")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application on node1. must be taken over from node2: ")
+	p1, err := node1.ApplicationStart("testDistApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(node1, gen.ApplicationStartReasonTakeover)
+	if p1 == nil || !isRunning(node1) {
+		t.Fatal("application is not running on node1")
+	}
+	waitStopped(node2)
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping application on node1. must fail over to node2: ")
+	if err := node1.ApplicationStop("testDistApp"); err != nil {
+		t.Fatal(err)
+	}
+	if isRunning(node1) {
+		t.Fatal("application is running on node1")
+	}
+	waitStarted(node2, gen.ApplicationStartReasonFailover)
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application on node1 again. must be taken over from node2: ")
+	if _, err := node1.ApplicationStart("testDistApp"); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(node1, gen.ApplicationStartReasonTakeover)
+	waitStopped(node2)
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping node1. must fail over to node2: ")
+	node1.Stop()
+	waitStarted(node2, gen.ApplicationStartReasonFailover)
+	if !isRunning(node2) || isRunning(node3) {
+		t.Fatal("application must be running on node2 only")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping node2. must fail over to node3: ")
+	node2.Stop()
+	waitStarted(node3, gen.ApplicationStartReasonFailover)
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application on the node out of the application nodes (must fail): ")
+	if _, err := node3.ApplicationLoad(&testDistApplication{ch: ch}, "testDistApp2", nodes[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node3.ApplicationStart("testDistApp2"); err != node.ErrAppNodeUnknown {
+		t.Fatal("expected", node.ErrAppNodeUnknown, "got", err)
+	}
+	fmt.Println("OK")
+}
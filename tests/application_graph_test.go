@@ -0,0 +1,175 @@
+package tests
+
+// - Application dependency graph
+//    loading application which closes the cycle of dependencies (must fail)
+//    including the application which is already included (must fail)
+//    starting application with unknown dependency (must fail)
+//    included application: its children are started under the including app,
+//    it can't be started on its own
+//    WhichApplicationsTree
+//    dependencies are started with the same start type
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testGraphApplication struct {
+	gen.Application
+}
+
+func (a *testGraphApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	name := args[0].(string)
+	return gen.ApplicationSpec{
+		Name:                 name,
+		Version:              "v.0.1",
+		Applications:         args[1].([]string),
+		IncludedApplications: args[2].([]string),
+		Environment: map[string]interface{}{
+			name: true,
+		},
+		Children: []gen.ApplicationChildSpec{
+			gen.ApplicationChildSpec{
+				Child: &testAppGenServer{},
+				Name:  name + "GS",
+			},
+		},
+	}, nil
+}
+
+func (a *testGraphApplication) Start(p gen.Process, args ...etf.Term) {
+}
+
+func TestApplicationGraph(t *testing.T) {
+	fmt.Printf("\n=== Test Application - dependency graph and included applications\n")
+	fmt.Printf("Starting node nodeAppGraph@localhost: ")
+	node1, _ := ergo.StartNode("nodeAppGraph@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	load := func(name string, deps []string, included []string) error {
+		_, err := node1.ApplicationLoad(&testGraphApplication{}, name, deps, included)
+		return err
+	}
+
+	fmt.Printf("... loading application with cyclic dependency (must fail): ")
+	if err := load("graphA", []string{"graphB"}, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := load("graphB", []string{}, []string{"graphC"}); err != nil {
+		t.Fatal(err)
+	}
+	err := load("graphC", []string{"graphA"}, []string{})
+	if !errors.Is(err, node.ErrAppDependencyCycle) {
+		t.Fatal("expected", node.ErrAppDependencyCycle, "got", err)
+	}
+	if !strings.Contains(err.Error(), "graphC -> graphA -> graphB -> graphC") {
+		t.Fatal("wrong error message:", err)
+	}
+	if err := load("graphSelf", []string{"graphSelf"}, []string{}); !errors.Is(err, node.ErrAppDependencyCycle) {
+		t.Fatal("expected", node.ErrAppDependencyCycle, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... including the application which is already included (must fail): ")
+	if err := load("graphD", []string{}, []string{"graphC"}); !errors.Is(err, node.ErrAppAlreadyIncluded) {
+		t.Fatal("expected", node.ErrAppAlreadyIncluded, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application with unknown dependencies (must fail): ")
+	if err := load("graphE", []string{"graphUnknown"}, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("graphE"); !errors.Is(err, node.ErrAppUnknown) {
+		t.Fatal("expected", node.ErrAppUnknown, "got", err)
+	}
+	// included application is not loaded yet
+	if _, err := node1.ApplicationStart("graphB"); !errors.Is(err, node.ErrAppUnknown) {
+		t.Fatal("expected", node.ErrAppUnknown, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... starting included application (must fail): ")
+	if err := load("graphC", []string{}, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("graphC"); !errors.Is(err, node.ErrAppIncluded) {
+		t.Fatal("expected", node.ErrAppIncluded, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... starting application. included one must be started under the including app: ")
+	app, err := node1.ApplicationStartPermanent("graphA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appB, err := node1.ApplicationInfo("graphB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appB.PID == (etf.Pid{}) {
+		t.Fatal("dependency is not started")
+	}
+	gsC := node1.ProcessByName("graphCGS")
+	if gsC == nil {
+		t.Fatal("child of the included application is not started")
+	}
+	if gsC.GroupLeader().Self() != appB.PID {
+		t.Fatal("child of the included application has wrong group leader")
+	}
+	if gsC.Env("graphB") != true || gsC.Env("graphC") != true {
+		t.Fatal("wrong environment", gsC.Env("graphB"), gsC.Env("graphC"))
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... WhichApplicationsTree: ")
+	appC, _ := node1.ApplicationInfo("graphC")
+	expected := gen.ApplicationTree{
+		ApplicationInfo: gen.ApplicationInfo{Name: "graphA", Version: "v.0.1", PID: app.Self()},
+		Applications: []gen.ApplicationTree{
+			gen.ApplicationTree{
+				ApplicationInfo: appB,
+				Included: []gen.ApplicationTree{
+					gen.ApplicationTree{ApplicationInfo: appC},
+				},
+			},
+		},
+	}
+	found := false
+	for _, tree := range node1.WhichApplicationsTree() {
+		switch tree.Name {
+		case "graphA":
+			if !reflect.DeepEqual(tree, expected) {
+				t.Fatalf("expected %#v, got %#v", expected, tree)
+			}
+			found = true
+		case "graphB", "graphC":
+			t.Fatal("must be listed under graphA only")
+		}
+	}
+	if !found {
+		t.Fatal("graphA is not in the tree")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... dependency must be started with the same start type (permanent): ")
+	// application graphB is permanent so the node must be stopped
+	gsC.Exit("abnormal")
+	if err := node1.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal("node must be stopped")
+	}
+	fmt.Println("OK")
+}
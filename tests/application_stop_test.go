@@ -0,0 +1,284 @@
+package tests
+
+// - Application stop
+//    ApplicationStop: PrepStop -> children are terminated -> Stop
+//    Shutdown: app2 (depends on app1) is stopped before app1. the children finish
+//              their work within the supervisor's shutdown timeout
+//    Shutdown with small timeout: ErrTimeout, node is stopped anyway
+//    ApplicationStop of the child with infinity shutdown: ErrProcessBusy, application keeps running
+//    permanent application: child terminated -> PrepStop -> Stop, node is stopped
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testStopApplication struct {
+	gen.Application
+	name string
+	ch   chan interface{}
+}
+
+type testAppStopEvent struct {
+	name   string
+	event  string
+	reason string
+}
+
+// testAppStopGS finishes its work on exit
+type testAppStopGS struct {
+	gen.Server
+}
+
+// testAppStopStuckGS ignores the exit signals
+type testAppStopStuckGS struct {
+	gen.Server
+}
+
+// testStopChildApplication has a single child with the given shutdown option
+type testStopChildApplication struct {
+	testStopApplication
+}
+
+func (a *testStopApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	a.name = args[0].(string)
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:     a.name + "GS",
+				Child:    &testAppStopGS{},
+				Args:     []etf.Term{a.ch},
+				Shutdown: time.Second,
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	return gen.ApplicationSpec{
+		Name:         a.name,
+		Version:      "v.0.1",
+		Applications: args[1].([]string),
+		Children: []gen.ApplicationChildSpec{
+			gen.ApplicationChildSpec{
+				Child: &testSupervisorChildSpec{},
+				Name:  a.name + "Sup",
+				Args:  []etf.Term{spec},
+			},
+		},
+	}, nil
+}
+
+func (a *testStopApplication) Start(p gen.Process, args ...etf.Term) {
+}
+
+func (a *testStopApplication) PrepStop(p gen.Process, reason string) {
+	a.ch <- testAppStopEvent{name: a.name, event: "prep_stop", reason: reason}
+}
+
+func (a *testStopApplication) Stop(reason string) {
+	a.ch <- testAppStopEvent{name: a.name, event: "stop", reason: reason}
+}
+
+func (a *testStopChildApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	a.name = args[0].(string)
+	child := gen.ApplicationChildSpec{
+		Child: &testAppStopGS{},
+		Name:  a.name + "GS",
+		Args:  []etf.Term{a.ch},
+	}
+	if shutdown := args[1].(time.Duration); shutdown != 0 {
+		spec := gen.SupervisorSpec{
+			Children: []gen.SupervisorChildSpec{
+				{
+					Name:     a.name + "GS",
+					Child:    &testAppStopStuckGS{},
+					Shutdown: shutdown,
+				},
+			},
+			Strategy: gen.SupervisorStrategy{
+				Type:      gen.SupervisorStrategyOneForOne,
+				Intensity: 10,
+				Period:    5,
+				Restart:   gen.SupervisorStrategyRestartPermanent,
+			},
+		}
+		child = gen.ApplicationChildSpec{
+			Child: &testSupervisorChildSpec{},
+			Name:  a.name + "Sup",
+			Args:  []etf.Term{spec},
+		}
+	}
+	return gen.ApplicationSpec{
+		Name:     a.name,
+		Version:  "v.0.1",
+		Children: []gen.ApplicationChildSpec{child},
+	}, nil
+}
+
+func (gs *testAppStopStuckGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.SetTrapExit(true)
+	return nil
+}
+
+func (gs *testAppStopStuckGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	return gen.ServerStatusOK
+}
+
+func (gs *testAppStopGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.State = args[0]
+	process.SetTrapExit(true)
+	return nil
+}
+
+func (gs *testAppStopGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	if exit, ok := message.(gen.MessageExit); ok {
+		// in-flight work
+		time.Sleep(200 * time.Millisecond)
+		return gen.ServerStatusStopWithReason(exit.Reason)
+	}
+	return gen.ServerStatusOK
+}
+
+func (gs *testAppStopGS) Terminate(process *gen.ServerProcess, reason string) {
+	process.State.(chan interface{}) <- testAppStopEvent{name: process.Name(), event: "terminate", reason: reason}
+}
+
+func TestApplicationStopCallbacks(t *testing.T) {
+	fmt.Printf("\n=== Test Application - stop callbacks and shutdown\n")
+	fmt.Printf("Starting nodes nodeAppStop1@localhost, nodeAppStop2@localhost: ")
+	node1, _ := ergo.StartNode("nodeAppStop1@localhost", "cookies", node.Options{})
+	node2, _ := ergo.StartNode("nodeAppStop2@localhost", "cookies", node.Options{})
+	if node1 == nil || node2 == nil {
+		t.Fatal("can't start nodes")
+	}
+	defer node1.Stop()
+	defer node2.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	waitEvents := func(events ...testAppStopEvent) {
+		for _, expected := range events {
+			select {
+			case m := <-ch:
+				if m != expected {
+					t.Fatalf("expected %#v, got %#v", expected, m)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("result timeout")
+			}
+		}
+	}
+
+	fmt.Printf("... ApplicationStop. must be invoked PrepStop, terminated the children, invoked Stop: ")
+	if _, err := node1.ApplicationLoad(&testStopApplication{ch: ch}, "testStopApp1", []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationLoad(&testStopApplication{ch: ch}, "testStopApp2", []string{"testStopApp1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("testStopApp1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.ApplicationStop("testStopApp1"); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(
+		testAppStopEvent{"testStopApp1", "prep_stop", "normal"},
+		testAppStopEvent{"testStopApp1GS", "terminate", "normal"},
+		testAppStopEvent{"testStopApp1", "stop", "normal"},
+	)
+	fmt.Println("OK")
+
+	fmt.Printf("... Shutdown. applications must be stopped in the reverse start order: ")
+	// starts testStopApp1 as a dependency
+	if _, err := node1.ApplicationStart("testStopApp2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Shutdown(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(
+		testAppStopEvent{"testStopApp2", "prep_stop", "shutdown"},
+		testAppStopEvent{"testStopApp2GS", "terminate", "shutdown"},
+		testAppStopEvent{"testStopApp2", "stop", "shutdown"},
+		testAppStopEvent{"testStopApp1", "prep_stop", "shutdown"},
+		testAppStopEvent{"testStopApp1GS", "terminate", "shutdown"},
+		testAppStopEvent{"testStopApp1", "stop", "shutdown"},
+	)
+	if node1.IsAlive() {
+		t.Fatal("node is still alive")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... Shutdown with the timeout shorter than the shutdown of the application (must fail): ")
+	if _, err := node2.ApplicationLoad(&testStopApplication{ch: ch}, "testStopApp3", []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node2.ApplicationStart("testStopApp3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node2.Shutdown(50 * time.Millisecond); err != node.ErrTimeout {
+		t.Fatal("expected", node.ErrTimeout, "got", err)
+	}
+	if node2.IsAlive() {
+		t.Fatal("node is still alive")
+	}
+	waitEvents(testAppStopEvent{"testStopApp3", "prep_stop", "shutdown"})
+	fmt.Println("OK")
+
+	fmt.Printf("Starting node nodeAppStop3@localhost: ")
+	node3, _ := ergo.StartNode("nodeAppStop3@localhost", "cookies", node.Options{})
+	if node3 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node3.Stop()
+	// testStopApp3GS might still be terminating
+	ch = make(chan interface{}, 10)
+	fmt.Println("OK")
+
+	fmt.Printf("... ApplicationStop of the child with infinity shutdown (must fail). application keeps running: ")
+	if _, err := node3.ApplicationLoad(&testStopChildApplication{testStopApplication{ch: ch}}, "testStopApp4", gen.SupervisorShutdownInfinity); err != nil {
+		t.Fatal(err)
+	}
+	app, err := node3.ApplicationStart("testStopApp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node3.ApplicationStop("testStopApp4"); err != node.ErrProcessBusy {
+		t.Fatal("expected", node.ErrProcessBusy, "got", err)
+	}
+	waitEvents(testAppStopEvent{"testStopApp4", "prep_stop", "normal"})
+	// application must not be stuck waiting for its children
+	if _, err := app.Direct(gen.MessageDirectChildren{}); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... permanent application. child terminated: PrepStop, Stop must be invoked, node must be stopped: ")
+	if _, err := node3.ApplicationLoad(&testStopChildApplication{testStopApplication{ch: ch}}, "testStopApp5", time.Duration(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node3.ApplicationStartPermanent("testStopApp5"); err != nil {
+		t.Fatal(err)
+	}
+	node3.ProcessByName("testStopApp5GS").Exit("abnormal")
+	waitEvents(
+		testAppStopEvent{"testStopApp5GS", "terminate", "abnormal"},
+		testAppStopEvent{"testStopApp5", "prep_stop", "shutdown"},
+		testAppStopEvent{"testStopApp5", "stop", "shutdown"},
+	)
+	if err := node3.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,332 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestCarrier(t *testing.T) {
+	fmt.Printf("\n=== Test Carrier\n")
+
+	carriers := []struct {
+		name    string
+		carrier node.Carrier
+		tls     node.TLSModeType
+	}{
+		{"pipe", node.NewPipeCarrier(), node.TLSModeDisabled},
+		{"pipe with TLS", node.NewPipeCarrier(), node.TLSModeAuto},
+		{"unix", node.UnixCarrier{Dir: t.TempDir()}, node.TLSModeDisabled},
+	}
+
+	hgs := &handshakeGenServer{}
+	for _, c := range carriers {
+		fmt.Printf("    %s: ", c.name)
+		opts := node.Options{
+			Carrier: c.carrier,
+			TLSMode: c.tls,
+		}
+		node1, e := ergo.StartNode("node1Carrier@localhost", "secret", opts)
+		if e != nil {
+			t.Fatal(e)
+		}
+		node2, e := ergo.StartNode("node2Carrier@localhost", "secret", opts)
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		// the name must be unique within the carrier
+		if _, e := ergo.StartNode("node2Carrier@localhost", "secret", opts); e != node.ErrTaken {
+			t.Fatal("expected", node.ErrTaken, "got", e)
+		}
+
+		p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+		if e != nil {
+			t.Fatal(e)
+		}
+		p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		call := makeCall{
+			to:      p2.Self(),
+			message: "test",
+		}
+		result, e := p1.Direct(call)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if r, ok := result.(string); !ok || r != "pass" {
+			t.Fatal("wrong result", result)
+		}
+
+		// and back using the same link
+		call = makeCall{
+			to:      p1.Self(),
+			message: etf.Tuple{"test", 1, 2, 3},
+		}
+		if _, e := p2.Direct(call); e != nil {
+			t.Fatal(e)
+		}
+
+		node1.Stop()
+		node2.Stop()
+		node1.Wait()
+		node2.Wait()
+		fmt.Println("OK")
+	}
+}
+
+type testCountingCarrier struct {
+	*node.PipeCarrier
+	dials chan string
+}
+
+func (tc testCountingCarrier) Dial(ctx context.Context, name string, route node.NetworkRoute) (net.Conn, error) {
+	tc.dials <- name
+	return tc.PipeCarrier.Dial(ctx, name, route)
+}
+
+func TestCarrierPeerConnections(t *testing.T) {
+	fmt.Printf("\n=== Test Carrier with multiple connections per peer\n")
+	carrier := testCountingCarrier{
+		PipeCarrier: node.NewPipeCarrier(),
+		dials:       make(chan string, 10),
+	}
+	opts := node.Options{
+		Carrier:         carrier,
+		PeerConnections: 4,
+	}
+	node1, e := ergo.StartNode("node1CarrierPeerConnections@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("node2CarrierPeerConnections@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	hgs := &handshakeGenServer{}
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    make calls from the different processes: ")
+	for i := 0; i < 10; i++ {
+		p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+		if e != nil {
+			t.Fatal(e)
+		}
+		call := makeCall{
+			to:      p2.Self(),
+			message: i,
+		}
+		result, e := p1.Direct(call)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if r, ok := result.(string); !ok || r != "pass" {
+			t.Fatal("wrong result", result)
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    check the number of connections: ")
+	if len(carrier.dials) != 4 {
+		t.Fatal("expected 4 connections, got", len(carrier.dials))
+	}
+	capacity := 0
+	for _, pair := range [][2]node.Node{{node1, node2}, {node2, node1}} {
+		stats, e := pair[0].PeerStats(pair[1].Name())
+		if e != nil {
+			t.Fatal(e)
+		}
+		if stats.Connections != 4 {
+			t.Fatalf("%s: expected 4 connections, got %d", pair[0].Name(), stats.Connections)
+		}
+		// both sides must shard their messages over all the connections
+		if capacity > 0 && stats.SendQueueCapacity != capacity {
+			t.Fatalf("%s: expected send queue capacity %d, got %d", pair[0].Name(), capacity, stats.SendQueueCapacity)
+		}
+		capacity = stats.SendQueueCapacity
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    make calls from the different processes of the accepting side: ")
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 10; i++ {
+		p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+		if e != nil {
+			t.Fatal(e)
+		}
+		call := makeCall{
+			to:      p1.Self(),
+			message: i,
+		}
+		result, e := p2.Direct(call)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if r, ok := result.(string); !ok || r != "pass" {
+			t.Fatal("wrong result", result)
+		}
+	}
+	fmt.Println("OK")
+}
+
+type testStallingCarrier struct {
+	*node.PipeCarrier
+	stall   *int32
+	release chan struct{}
+}
+
+type testStallingConn struct {
+	net.Conn
+	stall   *int32
+	release chan struct{}
+}
+
+func (tc testStallingCarrier) Dial(ctx context.Context, name string, route node.NetworkRoute) (net.Conn, error) {
+	c, err := tc.PipeCarrier.Dial(ctx, name, route)
+	if err != nil {
+		return nil, err
+	}
+	return testStallingConn{Conn: c, stall: tc.stall, release: tc.release}, nil
+}
+
+func (sc testStallingConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(sc.stall) == 1 {
+		<-sc.release
+	}
+	return sc.Conn.Write(b)
+}
+
+func TestCarrierSendQueuePolicy(t *testing.T) {
+	fmt.Printf("\n=== Test Carrier send queue policy\n")
+	carrier := testStallingCarrier{
+		PipeCarrier: node.NewPipeCarrier(),
+		stall:       new(int32),
+		release:     make(chan struct{}),
+	}
+	opts := node.Options{
+		Carrier:         carrier,
+		SendQueueLength: 1,
+	}
+	node1, e := ergo.StartNode("node1CarrierSendQueue@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("node2CarrierSendQueue@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	hgs := &handshakeGenServer{}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := p1.Direct(makeCall{to: p2.Self(), message: "test"}); e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    PeerStats of unknown peer: ")
+	if _, e := node1.PeerStats("unknown@localhost"); e != node.ErrPeerUnknown {
+		t.Fatal("expected", node.ErrPeerUnknown, "got", e)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    TrySend to the not connected peer returns ErrPeerUnknown: ")
+	node3, e := ergo.StartNode("node3CarrierSendQueue@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+	if _, e := node3.Spawn("p3", gen.ProcessOptions{}, hgs); e != nil {
+		t.Fatal(e)
+	}
+	if e := p1.TrySend(gen.ProcessID{Name: "p3", Node: node3.Name()}, 1); e != node.ErrPeerUnknown {
+		t.Fatal("expected", node.ErrPeerUnknown, "got", e)
+	}
+	if _, e := node1.PeerStats(node3.Name()); e != node.ErrPeerUnknown {
+		t.Fatal("TrySend must not connect to the peer")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    TrySend to the stalled peer returns ErrBusy: ")
+	atomic.StoreInt32(carrier.stall, 1)
+	busy := false
+	for i := 0; i < 1000; i++ {
+		if e := p1.TrySend(p2.Self(), i); e != nil {
+			if e != node.ErrBusy {
+				t.Fatal(e)
+			}
+			busy = true
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if busy == false {
+		t.Fatal("send queue is not full")
+	}
+	stats, e := node1.PeerStats(node2.Name())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stats.QueueFull == 0 || stats.SendQueueLength == 0 {
+		t.Fatal("wrong stats", stats)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    SendQueuePolicyDrop: ")
+	node1.SetPeerSendQueuePolicy(node2.Name(), node.SendQueuePolicyDrop, 0)
+	if e := p1.Send(p2.Self(), "drop"); e != node.ErrBusy {
+		t.Fatal("expected", node.ErrBusy, "got", e)
+	}
+	stats, _ = node1.PeerStats(node2.Name())
+	if stats.Dropped != 1 || stats.Policy != node.SendQueuePolicyDrop {
+		t.Fatal("wrong stats", stats)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    SendQueuePolicyWait: ")
+	node1.SetPeerSendQueuePolicy(node2.Name(), node.SendQueuePolicyWait, 100*time.Millisecond)
+	start := time.Now()
+	if e := p1.Send(p2.Self(), "wait"); e != node.ErrBusy {
+		t.Fatal("expected", node.ErrBusy, "got", e)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("timeout wasn't applied")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    release the stalled peer: ")
+	atomic.StoreInt32(carrier.stall, 0)
+	close(carrier.release)
+	if e := p1.Send(p2.Self(), "released"); e != nil {
+		t.Fatal(e)
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,354 @@
+// Code generated by etfgen. DO NOT EDIT.
+
+package tests
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/lib"
+)
+
+// EncodeETF implements etf.TermMarshaler interface
+func (x testGenMap) EncodeETF(b *lib.Buffer, options etf.EncodeOptions) error {
+	etf.EncodeMapHeader(b, 13)
+	if err := etf.Encode(etf.Atom("name"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Name, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Age"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Age, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Score"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Score, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Active"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Active, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Data"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Data, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Tag"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Tag, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Values"), b, options); err != nil {
+		return err
+	}
+	if len(x.Values) == 0 {
+		etf.EncodeNil(b)
+	} else {
+		etf.EncodeListHeader(b, len(x.Values))
+		for i0 := range x.Values {
+			if err := etf.Encode(x.Values[i0], b, options); err != nil {
+				return err
+			}
+		}
+		etf.EncodeNil(b)
+	}
+	if err := etf.Encode(etf.Atom("Labels"), b, options); err != nil {
+		return err
+	}
+	etf.EncodeMapHeader(b, len(x.Labels))
+	for k0, v0 := range x.Labels {
+		if err := etf.Encode(k0, b, options); err != nil {
+			return err
+		}
+		if err := etf.Encode(v0, b, options); err != nil {
+			return err
+		}
+	}
+	if err := etf.Encode(etf.Atom("Item"), b, options); err != nil {
+		return err
+	}
+	if err := x.Item.EncodeETF(b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Items"), b, options); err != nil {
+		return err
+	}
+	if len(x.Items) == 0 {
+		etf.EncodeNil(b)
+	} else {
+		etf.EncodeListHeader(b, len(x.Items))
+		for i0 := range x.Items {
+			if err := x.Items[i0].EncodeETF(b, options); err != nil {
+				return err
+			}
+		}
+		etf.EncodeNil(b)
+	}
+	if err := etf.Encode(etf.Atom("Ptr"), b, options); err != nil {
+		return err
+	}
+	if x.Ptr == nil {
+		etf.EncodeNil(b)
+	} else if err := x.Ptr.EncodeETF(b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Any"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Any, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(etf.Atom("Options"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Options, b, options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeETF implements etf.TermUnmarshaler interface
+func (x *testGenMap) DecodeETF(term etf.Term) error {
+	m, ok := term.(etf.Map)
+	if !ok {
+		return fmt.Errorf("can't convert %#v to testGenMap", term)
+	}
+	for k, v := range m {
+		key, ok := etf.TermToString(k)
+		if !ok {
+			return &etf.InvalidStructKeyError{Term: k}
+		}
+		switch {
+		case key == "name" || strings.EqualFold(key, "Name"):
+			if s, ok := etf.TermToString(v); ok {
+				x.Name = string(s)
+			} else {
+				return fmt.Errorf("can't convert %#v to string", v)
+			}
+		case strings.EqualFold(key, "Age"):
+			if i, ok := etf.TermToInt(v, 0); ok {
+				x.Age = int(i)
+			} else {
+				return fmt.Errorf("can't convert %#v to int", v)
+			}
+		case strings.EqualFold(key, "Score"):
+			if f, ok := v.(float64); ok {
+				x.Score = float64(f)
+			} else {
+				return fmt.Errorf("can't convert %#v to float64", v)
+			}
+		case strings.EqualFold(key, "Active"):
+			if b, ok := v.(bool); ok {
+				x.Active = b
+			} else {
+				return fmt.Errorf("can't convert %#v to bool", v)
+			}
+		case strings.EqualFold(key, "Data"):
+			if a, ok := v.([]byte); ok {
+				x.Data = a
+			} else {
+				return fmt.Errorf("can't convert %#v to []byte", v)
+			}
+		case strings.EqualFold(key, "Tag"):
+			if a, ok := v.(etf.Atom); ok {
+				x.Tag = a
+			} else {
+				return fmt.Errorf("can't convert %#v to etf.Atom", v)
+			}
+		case strings.EqualFold(key, "Values"):
+			switch l0 := v.(type) {
+			case etf.List:
+				x.Values = make([]uint16, len(l0))
+				for i0 := range l0 {
+					if i, ok := etf.TermToUint(l0[i0], 16); ok {
+						x.Values[i0] = uint16(i)
+					} else {
+						return fmt.Errorf("can't convert %#v to uint16", l0[i0])
+					}
+				}
+			case string:
+				x.Values = make([]uint16, len(l0))
+				for i0 := range l0 {
+					x.Values[i0] = uint16(l0[i0])
+				}
+			default:
+				return fmt.Errorf("can't convert %#v to []uint16", v)
+			}
+		case strings.EqualFold(key, "Labels"):
+			if m0, ok := v.(etf.Map); ok {
+				x.Labels = make(map[string]int, len(m0))
+				for k0, v0 := range m0 {
+					var key0 string
+					if s, ok := etf.TermToString(k0); ok {
+						key0 = string(s)
+					} else {
+						return fmt.Errorf("can't convert %#v to string", k0)
+					}
+					var value0 int
+					if i, ok := etf.TermToInt(v0, 0); ok {
+						value0 = int(i)
+					} else {
+						return fmt.Errorf("can't convert %#v to int", v0)
+					}
+					x.Labels[key0] = value0
+				}
+			} else {
+				return fmt.Errorf("can't convert %#v to map[string]int", v)
+			}
+		case strings.EqualFold(key, "Item"):
+			if err := x.Item.DecodeETF(v); err != nil {
+				return err
+			}
+		case strings.EqualFold(key, "Items"):
+			switch l0 := v.(type) {
+			case etf.List:
+				x.Items = make([]testGenRecord, len(l0))
+				for i0 := range l0 {
+					if err := x.Items[i0].DecodeETF(l0[i0]); err != nil {
+						return err
+					}
+				}
+			default:
+				return fmt.Errorf("can't convert %#v to []testGenRecord", v)
+			}
+		case strings.EqualFold(key, "Ptr"):
+			if l0, ok := v.(etf.List); v == nil || ok && len(l0) == 0 {
+				x.Ptr = nil
+			} else {
+				x.Ptr = new(testGenRecord)
+				if err := x.Ptr.DecodeETF(v); err != nil {
+					return err
+				}
+			}
+		case strings.EqualFold(key, "Any"):
+			x.Any = v
+		case strings.EqualFold(key, "Options"):
+			if err := etf.TermIntoStruct(v, &x.Options); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EncodeETF implements etf.TermMarshaler interface
+func (x testGenMarker) EncodeETF(b *lib.Buffer, options etf.EncodeOptions) error {
+	etf.EncodeTupleHeader(b, 2)
+	if err := etf.Encode(etf.Atom("marker"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.A, b, options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeETF implements etf.TermUnmarshaler interface
+func (x *testGenMarker) DecodeETF(term etf.Term) error {
+	t, ok := term.(etf.Tuple)
+	if !ok || len(t) != 2 {
+		return fmt.Errorf("can't convert %#v to testGenMarker", term)
+	}
+	if tag, ok := t[0].(etf.Atom); !ok || tag != "marker" {
+		return fmt.Errorf("can't convert %#v to testGenMarker: wrong record name", term)
+	}
+	if i, ok := etf.TermToInt(t[1], 0); ok {
+		x.A = int(i)
+	} else {
+		return fmt.Errorf("can't convert %#v to int", t[1])
+	}
+	return nil
+}
+
+// EncodeETF implements etf.TermMarshaler interface
+func (x testGenPrivate) EncodeETF(b *lib.Buffer, options etf.EncodeOptions) error {
+	etf.EncodeTupleHeader(b, 3)
+	if err := etf.Encode(etf.Atom("private"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.A, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.C, b, options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeETF implements etf.TermUnmarshaler interface
+func (x *testGenPrivate) DecodeETF(term etf.Term) error {
+	t, ok := term.(etf.Tuple)
+	if !ok || len(t) != 3 {
+		return fmt.Errorf("can't convert %#v to testGenPrivate", term)
+	}
+	if tag, ok := t[0].(etf.Atom); !ok || tag != "private" {
+		return fmt.Errorf("can't convert %#v to testGenPrivate: wrong record name", term)
+	}
+	if i, ok := etf.TermToInt(t[1], 0); ok {
+		x.A = int(i)
+	} else {
+		return fmt.Errorf("can't convert %#v to int", t[1])
+	}
+	if a, ok := t[2].(etf.Atom); ok {
+		x.C = a
+	} else {
+		return fmt.Errorf("can't convert %#v to etf.Atom", t[2])
+	}
+	return nil
+}
+
+// EncodeETF implements etf.TermMarshaler interface
+func (x testGenRecord) EncodeETF(b *lib.Buffer, options etf.EncodeOptions) error {
+	etf.EncodeTupleHeader(b, 4)
+	if err := etf.Encode(etf.Atom("item"), b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.ID, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Title, b, options); err != nil {
+		return err
+	}
+	if err := etf.Encode(x.Pid, b, options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeETF implements etf.TermUnmarshaler interface
+func (x *testGenRecord) DecodeETF(term etf.Term) error {
+	t, ok := term.(etf.Tuple)
+	if !ok || len(t) != 4 {
+		return fmt.Errorf("can't convert %#v to testGenRecord", term)
+	}
+	if tag, ok := t[0].(etf.Atom); !ok || tag != "item" {
+		return fmt.Errorf("can't convert %#v to testGenRecord: wrong record name", term)
+	}
+	if i, ok := etf.TermToInt(t[1], 64); ok {
+		x.ID = int64(i)
+	} else {
+		return fmt.Errorf("can't convert %#v to int64", t[1])
+	}
+	if s, ok := etf.TermToString(t[2]); ok {
+		x.Title = string(s)
+	} else {
+		return fmt.Errorf("can't convert %#v to string", t[2])
+	}
+	if a, ok := t[3].(etf.Pid); ok {
+		x.Pid = a
+	} else {
+		return fmt.Errorf("can't convert %#v to etf.Pid", t[3])
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package tests
+
+//go:generate go run ../cmd/etfgen
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/lib"
+	"github.com/ergo-services/ergo/node"
+
+	"github.com/ergo-services/ergo"
+)
+
+//etf:map
+type testGenMap struct {
+	Name    string `etf:"name"`
+	Age     int
+	Score   float64
+	Active  bool
+	Data    []byte
+	Tag     etf.Atom
+	Values  []uint16
+	Labels  map[string]int
+	Item    testGenRecord
+	Items   []testGenRecord
+	Ptr     *testGenRecord
+	Any     etf.Term
+	Options testGenOptions // not annotated. uses reflection
+	private int
+}
+
+//etf:record item
+type testGenRecord struct {
+	ID    int64
+	Title string
+	Pid   etf.Pid
+}
+
+// declared as a record using etf.Record
+type testGenMarker struct {
+	etf.Record `etf:"marker"`
+	A          int
+}
+
+// record with the unexported field (is skipped)
+type testGenPrivate struct {
+	etf.Record `etf:"private"`
+	A          int
+	b          string
+	C          etf.Atom
+}
+
+type testGenOptions struct {
+	A int
+	B string
+}
+
+func TestETFGen(t *testing.T) {
+	fmt.Printf("\n=== Test generated ETF marshaling\n")
+
+	value := testGenMap{
+		Name:    "test",
+		Age:     42,
+		Score:   3.14,
+		Active:  true,
+		Data:    []byte{1, 2, 3},
+		Tag:     etf.Atom("tag"),
+		Values:  []uint16{1, 2, 300},
+		Labels:  map[string]int{"a": 1},
+		Item:    testGenRecord{ID: 1, Title: "one", Pid: etf.Pid{Node: "a@b", ID: 10, Creation: 1}},
+		Items:   []testGenRecord{{ID: 2, Title: "two"}, {ID: 3, Title: "three"}},
+		Ptr:     &testGenRecord{ID: 4, Title: "four"},
+		Any:     etf.Tuple{etf.Atom("any"), 1},
+		Options: testGenOptions{A: 5, B: "five"},
+	}
+
+	encode := func(term etf.Term) []byte {
+		b := lib.TakeBuffer()
+		defer lib.ReleaseBuffer(b)
+		if err := etf.Encode(term, b, etf.EncodeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte{}, b.B...)
+	}
+
+	fmt.Printf("    record representation: ")
+	term, _, err := etf.Decode(encode(value.Item), []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := etf.Tuple{etf.Atom("item"), 1, "one", value.Item.Pid}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    record declared with etf.Record: ")
+	if _, ok := interface{}(testGenMarker{}).(etf.TermMarshaler); !ok {
+		t.Fatal("etf.TermMarshaler is not implemented")
+	}
+	term, _, err = etf.Decode(encode(testGenMarker{A: 1}), []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = etf.Tuple{etf.Atom("marker"), 1}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    record with unexported field. generated and reflection encoding must be equal: ")
+	// defined type has no methods, so it is encoded using reflection
+	type testReflectPrivate testGenPrivate
+	private := testGenPrivate{A: 1, b: "skipped", C: "c"}
+	generated := encode(private)
+	if reflected := encode(testReflectPrivate(private)); !reflect.DeepEqual(generated, reflected) {
+		t.Fatalf("expected %v got %v", generated, reflected)
+	}
+	term, _, err = etf.Decode(generated, []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = etf.Tuple{etf.Atom("private"), 1, etf.Atom("c")}
+	if !reflect.DeepEqual(term, expected) {
+		t.Fatalf("expected %#v got %#v", expected, term)
+	}
+	var decodedPrivate testGenPrivate
+	var reflectedPrivate testReflectPrivate
+	if err := etf.TermIntoStruct(term, &decodedPrivate); err != nil {
+		t.Fatal(err)
+	}
+	if err := etf.TermIntoStruct(term, &reflectedPrivate); err != nil {
+		t.Fatal(err)
+	}
+	private.b = ""
+	if decodedPrivate != private || testGenPrivate(reflectedPrivate) != private {
+		t.Fatalf("expected %#v got %#v and %#v", private, decodedPrivate, reflectedPrivate)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    map representation: ")
+	term, _, err = etf.Decode(encode(value), []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := term.(etf.Map)
+	if !ok || len(m) != 13 {
+		t.Fatal("wrong value", term)
+	}
+	if m[etf.Atom("name")] != "test" {
+		t.Fatal("wrong value of 'name'", m[etf.Atom("name")])
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    round trip: ")
+	result := testGenMap{}
+	if err := etf.TermIntoStruct(term, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, result) {
+		t.Fatalf("expected %#v\ngot %#v", value, result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    round trip with nil pointer: ")
+	value.Ptr = nil
+	term, _, err = etf.Decode(encode(value), []etf.Atom{}, etf.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = testGenMap{Ptr: &testGenRecord{}}
+	if err := etf.TermIntoStruct(term, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, result) {
+		t.Fatalf("expected %#v\ngot %#v", value, result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    wrong record name: ")
+	if err := etf.TermIntoStruct(etf.Tuple{etf.Atom("wrong"), 1, "a", etf.Pid{}}, &testGenRecord{}); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    send to the remote process: ")
+	node1, _ := ergo.StartNode("node1ETFGen@localhost", "cookies", node.Options{})
+	defer node1.Stop()
+	node2, _ := ergo.StartNode("node2ETFGen@localhost", "cookies", node.Options{})
+	defer node2.Stop()
+
+	gs := &testServer{
+		res: make(chan interface{}, 2),
+	}
+	p1, err := node1.Spawn("", gen.ProcessOptions{}, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs.res, nil)
+	p2, err := node2.Spawn("", gen.ProcessOptions{}, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForResultWithValue(t, gs.res, nil)
+
+	if err := p1.Send(p2.Self(), value.Item); err != nil {
+		t.Fatal(err)
+	}
+	received := testGenRecord{}
+	if err := etf.TermIntoStruct(<-gs.res, &received); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value.Item, received) {
+		t.Fatal("expected", value.Item, "got", received)
+	}
+	fmt.Println("OK")
+}
@@ -188,8 +188,10 @@ func TestMonitorLocalLocal(t *testing.T) {
 func TestMonitorLocalRemoteByPid(t *testing.T) {
 	fmt.Printf("\n=== Test Monitor Local-Remote by Pid\n")
 	fmt.Printf("Starting nodes: nodeM1LocalRemoteByPid@localhost, nodeM2LocalRemoteByPid@localhost: ")
-	node1, err1 := ergo.StartNode("nodeM1LocalRemoteByPid@localhost", "cookies", node.Options{})
-	node2, err2 := ergo.StartNode("nodeM2LocalRemoteByPid@localhost", "cookies", node.Options{})
+	// in-memory carrier doesn't depend on EPMD and the free ports
+	opts := node.Options{Carrier: node.NewPipeCarrier()}
+	node1, err1 := ergo.StartNode("nodeM1LocalRemoteByPid@localhost", "cookies", opts)
+	node2, err2 := ergo.StartNode("nodeM2LocalRemoteByPid@localhost", "cookies", opts)
 	if err1 != nil {
 		t.Fatal("can't start node1:", err1)
 	}
@@ -279,13 +281,17 @@ func TestMonitorLocalRemoteByPid(t *testing.T) {
 	ref = node1gs1.MonitorProcess(node2gs2.Self())
 	// wait a bit for the MessageDown if something went wrong
 	waitForTimeout(t, gs1.v)
+	// race conditioned case (see TestLinkLocalRemote): process termination
+	// on node2 can be handled faster than the connection termination.
 	node2.Stop()
 	result = gen.MessageDown{
 		Ref:    ref,
 		Pid:    node2gs2.Self(),
 		Reason: "noconnection",
 	}
-	waitForResultWithValue(t, gs1.v, result)
+	resultKill := result
+	resultKill.Reason = "kill"
+	waitForResultWithValueOrValue(t, gs1.v, result, resultKill)
 	if err := checkCleanProcessRef(node1gs1, ref); err != nil {
 		t.Fatal(err)
 	}
@@ -303,8 +309,9 @@ func TestMonitorLocalRemoteByPid(t *testing.T) {
 func TestMonitorLocalRemoteByName(t *testing.T) {
 	fmt.Printf("\n=== Test Monitor Local-Remote by Name\n")
 	fmt.Printf("Starting nodes: nodeM1LocalRemoteByTuple@localhost, nodeM2LocalRemoteByTuple@localhost: ")
-	node1, _ := ergo.StartNode("nodeM1LocalRemoteByTuple@localhost", "cookies", node.Options{})
-	node2, _ := ergo.StartNode("nodeM2LocalRemoteByTuple@localhost", "cookies", node.Options{})
+	opts := node.Options{Carrier: node.NewPipeCarrier()}
+	node1, _ := ergo.StartNode("nodeM1LocalRemoteByTuple@localhost", "cookies", opts)
+	node2, _ := ergo.StartNode("nodeM2LocalRemoteByTuple@localhost", "cookies", opts)
 	if node1 == nil || node2 == nil {
 		t.Fatal("can't start nodes")
 	} else {
@@ -395,10 +402,12 @@ func TestMonitorLocalRemoteByName(t *testing.T) {
 		ProcessID: processID,
 		Reason:    "noconnection",
 	}
+	resultKill := result
+	resultKill.Reason = "kill"
 	// wait a bit for the MessageDown if something went wrong
 	waitForTimeout(t, gs1.v)
 	node2.Stop()
-	waitForResultWithValue(t, gs1.v, result)
+	waitForResultWithValueOrValue(t, gs1.v, result, resultKill)
 	if node1gs1.IsMonitor(ref) {
 		t.Fatal("monitor ref is still alive")
 	}
@@ -413,6 +422,73 @@ func TestMonitorLocalRemoteByName(t *testing.T) {
 	node1.Stop()
 }
 
+func TestMonitorLocalRemoteNodeDown(t *testing.T) {
+	fmt.Printf("\n=== Test Monitor Local-Remote. Node down\n")
+	fmt.Printf("Starting nodes: nodeM1RemoteNodeDown@localhost, nodeM2RemoteNodeDown@localhost, nodeM3RemoteNodeDown@localhost: ")
+	opts := node.Options{Carrier: node.NewPipeCarrier()}
+	node1, _ := ergo.StartNode("nodeM1RemoteNodeDown@localhost", "cookies", opts)
+	node2, _ := ergo.StartNode("nodeM2RemoteNodeDown@localhost", "cookies", opts)
+	node3, _ := ergo.StartNode("nodeM3RemoteNodeDown@localhost", "cookies", opts)
+	if node1 == nil || node2 == nil || node3 == nil {
+		t.Fatal("can't start nodes")
+	}
+	fmt.Println("OK")
+
+	gs1 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	gs2 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+	gs3 := &testMonitor{
+		v: make(chan interface{}, 2),
+	}
+
+	// starting gen servers
+	fmt.Printf("    wait for start of gs1 on %#v: ", node1.Name())
+	node1gs1, _ := node1.Spawn("gs1", gen.ProcessOptions{}, gs1, nil)
+	waitForResultWithValue(t, gs1.v, node1gs1.Self())
+
+	fmt.Printf("    wait for start of gs2 on %#v: ", node2.Name())
+	node2gs2, _ := node2.Spawn("gs2", gen.ProcessOptions{}, gs2, nil)
+	waitForResultWithValue(t, gs2.v, node2gs2.Self())
+
+	fmt.Printf("    wait for start of gs3 on %#v: ", node3.Name())
+	node3gs3, _ := node3.Spawn("gs3", gen.ProcessOptions{}, gs3, nil)
+	waitForResultWithValue(t, gs3.v, node3gs3.Self())
+
+	fmt.Printf("... by Pid Local-Remote: gs1 -> gs2, gs1 -> gs3. onNodeDown of node3 must not affect gs2: ")
+	ref2 := node1gs1.MonitorProcess(node2gs2.Self())
+	ref3 := node1gs1.MonitorProcess(node3gs3.Self())
+	// wait a bit for the MessageDown if something went wrong
+	waitForTimeout(t, gs1.v)
+	// race conditioned case (see TestLinkLocalRemote): process termination
+	// on node3 can be handled faster than the connection termination.
+	node3.Stop()
+	result1 := gen.MessageDown{Ref: ref3, Pid: node3gs3.Self(), Reason: "noconnection"}
+	result2 := gen.MessageDown{Ref: ref3, Pid: node3gs3.Self(), Reason: "kill"}
+	waitForResultWithValueOrValue(t, gs1.v, result1, result2)
+	// must be no MessageDown for gs2
+	waitForTimeout(t, gs1.v)
+	if err := checkCleanProcessRef(node1gs1, ref2); err == nil {
+		t.Fatal("monitor reference of gs2 has been lost on node 1")
+	}
+
+	fmt.Printf("... by Pid Local-Remote: gs1 -> gs2. terminate: ")
+	node2gs2.Exit("normal")
+	result := gen.MessageDown{
+		Ref:    ref2,
+		Pid:    node2gs2.Self(),
+		Reason: "normal",
+	}
+	waitForResultWithValue(t, gs1.v, result)
+	if err := checkCleanProcessRef(node1gs1, ref2); err != nil {
+		t.Fatal(err)
+	}
+	node2.Stop()
+	node1.Stop()
+}
+
 /*
 	Test cases for Local-Local
 	Link
@@ -565,8 +641,9 @@ func TestLinkLocalLocal(t *testing.T) {
 func TestLinkLocalRemote(t *testing.T) {
 	fmt.Printf("\n=== Test Link Local-Remote by Pid\n")
 	fmt.Printf("Starting nodes: nodeL1LocalRemoteByPid@localhost, nodeL2LocalRemoteByPid@localhost: ")
-	node1, _ := ergo.StartNode("nodeL1LocalRemoteByPid@localhost", "cookies", node.Options{})
-	node2, _ := ergo.StartNode("nodeL2LocalRemoteByPid@localhost", "cookies", node.Options{})
+	opts := node.Options{Carrier: node.NewPipeCarrier()}
+	node1, _ := ergo.StartNode("nodeL1LocalRemoteByPid@localhost", "cookies", opts)
+	node2, _ := ergo.StartNode("nodeL2LocalRemoteByPid@localhost", "cookies", opts)
 	if node1 == nil || node2 == nil {
 		t.Fatal("can't start nodes")
 	} else {
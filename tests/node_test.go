@@ -242,19 +242,25 @@ func (h *handshakeGenServer) HandleDirect(process *gen.ServerProcess, message in
 func TestNodeDistHandshake(t *testing.T) {
 	fmt.Printf("\n=== Test Node Handshake versions\n")
 
+	// in-memory carrier doesn't depend on EPMD and the free ports
+	carrier := node.NewPipeCarrier()
 	nodeOptions5 := node.Options{
 		HandshakeVersion: dist.ProtoHandshake5,
+		Carrier:          carrier,
 	}
 	nodeOptions6 := node.Options{
 		HandshakeVersion: dist.ProtoHandshake6,
+		Carrier:          carrier,
 	}
 	nodeOptions5WithTLS := node.Options{
 		HandshakeVersion: dist.ProtoHandshake5,
 		TLSMode:          node.TLSModeAuto,
+		Carrier:          carrier,
 	}
 	nodeOptions6WithTLS := node.Options{
 		HandshakeVersion: dist.ProtoHandshake6,
 		TLSMode:          node.TLSModeAuto,
+		Carrier:          carrier,
 	}
 	hgs := &handshakeGenServer{}
 
@@ -364,6 +370,102 @@ func TestNodeDistHandshake(t *testing.T) {
 	}
 }
 
+func TestNodeAuthenticate(t *testing.T) {
+	fmt.Printf("\n=== Test Node Authenticate\n")
+
+	authenticated := make(chan dist.HandshakeAuthInfo, 2)
+	optsAuth := node.Options{
+		DenyNodes: []string{"node*AuthDenied@localhost"},
+		Authenticate: func(info dist.HandshakeAuthInfo) (string, error) {
+			authenticated <- info
+			if info.Name == "node3AuthCookie@localhost" {
+				return "peerSecret", nil
+			}
+			return "", nil
+		},
+	}
+	node1, e := ergo.StartNode("node1Auth@localhost", "secret", optsAuth)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("node2AuthDenied@localhost", "secret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+	node3, e := ergo.StartNode("node3AuthCookie@localhost", "peerSecret", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node3.Stop()
+
+	hgs := &handshakeGenServer{}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	p3, e := node3.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    denied node can't connect: ")
+	call := makeCall{
+		to:      p1.Self(),
+		message: "test",
+	}
+	if _, e := p2.Direct(call); e == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    connect to the denied node: ")
+	call = makeCall{
+		to:      p2.Self(),
+		message: "test",
+	}
+	if _, e := p1.Direct(call); e == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    per-peer cookie: ")
+	call = makeCall{
+		to:      p1.Self(),
+		message: "test",
+	}
+	result, e := p3.Direct(call)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r, ok := result.(string); !ok || r != "pass" {
+		t.Fatal("wrong result")
+	}
+	select {
+	case info := <-authenticated:
+		if info.Name != "node3AuthCookie@localhost" || info.Accept != true || info.RemoteAddr == nil {
+			t.Fatal("wrong auth info", info)
+		}
+	default:
+		t.Fatal("Authenticate hook wasn't invoked")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("    incorrect pattern: ")
+	optsIncorrect := node.Options{
+		AllowNodes: []string{"[node"},
+	}
+	if _, e := ergo.StartNode("node4Auth@localhost", "secret", optsIncorrect); e == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+}
+
 func TestNodeRemoteSpawn(t *testing.T) {
 	fmt.Printf("\n=== Test Node Remote Spawn\n")
 	node1, _ := ergo.StartNode("node1remoteSpawn@localhost", "secret", node.Options{})
@@ -23,6 +23,13 @@ type testRPCCase1 struct {
 	args []etf.Term
 }
 
+type testRPCCaseFun struct {
+	node string
+	fun  etf.Term
+	args []etf.Term
+	cast bool
+}
+
 func (trpc *testRPCGenServer) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
 	return message, gen.ServerStatusOK
 }
@@ -37,6 +44,19 @@ func (trpc *testRPCGenServer) HandleInfo(process *gen.ServerProcess, message etf
 		}
 		return gen.ServerStatusOK
 
+	case testRPCCaseFun:
+		if m.cast {
+			if e := process.CastFun(m.node, m.fun, m.args...); e != nil {
+				trpc.res <- e
+			}
+			return gen.ServerStatusOK
+		}
+		if v, e := process.CallFun(m.node, m.fun, m.args...); e != nil {
+			trpc.res <- e
+		} else {
+			trpc.res <- v
+		}
+		return gen.ServerStatusOK
 	}
 
 	return gen.ServerStatusStop
@@ -136,3 +156,102 @@ func TestRPC(t *testing.T) {
 	waitForResultWithValue(t, gs1.res, expected2)
 
 }
+
+func TestRPCFun(t *testing.T) {
+	fmt.Printf("\n=== Test RPC Fun\n")
+
+	node1, _ := ergo.StartNode("nodeRPCFun1@localhost", "cookies", node.Options{})
+	node2, _ := ergo.StartNode("nodeRPCFun2@localhost", "cookies", node.Options{})
+	defer node1.Stop()
+	defer node2.Stop()
+
+	gs1 := &testRPCGenServer{
+		res: make(chan interface{}, 2),
+	}
+
+	testFun := func(a ...etf.Term) etf.Term {
+		return etf.Tuple{etf.Atom("sum"), a[0].(int) + a[1].(int)}
+	}
+	casted := make(chan interface{}, 2)
+	testCast := func(a ...etf.Term) etf.Term {
+		casted <- a[0]
+		return etf.Atom("ok")
+	}
+
+	time.Sleep(100 * time.Millisecond) // waiting for start 'rex' gen_server
+	if e := node1.ProvideRPC("testMod", "testFun", testFun); e != nil {
+		t.Fatal(e)
+	}
+	if e := node1.ProvideRPC("testMod", "testCast", testCast); e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("Export RPC method 'testMod.testFun' on %s: ", node1.Name())
+	export, err := node1.ExportRPC("testMod", "testFun", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := etf.Export{Module: "testMod", Function: "testFun", Arity: 2}
+	if export != expected {
+		t.Fatal("wrong export", export)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("Export unknown RPC method 'testMod.unknown' on %s: ", node1.Name())
+	if _, err := node1.ExportRPC("testMod", "unknown", 1); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+
+	node2gs1, _ := node2.Spawn("gs1", gen.ProcessOptions{}, gs1, nil)
+
+	fmt.Printf("Call exported fun on %s from %s: ", node1.Name(), node2.Name())
+	case1 := testRPCCaseFun{
+		node: node1.Name(),
+		fun:  export,
+		args: []etf.Term{1, 2},
+	}
+	node2gs1.Send(node2gs1.Self(), case1)
+	waitForResultWithValue(t, gs1.res, etf.Tuple{etf.Atom("sum"), 3})
+
+	fmt.Printf("Call exported fun with wrong number of args: ")
+	case1.args = []etf.Term{1}
+	node2gs1.Send(node2gs1.Self(), case1)
+	waitForResultWithValue(t, gs1.res, gen.ErrFunArity)
+
+	fmt.Printf("Call unsupported fun: ")
+	case1.fun = etf.Atom("fun")
+	node2gs1.Send(node2gs1.Self(), case1)
+	waitForResultWithValue(t, gs1.res, gen.ErrFunUnsupported)
+
+	fmt.Printf("Call closure on %s (can't be evaluated by Go node): ", node1.Name())
+	closure := etf.Function{
+		Arity:    0,
+		Module:   "test",
+		Pid:      node2gs1.Self(),
+		FreeVars: []etf.Term{},
+	}
+	case1 = testRPCCaseFun{
+		node: node1.Name(),
+		fun:  closure,
+	}
+	node2gs1.Send(node2gs1.Self(), case1)
+	expected1 := etf.Tuple{etf.Atom("badrpc"),
+		etf.Tuple{etf.Atom("EXIT"),
+			etf.Tuple{etf.Tuple{etf.Atom("badfun"), closure}, etf.List{}}}}
+	waitForResultWithValue(t, gs1.res, expected1)
+
+	fmt.Printf("Cast exported fun on %s from %s: ", node1.Name(), node2.Name())
+	exportCast, err := node1.ExportRPC("testMod", "testCast", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	case1 = testRPCCaseFun{
+		node: node1.Name(),
+		fun:  exportCast,
+		args: []etf.Term{etf.Atom("casted")},
+		cast: true,
+	}
+	node2gs1.Send(node2gs1.Self(), case1)
+	waitForResultWithValue(t, casted, etf.Atom("casted"))
+}
@@ -0,0 +1,260 @@
+package tests
+
+// - Server code change
+//    suspended process keeps the messages until it's resumed
+//    CodeChange: the state is migrated, the new behavior handles the messages.
+//    supervisor restarts the child using the new behavior
+//    CodeChange with failed callback: the process keeps the old behavior
+//    ApplicationUpgrade: upgrade instructions of the new version are applied
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testCodeChangeV1 struct {
+	gen.Server
+}
+
+type testCodeChangeV2 struct {
+	gen.Server
+	fail bool
+}
+
+type testCodeChangeStateV2 struct {
+	count int
+}
+
+func (gs *testCodeChangeV1) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.State = 0
+	return nil
+}
+
+func (gs *testCodeChangeV1) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	process.State = process.State.(int) + 1
+	return gen.ServerStatusOK
+}
+
+func (gs *testCodeChangeV1) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	return fmt.Sprintf("v1:%d", process.State.(int)), nil
+}
+
+func (gs *testCodeChangeV1) Version() string {
+	return "1"
+}
+
+func (gs *testCodeChangeV2) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.State = testCodeChangeStateV2{}
+	return nil
+}
+
+func (gs *testCodeChangeV2) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	state := process.State.(testCodeChangeStateV2)
+	state.count += 10
+	process.State = state
+	return gen.ServerStatusOK
+}
+
+func (gs *testCodeChangeV2) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	return fmt.Sprintf("v2:%d", process.State.(testCodeChangeStateV2).count), nil
+}
+
+func (gs *testCodeChangeV2) Version() string {
+	return "2"
+}
+
+func (gs *testCodeChangeV2) CodeChange(process *gen.ServerProcess, oldVersion string, state interface{}) (interface{}, error) {
+	if gs.fail {
+		return nil, fmt.Errorf("failed")
+	}
+	if oldVersion != "1" {
+		return nil, fmt.Errorf("unknown version %q", oldVersion)
+	}
+	return testCodeChangeStateV2{count: state.(int)}, nil
+}
+
+type testCodeChangeApplication struct {
+	gen.Application
+}
+
+func (a *testCodeChangeApplication) Load(args ...etf.Term) (gen.ApplicationSpec, error) {
+	version := args[0].(string)
+	var child gen.ProcessBehavior = &testCodeChangeV1{}
+	upgrade := []gen.ApplicationUpgrade{}
+	if version == "v2" {
+		child = &testCodeChangeV2{}
+		upgrade = append(upgrade, gen.ApplicationUpgrade{
+			From: &testCodeChangeV1{},
+			To:   &testCodeChangeV2{},
+		})
+	}
+	return gen.ApplicationSpec{
+		Name:    "testCodeChangeApp",
+		Version: version,
+		Children: []gen.ApplicationChildSpec{
+			gen.ApplicationChildSpec{
+				Child: child,
+				Name:  "testCodeChangeAppGS",
+			},
+		},
+		Upgrade: upgrade,
+	}, nil
+}
+
+func (a *testCodeChangeApplication) Start(p gen.Process, args ...etf.Term) {
+}
+
+func TestServerCodeChange(t *testing.T) {
+	fmt.Printf("\n=== Test Server - code change\n")
+	fmt.Printf("Starting node nodeGSCodeChange@localhost: ")
+	node1, _ := ergo.StartNode("nodeGSCodeChange@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	get := func(p gen.Process, expected string) {
+		value, err := p.Direct(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Fatalf("expected %q, got %q", expected, value)
+		}
+	}
+	inc := func(p gen.Process) {
+		p.Send(p.Self(), etf.Tuple{etf.Atom("$gen_cast"), "inc"})
+	}
+
+	fmt.Printf("    starting processes: ")
+	gs, err := node1.Spawn("", gen.ProcessOptions{}, &testCodeChangeV1{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:  "testCodeChangeChild",
+				Child: &testCodeChangeV1{},
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	if _, err := node1.Spawn("", gen.ProcessOptions{}, &testSupervisorChildSpec{}, spec); err != nil {
+		t.Fatal(err)
+	}
+	child := node1.ProcessByName("testCodeChangeChild")
+	if child == nil {
+		t.Fatal("child is not started")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... suspended process must keep the messages until it's resumed: ")
+	if _, err := gs.Direct(gen.MessageDirectSuspend{}); err != nil {
+		t.Fatal(err)
+	}
+	inc(gs)
+	result := make(chan interface{}, 1)
+	go func() {
+		value, _ := gs.Direct(nil)
+		result <- value
+	}()
+	select {
+	case value := <-result:
+		t.Fatal("suspended process handled the request", value)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := gs.Direct(gen.MessageDirectResume{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case value := <-result:
+		// kept messages are handled in the order they came
+		if value != "v1:1" {
+			t.Fatal("expected v1:1, got", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result timeout")
+	}
+	get(gs, "v1:1")
+	fmt.Println("OK")
+
+	fmt.Printf("... CodeChange. state must be migrated: ")
+	if err := node1.CodeChange(&testCodeChangeV1{}, &testCodeChangeV2{}); err != nil {
+		t.Fatal(err)
+	}
+	get(gs, "v2:1")
+	inc(gs)
+	get(gs, "v2:11")
+	get(child, "v2:0")
+	if _, ok := gs.Behavior().(*testCodeChangeV2); !ok {
+		t.Fatalf("wrong behavior %#v", gs.Behavior())
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... supervisor must restart the child using the new behavior: ")
+	child.Exit("abnormal")
+	if err := child.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var restarted gen.Process
+	for i := 0; i < 10; i++ {
+		restarted = node1.ProcessByName("testCodeChangeChild")
+		if restarted != nil && restarted.Self() != child.Self() {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if restarted == nil || restarted.Self() == child.Self() {
+		t.Fatal("child is not restarted")
+	}
+	get(restarted, "v2:0")
+	fmt.Println("OK")
+
+	fmt.Printf("... CodeChange with failed callback (must fail). process keeps the behavior: ")
+	if err := node1.CodeChange(&testCodeChangeV2{}, &testCodeChangeV2{fail: true}); err == nil {
+		t.Fatal("expected error")
+	}
+	get(gs, "v2:11")
+	inc(gs)
+	get(gs, "v2:21")
+	fmt.Println("OK")
+
+	fmt.Printf("... ApplicationUpgrade: ")
+	if _, err := node1.ApplicationLoad(&testCodeChangeApplication{}, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node1.ApplicationStart("testCodeChangeApp"); err != nil {
+		t.Fatal(err)
+	}
+	appGS := node1.ProcessByName("testCodeChangeAppGS")
+	if appGS == nil {
+		t.Fatal("application child is not started")
+	}
+	inc(appGS)
+	get(appGS, "v1:1")
+	if err := node1.ApplicationUpgrade(&testCodeChangeApplication{}, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	get(appGS, "v2:1")
+	info, err := node1.ApplicationInfo("testCodeChangeApp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v2" {
+		t.Fatal("expected v2, got", info.Version)
+	}
+	fmt.Println("OK")
+}
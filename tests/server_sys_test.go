@@ -0,0 +1,320 @@
+package tests
+
+// - Server system messages (sys module)
+//    get_state, replace_state
+//    statistics, log, trace, no_debug
+//    suspend/resume: the messages are kept until the process is resumed
+//    suspend/resume: the kept messages are limited by the mailbox size (the rest are dropped)
+//    unknown system message (must fail)
+//    malformed debug options (must fail). the process keeps running
+//    supervisor: get_state, replace_state, suspend/resume
+//    remote process: get_state. state that can't be encoded is returned as a string
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testSysServer struct {
+	gen.Server
+}
+
+type testSysCaller struct {
+	gen.Server
+}
+
+type testSysState struct {
+	ch chan int
+}
+
+type testSysRequest func(process *gen.ServerProcess) (etf.Term, error)
+
+func (s *testSysServer) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	process.State = args[0]
+	return nil
+}
+
+func (s *testSysServer) HandleCast(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	process.State = process.State.(int) + 1
+	return gen.ServerStatusOK
+}
+
+func (s *testSysServer) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	return process.State, gen.ServerStatusOK
+}
+
+func (c *testSysCaller) HandleDirect(process *gen.ServerProcess, message interface{}) (interface{}, error) {
+	return message.(testSysRequest)(process)
+}
+
+func TestServerSys(t *testing.T) {
+	fmt.Printf("\n=== Test Server - system messages\n")
+	fmt.Printf("Starting nodes: nodeGSSys1@localhost, nodeGSSys2@localhost: ")
+	node1, _ := ergo.StartNode("nodeGSSys1@localhost", "cookies", node.Options{})
+	node2, _ := ergo.StartNode("nodeGSSys2@localhost", "cookies", node.Options{})
+	if node1 == nil || node2 == nil {
+		t.Fatal("can't start nodes")
+	}
+	defer node1.Stop()
+	defer node2.Stop()
+	fmt.Println("OK")
+
+	target, err := node1.Spawn("sysTarget", gen.ProcessOptions{}, &testSysServer{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller, err := node1.Spawn("", gen.ProcessOptions{}, &testSysCaller{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(request testSysRequest) etf.Term {
+		value, err := caller.Direct(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	check := func(request testSysRequest, expected etf.Term) {
+		if value := call(request); !reflect.DeepEqual(value, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, value)
+		}
+	}
+	getState := func(to interface{}) testSysRequest {
+		return func(p *gen.ServerProcess) (etf.Term, error) {
+			return p.SysGetState(to)
+		}
+	}
+	inc := func() {
+		caller.Send(target.Self(), etf.Tuple{etf.Atom("$gen_cast"), "inc"})
+	}
+
+	fmt.Printf("... get_state, replace_state: ")
+	check(getState(target.Self()), 1)
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysReplaceState("sysTarget", func(state interface{}) interface{} {
+			return state.(int) + 100
+		})
+	}, 101)
+	check(getState(target.Self()), 101)
+	fmt.Println("OK")
+
+	fmt.Printf("... statistics: ")
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysStatistics(target.Self(), etf.Atom("get"))
+	}, etf.Atom("no_statistics"))
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysStatistics(target.Self(), true)
+	}, etf.Atom("ok"))
+	inc()
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.Call(target.Self(), "get")
+	}, 102)
+	stats := call(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysStatistics(target.Self(), etf.Atom("get"))
+	})
+	expected := map[etf.Atom]etf.Term{
+		"messages_in":  uint64(2),
+		"messages_out": uint64(1),
+	}
+	for _, s := range stats.(etf.Tuple).Element(2).(etf.List) {
+		stat := s.(etf.Tuple)
+		if value, ok := expected[stat.Element(1).(etf.Atom)]; ok && value != stat.Element(2) {
+			t.Fatalf("%s: expected %v, got %v", stat.Element(1), value, stat.Element(2))
+		}
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... log, trace, no_debug: ")
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysLog(target.Self(), etf.Tuple{true, 1})
+	}, etf.Atom("ok"))
+	inc()
+	inc()
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysLog(target.Self(), etf.Atom("get"))
+	}, etf.Tuple{etf.Atom("ok"), etf.List{"got cast inc"}})
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysTrace(target.Self(), false)
+	}, nil)
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysNoDebug(target.Self())
+	}, nil)
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysLog(target.Self(), etf.Atom("get"))
+	}, etf.Tuple{etf.Atom("ok"), etf.List{}})
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysStatistics(target.Self(), etf.Atom("get"))
+	}, etf.Atom("no_statistics"))
+	fmt.Println("OK")
+
+	fmt.Printf("... suspend/resume. messages must be kept until the process is resumed: ")
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysSuspend(target.Self())
+	}, nil)
+	inc()
+	check(getState(target.Self()), 104)
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysResume(target.Self())
+	}, nil)
+	check(getState(target.Self()), 105)
+	fmt.Println("OK")
+
+	fmt.Printf("... suspend/resume. kept messages are limited by the mailbox size: ")
+	small, err := node1.Spawn("", gen.ProcessOptions{MailboxSize: 2}, &testSysServer{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysSuspend(small.Self())
+	}, nil)
+	for i := 0; i < 5; i++ {
+		caller.Send(small.Self(), etf.Tuple{etf.Atom("$gen_cast"), "inc"})
+		// let the process read the mailbox
+		check(getState(small.Self()), 0)
+	}
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysResume(small.Self())
+	}, nil)
+	check(getState(small.Self()), 2)
+	fmt.Println("OK")
+
+	fmt.Printf("... unknown system message (must fail): ")
+	if _, err := caller.Direct(testSysRequest(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysStatistics(target.Self(), etf.Atom("unknown"))
+	})); err != gen.ErrUnsupportedRequest {
+		t.Fatal("expected", gen.ErrUnsupportedRequest, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... malformed debug options (must fail). the process keeps running: ")
+	for _, flag := range []etf.Term{etf.Tuple{true}, etf.Tuple{}, etf.Tuple{true, "10"}, etf.Tuple{true, 0}} {
+		if _, err := caller.Direct(testSysRequest(func(p *gen.ServerProcess) (etf.Term, error) {
+			return p.SysLog(target.Self(), flag)
+		})); err != gen.ErrUnsupportedRequest {
+			t.Fatal("expected", gen.ErrUnsupportedRequest, "got", err)
+		}
+	}
+	check(getState(target.Self()), 105)
+	fmt.Println("OK")
+
+	fmt.Printf("... supervisor get_state, replace_state, suspend/resume: ")
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:  "sysChild",
+				Child: &testSysServer{},
+				Args:  []etf.Term{0},
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	sup, err := node1.Spawn("", gen.ProcessOptions{}, &testSupervisorChildSpec{}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sysChild := node1.ProcessByName("sysChild")
+	children := etf.List{
+		etf.Tuple{etf.Atom("sysChild"), sysChild.Self(), etf.Atom("worker"), etf.List{etf.Atom("testSysServer")}},
+	}
+	check(getState(sup.Self()), etf.Tuple{etf.Atom("state"), etf.Atom("one_for_one"), 10, 5, children})
+	replaceState := func(fun gen.SysReplaceStateFun) testSysRequest {
+		return func(p *gen.ServerProcess) (etf.Term, error) {
+			return p.SysReplaceState(sup.Self(), fun)
+		}
+	}
+	check(replaceState(func(state interface{}) interface{} {
+		s := append(etf.Tuple{}, state.(etf.Tuple)...)
+		s[1] = etf.Atom("rest_for_one")
+		s[2] = 20
+		return s
+	}), etf.Tuple{etf.Atom("state"), etf.Atom("rest_for_one"), 20, 5, children})
+	// children can't be replaced, strategy can't be changed to simple_one_for_one
+	for _, change := range []func(s etf.Tuple){
+		func(s etf.Tuple) { s[4] = etf.List{} },
+		func(s etf.Tuple) { s[1] = etf.Atom("simple_one_for_one") },
+		func(s etf.Tuple) { s[2] = 1 << 16 },
+	} {
+		change := change
+		if _, err := caller.Direct(replaceState(func(state interface{}) interface{} {
+			s := append(etf.Tuple{}, state.(etf.Tuple)...)
+			change(s)
+			return s
+		})); err == nil {
+			t.Fatal("malformed supervisor state is accepted")
+		}
+	}
+	check(getState(sup.Self()), etf.Tuple{etf.Atom("state"), etf.Atom("rest_for_one"), 20, 5, children})
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysSuspend(sup.Self())
+	}, nil)
+	child := node1.ProcessByName("sysChild")
+	child.Exit("abnormal")
+	if err := child.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if restarted := node1.ProcessByName("sysChild"); restarted != nil {
+		t.Fatal("suspended supervisor restarted the child")
+	}
+	check(func(p *gen.ServerProcess) (etf.Term, error) {
+		return nil, p.SysResume(sup.Self())
+	}, nil)
+	var restarted gen.Process
+	for i := 0; i < 10; i++ {
+		if restarted = node1.ProcessByName("sysChild"); restarted != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if restarted == nil {
+		t.Fatal("child is not restarted")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... get_state of the remote process: ")
+	remoteCaller, err := node2.Spawn("", gen.ProcessOptions{}, &testSysCaller{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := remoteCaller.Direct(getState(gen.ProcessID{Name: "sysTarget", Node: node1.Name()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 105 {
+		t.Fatal("expected 105, got", value)
+	}
+	// the integer above 255 is decoded as int64
+	value, err = remoteCaller.Direct(testSysRequest(func(p *gen.ServerProcess) (etf.Term, error) {
+		return p.SysLog(gen.ProcessID{Name: "sysTarget", Node: node1.Name()}, etf.Tuple{true, 1000})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != etf.Atom("ok") {
+		t.Fatal("expected ok, got", value)
+	}
+	_, err = node1.Spawn("sysTargetChan", gen.ProcessOptions{}, &testSysServer{}, testSysState{ch: make(chan int)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err = remoteCaller.Direct(getState(gen.ProcessID{Name: "sysTargetChan", Node: node1.Name()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := value.(string); !ok {
+		t.Fatalf("expected string, got %#v", value)
+	}
+	fmt.Println("OK")
+}
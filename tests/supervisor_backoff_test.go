@@ -0,0 +1,194 @@
+package tests
+
+// - Supervisor
+
+// - backoff (one for one)
+//    start supervisor with gs1 (backoff min 100ms), gs2 (no backoff)
+//    gs1.stop(abnormal) -> circuit is open, restarted in 100ms -> circuit is half open
+//    gs1.stop(abnormal) -> restarted in 200ms, gs2.stop(abnormal) -> restarted immediately
+
+// - backoff (one for all)
+//    gs1.stop(abnormal) -> gs1, gs2 are restarted together after the delay
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestSupervisorBackoff(t *testing.T) {
+	fmt.Printf("\n=== Test Supervisor - backoff\n")
+	fmt.Printf("Starting node nodeSvBackoff@localhost: ")
+	node1, _ := ergo.StartNode("nodeSvBackoff@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	child := func(order int) gen.SupervisorChildSpec {
+		return gen.SupervisorChildSpec{
+			Name:  fmt.Sprintf("testGS%d", order+1),
+			Child: &testSupervisorChildGenServer{},
+			Args:  []etf.Term{ch, order},
+		}
+	}
+	waitTerminated := func(order int) {
+		select {
+		case m := <-ch:
+			if m != (testMessageTerminatedReason{order: order, reason: "abnormal"}) {
+				t.Fatalf("wrong message %#v", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	waitStarted := func(order int) etf.Pid {
+		select {
+		case m := <-ch:
+			started, ok := m.(testMessageStarted)
+			if !ok || started.order != order {
+				t.Fatalf("wrong message %#v", m)
+			}
+			return started.pid
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+		return etf.Pid{}
+	}
+	backoff := gen.SupervisorBackoff{
+		Min:   100 * time.Millisecond,
+		Max:   time.Second,
+		Reset: 5 * time.Second,
+	}
+
+	fmt.Printf("Starting supervisor (one for one) with backoff for gs1... ")
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0), child(1)},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	spec.Children[0].Backoff = backoff
+	sv := &testSupervisorChildSpec{}
+	processSV, err := node1.Spawn("testSupervisorBackoff", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := waitNeventsSupervisorChildSpec(ch, 2, make([]etf.Pid, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	for i, delay := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		fmt.Printf("... stopping gs1 with 'abnormal' reason (failure %d). must be restarted in %s: ", i+1, delay)
+		started := time.Now()
+		processSV.Send(children[0], "abnormal")
+		waitTerminated(0)
+		which, err := sv.WhichChildren(processSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if which[0].Circuit != gen.SupervisorChildCircuitOpen || which[0].Restarting == false ||
+			which[0].Failures != i+1 || which[0].RestartAt.IsZero() {
+			t.Fatalf("wrong result %#v", which[0])
+		}
+		if which[1].Circuit != gen.SupervisorChildCircuitClosed {
+			t.Fatalf("wrong result %#v", which[1])
+		}
+		children[0] = waitStarted(0)
+		if elapsed := time.Since(started); elapsed < delay {
+			t.Fatalf("restarted in %s", elapsed)
+		}
+		which, _ = sv.WhichChildren(processSV)
+		if which[0].Circuit != gen.SupervisorChildCircuitHalfOpen || which[0].Process.Self() != children[0] {
+			t.Fatalf("wrong result %#v", which[0])
+		}
+		fmt.Println("OK")
+	}
+
+	fmt.Printf("... stopping gs2 with 'abnormal' reason. must be restarted immediately: ")
+	started := time.Now()
+	processSV.Send(children[1], "abnormal")
+	waitTerminated(1)
+	children[1] = waitStarted(1)
+	if elapsed := time.Since(started); elapsed > 50*time.Millisecond {
+		t.Fatalf("restarted in %s", elapsed)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... terminating gs1 while it is waiting for the restart: ")
+	processSV.Send(children[0], "abnormal")
+	waitTerminated(0)
+	if err := sv.TerminateChild(processSV, "testGS1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = waitNeventsSupervisorChildSpec(ch, 0, children); err != nil {
+		t.Fatal("must not be restarted", err)
+	}
+	processSV.Exit("normal")
+	if _, err := waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor (one for all) with backoff... ")
+	spec.Strategy.Type = gen.SupervisorStrategyOneForAll
+	spec.Strategy.Backoff = backoff
+	spec.Children = []gen.SupervisorChildSpec{child(0), child(1)}
+	processSV, err = node1.Spawn("testSupervisorBackoff", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err = waitNeventsSupervisorChildSpec(ch, 2, make([]etf.Pid, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping gs1 with 'abnormal' reason. all children must be restarted after the delay: ")
+	started = time.Now()
+	processSV.Send(children[0], "abnormal")
+	// gs1 and gs2 are terminated
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-ch:
+			if _, ok := m.(testMessageTerminatedReason); !ok {
+				t.Fatalf("wrong message %#v", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	children1 := []etf.Pid{waitStarted(0), waitStarted(1)}
+	statuses := []string{"new", "new"}
+	if !checkExpectedChildrenStatus(children, children1, statuses) {
+		t.Fatalf("expected %v. old: %v new: %v", statuses, children, children1)
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Fatalf("restarted in %s", elapsed)
+	}
+	fmt.Println("OK")
+	processSV.Exit("normal")
+	if _, err := waitNeventsSupervisorChildSpec(ch, 2, children1); err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Printf("Starting supervisor with wrong backoff options (must fail)... ")
+	spec.Strategy.Backoff.Jitter = 2
+	if _, err := node1.Spawn("testSupervisorBackoff", gen.ProcessOptions{}, sv, spec); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,322 @@
+package tests
+
+// - Supervisor
+
+// - per-child restart type
+//    start supervisor (one for one, permanent) with gs1 (permanent), gs2 (temporary), gs3 (transient)
+//    gs1,gs2,gs3.stop(normal) (sv1 restarting gs1 only)
+
+// - shutdown
+//    start supervisor with gs1 (brutal kill), gs2 (default), gs3 (timeout)
+//    stop supervisor: gs3 (traps exit and ignores it) is killed once the timeout is exceeded,
+//                     gs2 is terminated gracefully, gs1 is killed
+
+// - auto shutdown
+//    any_significant: gs2 (significant, transient) stop(normal) -> supervisor stops
+//    all_significant: gs2, gs3 (significant, temporary) stop(normal) -> supervisor stops
+//                     once both of them have terminated
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testSupervisorChildSpec struct {
+	gen.Supervisor
+}
+
+type testSupervisorChildGenServer struct {
+	gen.Server
+}
+
+type testSupervisorChildState struct {
+	ch    chan interface{}
+	order int
+}
+
+type testMessageTerminatedReason struct {
+	order  int
+	reason string
+}
+
+func (tgs *testSupervisorChildGenServer) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	st := &testSupervisorChildState{
+		ch:    args[0].(chan interface{}),
+		order: args[1].(int),
+	}
+	if len(args) > 2 {
+		// ignore exit signals
+		process.SetTrapExit(args[2].(bool))
+	}
+	process.State = st
+	st.ch <- testMessageStarted{
+		pid:   process.Self(),
+		name:  process.Name(),
+		order: st.order,
+	}
+	return nil
+}
+
+func (tgs *testSupervisorChildGenServer) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	if _, ok := message.(gen.MessageExit); ok {
+		return gen.ServerStatusOK
+	}
+	return gen.ServerStatusStopWithReason(message.(string))
+}
+
+func (tgs *testSupervisorChildGenServer) Terminate(process *gen.ServerProcess, reason string) {
+	st := process.State.(*testSupervisorChildState)
+	st.ch <- testMessageTerminatedReason{
+		order:  st.order,
+		reason: reason,
+	}
+}
+
+func (ts *testSupervisorChildSpec) Init(args ...etf.Term) (gen.SupervisorSpec, error) {
+	return args[0].(gen.SupervisorSpec), nil
+}
+
+func TestSupervisorChildSpec(t *testing.T) {
+	fmt.Printf("\n=== Test Supervisor - child spec\n")
+	fmt.Printf("Starting node nodeSvChildSpec@localhost: ")
+	node1, _ := ergo.StartNode("nodeSvChildSpec@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	child := func(order int, args ...etf.Term) gen.SupervisorChildSpec {
+		return gen.SupervisorChildSpec{
+			Name:  fmt.Sprintf("testGS%d", order+1),
+			Child: &testSupervisorChildGenServer{},
+			Args:  append([]etf.Term{ch, order}, args...),
+		}
+	}
+	strategy := gen.SupervisorStrategy{
+		Type:      gen.SupervisorStrategyOneForOne,
+		Intensity: 10,
+		Period:    5,
+		Restart:   gen.SupervisorStrategyRestartPermanent,
+	}
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor with permanent, temporary and transient children... ")
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0), child(1), child(2)},
+		Strategy: strategy,
+	}
+	spec.Children[1].Restart = gen.SupervisorStrategyRestartTemporary
+	spec.Children[2].Restart = gen.SupervisorStrategyRestartTransient
+	sv := &testSupervisorChildSpec{}
+	processSV, err := node1.Spawn("testSupervisorChildRestart", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := make([]etf.Pid, 3)
+	children, err = waitNeventsSupervisorChildSpec(ch, 3, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping children with 'normal' reason. only the permanent one must be restarted... ")
+	for i := range children {
+		processSV.Send(children[i], "normal")
+	}
+	// 3 terminates and 1 start
+	children1, err := waitNeventsSupervisorChildSpec(ch, 4, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := []string{"new", "empty", "empty"}
+	if !checkExpectedChildrenStatus(children, children1, statuses) {
+		t.Fatalf("expected %v. old: %v new: %v", statuses, children, children1)
+	}
+	fmt.Println("OK")
+	processSV.Exit("normal")
+	if _, err := waitNeventsSupervisorChildSpec(ch, 1, children1); err != nil {
+		t.Fatal(err)
+	}
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor with brutal kill, default and timeout shutdown children... ")
+	spec = gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			child(0),
+			child(1),
+			child(2, true),
+		},
+		Strategy: strategy,
+	}
+	spec.Children[0].Shutdown = gen.SupervisorShutdownBrutalKill
+	spec.Children[2].Shutdown = 200 * time.Millisecond
+	processSV, err = node1.Spawn("testSupervisorChildShutdown", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = waitNeventsSupervisorChildSpec(ch, 3, make([]etf.Pid, 3)); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping supervisor. the child ignoring exit must be killed after the timeout... ")
+	started := time.Now()
+	processSV.Exit("shutdown")
+	if err := processSV.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal("supervisor hasn't been stopped in time")
+	}
+	if time.Since(started) < 200*time.Millisecond {
+		t.Fatal("shutdown timeout is not respected")
+	}
+	reasons := make(map[int]string)
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-ch:
+			r := m.(testMessageTerminatedReason)
+			reasons[r.order] = r.reason
+		case <-time.After(time.Second):
+			t.Fatal("result timeout")
+		}
+	}
+	expected := map[int]string{0: "kill", 1: "shutdown", 2: "kill"}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Fatalf("expected %v, got %v", expected, reasons)
+	}
+	fmt.Println("OK")
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor with auto shutdown 'any_significant'... ")
+	spec = gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0), child(1), child(2)},
+		Strategy: strategy,
+	}
+	spec.Strategy.AutoShutdown = gen.SupervisorAutoShutdownAnySignificant
+	spec.Children[1].Restart = gen.SupervisorStrategyRestartTransient
+	spec.Children[1].Significant = true
+	processSV, err = node1.Spawn("testSupervisorChildAny", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err = waitNeventsSupervisorChildSpec(ch, 3, make([]etf.Pid, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping significant child with 'abnormal' reason. it must be restarted... ")
+	processSV.Send(children[1], "abnormal")
+	children1, err = waitNeventsSupervisorChildSpec(ch, 2, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses = []string{"old", "new", "old"}
+	if !checkExpectedChildrenStatus(children, children1, statuses) || !processSV.IsAlive() {
+		t.Fatalf("expected %v. old: %v new: %v", statuses, children, children1)
+	}
+	children = children1
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping significant child with 'normal' reason. supervisor must be stopped... ")
+	processSV.Send(children[1], "normal")
+	if err := processSV.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal("supervisor hasn't been stopped")
+	}
+	if _, err := waitNeventsSupervisorChildSpec(ch, 3, children); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor with auto shutdown 'all_significant'... ")
+	spec = gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0), child(1), child(2)},
+		Strategy: strategy,
+	}
+	spec.Strategy.AutoShutdown = gen.SupervisorAutoShutdownAllSignificant
+	for i := 1; i < 3; i++ {
+		spec.Children[i].Restart = gen.SupervisorStrategyRestartTemporary
+		spec.Children[i].Significant = true
+	}
+	processSV, err = node1.Spawn("testSupervisorChildAll", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err = waitNeventsSupervisorChildSpec(ch, 3, make([]etf.Pid, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping the first significant child. supervisor must keep working... ")
+	processSV.Send(children[1], "abnormal")
+	if _, err := waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	if !processSV.IsAlive() {
+		t.Fatal("supervisor has been stopped")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping the last significant child. supervisor must be stopped... ")
+	processSV.Send(children[2], "normal")
+	if err := processSV.WaitWithTimeout(time.Second); err != nil {
+		t.Fatal("supervisor hasn't been stopped")
+	}
+	if _, err := waitNeventsSupervisorChildSpec(ch, 2, children); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor with significant permanent child (must fail)... ")
+	spec = gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0)},
+		Strategy: strategy,
+	}
+	spec.Strategy.AutoShutdown = gen.SupervisorAutoShutdownAnySignificant
+	spec.Children[0].Significant = true
+	if _, err := node1.Spawn("testSupervisorChildWrong", gen.ProcessOptions{}, sv, spec); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("Starting supervisor with significant child and auto shutdown 'never' (must fail)... ")
+	spec.Strategy.AutoShutdown = gen.SupervisorAutoShutdownNever
+	spec.Children[0].Restart = gen.SupervisorStrategyRestartTransient
+	if _, err := node1.Spawn("testSupervisorChildWrong", gen.ProcessOptions{}, sv, spec); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+}
+
+func waitNeventsSupervisorChildSpec(ch chan interface{}, n int, children []etf.Pid) ([]etf.Pid, error) {
+	childrenNew := make([]etf.Pid, len(children))
+	copy(childrenNew, children)
+	for i := 0; i < n+1; i++ {
+		select {
+		case c := <-ch:
+			switch child := c.(type) {
+			case testMessageTerminatedReason:
+				childrenNew[child.order] = etf.Pid{}
+			case testMessageStarted:
+				childrenNew[child.order] = child.pid
+			}
+
+		case <-time.After(300 * time.Millisecond):
+			if i == n {
+				return childrenNew, nil
+			}
+			return childrenNew, fmt.Errorf("expected %d events, but got %d. TIMEOUT", n, i)
+		}
+	}
+	return childrenNew, fmt.Errorf("expected %d events, but got %d. ", n, n+1)
+}
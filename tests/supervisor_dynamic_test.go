@@ -0,0 +1,299 @@
+package tests
+
+// - Supervisor
+
+// - dynamic children (one for one)
+//    start supervisor with gs1, gs2
+//    which_children, count_children
+//    terminate_child gs1 (must not be restarted), restart_child gs1, delete_child gs1
+//    start_child with a new spec gs3, start_child gs2 (a new unnamed instance)
+//    the same requests made by Erlang's supervisor module ($gen_call)
+
+// - dynamic children (simple one for one)
+//    start_child gs1 twice (the name is kept), terminate_child by pid
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+func TestSupervisorDynamicChildren(t *testing.T) {
+	fmt.Printf("\n=== Test Supervisor - dynamic children\n")
+	fmt.Printf("Starting node nodeSvDynamic@localhost: ")
+	node1, _ := ergo.StartNode("nodeSvDynamic@localhost", "cookies", node.Options{})
+	if node1 == nil {
+		t.Fatal("can't start node")
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	ch := make(chan interface{}, 10)
+	child := func(order int) gen.SupervisorChildSpec {
+		return gen.SupervisorChildSpec{
+			Name:  fmt.Sprintf("testGS%d", order+1),
+			Child: &testSupervisorChildGenServer{},
+			Args:  []etf.Term{ch, order},
+		}
+	}
+
+	fmt.Printf("Starting supervisor (one for one) with 2 children... ")
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{child(0), child(1)},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	sv := &testSupervisorChildSpec{}
+	processSV, err := node1.Spawn("testSupervisorDynamic", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := waitNeventsSupervisorChildSpec(ch, 2, make([]etf.Pid, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... WhichChildren and CountChildren: ")
+	which, err := sv.WhichChildren(processSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(which) != 2 || which[0].Name != "testGS1" || which[0].Process.Self() != children[0] ||
+		which[1].Name != "testGS2" || which[1].Process.Self() != children[1] ||
+		which[1].Type != gen.SupervisorChildTypeWorker {
+		t.Fatalf("wrong result %#v", which)
+	}
+	count, err := sv.CountChildren(processSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != (gen.SupervisorChildrenCount{Specs: 2, Active: 2, Workers: 2}) {
+		t.Fatalf("wrong result %#v", count)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... TerminateChild 'testGS1'. must not be restarted: ")
+	if err := sv.TerminateChild(processSV, "testGS1"); err != nil {
+		t.Fatal(err)
+	}
+	children, err = waitNeventsSupervisorChildSpec(ch, 1, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children[0] != (etf.Pid{}) {
+		t.Fatal("child has been restarted")
+	}
+	which, _ = sv.WhichChildren(processSV)
+	if which[0].Process != nil || which[0].Restarting {
+		t.Fatalf("wrong result %#v", which[0])
+	}
+	if err := sv.TerminateChild(processSV, "unknown"); err != gen.ErrSupervisorChildNotFound {
+		t.Fatal("expected", gen.ErrSupervisorChildNotFound, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... RestartChild 'testGS1': ")
+	p, err := sv.RestartChild(processSV, "testGS1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err = waitNeventsSupervisorChildSpec(ch, 1, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children[0] != p.Self() || node1.ProcessByName("testGS1") == nil {
+		t.Fatal("wrong process", children[0], p.Self())
+	}
+	if _, err := sv.RestartChild(processSV, "testGS1"); err != gen.ErrSupervisorChildRunning {
+		t.Fatal("expected", gen.ErrSupervisorChildRunning, "got", err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... DeleteChild 'testGS1': ")
+	if err := sv.DeleteChild(processSV, "testGS1"); err != gen.ErrSupervisorChildRunning {
+		t.Fatal("expected", gen.ErrSupervisorChildRunning, "got", err)
+	}
+	sv.TerminateChild(processSV, "testGS1")
+	if children, err = waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.DeleteChild(processSV, "testGS1"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := sv.CountChildren(processSV); count.Specs != 1 {
+		t.Fatalf("wrong result %#v", count)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... StartChild with spec 'testGS3': ")
+	p, err = sv.StartChild(processSV, child(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children, err = waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	if children[2] != p.Self() || node1.ProcessByName("testGS3") == nil {
+		t.Fatal("wrong process", children[2], p.Self())
+	}
+	if _, err := sv.StartChild(processSV, child(2)); err != gen.ErrSupervisorChildPresent {
+		t.Fatal("expected", gen.ErrSupervisorChildPresent, "got", err)
+	}
+	wrong := child(3)
+	wrong.Restart = "unknown"
+	if _, err := sv.StartChild(processSV, wrong); err == nil {
+		t.Fatal("expected error")
+	}
+	// must be restarted by the supervisor
+	processSV.Send(children[2], "abnormal")
+	if children, err = waitNeventsSupervisorChildSpec(ch, 2, children); err != nil {
+		t.Fatal(err)
+	}
+	if children[2] == p.Self() || children[2] == (etf.Pid{}) {
+		t.Fatal("child hasn't been restarted")
+	}
+	fmt.Println("OK")
+
+	// ===================================================================================================
+	fmt.Printf("... supervisor:which_children (Erlang's $gen_call): ")
+	gs := &testServer{
+		res: make(chan interface{}, 2),
+	}
+	processGS, err := node1.Spawn("gsDynamic", gen.ProcessOptions{}, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(message etf.Term) etf.Term {
+		result, err := processGS.Direct(makeCall{processSV.Self(), message})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	expected := etf.Term(etf.List{
+		etf.Tuple{etf.Atom("testGS2"), children[1], etf.Atom("worker"), etf.List{etf.Atom("testSupervisorChildGenServer")}},
+		etf.Tuple{etf.Atom("testGS3"), children[2], etf.Atom("worker"), etf.List{etf.Atom("testSupervisorChildGenServer")}},
+	})
+	if result := call(etf.Atom("which_children")); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v got %#v", expected, result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... supervisor:count_children (Erlang's $gen_call): ")
+	expected = etf.List{
+		etf.Tuple{etf.Atom("specs"), 2},
+		etf.Tuple{etf.Atom("active"), 2},
+		etf.Tuple{etf.Atom("supervisors"), 0},
+		etf.Tuple{etf.Atom("workers"), 2},
+	}
+	if result := call(etf.Atom("count_children")); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v got %#v", expected, result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... supervisor:terminate_child, restart_child and delete_child (Erlang's $gen_call): ")
+	if result := call(etf.Tuple{etf.Atom("terminate_child"), etf.Atom("testGS2")}); result != etf.Atom("ok") {
+		t.Fatal("wrong result", result)
+	}
+	if children, err = waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	result := call(etf.Tuple{etf.Atom("restart_child"), etf.Atom("testGS2")})
+	if children, err = waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, etf.Tuple{etf.Atom("ok"), children[1]}) {
+		t.Fatal("wrong result", result)
+	}
+	expected = etf.Tuple{etf.Atom("error"), etf.Atom("running")}
+	if result := call(etf.Tuple{etf.Atom("delete_child"), etf.Atom("testGS2")}); !reflect.DeepEqual(result, expected) {
+		t.Fatal("wrong result", result)
+	}
+	expected = etf.Tuple{etf.Atom("error"), etf.Atom("not_found")}
+	if result := call(etf.Tuple{etf.Atom("restart_child"), etf.Atom("unknown")}); !reflect.DeepEqual(result, expected) {
+		t.Fatal("wrong result", result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... StartChild 'testGS2' by name starts a new unnamed instance: ")
+	p, err = sv.StartChild(processSV, "testGS2", ch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children, err = waitNeventsSupervisorChildSpec(ch, 1, children); err != nil {
+		t.Fatal(err)
+	}
+	if children[0] != p.Self() || children[1] == p.Self() {
+		t.Fatal("wrong process", children[0], p.Self())
+	}
+	which, _ = sv.WhichChildren(processSV)
+	if len(which) != 3 || which[2].Name != "" || which[2].Process.Self() != p.Self() {
+		t.Fatalf("wrong result %#v", which)
+	}
+	fmt.Println("OK")
+	processSV.Exit("normal")
+	if _, err := waitNeventsSupervisorChildSpec(ch, 3, children); err != nil {
+		t.Fatal(err)
+	}
+
+	// ===================================================================================================
+	fmt.Printf("Starting supervisor (simple one for one)... ")
+	spec.Strategy.Type = gen.SupervisorStrategySimpleOneForOne
+	spec.Children = []gen.SupervisorChildSpec{child(0)}
+	processSV, err = node1.Spawn("testSupervisorDynamic", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... StartChild 'testGS1' twice: ")
+	p1, err := sv.StartChild(processSV, "testGS1", ch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := sv.StartChild(processSV, "testGS1", ch, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children, err = waitNeventsSupervisorChildSpec(ch, 2, make([]etf.Pid, 3)); err != nil {
+		t.Fatal(err)
+	}
+	which, _ = sv.WhichChildren(processSV)
+	if len(which) != 2 || which[0].Name != "testGS1" || which[1].Name != "testGS1" ||
+		which[0].Process.Self() != p1.Self() || which[1].Process.Self() != p2.Self() {
+		t.Fatalf("wrong result %#v", which)
+	}
+	expected = etf.Tuple{etf.Atom("error"), etf.Atom("simple_one_for_one")}
+	if result := call(etf.Tuple{etf.Atom("delete_child"), etf.Atom("testGS1")}); !reflect.DeepEqual(result, expected) {
+		t.Fatal("wrong result", result)
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... TerminateChild by pid: ")
+	if err := sv.TerminateChild(processSV, "testGS1"); err != gen.ErrSupervisorChildNotFound {
+		t.Fatal("expected", gen.ErrSupervisorChildNotFound, "got", err)
+	}
+	if err := sv.TerminateChild(processSV, p1.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if result := call(etf.Tuple{etf.Atom("terminate_child"), p2.Self()}); result != etf.Atom("ok") {
+		t.Fatal("wrong result", result)
+	}
+	if _, err = waitNeventsSupervisorChildSpec(ch, 2, children); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := sv.CountChildren(processSV); count != (gen.SupervisorChildrenCount{}) {
+		t.Fatalf("wrong result %#v", count)
+	}
+	fmt.Println("OK")
+}
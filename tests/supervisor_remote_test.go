@@ -0,0 +1,179 @@
+package tests
+
+// - Supervisor
+
+// - remote children
+//    start node1 (supervisor), node2, node3
+//    start supervisor (one for one) with gs1 (node2), gs2 (node3, failover: node2)
+//    gs1.stop(abnormal) -> restarted on node2
+//    node3.stop -> gs2 is restarted on node2 (noconnection)
+//    terminate_child gs1 -> remote process is terminated with 'shutdown' (waits for it)
+//    restart_child gs1 -> restarted on node2 with the same name
+//    supervisor.stop(shutdown) -> gs2, gs1 are terminated with 'shutdown' (reverse order)
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testSupervisorRemoteGS struct {
+	gen.Server
+	ch chan interface{}
+}
+
+func (tgs *testSupervisorRemoteGS) Init(process *gen.ServerProcess, args ...etf.Term) error {
+	order := args[0].(int)
+	process.State = order
+	tgs.ch <- testMessageStarted{
+		pid:   process.Self(),
+		name:  process.Name(),
+		order: order,
+	}
+	return nil
+}
+
+func (tgs *testSupervisorRemoteGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	return gen.ServerStatusStopWithReason(message.(string))
+}
+
+func (tgs *testSupervisorRemoteGS) Terminate(process *gen.ServerProcess, reason string) {
+	tgs.ch <- testMessageTerminatedReason{
+		order:  process.State.(int),
+		reason: reason,
+	}
+}
+
+func TestSupervisorRemoteChildren(t *testing.T) {
+	fmt.Printf("\n=== Test Supervisor - remote children\n")
+	fmt.Printf("Starting nodes nodeSvRemote1@localhost, nodeSvRemote2@localhost, nodeSvRemote3@localhost: ")
+	node1, _ := ergo.StartNode("nodeSvRemote1@localhost", "cookies", node.Options{})
+	node2, _ := ergo.StartNode("nodeSvRemote2@localhost", "cookies", node.Options{})
+	node3, _ := ergo.StartNode("nodeSvRemote3@localhost", "cookies", node.Options{})
+	if node1 == nil || node2 == nil || node3 == nil {
+		t.Fatal("can't start nodes")
+	}
+	defer node1.Stop()
+	defer node2.Stop()
+	defer node3.Stop()
+
+	ch := make(chan interface{}, 10)
+	node2.ProvideRemoteSpawn("gs", &testSupervisorRemoteGS{ch: ch})
+	node3.ProvideRemoteSpawn("gs", &testSupervisorRemoteGS{ch: ch})
+	fmt.Println("OK")
+
+	waitEvent := func(expected interface{}) interface{} {
+		select {
+		case m := <-ch:
+			switch e := expected.(type) {
+			case testMessageStarted:
+				started, ok := m.(testMessageStarted)
+				if !ok || started.order != e.order || started.pid.Node != e.pid.Node {
+					t.Fatalf("expected %#v, got %#v", expected, m)
+				}
+			default:
+				if m != expected {
+					t.Fatalf("expected %#v, got %#v", expected, m)
+				}
+			}
+			return m
+		case <-time.After(3 * time.Second):
+			t.Fatal("result timeout")
+		}
+		return nil
+	}
+	startedOn := func(order int, n node.Node) testMessageStarted {
+		return testMessageStarted{order: order, pid: etf.Pid{Node: etf.Atom(n.Name())}}
+	}
+
+	fmt.Printf("Starting supervisor with remote children gs1 (node2), gs2 (node3, failover: node2)... ")
+	spec := gen.SupervisorSpec{
+		Children: []gen.SupervisorChildSpec{
+			{
+				Name:           "gs1",
+				Node:           node2.Name(),
+				RemoteBehavior: "gs",
+				Args:           []etf.Term{0},
+			},
+			{
+				Name:           "gs2",
+				Node:           node3.Name(),
+				FailoverNodes:  []string{node2.Name()},
+				RemoteBehavior: "gs",
+				Args:           []etf.Term{1},
+			},
+		},
+		Strategy: gen.SupervisorStrategy{
+			Type:      gen.SupervisorStrategyOneForOne,
+			Intensity: 10,
+			Period:    5,
+			Restart:   gen.SupervisorStrategyRestartPermanent,
+		},
+	}
+	sv := &testSupervisorChildSpec{}
+	processSV, err := node1.Spawn("testSupervisorRemote", gen.ProcessOptions{}, sv, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs1 := waitEvent(startedOn(0, node2)).(testMessageStarted)
+	waitEvent(startedOn(1, node3))
+	which, err := sv.WhichChildren(processSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if which[0].Pid != gs1.pid || which[0].Process != nil || node2.ProcessByName("gs1") == nil {
+		t.Fatalf("wrong result %#v", which[0])
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping gs1 with 'abnormal' reason. must be restarted on node2: ")
+	processSV.Send(gs1.pid, "abnormal")
+	waitEvent(testMessageTerminatedReason{order: 0, reason: "abnormal"})
+	gs1 = waitEvent(startedOn(0, node2)).(testMessageStarted)
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping node3. gs2 must be restarted on node2: ")
+	node3.Stop()
+	waitEvent(testMessageTerminatedReason{order: 1, reason: "kill"})
+	waitEvent(startedOn(1, node2))
+	fmt.Println("OK")
+
+	fmt.Printf("... TerminateChild gs1. remote process must be terminated with 'shutdown': ")
+	if err := sv.TerminateChild(processSV, "gs1"); err != nil {
+		t.Fatal(err)
+	}
+	// must be terminated by the time TerminateChild returns
+	if node2.ProcessByName("gs1") != nil {
+		t.Fatal("gs1 is still running")
+	}
+	waitEvent(testMessageTerminatedReason{order: 0, reason: "shutdown"})
+	fmt.Println("OK")
+
+	fmt.Printf("... RestartChild gs1. must be registered on node2 with the same name: ")
+	if _, err := sv.RestartChild(processSV, "gs1"); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(startedOn(0, node2))
+	if node2.ProcessByName("gs1") == nil {
+		t.Fatal("gs1 is not registered")
+	}
+	fmt.Println("OK")
+
+	fmt.Printf("... stopping supervisor. gs2 and gs1 must be terminated with 'shutdown': ")
+	processSV.Exit("shutdown")
+	waitEvent(testMessageTerminatedReason{order: 1, reason: "shutdown"})
+	waitEvent(testMessageTerminatedReason{order: 0, reason: "shutdown"})
+	fmt.Println("OK")
+
+	fmt.Printf("Starting supervisor with remote child and no behavior name (must fail)... ")
+	spec.Children[0].RemoteBehavior = ""
+	if _, err := node1.Spawn("testSupervisorRemote", gen.ProcessOptions{}, sv, spec); err == nil {
+		t.Fatal("expected error")
+	}
+	fmt.Println("OK")
+}
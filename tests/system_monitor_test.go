@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ergo-services/ergo"
+	"github.com/ergo-services/ergo/etf"
+	"github.com/ergo-services/ergo/gen"
+	"github.com/ergo-services/ergo/node"
+)
+
+type testSystemMonitorGS struct {
+	gen.Server
+	release chan bool
+}
+
+func (gs *testSystemMonitorGS) HandleCall(process *gen.ServerProcess, from gen.ServerFrom, message etf.Term) (etf.Term, gen.ServerStatus) {
+	time.Sleep(100 * time.Millisecond)
+	return message, gen.ServerStatusOK
+}
+
+func (gs *testSystemMonitorGS) HandleInfo(process *gen.ServerProcess, message etf.Term) gen.ServerStatus {
+	if message == "block" {
+		<-gs.release
+	}
+	return gen.ServerStatusOK
+}
+
+// waitForSystemMonitorMessage skips the messages of the other types
+func waitForSystemMonitorMessage(t *testing.T, w chan interface{}, check func(m interface{}) bool) {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-w:
+			if check(m) {
+				fmt.Println("OK")
+				return
+			}
+		case <-timeout:
+			t.Fatal("result timeout")
+		}
+	}
+}
+
+func TestSystemMonitor(t *testing.T) {
+	fmt.Printf("\n=== Test System Monitor\n")
+	fmt.Printf("Starting node: nodeSystemMonitor@localhost...")
+	node1, e := ergo.StartNode("nodeSystemMonitor@localhost", "cookies", node.Options{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	fmt.Println("OK")
+
+	monitor := &testServer{
+		res: make(chan interface{}, 10),
+	}
+	monitorProcess, e := node1.Spawn("", gen.ProcessOptions{}, monitor)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, monitor.res, nil)
+
+	caller := &testServer{
+		res: make(chan interface{}, 10),
+	}
+	callerProcess, e := node1.Spawn("", gen.ProcessOptions{}, caller)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, caller.res, nil)
+
+	slow := &testSystemMonitorGS{
+		release: make(chan bool),
+	}
+	slowProcess, e := node1.Spawn("", gen.ProcessOptions{MailboxSize: 10}, slow)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    set system monitor with unknown process: ")
+	unknown := monitorProcess.Self()
+	unknown.ID += 1000
+	if e := node1.SystemMonitor(unknown, node.SystemMonitorOptions{}); e != node.ErrProcessUnknown {
+		t.Fatal("expected", node.ErrProcessUnknown, "got", e)
+	}
+	fmt.Println("OK")
+
+	opts := node.SystemMonitorOptions{
+		LongCallback: 50 * time.Millisecond,
+		LargeMailbox: 5,
+	}
+	if e := node1.SystemMonitor(monitorProcess.Self(), opts); e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    long HandleCall callback: ")
+	call := makeCall{
+		to:      slowProcess.Self(),
+		message: "sleep",
+	}
+	if _, e := callerProcess.Direct(call); e != nil {
+		t.Fatal(e)
+	}
+	waitForSystemMonitorMessage(t, monitor.res, func(m interface{}) bool {
+		lc, ok := m.(gen.MessageSystemMonitorLongCallback)
+		return ok && lc.Pid == slowProcess.Self() && lc.Callback == "HandleCall" &&
+			lc.Duration >= opts.LongCallback
+	})
+
+	fmt.Printf("    large mailbox: ")
+	callerProcess.Send(slowProcess.Self(), "block")
+	for i := 0; i < opts.LargeMailbox+1; i++ {
+		callerProcess.Send(slowProcess.Self(), i)
+	}
+	waitForSystemMonitorMessage(t, monitor.res, func(m interface{}) bool {
+		lm, ok := m.(gen.MessageSystemMonitorLargeMailbox)
+		return ok && lm.Pid == slowProcess.Self() && lm.MailboxLength >= opts.LargeMailbox &&
+			lm.MailboxSize == 10
+	})
+
+	fmt.Printf("    long HandleInfo callback: ")
+	time.Sleep(opts.LongCallback)
+	close(slow.release)
+	waitForSystemMonitorMessage(t, monitor.res, func(m interface{}) bool {
+		lc, ok := m.(gen.MessageSystemMonitorLongCallback)
+		return ok && lc.Pid == slowProcess.Self() && lc.Callback == "HandleInfo" && lc.Message == "block"
+	})
+
+	fmt.Printf("    disable system monitor: ")
+	if e := node1.SystemMonitor(etf.Pid{}, opts); e != nil {
+		t.Fatal(e)
+	}
+	if pid, o := node1.SystemMonitorInfo(); pid != (etf.Pid{}) || o != (node.SystemMonitorOptions{}) {
+		t.Fatal("system monitor is still enabled", pid, o)
+	}
+	fmt.Println("OK")
+}
+
+func TestSystemMonitorBusyDist(t *testing.T) {
+	fmt.Printf("\n=== Test System Monitor busy dist\n")
+	carrier := testStallingCarrier{
+		PipeCarrier: node.NewPipeCarrier(),
+		stall:       new(int32),
+		release:     make(chan struct{}),
+	}
+	opts := node.Options{
+		Carrier:         carrier,
+		SendQueueLength: 10,
+	}
+	node1, e := ergo.StartNode("node1SystemMonitorBusyDist@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node1.Stop()
+	node2, e := ergo.StartNode("node2SystemMonitorBusyDist@localhost", "secret", opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node2.Stop()
+
+	monitor := &testServer{
+		res: make(chan interface{}, 10),
+	}
+	monitorProcess, e := node1.Spawn("", gen.ProcessOptions{}, monitor)
+	if e != nil {
+		t.Fatal(e)
+	}
+	waitForResultWithValue(t, monitor.res, nil)
+	monitorOptions := node.SystemMonitorOptions{
+		BusyDist:            true,
+		BusyDistQueueLength: 5,
+	}
+	if e := node1.SystemMonitor(monitorProcess.Self(), monitorOptions); e != nil {
+		t.Fatal(e)
+	}
+
+	hgs := &handshakeGenServer{}
+	p1, e := node1.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	p2, e := node2.Spawn("", gen.ProcessOptions{}, hgs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := p1.Direct(makeCall{to: p2.Self(), message: "test"}); e != nil {
+		t.Fatal(e)
+	}
+
+	fmt.Printf("    send queue of the stalled peer reaches the threshold: ")
+	atomic.StoreInt32(carrier.stall, 1)
+	// the writer takes the first message and gets stalled. the rest are queued
+	for i := 0; i < 7; i++ {
+		if e := p1.TrySend(p2.Self(), i); e != nil {
+			t.Fatal(e)
+		}
+	}
+	waitForSystemMonitorMessage(t, monitor.res, func(m interface{}) bool {
+		bd, ok := m.(gen.MessageSystemMonitorBusyDist)
+		if !ok || bd.Node != node2.Name() {
+			return false
+		}
+		if bd.SendQueueLength < 5 || bd.SendQueueLength >= bd.SendQueueSize || bd.SendQueueSize != 10 {
+			t.Fatal("wrong message", bd)
+		}
+		return true
+	})
+
+	atomic.StoreInt32(carrier.stall, 0)
+	close(carrier.release)
+}